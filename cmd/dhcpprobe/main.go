@@ -0,0 +1,87 @@
+// Command dhcpprobe plays a netboot client against a DHCP server: it sends
+// DISCOVER and REQUEST with the given client-arch and user-class options
+// and prints the offered lease as JSON. It needs to bind port 68, so it is
+// usually run as root inside a container on the network under test.
+//
+// Usage:
+//
+//	dhcpprobe [-iface eth0] [-arch 9] [-user-class iPXE]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/yebyen/home-lab-terraform/internal/dhcp"
+)
+
+// result is the JSON dhcpprobe prints
+type result struct {
+	MAC        string `json:"mac"`
+	Address    string `json:"address"`
+	ServerID   string `json:"server_id"`
+	Router     string `json:"router"`
+	DNSServer  string `json:"dns_server"`
+	NextServer string `json:"next_server"`
+	BootFile   string `json:"boot_file"`
+	Acked      bool   `json:"acked"`
+}
+
+func main() {
+	iface := flag.String("iface", "eth0", "interface whose MAC address to use")
+	mac := flag.String("mac", "", "client MAC address (default: the -iface address)")
+	arch := flag.Int("arch", -1, "client-arch (option 93): 0 BIOS, 6 EFI IA32, 7 EFI BC, 9 EFI x86-64; negative to omit")
+	userClass := flag.String("user-class", "", `user class (option 77), e.g. "iPXE"`)
+	timeout := flag.Duration("timeout", 10*time.Second, "how long to wait for each reply")
+	flag.Parse()
+
+	if err := run(*iface, *mac, *arch, *userClass, *timeout); err != nil {
+		fmt.Fprintf(os.Stderr, "dhcpprobe: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ifaceName, macFlag string, arch int, userClass string, timeout time.Duration) error {
+	var hw net.HardwareAddr
+	if macFlag != "" {
+		parsed, err := net.ParseMAC(macFlag)
+		if err != nil {
+			return err
+		}
+		hw = parsed
+	} else {
+		iface, err := net.InterfaceByName(ifaceName)
+		if err != nil {
+			return err
+		}
+		hw = iface.HardwareAddr
+	}
+
+	conn, err := dhcp.Listen()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client := &dhcp.Client{Conn: conn, Server: dhcp.BroadcastServer, Timeout: timeout}
+	lease, err := client.Exchange(dhcp.ClientOptions{MAC: hw, Arch: arch, UserClass: userClass})
+	if err != nil {
+		return err
+	}
+
+	out := result{
+		MAC:        hw.String(),
+		Address:    lease.Ack.YIAddr.String(),
+		ServerID:   lease.Ack.Addr(dhcp.OptionServerID).String(),
+		Router:     lease.Ack.Addr(dhcp.OptionRouter).String(),
+		DNSServer:  lease.Ack.Addr(dhcp.OptionDNSServers).String(),
+		NextServer: lease.Offer.SIAddr.String(),
+		BootFile:   lease.Offer.BootFile(),
+		Acked:      true,
+	}
+	return json.NewEncoder(os.Stdout).Encode(out)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/yebyen/home-lab-terraform/internal/pihole"
+)
+
+// runBlocking implements `homelab blocking [flags] status|enable|disable`
+func runBlocking(args []string) error {
+	fs := flag.NewFlagSet("blocking", flag.ExitOnError)
+	var selection instanceFlags
+	selection.register(fs)
+	timer := fs.Duration("for", 0, "revert the change after this long, e.g. 5m (default: permanent)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: homelab blocking [flags] status|enable|disable")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Example: disable blocking for 5 minutes on every Pi-hole in the test environment")
+		fmt.Fprintln(os.Stderr, "  homelab blocking -env terraform/environments/test -for 5m disable")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	action := fs.Arg(0)
+	if action != "status" && action != "enable" && action != "disable" {
+		return fmt.Errorf("unknown action %q: want status, enable or disable", action)
+	}
+	if action == "status" && *timer != 0 {
+		return fmt.Errorf("-for only applies to enable and disable")
+	}
+
+	instances, err := selection.instances()
+	if err != nil {
+		return err
+	}
+
+	// Fan out to every instance concurrently; results keep instance order
+	results := make([]*pihole.Blocking, len(instances))
+	errs := make([]error, len(instances))
+	var wg sync.WaitGroup
+	for i, instance := range instances {
+		wg.Add(1)
+		go func(i int, instance piholeInstance) {
+			defer wg.Done()
+
+			session, err := selection.session(instance)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			switch action {
+			case "status":
+				results[i], errs[i] = session.GetBlocking()
+			case "enable":
+				results[i], errs[i] = session.SetBlocking(true, *timer)
+			case "disable":
+				results[i], errs[i] = session.SetBlocking(false, *timer)
+			}
+		}(i, instance)
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, instance := range instances {
+		if errs[i] != nil {
+			failed++
+			fmt.Printf("%-20s %-30s error: %v\n", instance.Name, instance.BaseURL, errs[i])
+			continue
+		}
+		fmt.Printf("%-20s %-30s %s\n", instance.Name, instance.BaseURL, describeBlocking(results[i]))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d instances failed", failed, len(instances))
+	}
+	return nil
+}
+
+// describeBlocking renders a blocking state such as "disabled (reverts in 5m0s)"
+func describeBlocking(b *pihole.Blocking) string {
+	if remaining := b.Remaining(); remaining > 0 {
+		return fmt.Sprintf("%s (reverts in %s)", b.Status, remaining.Round(time.Second))
+	}
+	return b.Status
+}
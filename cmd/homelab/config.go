@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/yebyen/home-lab-terraform/internal/pihole"
+)
+
+// runConfig implements `homelab config [flags] get|diff`
+func runConfig(args []string) error {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	var selection instanceFlags
+	selection.register(fs)
+	container := fs.String("container", "", "Pi-hole container whose FTLCONF_* environment is compared (diff only)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: homelab config [flags] get|diff")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "  get   print the typed dns/dhcp/webserver/misc configuration as JSON")
+		fmt.Fprintln(os.Stderr, "  diff  compare the container's FTLCONF_* variables with what FTL reports")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	instances, err := selection.instances()
+	if err != nil {
+		return err
+	}
+	if len(instances) != 1 {
+		return fmt.Errorf("config works on a single instance, got %d", len(instances))
+	}
+
+	session, err := selection.session(instances[0])
+	if err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "get":
+		config, err := session.GetConfig()
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(config)
+
+	case "diff":
+		if *container == "" {
+			return fmt.Errorf("diff needs -container")
+		}
+		env, err := dockerContainerEnv(*container)
+		if err != nil {
+			return err
+		}
+		raw, err := session.GetRawConfig()
+		if err != nil {
+			return err
+		}
+
+		drifted := 0
+		for _, drift := range pihole.DiffEnvConfig(env, raw) {
+			fmt.Printf("%-10s %-28s %-32s expected=%q actual=%q\n", drift.Status, drift.Path, drift.Env, drift.Expected, drift.Actual)
+			if drift.Status == pihole.DriftMismatch || drift.Status == pihole.DriftMissing {
+				drifted++
+			}
+		}
+		if drifted > 0 {
+			return fmt.Errorf("%d settings differ from the container environment", drifted)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown action %q: want get or diff", fs.Arg(0))
+	}
+}
+
+// dockerContainerEnv returns a container's environment in KEY=value form
+func dockerContainerEnv(container string) ([]string, error) {
+	out, err := exec.Command("docker", "inspect", "--format", "{{json .Config.Env}}", container).Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker inspect %s failed: %w", container, err)
+	}
+
+	var env []string
+	if err := json.Unmarshal(out, &env); err != nil {
+		return nil, fmt.Errorf("failed to parse environment of %s: %w", container, err)
+	}
+	return env, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/yebyen/home-lab-terraform/internal/pihole"
+)
+
+// dnsmasqLeaseFile is where the dnsmasq module's container keeps its leases
+const dnsmasqLeaseFile = "/var/lib/misc/dnsmasq.leases"
+
+// runDHCP implements `homelab dhcp [flags] config|leases|reservations|report`
+func runDHCP(args []string) error {
+	fs := flag.NewFlagSet("dhcp", flag.ExitOnError)
+	var selection instanceFlags
+	selection.register(fs)
+	dnsmasqContainer := fs.String("dnsmasq-container", "", "read leases from this dnsmasq container instead of Pi-hole (e.g. dnsmasq on 13-net)")
+	clientsFile := fs.String("clients", "", "JSON file of client definitions to check instead of Pi-hole's configured clients (report only)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: homelab dhcp [flags] config|leases|reservations|report")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "  config        show Pi-hole's DHCP server settings")
+		fmt.Fprintln(os.Stderr, "  leases        list active leases")
+		fmt.Fprintln(os.Stderr, "  reservations  list static leases (dhcp.hosts)")
+		fmt.Fprintln(os.Stderr, "  report        flag clients whose leased IP drifted from their definition")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	action := fs.Arg(0)
+
+	// Leases from the dnsmasq module checked against a clients file need no
+	// Pi-hole session
+	var session *pihole.Session
+	if *dnsmasqContainer == "" || action == "config" || action == "reservations" || (action == "report" && *clientsFile == "") {
+		instances, err := selection.instances()
+		if err != nil {
+			return err
+		}
+		if len(instances) != 1 {
+			return fmt.Errorf("dhcp works on a single instance, got %d", len(instances))
+		}
+		if session, err = selection.session(instances[0]); err != nil {
+			return err
+		}
+	}
+
+	leases := func() ([]pihole.DHCPLease, error) {
+		if *dnsmasqContainer != "" {
+			return dnsmasqLeases(*dnsmasqContainer)
+		}
+		return session.GetDHCPLeases()
+	}
+
+	switch action {
+	case "config":
+		dhcp, err := session.GetDHCPConfig()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("active:     %v\n", deref(dhcp.Active))
+		fmt.Printf("range:      %s - %s\n", deref(dhcp.Start), deref(dhcp.End))
+		fmt.Printf("router:     %s\n", deref(dhcp.Router))
+		fmt.Printf("netmask:    %s\n", deref(dhcp.Netmask))
+		fmt.Printf("lease time: %s\n", deref(dhcp.LeaseTime))
+		if dhcp.Hosts != nil {
+			fmt.Printf("static:     %d reservations\n", len(*dhcp.Hosts))
+		}
+		return nil
+
+	case "leases":
+		table, err := leases()
+		if err != nil {
+			return err
+		}
+		for _, lease := range table {
+			expires := "never"
+			if !lease.ExpiresAt().IsZero() {
+				expires = lease.ExpiresAt().Format(time.RFC3339)
+			}
+			fmt.Printf("%-16s %-18s %-24s %s\n", lease.IP, lease.HWAddr, lease.Name, expires)
+		}
+		return nil
+
+	case "reservations":
+		reservations, err := session.GetDHCPReservations()
+		if err != nil {
+			return err
+		}
+		for _, r := range reservations {
+			fmt.Printf("%-16s %-18s %s\n", r.IP, r.MAC, r.Hostname)
+		}
+		return nil
+
+	case "report":
+		var clients []pihole.Client
+		if *clientsFile != "" {
+			var err error
+			if clients, err = pihole.ReadClientsFile(*clientsFile); err != nil {
+				return err
+			}
+		} else {
+			configured, err := session.GetClients()
+			if err != nil {
+				return err
+			}
+			clients = pihole.ClientsFromConfigured(configured)
+		}
+		table, err := leases()
+		if err != nil {
+			return err
+		}
+
+		problems := 0
+		for _, check := range pihole.CheckClientLeases(clients, table) {
+			detail := ""
+			switch check.Status {
+			case pihole.LeaseDrifted:
+				detail = "now leased " + check.LeaseIP
+			case pihole.LeaseConflict:
+				detail = "IP leased to " + check.LeaseMAC
+			}
+			if check.Status != pihole.LeaseOK {
+				problems++
+			}
+			fmt.Printf("%-9s %-20s %-16s %-18s %s\n", check.Status, check.Client.Name, check.Client.IP, check.Client.MAC, detail)
+		}
+		if problems > 0 {
+			return fmt.Errorf("%d clients do not hold their configured address", problems)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown action %q: want config, leases, reservations or report", action)
+	}
+}
+
+// dnsmasqLeases reads the lease file from a running dnsmasq container
+func dnsmasqLeases(container string) ([]pihole.DHCPLease, error) {
+	out, err := exec.Command("docker", "exec", container, "cat", dnsmasqLeaseFile).Output()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s from %s failed: %w", dnsmasqLeaseFile, container, err)
+	}
+	return pihole.ParseDnsmasqLeases(bytes.NewReader(out))
+}
+
+// deref returns the value behind a Config field, or its zero value if unset
+func deref[T any](v *T) T {
+	var zero T
+	if v == nil {
+		return zero
+	}
+	return *v
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yebyen/home-lab-terraform/internal/dnsbench"
+)
+
+// runDNSBench implements `homelab dnsbench [flags]`
+func runDNSBench(args []string) error {
+	fs := flag.NewFlagSet("dnsbench", flag.ExitOnError)
+	var targets stringList
+	fs.Var(&targets, "target", "DNS server to benchmark as host:port or name=host:port (repeatable; targets run one after another)")
+	qps := fs.Int("qps", 100, "queries per second to send")
+	duration := fs.Duration("duration", 30*time.Second, "how long to send queries to each target")
+	timeout := fs.Duration("timeout", 2*time.Second, "how long to wait for each reply")
+	tcp := fs.Bool("tcp", false, "query over TCP instead of UDP")
+	cached := fs.String("cached", "google.com,github.com,cloudflare.com,wikipedia.org", "comma-separated names answered from the cache after a warm-up query")
+	uncached := fs.String("uncached", "example.com", "comma-separated domains to prefix with random labels so every query is forwarded")
+	blocked := fs.String("blocked", "", "comma-separated names on the blocklist, e.g. ones added with the denylist")
+	local := fs.String("local", "pi.hole", "comma-separated local DNS record names, e.g. nas.homelab.local")
+	mix := fs.String("mix", "cached=60,uncached=20,blocked=10,local=10", "relative query shares by category")
+	seed := fs.Uint64("seed", 1, "seed for the query sequence, so runs are repeatable")
+	output := fs.String("o", "text", "output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: homelab dnsbench [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Sends queries at a fixed rate and reports latency percentiles, error and")
+		fmt.Fprintln(os.Stderr, "timeout rates per kind of name, with targets side by side.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Example: primary vs. secondary Pi-hole")
+		fmt.Fprintln(os.Stderr, "  homelab dnsbench -target primary=10.17.13.2:53 -target secondary=10.17.12.2:53 -qps 200 -blocked doubleclick.net")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("unknown output format %q: want text or json", *output)
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("no targets: use -target")
+	}
+	weights, err := parseMix(*mix)
+	if err != nil {
+		return err
+	}
+	opts := dnsbench.Options{
+		Net:      "udp",
+		QPS:      *qps,
+		Duration: *duration,
+		Timeout:  *timeout,
+		Weights:  weights,
+		Seed:     *seed,
+		Names: map[dnsbench.Category][]string{
+			dnsbench.Cached:   splitList(*cached),
+			dnsbench.Uncached: splitList(*uncached),
+			dnsbench.Blocked:  splitList(*blocked),
+			dnsbench.Local:    splitList(*local),
+		},
+	}
+	if *tcp {
+		opts.Net = "tcp"
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var reports []*dnsbench.Report
+	for _, target := range targets {
+		name, server, ok := strings.Cut(target, "=")
+		if !ok {
+			name, server = target, target
+		}
+		opts.Server = server
+		fmt.Fprintf(os.Stderr, "Benchmarking %s at %d qps for %s...\n", name, opts.QPS, opts.Duration)
+		report, err := dnsbench.Run(ctx, opts)
+		if report != nil {
+			report.Name = name
+			reports = append(reports, report)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			break
+		}
+	}
+
+	if *output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(reports)
+	}
+	return dnsbench.WriteTable(os.Stdout, reports...)
+}
+
+// parseMix reads category=weight pairs such as "cached=60,uncached=20"
+func parseMix(mix string) (map[dnsbench.Category]int, error) {
+	weights := make(map[dnsbench.Category]int)
+	for _, pair := range splitList(mix) {
+		name, value, ok := strings.Cut(pair, "=")
+		weight, err := strconv.Atoi(value)
+		if !ok || err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid -mix entry %q: want category=weight", pair)
+		}
+		category := dnsbench.Category(name)
+		if !slices.Contains(dnsbench.Categories, category) {
+			return nil, fmt.Errorf("unknown -mix category %q: want cached, uncached, blocked or local", name)
+		}
+		weights[category] = weight
+	}
+	return weights, nil
+}
+
+// splitList splits a comma-separated flag, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
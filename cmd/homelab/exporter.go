@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/yebyen/home-lab-terraform/internal/exporter"
+)
+
+// runExporter implements `homelab exporter [flags]`
+func runExporter(args []string) error {
+	fs := flag.NewFlagSet("exporter", flag.ExitOnError)
+	var selection instanceFlags
+	selection.register(fs)
+	listen := fs.String("listen", ":9617", "address to serve /metrics on")
+	top := fs.Int("top", 10, "how many of the busiest and most blocked clients to export")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout for each Pi-hole API request")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: homelab exporter [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Serves summary stats, per-client and per-group block counts, upstream")
+		fmt.Fprintln(os.Stderr, "latencies and gravity age of each Pi-hole on /metrics, scraping the API")
+		fmt.Fprintln(os.Stderr, "on every request.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Example: export every Pi-hole in the test environment")
+		fmt.Fprintln(os.Stderr, "  homelab exporter -env terraform/environments/test -listen :9617")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *top < 1 {
+		return fmt.Errorf("-top must be at least 1")
+	}
+
+	instances, err := selection.instances()
+	if err != nil {
+		return err
+	}
+	targets := make([]exporter.Target, len(instances))
+	for i, instance := range instances {
+		targets[i] = exporter.Target{Name: instance.Name, BaseURL: instance.BaseURL, Password: selection.webPassword()}
+	}
+
+	exp := exporter.New(targets)
+	exp.TopClients = *top
+	exp.Timeout = *timeout
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", exp)
+	fmt.Fprintf(os.Stderr, "Serving metrics for %d Pi-hole instance(s) on %s/metrics\n", len(targets), *listen)
+	return http.ListenAndServe(*listen, mux)
+}
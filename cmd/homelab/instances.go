@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yebyen/home-lab-terraform/internal/pihole"
+	"github.com/yebyen/home-lab-terraform/internal/tfoutput"
+)
+
+// piholeInstance is a Pi-hole web endpoint the CLI talks to
+type piholeInstance struct {
+	Name    string
+	BaseURL string
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// instanceFlags selects Pi-hole instances either explicitly with -url or
+// from the outputs of an applied environment with -env
+type instanceFlags struct {
+	env      string
+	urls     stringList
+	password string
+	tfBinary string
+}
+
+func (f *instanceFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.env, "env", "", "environment directory whose outputs declare the Pi-hole instances (e.g. terraform/environments/test)")
+	fs.Var(&f.urls, "url", "Pi-hole base URL, e.g. http://localhost:8080 (repeatable)")
+	fs.StringVar(&f.password, "password", "", "Pi-hole web password (defaults to $PIHOLE_PASSWORD)")
+	fs.StringVar(&f.tfBinary, "terraform", "tofu", "terraform-compatible binary used to read environment outputs")
+}
+
+// instances resolves the selected Pi-hole instances
+func (f *instanceFlags) instances() ([]piholeInstance, error) {
+	var instances []piholeInstance
+
+	for _, url := range f.urls {
+		instances = append(instances, piholeInstance{Name: url, BaseURL: strings.TrimSuffix(url, "/")})
+	}
+
+	if f.env != "" {
+		outputs, err := tfoutput.Read(f.tfBinary, f.env)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, piholeInstancesFromOutputs(outputs)...)
+	}
+
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no Pi-hole instances selected: use -url or -env")
+	}
+	return instances, nil
+}
+
+// webPassword is -password, or $PIHOLE_PASSWORD when it is not set
+func (f *instanceFlags) webPassword() string {
+	if f.password != "" {
+		return f.password
+	}
+	return os.Getenv("PIHOLE_PASSWORD")
+}
+
+// session authenticates against a single instance
+func (f *instanceFlags) session(instance piholeInstance) (*pihole.Session, error) {
+	session, err := pihole.NewSession(instance.BaseURL, f.webPassword())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", instance.Name, err)
+	}
+	return session, nil
+}
+
+// piholeInstancesFromOutputs finds the Pi-hole web interfaces an environment
+// exposes. The pihole module's web_endpoint output is re-exported by
+// environments as "<name>_web_interface", e.g. primary_web_interface.
+func piholeInstancesFromOutputs(outputs tfoutput.Outputs) []piholeInstance {
+	var instances []piholeInstance
+	for _, name := range outputs.Names() {
+		if !strings.HasSuffix(name, "web_interface") && !strings.HasSuffix(name, "web_endpoint") {
+			continue
+		}
+		url, ok := outputs.String(name)
+		if !ok {
+			continue
+		}
+
+		instanceName := strings.TrimSuffix(strings.TrimSuffix(name, "_web_interface"), "_web_endpoint")
+		instances = append(instances, piholeInstance{
+			Name:    instanceName,
+			BaseURL: strings.TrimSuffix(strings.TrimSuffix(url, "/"), "/admin"),
+		})
+	}
+	return instances
+}
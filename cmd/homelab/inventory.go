@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/yebyen/home-lab-terraform/internal/pihole"
+)
+
+// runInventory implements `homelab inventory [flags]`
+func runInventory(args []string) error {
+	fs := flag.NewFlagSet("inventory", flag.ExitOnError)
+	var selection instanceFlags
+	selection.register(fs)
+	clientsFile := fs.String("clients", "", "JSON file of client definitions to use instead of Pi-hole's configured clients")
+	format := fs.String("format", "table", "output format: table, json or csv")
+	bootstrap := fs.String("bootstrap", "", "write client definitions for every device to this JSON file")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: homelab inventory [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Lists devices from Pi-hole's network table, marked known or unknown")
+		fmt.Fprintln(os.Stderr, "relative to the clients configured in Pi-hole or given with -clients.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	instances, err := selection.instances()
+	if err != nil {
+		return err
+	}
+
+	var clients []pihole.Client
+	if *clientsFile != "" {
+		if clients, err = pihole.ReadClientsFile(*clientsFile); err != nil {
+			return err
+		}
+	}
+
+	// Merge the network tables, and unless -clients was given the configured
+	// clients, of every selected instance
+	var devices []pihole.NetworkDevice
+	seen := make(map[string]bool)
+	seenClients := make(map[string]bool)
+	for _, instance := range instances {
+		session, err := selection.session(instance)
+		if err != nil {
+			return err
+		}
+		if *clientsFile == "" {
+			configured, err := session.GetClients()
+			if err != nil {
+				return fmt.Errorf("%s: %w", instance.Name, err)
+			}
+			for _, client := range pihole.ClientsFromConfigured(configured) {
+				// Replicated instances configure the same clients
+				key := client.Name + "|" + client.IP + "|" + client.MAC
+				if !seenClients[key] {
+					seenClients[key] = true
+					clients = append(clients, client)
+				}
+			}
+		}
+		table, err := session.GetNetworkDevices()
+		if err != nil {
+			return fmt.Errorf("%s: %w", instance.Name, err)
+		}
+		for _, device := range table {
+			if !seen[device.HWAddr] {
+				seen[device.HWAddr] = true
+				devices = append(devices, device)
+			}
+		}
+
+		if *format == "table" {
+			gateways, err := session.GetNetworkGateway()
+			if err != nil {
+				return fmt.Errorf("%s: %w", instance.Name, err)
+			}
+			for _, gw := range gateways {
+				fmt.Printf("# %s gateway %s via %s (%s)\n", instance.Name, gw.Address, gw.Interface, gw.Family)
+			}
+		}
+	}
+
+	entries := pihole.BuildInventory(devices, clients)
+
+	if *bootstrap != "" {
+		if err := pihole.WriteClientsFile(*bootstrap, pihole.BootstrapClients(entries)); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "wrote %d client definitions to %s\n", len(entries), *bootstrap)
+	}
+
+	switch *format {
+	case "json":
+		return pihole.WriteInventoryJSON(os.Stdout, entries)
+	case "csv":
+		return pihole.WriteInventoryCSV(os.Stdout, entries)
+	case "table":
+		for _, entry := range entries {
+			status, name := "unknown", entry.Hostname
+			if entry.Client != nil {
+				status, name = "known", entry.Client.Name
+				if !entry.Seen {
+					status = "not-seen"
+				}
+			}
+			fmt.Printf("%-9s %-18s %-32v %-20s %s\n", status, entry.MAC, entry.IPs, name, entry.Vendor)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q: want table, json or csv", *format)
+	}
+}
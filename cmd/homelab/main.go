@@ -0,0 +1,85 @@
+// Command homelab bundles day-to-day operational helpers for the home lab
+// services deployed by the Terraform environments in this repository.
+//
+// Usage:
+//
+//	homelab [-v] <command> [flags] [args]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+)
+
+// command is a homelab subcommand. It receives the arguments that follow
+// the command name.
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+var commands = map[string]command{
+	"blocking":      {"show, enable or disable Pi-hole blocking across instances", runBlocking},
+	"config":        {"read FTL configuration and diff it against the container environment", runConfig},
+	"dhcp":          {"inspect DHCP settings, leases and reservations; report drifted clients", runDHCP},
+	"dnsbench":      {"load-test DNS servers and compare latency percentiles, errors and timeouts", runDNSBench},
+	"exporter":      {"serve Prometheus metrics for one or more Pi-hole instances", runExporter},
+	"inventory":     {"list devices from Pi-hole's network table as known or unknown clients", runInventory},
+	"matchbox":      {"generate matchbox profiles and groups from a machine inventory, or store them over gRPC", runMatchbox},
+	"mirrors":       {"generate Docker, containerd and Talos registry mirror configuration for the caches", runMirrors},
+	"perf":          {"record test suite timings from go test -json and flag regressions against a rolling baseline", runPerf},
+	"pxe":           {"check the netboot chain from dnsmasq through TFTP to matchbox, hop by hop", runPXE},
+	"registry":      {"inspect registry cache contents and prune repositories that are no longer pulled", runRegistry},
+	"scrape-config": {"generate Prometheus file_sd targets and scrape configs from environment outputs", runScrapeConfig},
+	"tail":          {"stream Pi-hole's query log with client, domain and status filters", runTail},
+}
+
+func main() {
+	verbose := flag.Bool("v", false, "log API requests and authentication details to stderr")
+	flag.Usage = usage
+	flag.Parse()
+
+	log.SetFlags(0)
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "homelab: unknown command %q\n\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "homelab %s: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: homelab [-v] <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", name, commands[name].summary)
+	}
+
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'homelab <command> -h' for command flags.")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/yebyen/home-lab-terraform/internal/matchbox"
+)
+
+// runMatchbox implements `homelab matchbox [flags]`
+func runMatchbox(args []string) error {
+	fs := flag.NewFlagSet("matchbox", flag.ExitOnError)
+	inventoryFile := fs.String("inventory", "", "machine inventory file listing boot profiles and machines")
+	out := fs.String("o", "", "matchbox data directory to write profiles/, groups/, generic/ and ignition/ to (default: print them)")
+	rpc := fs.String("rpc", "", "store the layout through matchbox's gRPC API at this address (e.g. 10.17.13.251:8081) instead")
+	caFile := fs.String("ca", "ca.crt", "CA certificate matchbox's gRPC server certificate is signed by")
+	certFile := fs.String("cert", "client.crt", "client certificate for the gRPC API")
+	keyFile := fs.String("key", "client.key", "client key for the gRPC API")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout for storing the layout through the gRPC API")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: homelab matchbox -inventory FILE [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Generates matchbox profiles and groups from a machine inventory.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Example: write the layout for the data volume the matchbox container mounts")
+		fmt.Fprintln(os.Stderr, "  homelab matchbox -inventory machines.yaml -o /var/lib/docker/volumes/matchbox-data/_data")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Example: store it through the gRPC API of a running matchbox")
+		fmt.Fprintln(os.Stderr, "  homelab matchbox -inventory machines.yaml -rpc 10.17.13.251:8081 -ca ca.crt -cert client.crt -key client.key")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *inventoryFile == "" {
+		return fmt.Errorf("no inventory: use -inventory")
+	}
+	inventory, err := matchbox.LoadInventory(*inventoryFile)
+	if err != nil {
+		return err
+	}
+	layout, err := matchbox.Generate(inventory)
+	if err != nil {
+		return err
+	}
+
+	if *rpc != "" {
+		tlsConfig, err := matchbox.LoadClientTLS(*caFile, *certFile, *keyFile)
+		if err != nil {
+			return err
+		}
+		client, err := matchbox.DialRPC(*rpc, tlsConfig)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		if err := client.Apply(ctx, layout); err != nil {
+			return err
+		}
+		fmt.Printf("Stored %d profiles and %d groups in matchbox at %s\n", len(layout.Profiles), len(layout.Groups), *rpc)
+		return nil
+	}
+
+	if *out != "" {
+		if err := layout.WriteTo(*out); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %d profiles and %d groups to %s\n", len(layout.Profiles), len(layout.Groups), *out)
+		return nil
+	}
+
+	files, err := layout.Files()
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Printf("# %s\n%s\n", path, files[path])
+	}
+	return nil
+}
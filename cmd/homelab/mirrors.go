@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/yebyen/home-lab-terraform/internal/filetree"
+	"github.com/yebyen/home-lab-terraform/internal/mirrors"
+	"github.com/yebyen/home-lab-terraform/internal/registry"
+	"github.com/yebyen/home-lab-terraform/internal/tfoutput"
+)
+
+// runMirrors implements `homelab mirrors [flags]`
+func runMirrors(args []string) error {
+	fs := flag.NewFlagSet("mirrors", flag.ExitOnError)
+	env := fs.String("env", "", "environment directory whose registry_caches output lists the caches (e.g. terraform/environments/registry-caches)")
+	outputsFile := fs.String("outputs", "", "read a saved `terraform output -json` document instead of running -terraform in -env")
+	tfBinary := fs.String("terraform", "tofu", "terraform-compatible binary used to read environment outputs")
+	host := fs.String("host", "", "address nodes reach the caches on, replacing localhost in the cache endpoints")
+	out := fs.String("o", "", "directory to write daemon.json, containerd/certs.d/ and talos-registries.yaml to (default: print them)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: homelab mirrors [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Generates Docker, containerd and Talos registry mirror configuration for the caches.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Example: configure nodes to pull through the caches on 10.17.13.10")
+		fmt.Fprintln(os.Stderr, "  homelab mirrors -env terraform/environments/registry-caches -host 10.17.13.10 -o mirrors/")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var outputs tfoutput.Outputs
+	var err error
+	switch {
+	case *outputsFile != "":
+		data, readErr := os.ReadFile(*outputsFile)
+		if readErr != nil {
+			return fmt.Errorf("failed to read outputs: %w", readErr)
+		}
+		outputs, err = tfoutput.Parse(data)
+	case *env != "":
+		outputs, err = tfoutput.Read(*tfBinary, *env)
+	default:
+		return fmt.Errorf("no registry caches selected: use -env or -outputs")
+	}
+	if err != nil {
+		return err
+	}
+
+	caches, err := registry.CachesFromOutputs(outputs)
+	if err != nil {
+		return err
+	}
+	mirrorList, err := mirrors.FromCaches(caches, *host)
+	if err != nil {
+		return err
+	}
+	files, err := mirrors.Files(mirrorList)
+	if err != nil {
+		return err
+	}
+
+	if *out != "" {
+		if err := filetree.Write(*out, files); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %d files for %d mirrors to %s\n", len(files), len(mirrorList), *out)
+		return nil
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Printf("# %s\n%s\n", path, files[path])
+	}
+	return nil
+}
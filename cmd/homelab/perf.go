@@ -0,0 +1,169 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yebyen/home-lab-terraform/internal/perftrack"
+)
+
+// runPerf implements `homelab perf [flags]`
+func runPerf(args []string) error {
+	fs := flag.NewFlagSet("perf", flag.ExitOnError)
+	input := fs.String("input", "-", "`go test -json` output to read, - for stdin")
+	historyFile := fs.String("history", "perf-history.json", "JSON history file the run is appended to")
+	window := fs.Int("window", 10, "number of recent runs the baseline is the median of")
+	threshold := fs.Float64("threshold", 20, "percent slower than the baseline that counts as a regression")
+	minDelta := fs.Duration("min-delta", 2*time.Second, "ignore slowdowns smaller than this")
+	goal := fs.Duration("goal", 30*time.Second, "wall clock target for the suite (0 to disable)")
+	keep := fs.Int("keep", 100, "number of runs to keep in the history")
+	top := fs.Int("top", 10, "number of slowest tests to list")
+	dryRun := fs.Bool("dry-run", false, "compare without appending the run to the history")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: homelab perf [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Records per-test durations and environment phase timings from `go test -json`")
+		fmt.Fprintln(os.Stderr, "output, compares them with a rolling baseline and fails on regressions or")
+		fmt.Fprintln(os.Stderr, "failed tests, since a pipe from go test hides its exit status.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Example: record a run of the test suite")
+		fmt.Fprintln(os.Stderr, "  go test ./tests/... -json | homelab perf -history perf-history.json")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var in io.Reader = os.Stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return fmt.Errorf("failed to open input: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	run, err := perftrack.ParseTestJSON(in)
+	if err != nil {
+		return err
+	}
+	run.Commit = gitCommit()
+
+	history, err := perftrack.Load(*historyFile)
+	if err != nil {
+		return err
+	}
+	baseline := history.Baseline(*window)
+	regressions := perftrack.Compare(run, baseline, perftrack.Thresholds{
+		Ratio:    1 + *threshold/100,
+		MinDelta: *minDelta,
+	})
+	printRun(run, baseline, *top)
+
+	if len(history.Runs) > 0 {
+		fmt.Printf("\nRegressions beyond %.0f%% and %s over the median of the last %d runs: %d\n",
+			*threshold, *minDelta, min(*window, len(history.Runs)), len(regressions))
+		for _, regression := range regressions {
+			fmt.Printf("  %-60s %10s -> %-10s %+.0f%%\n", regression.Key,
+				formatDuration(regression.Baseline), formatDuration(regression.Current), 100*(regression.Ratio()-1))
+		}
+	} else {
+		fmt.Println("\nNo history yet; this run starts the baseline.")
+	}
+
+	if !*dryRun {
+		history.Runs = append(history.Runs, run)
+		if err := history.Save(*historyFile, *keep); err != nil {
+			return err
+		}
+	}
+
+	var problems []string
+	if failed := run.FailedTests(); len(failed) > 0 {
+		problems = append(problems, fmt.Sprintf("%d tests failed: %s", len(failed), strings.Join(failed, ", ")))
+	} else if len(run.FailedPackages) > 0 {
+		problems = append(problems, "packages failed: "+strings.Join(run.FailedPackages, ", "))
+	}
+	if len(regressions) > 0 {
+		problems = append(problems, fmt.Sprintf("%d timing regressions", len(regressions)))
+	}
+	if *goal > 0 && run.Total > *goal {
+		problems = append(problems, fmt.Sprintf("suite took %s, over the %s goal", formatDuration(run.Total), *goal))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// printRun summarizes outcomes, where the time went and the slowest tests
+func printRun(run *perftrack.Run, baseline perftrack.Baseline, top int) {
+	outcomes := make(map[string]int)
+	for _, timing := range run.Tests {
+		outcomes[timing.Outcome]++
+	}
+	fmt.Printf("Run %s", run.Started.Format(time.RFC3339))
+	if run.Commit != "" {
+		fmt.Printf(" at %s", run.Commit)
+	}
+	fmt.Printf(": %s, %d passed, %d failed, %d skipped\n",
+		formatDuration(run.Total), outcomes["pass"], outcomes["fail"], outcomes["skip"])
+
+	totals := run.PhaseTotals()
+	if len(totals) > 0 {
+		fmt.Printf("\n%-12s %10s\n", "PHASE", "TOTAL")
+		for _, phase := range perftrack.Phases {
+			if d, ok := totals[phase]; ok {
+				fmt.Printf("%-12s %10s\n", phase, formatDuration(d))
+			}
+		}
+	}
+
+	// Subtests are counted in their parents
+	var names []string
+	for name, timing := range run.Tests {
+		if !strings.Contains(name, "/") && timing.Outcome != "skip" {
+			names = append(names, name)
+		}
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if c := cmp.Compare(run.Tests[b].Duration, run.Tests[a].Duration); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+	if len(names) > top {
+		names = names[:top]
+	}
+	if len(names) == 0 {
+		return
+	}
+	fmt.Printf("\n%-60s %-7s %10s %10s\n", "SLOWEST TESTS", "OUTCOME", "DURATION", "BASELINE")
+	for _, name := range names {
+		base := "-"
+		if d, ok := baseline[name]; ok {
+			base = formatDuration(d)
+		}
+		fmt.Printf("%-60s %-7s %10s %10s\n", name, run.Tests[name].Outcome, formatDuration(run.Tests[name].Duration), base)
+	}
+}
+
+// formatDuration rounds to what matters for suite timings
+func formatDuration(d time.Duration) string {
+	return d.Round(10 * time.Millisecond).String()
+}
+
+// gitCommit is the current short revision, or empty outside a git checkout
+func gitCommit() string {
+	out, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yebyen/home-lab-terraform/internal/pxe"
+	"github.com/yebyen/home-lab-terraform/internal/tfoutput"
+)
+
+// runPXE implements `homelab pxe [flags]`
+func runPXE(args []string) error {
+	fs := flag.NewFlagSet("pxe", flag.ExitOnError)
+	env := fs.String("env", "terraform/environments/metnoom-13net", "environment directory whose pxe_boot_chain output describes the chain")
+	outputsFile := fs.String("outputs", "", "read a saved `terraform output -json` document instead of running -terraform in -env")
+	tfBinary := fs.String("terraform", "tofu", "terraform-compatible binary used to read environment outputs")
+	tftpServer := fs.String("tftp", "", "TFTP server host:port to fetch boot loaders from (default: dnsmasq's static IP, port 69)")
+	matchboxURL := fs.String("matchbox", "", "matchbox base URL to fetch boot.ipxe from (default: matchbox's boot_ipxe_url)")
+	bootLoaders := fs.String("files", "", "comma-separated boot loaders to fetch (default: those the client-arch rules hand out)")
+	timeout := fs.Duration("timeout", 5*time.Second, "timeout for each TFTP packet and HTTP request")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: homelab pxe [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Checks the netboot chain from dnsmasq through TFTP to matchbox and reports each hop.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var outputs tfoutput.Outputs
+	var err error
+	if *outputsFile != "" {
+		data, readErr := os.ReadFile(*outputsFile)
+		if readErr != nil {
+			return fmt.Errorf("failed to read outputs: %w", readErr)
+		}
+		outputs, err = tfoutput.Parse(data)
+	} else {
+		outputs, err = tfoutput.Read(*tfBinary, *env)
+	}
+	if err != nil {
+		return err
+	}
+	chain, err := pxe.FromOutputs(outputs)
+	if err != nil {
+		return err
+	}
+
+	validator := &pxe.Validator{TFTPServer: *tftpServer, MatchboxURL: *matchboxURL, Timeout: *timeout}
+	if *bootLoaders != "" {
+		validator.BootLoaders = strings.Split(*bootLoaders, ",")
+	}
+	hops := validator.Validate(chain)
+
+	fmt.Printf("%-22s %-8s %-38s %s\n", "HOP", "STATUS", "TARGET", "DETAIL")
+	for _, hop := range hops {
+		fmt.Printf("%-22s %-8s %-38s %s\n", hop.Name, hop.Status, hop.Target, hop.Detail)
+	}
+	if pxe.AnyFailed(hops) {
+		return fmt.Errorf("boot chain is broken")
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/yebyen/home-lab-terraform/internal/registry"
+	"github.com/yebyen/home-lab-terraform/internal/tfoutput"
+)
+
+// registryStorageRoot is where registry:2 keeps its filesystem storage, as
+// set by REGISTRY_STORAGE_FILESYSTEM_ROOTDIRECTORY in the registry-cache module
+const registryStorageRoot = "/var/lib/registry"
+
+// runRegistry implements `homelab registry [flags] inspect|prune`
+func runRegistry(args []string) error {
+	fs := flag.NewFlagSet("registry", flag.ExitOnError)
+	env := fs.String("env", "", "environment directory whose registry_caches output lists the caches (e.g. terraform/environments/metnoom-13net)")
+	var urls stringList
+	fs.Var(&urls, "url", "registry cache base URL, e.g. http://localhost:5050 (repeatable; inspect only)")
+	tfBinary := fs.String("terraform", "tofu", "terraform-compatible binary used to read environment outputs")
+	repos := fs.Bool("repos", false, "inspect: list every repository, not just per-cache totals")
+	days := fs.Int("days", 30, "prune: remove repositories not pulled in this many days")
+	dryRun := fs.Bool("dry-run", false, "prune: list what would be removed without removing it")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: homelab registry [flags] inspect|prune")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "inspect walks each cache's catalog and tags and reports repositories and size.")
+		fmt.Fprintln(os.Stderr, "prune removes repositories with no pulls in the cache's access log (docker logs)")
+		fmt.Fprintln(os.Stderr, "for -days, then runs the registry's garbage collector in the container.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Example: see what 90 days of disuse would free on the 13-net caches")
+		fmt.Fprintln(os.Stderr, "  homelab registry -env terraform/environments/metnoom-13net -days 90 -dry-run prune")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	action := fs.Arg(0)
+	if action != "inspect" && action != "prune" {
+		return fmt.Errorf("unknown action %q: want inspect or prune", action)
+	}
+
+	var caches []registry.Cache
+	for _, url := range urls {
+		endpoint := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSuffix(url, "/"), "http://"), "https://")
+		caches = append(caches, registry.Cache{Name: endpoint, Endpoint: endpoint})
+	}
+	if *env != "" {
+		outputs, err := tfoutput.Read(*tfBinary, *env)
+		if err != nil {
+			return err
+		}
+		fromEnv, err := registry.CachesFromOutputs(outputs)
+		if err != nil {
+			return err
+		}
+		caches = append(caches, fromEnv...)
+	}
+	if len(caches) == 0 {
+		return fmt.Errorf("no registry caches selected: use -url or -env")
+	}
+
+	if action == "inspect" {
+		return inspectCaches(caches, *repos)
+	}
+	if *days <= 0 {
+		return fmt.Errorf("-days must be positive")
+	}
+	return pruneCaches(caches, time.Now().AddDate(0, 0, -*days), *dryRun)
+}
+
+func inspectCaches(caches []registry.Cache, repos bool) error {
+	failed := 0
+	fmt.Printf("%-12s %-16s %-30s %6s %6s %10s\n", "CACHE", "ENDPOINT", "UPSTREAM", "REPOS", "TAGS", "SIZE")
+	for _, cache := range caches {
+		usage, err := registry.NewClient(cache.URL()).Inspect()
+		if err != nil {
+			failed++
+			fmt.Printf("%-12s %-16s error: %v\n", cache.Name, cache.Endpoint, err)
+			continue
+		}
+		fmt.Printf("%-12s %-16s %-30s %6d %6d %10s\n", cache.Name, cache.Endpoint, cache.Upstream,
+			len(usage.Repositories), usage.Tags(), formatBytes(usage.Size()))
+		if repos {
+			for _, repository := range usage.Repositories {
+				fmt.Printf("  %-56s %6d %10s\n", repository.Repository, len(repository.Tags), formatBytes(repository.Size()))
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d caches failed", failed, len(caches))
+	}
+	return nil
+}
+
+func pruneCaches(caches []registry.Cache, cutoff time.Time, dryRun bool) error {
+	failed := 0
+	for _, cache := range caches {
+		if err := pruneCache(cache, cutoff, dryRun); err != nil {
+			failed++
+			fmt.Printf("%s (%s): error: %v\n", cache.Name, cache.Endpoint, err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d caches failed", failed, len(caches))
+	}
+	return nil
+}
+
+// pruneCache removes one cache's stale repositories. Pull-through caches
+// refuse manifest deletes, so for them the repository is removed from the
+// storage inside the container before garbage collection.
+func pruneCache(cache registry.Cache, cutoff time.Time, dryRun bool) error {
+	if cache.ContainerID == "" {
+		return fmt.Errorf("no container ID to read the access log from: use -env")
+	}
+
+	// Read the log first so it ends before Inspect's own manifest requests
+	logs, err := dockerOutput("logs", cache.ContainerID)
+	if err != nil {
+		return err
+	}
+	client := registry.NewClient(cache.URL())
+	usage, err := client.Inspect()
+	if err != nil {
+		return err
+	}
+	pulls, err := registry.ParseAccessLog(bytes.NewReader(logs))
+	if err != nil {
+		return err
+	}
+	stale, err := pulls.Stale(usage, cutoff)
+	if err != nil {
+		return err
+	}
+
+	verb := "pruning"
+	if dryRun {
+		verb = "would prune"
+	}
+	reclaimed := usage.Size() - usage.Without(stale).Size()
+	fmt.Printf("%s (%s): %s %d of %d repositories, %s\n", cache.Name, cache.Endpoint, verb,
+		len(stale), len(usage.Repositories), formatBytes(reclaimed))
+	for _, repository := range stale {
+		last := "never"
+		if at, ok := pulls.Last[repository.Repository]; ok {
+			last = at.Format("2006-01-02")
+		}
+		fmt.Printf("  %-50s last pulled %-10s %10s\n", repository.Repository, last, formatBytes(repository.Size()))
+	}
+	if dryRun || len(stale) == 0 {
+		return nil
+	}
+
+	for _, repository := range stale {
+		err := client.DeleteRepository(repository)
+		if errors.Is(err, registry.ErrDeleteUnsupported) {
+			err = removeRepositoryStorage(cache.ContainerID, repository.Repository)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to remove %s: %w", repository.Repository, err)
+		}
+	}
+
+	if _, err := dockerOutput("exec", cache.ContainerID, "registry", "garbage-collect", "/etc/docker/registry/config.yml"); err != nil {
+		return fmt.Errorf("failed to garbage collect: %w", err)
+	}
+	return nil
+}
+
+// removeRepositoryStorage deletes a repository's links from the registry's
+// storage so that garbage collection frees its blobs
+func removeRepositoryStorage(container, repository string) error {
+	if !registry.ValidRepositoryName(repository) {
+		return fmt.Errorf("refusing to remove invalid repository name %q", repository)
+	}
+	_, err := dockerOutput("exec", container, "rm", "-rf",
+		registryStorageRoot+"/docker/registry/v2/repositories/"+repository)
+	return err
+}
+
+// dockerOutput runs a docker CLI command and returns its combined output, so
+// that `docker logs` includes both the access log and the application log
+func dockerOutput(args ...string) ([]byte, error) {
+	output, err := exec.Command("docker", args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("docker %s failed: %w: %s", args[0], err, bytes.TrimSpace(output))
+	}
+	return output, nil
+}
+
+// formatBytes renders a size in binary units, e.g. 1.5 GiB
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yebyen/home-lab-terraform/internal/filetree"
+	"github.com/yebyen/home-lab-terraform/internal/scrape"
+	"github.com/yebyen/home-lab-terraform/internal/tfoutput"
+)
+
+// runScrapeConfig implements `homelab scrape-config [flags]`
+func runScrapeConfig(args []string) error {
+	fs := flag.NewFlagSet("scrape-config", flag.ExitOnError)
+	var envs, outputsFiles stringList
+	fs.Var(&envs, "env", "environment directory whose prometheus_targets output lists scrape targets (repeatable)")
+	fs.Var(&outputsFiles, "outputs", "read a saved `terraform output -json` document, named after the file, instead of an -env (repeatable)")
+	tfBinary := fs.String("terraform", "tofu", "terraform-compatible binary used to read environment outputs")
+	host := fs.String("host", "", "address Prometheus reaches the Docker host on, replacing localhost in the targets")
+	blackbox := fs.String("blackbox", "localhost:9115", "blackbox exporter host:port that probes services without metrics, like matchbox")
+	sdDir := fs.String("sd-dir", "file_sd", "directory Prometheus reads the file_sd target files from")
+	out := fs.String("o", "", "directory to write scrape-configs.yml and file_sd/ to (default: print them)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: homelab scrape-config [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Generates Prometheus file_sd target files and a scrape config, for")
+		fmt.Fprintln(os.Stderr, "scrape_config_files, from the environments' prometheus_targets outputs.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Example: scrape the 13-net services and the registry caches on 10.17.13.10")
+		fmt.Fprintln(os.Stderr, "  homelab scrape-config -env terraform/environments/metnoom-13net \\")
+		fmt.Fprintln(os.Stderr, "    -env terraform/environments/registry-caches -host 10.17.13.10 \\")
+		fmt.Fprintln(os.Stderr, "    -sd-dir /etc/prometheus/file_sd -o prometheus/")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if len(envs) == 0 && len(outputsFiles) == 0 {
+		return fmt.Errorf("no environments selected: use -env or -outputs")
+	}
+
+	var targets []scrape.Target
+	add := func(env string, outputs tfoutput.Outputs) error {
+		found, err := scrape.FromOutputs(env, outputs)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			fmt.Fprintf(os.Stderr, "%s declares no prometheus_targets\n", env)
+		}
+		targets = append(targets, found...)
+		return nil
+	}
+	for _, dir := range envs {
+		outputs, err := tfoutput.Read(*tfBinary, dir)
+		if err != nil {
+			return err
+		}
+		if err := add(filepath.Base(filepath.Clean(dir)), outputs); err != nil {
+			return err
+		}
+	}
+	for _, file := range outputsFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read outputs: %w", err)
+		}
+		outputs, err := tfoutput.Parse(data)
+		if err != nil {
+			return err
+		}
+		if err := add(strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)), outputs); err != nil {
+			return err
+		}
+	}
+
+	targets, err := scrape.Localize(targets, *host)
+	if err != nil {
+		return err
+	}
+	files, err := scrape.Files(targets, scrape.Options{SDDir: *sdDir, Blackbox: *blackbox})
+	if err != nil {
+		return err
+	}
+
+	if *out != "" {
+		if err := filetree.Write(*out, files); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %d files for %d targets to %s\n", len(files), len(targets), *out)
+		return nil
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Printf("# %s\n%s\n", path, files[path])
+	}
+	return nil
+}
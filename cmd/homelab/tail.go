@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/yebyen/home-lab-terraform/internal/pihole"
+)
+
+// runTail implements `homelab tail [flags]`
+func runTail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	var selection instanceFlags
+	selection.register(fs)
+	client := fs.String("client", "", "only show queries from this client IP (or name substring)")
+	domain := fs.String("domain", "", "only show domains matching this regular expression")
+	status := fs.String("status", "", "comma-separated FTL statuses to show, e.g. GRAVITY,REGEX or blocked")
+	output := fs.String("o", "text", "output format: text or ndjson")
+	interval := fs.Duration("interval", 2*time.Second, "poll interval")
+	since := fs.Duration("since", 0, "also show queries from this far back, e.g. 10m")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: homelab tail [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Streams new queries from Pi-hole's query log until interrupted.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Example: why is the work laptop being blocked?")
+		fmt.Fprintln(os.Stderr, "  homelab tail -url http://localhost:8080 -client 10.17.12.100 -status blocked -o ndjson | jq .domain")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *output != "text" && *output != "ndjson" {
+		return fmt.Errorf("unknown output format %q: want text or ndjson", *output)
+	}
+
+	filter := pihole.QueryFilter{Client: *client}
+	if *domain != "" {
+		re, err := regexp.Compile(*domain)
+		if err != nil {
+			return fmt.Errorf("invalid -domain: %w", err)
+		}
+		filter.Domain = re
+	}
+	if *status != "" {
+		filter.Statuses = strings.Split(*status, ",")
+	}
+
+	instances, err := selection.instances()
+	if err != nil {
+		return err
+	}
+	if len(instances) != 1 {
+		return fmt.Errorf("tail follows a single instance, got %d", len(instances))
+	}
+	session, err := selection.session(instances[0])
+	if err != nil {
+		return err
+	}
+
+	tail := &pihole.QueryTail{Session: session, Filter: filter}
+	if *since > 0 {
+		tail.Since = time.Now().Add(-*since)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	encoder := json.NewEncoder(os.Stdout)
+	return tail.Follow(ctx, *interval, func(q pihole.Query) error {
+		if *output == "ndjson" {
+			return encoder.Encode(q)
+		}
+		_, err := fmt.Println(formatQuery(q))
+		return err
+	})
+}
+
+// formatQuery renders a query as a single human-readable line
+func formatQuery(q pihole.Query) string {
+	client := q.Client.IP
+	if q.Client.Name != "" {
+		client += " (" + q.Client.Name + ")"
+	}
+
+	line := fmt.Sprintf("%s  %-32s %-6s %-40s %s",
+		q.Timestamp().Format("15:04:05.000"), client, q.Type, q.Domain, q.Status)
+
+	if q.Reply.Type != "" {
+		line += fmt.Sprintf("  %s %.1fms", q.Reply.Type, q.Reply.Time*1000)
+	}
+	if q.Upstream != nil && *q.Upstream != "" {
+		line += "  via " + *q.Upstream
+	}
+	return line
+}
@@ -0,0 +1,152 @@
+package dhcp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// ClientOptions describe the netboot client being simulated
+type ClientOptions struct {
+	MAC net.HardwareAddr
+	// Arch is sent as option 93 (0 BIOS, 6 EFI IA32, 7 EFI BC, 9 EFI x86-64);
+	// negative values leave the option out
+	Arch int
+	// UserClass is sent verbatim as option 77, the way iPXE sends "iPXE"
+	UserClass string
+}
+
+// vendorClass is what PXE firmware sends as option 60
+func (o ClientOptions) vendorClass() string {
+	return fmt.Sprintf("PXEClient:Arch:%05d:UNDI:002001", o.Arch)
+}
+
+// Lease is the outcome of a DISCOVER/OFFER/REQUEST/ACK exchange
+type Lease struct {
+	Offer *Packet
+	Ack   *Packet
+}
+
+// Client exchanges packets with a DHCP server over Conn. Server is usually
+// the broadcast address 255.255.255.255:67 and Conn bound to port 68.
+type Client struct {
+	Conn    net.PacketConn
+	Server  net.Addr
+	Timeout time.Duration
+}
+
+// Listen binds the DHCP client port on all interfaces
+func Listen() (net.PacketConn, error) {
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:68")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on the DHCP client port: %w", err)
+	}
+	return conn, nil
+}
+
+// BroadcastServer is where a client without an address sends requests
+var BroadcastServer = &net.UDPAddr{IP: net.IPv4bcast, Port: 67}
+
+// Exchange runs a full DISCOVER/OFFER/REQUEST/ACK exchange
+func (c *Client) Exchange(opts ClientOptions) (*Lease, error) {
+	xid, err := newXID()
+	if err != nil {
+		return nil, err
+	}
+
+	discover := newPacket(xid, Discover, opts)
+	offer, err := c.roundTrip(discover, Offer)
+	if err != nil {
+		return nil, fmt.Errorf("DISCOVER: %w", err)
+	}
+
+	request := newPacket(xid, Request, opts)
+	request.Options[OptionRequestedIP] = addrBytes(offer.YIAddr)
+	request.Options[OptionServerID] = offer.Options[OptionServerID]
+	ack, err := c.roundTrip(request, Ack)
+	if err != nil {
+		return &Lease{Offer: offer}, fmt.Errorf("REQUEST: %w", err)
+	}
+	return &Lease{Offer: offer, Ack: ack}, nil
+}
+
+// roundTrip sends packet and waits for a reply of the wanted type with the
+// same transaction ID, failing early on a NAK
+func (c *Client) roundTrip(packet *Packet, want byte) (*Packet, error) {
+	if _, err := c.Conn.WriteTo(packet.Marshal(), c.Server); err != nil {
+		return nil, fmt.Errorf("failed to send: %w", err)
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	if err := c.Conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := c.Conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil, fmt.Errorf("no reply within %s", timeout)
+			}
+			return nil, err
+		}
+		reply, err := Parse(buf[:n])
+		if err != nil || reply.Op != bootReply || reply.XID != packet.XID {
+			continue
+		}
+		switch reply.MessageType() {
+		case want:
+			return reply, nil
+		case Nak:
+			return nil, fmt.Errorf("server sent NAK: %s", reply.Options[56])
+		}
+	}
+}
+
+func newPacket(xid uint32, messageType byte, opts ClientOptions) *Packet {
+	p := &Packet{
+		Op:     bootRequest,
+		XID:    xid,
+		Flags:  flagBroadcast,
+		CHAddr: opts.MAC,
+		Options: map[byte][]byte{
+			OptionMessageType: {messageType},
+			OptionParameterList: {
+				OptionSubnetMask, OptionRouter, OptionDNSServers,
+				OptionTFTPServerName, OptionBootFileName,
+			},
+		},
+	}
+	if opts.Arch >= 0 {
+		arch := make([]byte, 2)
+		binary.BigEndian.PutUint16(arch, uint16(opts.Arch))
+		p.Options[OptionClientArch] = arch
+		p.Options[OptionVendorClass] = []byte(opts.vendorClass())
+	}
+	if opts.UserClass != "" {
+		p.Options[OptionUserClass] = []byte(opts.UserClass)
+	}
+	return p
+}
+
+func newXID() (uint32, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, fmt.Errorf("failed to generate transaction ID: %w", err)
+	}
+	return binary.BigEndian.Uint32(b[:]), nil
+}
+
+func addrBytes(addr netip.Addr) []byte {
+	a := addr.As4()
+	return a[:]
+}
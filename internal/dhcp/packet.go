@@ -0,0 +1,220 @@
+// Package dhcp is a minimal DHCPv4 client, just enough to act as a netboot
+// client against the dnsmasq module: DISCOVER/OFFER/REQUEST/ACK with the
+// client-arch and user-class options PXE firmware and iPXE send.
+package dhcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+)
+
+// Message types (option 53)
+const (
+	Discover byte = 1
+	Offer    byte = 2
+	Request  byte = 3
+	Decline  byte = 4
+	Ack      byte = 5
+	Nak      byte = 6
+	Release  byte = 7
+)
+
+// Option codes used by the client
+const (
+	OptionSubnetMask     byte = 1
+	OptionRouter         byte = 3
+	OptionDNSServers     byte = 6
+	OptionRequestedIP    byte = 50
+	OptionLeaseTime      byte = 51
+	OptionOverload       byte = 52
+	OptionMessageType    byte = 53
+	OptionServerID       byte = 54
+	OptionParameterList  byte = 55
+	OptionVendorClass    byte = 60
+	OptionTFTPServerName byte = 66
+	OptionBootFileName   byte = 67
+	OptionUserClass      byte = 77
+	OptionClientArch     byte = 93
+	OptionEnd            byte = 255
+	OptionPad            byte = 0
+)
+
+const (
+	bootRequest = 1
+	bootReply   = 2
+	// flagBroadcast asks the server to broadcast replies, since the client
+	// has no address to receive unicast on yet
+	flagBroadcast = 0x8000
+	headerLen     = 236
+)
+
+var magicCookie = []byte{99, 130, 83, 99}
+
+// Packet is a DHCPv4 message
+type Packet struct {
+	Op      byte
+	XID     uint32
+	Flags   uint16
+	CIAddr  netip.Addr
+	YIAddr  netip.Addr
+	SIAddr  netip.Addr
+	GIAddr  netip.Addr
+	CHAddr  net.HardwareAddr
+	SName   string
+	File    string
+	Options map[byte][]byte
+}
+
+// MessageType returns option 53, or 0 when it is missing
+func (p *Packet) MessageType() byte {
+	if value := p.Options[OptionMessageType]; len(value) == 1 {
+		return value[0]
+	}
+	return 0
+}
+
+// Addr returns the first address in an address option such as the router
+func (p *Packet) Addr(option byte) netip.Addr {
+	value := p.Options[option]
+	if len(value) < 4 {
+		return netip.Addr{}
+	}
+	return netip.AddrFrom4([4]byte(value[:4]))
+}
+
+// BootFile is the boot file name from option 67, falling back to the
+// header's file field
+func (p *Packet) BootFile() string {
+	if value, ok := p.Options[OptionBootFileName]; ok {
+		return string(bytes.TrimRight(value, "\x00"))
+	}
+	return p.File
+}
+
+// Marshal encodes the packet. Options are written in code order.
+func (p *Packet) Marshal() []byte {
+	buf := make([]byte, headerLen, 300)
+	buf[0] = p.Op
+	buf[1] = 1 // Ethernet
+	buf[2] = 6
+	binary.BigEndian.PutUint32(buf[4:], p.XID)
+	binary.BigEndian.PutUint16(buf[10:], p.Flags)
+	putAddr(buf[12:], p.CIAddr)
+	putAddr(buf[16:], p.YIAddr)
+	putAddr(buf[20:], p.SIAddr)
+	putAddr(buf[24:], p.GIAddr)
+	copy(buf[28:44], p.CHAddr)
+	copy(buf[44:108], p.SName)
+	copy(buf[108:236], p.File)
+
+	buf = append(buf, magicCookie...)
+	codes := make([]int, 0, len(p.Options))
+	for code := range p.Options {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		value := p.Options[byte(code)]
+		// Options longer than 255 bytes are split, per RFC 3396
+		for len(value) > 255 {
+			buf = append(buf, byte(code), 255)
+			buf = append(buf, value[:255]...)
+			value = value[255:]
+		}
+		buf = append(buf, byte(code), byte(len(value)))
+		buf = append(buf, value...)
+	}
+	buf = append(buf, OptionEnd)
+
+	// Some servers ignore packets shorter than a BOOTP packet
+	for len(buf) < 300 {
+		buf = append(buf, OptionPad)
+	}
+	return buf
+}
+
+// Parse decodes a packet, honouring option overload of the file and sname
+// fields
+func Parse(data []byte) (*Packet, error) {
+	if len(data) < headerLen+len(magicCookie) {
+		return nil, fmt.Errorf("packet too short: %d bytes", len(data))
+	}
+	if !bytes.Equal(data[headerLen:headerLen+4], magicCookie) {
+		return nil, errors.New("missing DHCP magic cookie")
+	}
+
+	p := &Packet{
+		Op:      data[0],
+		XID:     binary.BigEndian.Uint32(data[4:]),
+		Flags:   binary.BigEndian.Uint16(data[10:]),
+		CIAddr:  netip.AddrFrom4([4]byte(data[12:16])),
+		YIAddr:  netip.AddrFrom4([4]byte(data[16:20])),
+		SIAddr:  netip.AddrFrom4([4]byte(data[20:24])),
+		GIAddr:  netip.AddrFrom4([4]byte(data[24:28])),
+		CHAddr:  net.HardwareAddr(append([]byte(nil), data[28:28+min(int(data[2]), 16)]...)),
+		Options: make(map[byte][]byte),
+	}
+	if err := parseOptions(data[headerLen+4:], p.Options); err != nil {
+		return nil, err
+	}
+
+	overload := byte(0)
+	if value := p.Options[OptionOverload]; len(value) == 1 {
+		overload = value[0]
+	}
+	if overload&1 != 0 {
+		if err := parseOptions(data[108:236], p.Options); err != nil {
+			return nil, fmt.Errorf("overloaded file field: %w", err)
+		}
+	} else {
+		p.File = cString(data[108:236])
+	}
+	if overload&2 != 0 {
+		if err := parseOptions(data[44:108], p.Options); err != nil {
+			return nil, fmt.Errorf("overloaded sname field: %w", err)
+		}
+	} else {
+		p.SName = cString(data[44:108])
+	}
+	return p, nil
+}
+
+// parseOptions reads options until End, concatenating repeated codes
+func parseOptions(data []byte, options map[byte][]byte) error {
+	for i := 0; i < len(data); {
+		code := data[i]
+		if code == OptionEnd {
+			return nil
+		}
+		if code == OptionPad {
+			i++
+			continue
+		}
+		if i+1 >= len(data) || i+2+int(data[i+1]) > len(data) {
+			return fmt.Errorf("option %d is truncated", code)
+		}
+		length := int(data[i+1])
+		options[code] = append(options[code], data[i+2:i+2+length]...)
+		i += 2 + length
+	}
+	return nil
+}
+
+func putAddr(dst []byte, addr netip.Addr) {
+	if addr.Is4() {
+		a := addr.As4()
+		copy(dst, a[:])
+	}
+}
+
+func cString(data []byte) string {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return string(data)
+}
@@ -0,0 +1,275 @@
+// Package dnsbench load-tests DNS servers. It sends queries at a fixed rate
+// from a weighted mix of cached, uncached, blocked and local names and
+// reports latency percentiles, error and timeout rates per category.
+package dnsbench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Category is a kind of name, each exercising a different path in Pi-hole
+type Category string
+
+const (
+	// Cached names are asked for repeatedly, so FTL answers from its cache
+	Cached Category = "cached"
+	// Uncached names get a random label each time, so FTL forwards them
+	Uncached Category = "uncached"
+	// Blocked names are on the blocklist and answered by FTL itself
+	Blocked Category = "blocked"
+	// Local names are local DNS records, e.g. from pihole-config
+	Local Category = "local"
+)
+
+// Categories are the categories in report order
+var Categories = []Category{Cached, Uncached, Blocked, Local}
+
+// DefaultWeights resemble a home network: mostly cache hits
+var DefaultWeights = map[Category]int{Cached: 60, Uncached: 20, Blocked: 10, Local: 10}
+
+// Options configure a benchmark run
+type Options struct {
+	// Server is the host:port under test
+	Server string
+	// Net is "udp" (the default) or "tcp"; TCP opens a connection per query
+	Net      string
+	QPS      int
+	Duration time.Duration
+	Timeout  time.Duration
+	// Names are the names to ask for by category. Uncached names are base
+	// domains that get a random label prepended.
+	Names map[Category][]string
+	// Weights are relative query shares by category, DefaultWeights if nil.
+	// Categories without names are left out.
+	Weights map[Category]int
+	// Seed makes the query sequence repeatable
+	Seed uint64
+}
+
+// Report is the outcome of a run
+type Report struct {
+	Name     string        `json:"name"`
+	Server   string        `json:"server"`
+	Net      string        `json:"net"`
+	QPS      int           `json:"qps"`
+	Duration time.Duration `json:"duration_ns"`
+	// Elapsed includes waiting for the last queries to finish
+	Elapsed    time.Duration       `json:"elapsed_ns"`
+	Total      *Stats              `json:"total"`
+	Categories map[Category]*Stats `json:"categories"`
+}
+
+// AchievedQPS is the rate queries were actually sent at
+func (r *Report) AchievedQPS() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Total.Queries) / r.Duration.Seconds()
+}
+
+// Stats summarize the queries of a category or a whole run
+type Stats struct {
+	Queries int `json:"queries"`
+	// Replies are the queries answered in time; latencies are theirs
+	Replies int `json:"replies"`
+	// Errors are failed exchanges and SERVFAIL, REFUSED, FORMERR or NOTIMP replies
+	Errors   int            `json:"errors"`
+	Timeouts int            `json:"timeouts"`
+	Rcodes   map[string]int `json:"rcodes"`
+	P50      time.Duration  `json:"p50_ns"`
+	P95      time.Duration  `json:"p95_ns"`
+	P99      time.Duration  `json:"p99_ns"`
+	Max      time.Duration  `json:"max_ns"`
+
+	latencies []time.Duration
+}
+
+// ErrorRate is the share of queries that failed, timeouts excluded
+func (s *Stats) ErrorRate() float64 {
+	return rate(s.Errors, s.Queries)
+}
+
+// TimeoutRate is the share of queries that got no reply in time
+func (s *Stats) TimeoutRate() float64 {
+	return rate(s.Timeouts, s.Queries)
+}
+
+func rate(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// record adds one query's outcome; rtt only counts when there was a reply
+func (s *Stats) record(reply *dns.Msg, rtt time.Duration, err error) {
+	s.Queries++
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		s.Timeouts++
+		return
+	case err != nil:
+		s.Errors++
+		return
+	}
+
+	s.Replies++
+	s.latencies = append(s.latencies, rtt)
+	s.Rcodes[dns.RcodeToString[reply.Rcode]]++
+	switch reply.Rcode {
+	case dns.RcodeServerFailure, dns.RcodeRefused, dns.RcodeFormatError, dns.RcodeNotImplemented:
+		s.Errors++
+	}
+}
+
+// finish computes the percentiles
+func (s *Stats) finish() {
+	slices.Sort(s.latencies)
+	s.P50 = Percentile(s.latencies, 50)
+	s.P95 = Percentile(s.latencies, 95)
+	s.P99 = Percentile(s.latencies, 99)
+	s.Max = Percentile(s.latencies, 100)
+}
+
+// Percentile is the nearest-rank percentile p (0-100] of sorted latencies
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	rank = min(max(rank, 1), len(sorted))
+	return sorted[rank-1]
+}
+
+func newStats() *Stats {
+	return &Stats{Rcodes: make(map[string]int)}
+}
+
+// Run benchmarks one server. Cached names are asked once before the clock
+// starts so they are in the cache. Queries are sent on schedule whether or
+// not earlier ones have been answered, so a slow server shows up as
+// latency and timeouts rather than a lower rate.
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	if opts.Server == "" {
+		return nil, fmt.Errorf("no server to benchmark")
+	}
+	if opts.QPS <= 0 || opts.Duration <= 0 {
+		return nil, fmt.Errorf("QPS and duration must be positive")
+	}
+	if opts.Net == "" {
+		opts.Net = "udp"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	pick, err := picker(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &dns.Client{Net: opts.Net, Timeout: opts.Timeout}
+	for _, name := range opts.Names[Cached] {
+		client.ExchangeContext(ctx, query(name), opts.Server)
+	}
+
+	report := &Report{
+		Server:     opts.Server,
+		Net:        opts.Net,
+		QPS:        opts.QPS,
+		Duration:   opts.Duration,
+		Total:      newStats(),
+		Categories: make(map[Category]*Stats),
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	send := func(category Category, name string) {
+		defer wg.Done()
+		reply, rtt, err := client.ExchangeContext(ctx, query(name), opts.Server)
+		mu.Lock()
+		defer mu.Unlock()
+		if report.Categories[category] == nil {
+			report.Categories[category] = newStats()
+		}
+		report.Categories[category].record(reply, rtt, err)
+		report.Total.record(reply, rtt, err)
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(time.Second / time.Duration(opts.QPS))
+	defer ticker.Stop()
+	stop := time.NewTimer(opts.Duration)
+	defer stop.Stop()
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-stop.C:
+			break loop
+		case <-ticker.C:
+			category, name := pick()
+			wg.Add(1)
+			go send(category, name)
+		}
+	}
+	wg.Wait()
+	report.Elapsed = time.Since(start)
+
+	report.Total.finish()
+	for _, stats := range report.Categories {
+		stats.finish()
+	}
+	return report, ctx.Err()
+}
+
+// picker returns a function choosing the next query's category and name
+func picker(opts Options) (func() (Category, string), error) {
+	weights := opts.Weights
+	if weights == nil {
+		weights = DefaultWeights
+	}
+	var categories []Category
+	var cumulative []int
+	total := 0
+	for _, category := range Categories {
+		if weights[category] <= 0 || len(opts.Names[category]) == 0 {
+			continue
+		}
+		total += weights[category]
+		categories = append(categories, category)
+		cumulative = append(cumulative, total)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("no names to query: give names for at least one weighted category")
+	}
+
+	random := rand.New(rand.NewPCG(opts.Seed, opts.Seed))
+	return func() (Category, string) {
+		n := random.IntN(total)
+		i, _ := slices.BinarySearch(cumulative, n+1)
+		category := categories[i]
+		names := opts.Names[category]
+		name := names[random.IntN(len(names))]
+		if category == Uncached {
+			name = fmt.Sprintf("%08x.%s", random.Uint32(), name)
+		}
+		return category, name
+	}, nil
+}
+
+func query(name string) *dns.Msg {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), dns.TypeA)
+	return msg
+}
@@ -0,0 +1,127 @@
+package dnsbench
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// WriteTable prints reports side by side, one column per target, with a
+// row per category and metric. With exactly two reports a last column
+// shows how the second differs from the first.
+func WriteTable(w io.Writer, reports ...*Report) error {
+	header := []string{"CATEGORY", "METRIC"}
+	for _, report := range reports {
+		header = append(header, strings.ToUpper(report.Name))
+	}
+	compare := len(reports) == 2
+	if compare {
+		header = append(header, "CHANGE")
+	}
+	rows := [][]string{header}
+
+	row := func(category, metric string, value func(*Report) string, change func(a, b *Report) string) {
+		cells := []string{category, metric}
+		for _, report := range reports {
+			cells = append(cells, value(report))
+		}
+		if compare {
+			cells = append(cells, change(reports[0], reports[1]))
+		}
+		rows = append(rows, cells)
+	}
+	none := func(a, b *Report) string { return "" }
+	row("", "server", func(r *Report) string { return r.Server + "/" + r.Net }, none)
+	row("", "qps", func(r *Report) string { return fmt.Sprintf("%.1f", r.AchievedQPS()) }, none)
+
+	for _, category := range append([]Category{"total"}, Categories...) {
+		stats := func(r *Report) *Stats {
+			if category == "total" {
+				return r.Total
+			}
+			return r.Categories[category]
+		}
+		if !anyQueries(reports, stats) {
+			continue
+		}
+		metric := func(name string, value func(*Stats) string, number func(*Stats) float64) {
+			row(string(category), name, func(r *Report) string {
+				if s := stats(r); s != nil && s.Queries > 0 {
+					return value(s)
+				}
+				return "-"
+			}, func(a, b *Report) string {
+				sa, sb := stats(a), stats(b)
+				if number == nil || sa == nil || sb == nil || sa.Queries == 0 || sb.Queries == 0 {
+					return ""
+				}
+				return change(number(sa), number(sb))
+			})
+		}
+		latency := func(name string, d func(*Stats) time.Duration) {
+			metric(name, func(s *Stats) string {
+				if s.Replies == 0 {
+					return "-"
+				}
+				return formatLatency(d(s))
+			}, func(s *Stats) float64 {
+				if s.Replies == 0 {
+					return math.NaN()
+				}
+				return float64(d(s))
+			})
+		}
+		metric("queries", func(s *Stats) string { return fmt.Sprint(s.Queries) }, nil)
+		latency("p50", func(s *Stats) time.Duration { return s.P50 })
+		latency("p95", func(s *Stats) time.Duration { return s.P95 })
+		latency("p99", func(s *Stats) time.Duration { return s.P99 })
+		latency("max", func(s *Stats) time.Duration { return s.Max })
+		metric("errors", func(s *Stats) string { return formatRate(s.ErrorRate()) }, nil)
+		metric("timeouts", func(s *Stats) string { return formatRate(s.TimeoutRate()) }, nil)
+	}
+
+	widths := make([]int, len(header))
+	for _, cells := range rows {
+		for i, cell := range cells {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+	for _, cells := range rows {
+		var line strings.Builder
+		for i, cell := range cells {
+			fmt.Fprintf(&line, "%-*s  ", widths[i], cell)
+		}
+		if _, err := fmt.Fprintln(w, strings.TrimRight(line.String(), " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func anyQueries(reports []*Report, stats func(*Report) *Stats) bool {
+	for _, report := range reports {
+		if s := stats(report); s != nil && s.Queries > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// formatLatency rounds to 10µs, enough to tell a cache hit from a forward
+func formatLatency(d time.Duration) string {
+	return d.Round(10 * time.Microsecond).String()
+}
+
+func formatRate(r float64) string {
+	return fmt.Sprintf("%.2f%%", 100*r)
+}
+
+// change is the relative difference from a to b, e.g. "+12.5%"
+func change(a, b float64) string {
+	if a == 0 || math.IsNaN(a) || math.IsNaN(b) {
+		return ""
+	}
+	return fmt.Sprintf("%+.1f%%", 100*(b-a)/a)
+}
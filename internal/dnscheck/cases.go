@@ -0,0 +1,138 @@
+package dnscheck
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+// Profile is what the server under test should know. Empty fields skip
+// the cases that need them.
+type Profile struct {
+	// Records are local A records, name to IPv4 address, e.g. from
+	// pihole-config's pihole_dns_record resources
+	Records map[string]string
+	// CNAMEs are local aliases, name to target
+	CNAMEs map[string]string
+	// External is an upstream domain with A, AAAA, TXT and MX records
+	External string
+	// SRV is an upstream SRV name, e.g. _imaps._tcp.gmail.com
+	SRV string
+	// Large is a name whose TXT records do not fit in 512 bytes
+	Large string
+	// Missing is a name in an existing zone that does not exist
+	Missing string
+	// Blocked is a domain on the server's blocklist
+	Blocked string
+	// BlockingMode is FTL's dns.blocking.mode for Blocked: NULL, NX or NODATA
+	BlockingMode string
+}
+
+// EDNSSizes are the EDNS0 buffer sizes the suite advertises: the classic
+// minimum, the DNS Flag Day 2020 default and the common maximum
+var EDNSSizes = []uint16{512, 1232, 4096}
+
+// Cases builds the conformance table for a profile
+func Cases(p Profile) ([]Case, error) {
+	var cases []Case
+	both := func(name, question string, qtype uint16, expect Expect) {
+		for _, network := range []string{"udp", "tcp"} {
+			cases = append(cases, Case{
+				Name:     fmt.Sprintf("%s_%s_%s", dns.TypeToString[qtype], name, network),
+				Question: question,
+				Type:     qtype,
+				Net:      network,
+				Expect:   expect,
+			})
+		}
+	}
+
+	if p.External != "" {
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeTXT, dns.TypeMX} {
+			both("External", p.External, qtype, Expect{AnswerType: qtype})
+			if qtype == dns.TypeTXT {
+				// TXT sets like google.com's outgrow 512 bytes; resolvers retry over TCP
+				cases[len(cases)-2].Fallback = true
+			}
+		}
+		for _, size := range EDNSSizes {
+			cases = append(cases, Case{
+				Name:     fmt.Sprintf("EDNS0_%d", size),
+				Question: p.External,
+				Type:     dns.TypeA,
+				Net:      "udp",
+				UDPSize:  size,
+				Expect:   Expect{AnswerType: dns.TypeA, EDNS: true},
+			})
+		}
+	}
+	if p.SRV != "" {
+		both("External", p.SRV, dns.TypeSRV, Expect{AnswerType: dns.TypeSRV})
+	}
+	if p.Large != "" {
+		cases = append(cases, Case{
+			Name:     "Truncation_Fallback",
+			Question: p.Large,
+			Type:     dns.TypeTXT,
+			Net:      "udp",
+			Fallback: true,
+			Expect:   Expect{AnswerType: dns.TypeTXT},
+		})
+	}
+	if p.Missing != "" {
+		both("NXDOMAIN", p.Missing, dns.TypeA, Expect{Rcode: dns.RcodeNameError})
+	}
+
+	// Reverse lookups are only unambiguous for addresses with one name
+	names := make(map[string][]string)
+	for _, name := range slices.Sorted(maps.Keys(p.Records)) {
+		ip := p.Records[name]
+		names[ip] = append(names[ip], name)
+		both("Local_"+name, name, dns.TypeA, Expect{Answers: []string{ip}})
+		both("NODATA_"+name, name, dns.TypeAAAA, Expect{NoData: true})
+	}
+	for _, ip := range slices.Sorted(maps.Keys(names)) {
+		if len(names[ip]) != 1 {
+			continue
+		}
+		reverse, err := ReverseName(ip)
+		if err != nil {
+			return nil, fmt.Errorf("local record %s: %w", names[ip][0], err)
+		}
+		both("Local_"+ip, reverse, dns.TypePTR, Expect{Answers: []string{dns.Fqdn(names[ip][0])}})
+	}
+	for _, name := range slices.Sorted(maps.Keys(p.CNAMEs)) {
+		target := p.CNAMEs[name]
+		expect := Expect{Answers: []string{dns.Fqdn(target)}, AnswerType: dns.TypeCNAME}
+		if ip, ok := p.Records[target]; ok {
+			expect.Answers = append(expect.Answers, ip)
+		}
+		both("Local_"+name, name, dns.TypeA, expect)
+	}
+
+	if p.Blocked != "" {
+		a, aaaa, err := blockedExpectations(p.BlockingMode)
+		if err != nil {
+			return nil, err
+		}
+		both("Blocked", p.Blocked, dns.TypeA, a)
+		both("Blocked", p.Blocked, dns.TypeAAAA, aaaa)
+	}
+	return cases, nil
+}
+
+// blockedExpectations are the A and AAAA replies FTL gives for a blocked
+// domain in a blocking mode
+func blockedExpectations(mode string) (Expect, Expect, error) {
+	switch mode {
+	case "", "NULL":
+		return Expect{Answers: []string{"0.0.0.0"}}, Expect{Answers: []string{"::"}}, nil
+	case "NX":
+		return Expect{Rcode: dns.RcodeNameError}, Expect{Rcode: dns.RcodeNameError}, nil
+	case "NODATA":
+		return Expect{NoData: true}, Expect{NoData: true}, nil
+	}
+	return Expect{}, Expect{}, fmt.Errorf("unsupported blocking mode %q: want NULL, NX or NODATA", mode)
+}
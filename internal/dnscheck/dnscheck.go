@@ -0,0 +1,168 @@
+// Package dnscheck is a table-driven DNS conformance suite. It runs the
+// same cases against any server address, so it can check a Pi-hole in a
+// test container, one deployed by an environment, or a stub resolver.
+package dnscheck
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Case is one query and what its reply must look like
+type Case struct {
+	Name     string
+	Question string
+	Type     uint16
+	// Net is "udp" or "tcp"
+	Net string
+	// UDPSize advertises an EDNS0 buffer size; 0 sends no OPT record
+	UDPSize uint16
+	// Fallback retries over TCP when the UDP reply is truncated, the way
+	// stub resolvers do, and checks the TCP reply
+	Fallback bool
+	Expect   Expect
+}
+
+// Expect describes a conforming reply
+type Expect struct {
+	Rcode int
+	// Answers must each be the data of an answer record, as miekg/dns
+	// formats it, e.g. "10.17.12.1" or "registry.homelab.local."
+	Answers []string
+	// AnswerType requires at least one answer record of this type
+	AnswerType uint16
+	// NoData requires an empty answer section
+	NoData bool
+	// EDNS requires an OPT record in the reply
+	EDNS bool
+}
+
+// Result is the outcome of one case
+type Result struct {
+	Case     Case
+	Reply    *dns.Msg
+	RTT      time.Duration
+	Problems []string
+	// Truncated is set when a Fallback case's UDP reply was truncated
+	Truncated bool
+}
+
+// OK reports whether the reply conformed
+func (r Result) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Run sends every case to server (host:port) and checks the replies
+func Run(server string, cases []Case, timeout time.Duration) []Result {
+	results := make([]Result, len(cases))
+	for i, c := range cases {
+		results[i] = runCase(server, c, timeout)
+	}
+	return results
+}
+
+func runCase(server string, c Case, timeout time.Duration) Result {
+	result := Result{Case: c}
+	query := new(dns.Msg)
+	query.SetQuestion(dns.Fqdn(c.Question), c.Type)
+	if c.UDPSize > 0 {
+		query.SetEdns0(c.UDPSize, false)
+	}
+
+	network := c.Net
+	if network == "" {
+		network = "udp"
+	}
+	client := &dns.Client{Net: network, Timeout: timeout}
+	if c.UDPSize > 0 {
+		client.UDPSize = c.UDPSize
+	}
+	reply, rtt, err := client.Exchange(query, server)
+	if err == nil && c.Fallback && reply.Truncated && network == "udp" {
+		result.Truncated = true
+		result.Problems = append(result.Problems, sizeProblems(c, network, reply)...)
+		network, client.Net = "tcp", "tcp"
+		reply, rtt, err = client.Exchange(query, server)
+	}
+	result.Reply, result.RTT = reply, rtt
+	if err != nil {
+		result.Problems = append(result.Problems, err.Error())
+		return result
+	}
+	result.Problems = append(result.Problems, check(c, reply)...)
+	result.Problems = append(result.Problems, sizeProblems(c, network, reply)...)
+	return result
+}
+
+// sizeProblems checks a UDP reply fits the buffer the query advertised,
+// or 512 bytes without EDNS0
+func sizeProblems(c Case, network string, reply *dns.Msg) []string {
+	if network != "udp" {
+		return nil
+	}
+	limit := dns.MinMsgSize
+	if c.UDPSize > 0 {
+		limit = int(c.UDPSize)
+	}
+	// Unpacked messages forget compression; servers compress on the wire
+	wire := reply.Copy()
+	wire.Compress = true
+	if wire.Len() > limit {
+		return []string{fmt.Sprintf("%d-byte UDP reply exceeds the %d-byte buffer", wire.Len(), limit)}
+	}
+	return nil
+}
+
+// check compares a reply with the case's expectations
+func check(c Case, reply *dns.Msg) []string {
+	var problems []string
+	if reply.Rcode != c.Expect.Rcode {
+		problems = append(problems, fmt.Sprintf("rcode %s, want %s", dns.RcodeToString[reply.Rcode], dns.RcodeToString[c.Expect.Rcode]))
+	}
+	if reply.Truncated && !c.Fallback {
+		problems = append(problems, "reply is truncated")
+	}
+
+	data := make([]string, len(reply.Answer))
+	var types []uint16
+	for i, rr := range reply.Answer {
+		data[i] = RData(rr)
+		types = append(types, rr.Header().Rrtype)
+	}
+	for _, want := range c.Expect.Answers {
+		if !slices.Contains(data, want) {
+			problems = append(problems, fmt.Sprintf("no answer %q in [%s]", want, strings.Join(data, ", ")))
+		}
+	}
+	if c.Expect.AnswerType != 0 && !slices.Contains(types, c.Expect.AnswerType) {
+		problems = append(problems, fmt.Sprintf("no %s answer", dns.TypeToString[c.Expect.AnswerType]))
+	}
+	if c.Expect.NoData && len(reply.Answer) > 0 {
+		problems = append(problems, fmt.Sprintf("want NODATA, got %d answers", len(reply.Answer)))
+	}
+
+	opt := reply.IsEdns0()
+	if c.Expect.EDNS && opt == nil {
+		problems = append(problems, "reply has no OPT record")
+	}
+	return problems
+}
+
+// RData formats a record's data without its header, e.g. "10.17.12.1" for
+// an A record or "10 mx.example.com." for an MX record
+func RData(rr dns.RR) string {
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
+
+// ReverseName is the in-addr.arpa or ip6.arpa name of an address
+func ReverseName(ip string) (string, error) {
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("invalid IP address %q", ip)
+	}
+	return dns.ReverseAddr(ip)
+}
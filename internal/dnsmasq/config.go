@@ -0,0 +1,312 @@
+// Package dnsmasq models the DHCP, TFTP and PXE settings the dnsmasq module
+// passes to its container as command-line flags, so they can be rendered as
+// a dnsmasq.conf for review and validated against the VLAN they serve.
+package dnsmasq
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/yebyen/home-lab-terraform/internal/tfeval"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// TFTPRoot is where the dnsmasq module mounts its TFTP volume
+const TFTPRoot = "/var/lib/tftpboot"
+
+// Config is one dnsmasq instance
+type Config struct {
+	StaticIP netip.Addr
+	// DHCP, TFTP and PXE are nil when the service is disabled
+	DHCP *DHCP
+	TFTP *TFTP
+	PXE  *PXE
+	// Logging adds --log-queries and --log-dhcp
+	Logging   bool
+	ExtraArgs []string
+}
+
+// DHCP is the lease range and the options handed to clients
+type DHCP struct {
+	RangeStart netip.Addr
+	RangeEnd   netip.Addr
+	Router     netip.Addr
+	DNSServer  netip.Addr
+}
+
+// TFTP serves boot loaders from Root
+type TFTP struct {
+	Root string
+}
+
+// PXE chainloads iPXE and then matchbox
+type PXE struct {
+	Matchbox netip.AddrPort
+	// Arches pick a boot loader by the client-arch DHCP option
+	Arches []ArchBoot
+}
+
+// ArchBoot tags clients of one architecture and names their boot loader
+type ArchBoot struct {
+	Tag  string
+	Arch int
+	File string
+}
+
+// IPXETag is set for clients whose user class says they are already
+// running iPXE; they get BootURL instead of a boot loader
+const IPXETag = "ipxe"
+
+// BootURL is the matchbox iPXE script iPXE clients are sent to
+func (p *PXE) BootURL() string {
+	return fmt.Sprintf("http://%s/boot.ipxe", p.Matchbox)
+}
+
+// BootFile predicts the boot file name dnsmasq hands a client. dnsmasq
+// checks dhcp-boot rules from the last configured to the first, so the iPXE
+// rule wins over the client-arch rules once a client runs iPXE. It returns
+// "" when PXE is disabled or no rule matches.
+func (c *Config) BootFile(arch int, userClass string) string {
+	if c.PXE == nil {
+		return ""
+	}
+	if userClass == "iPXE" {
+		return c.PXE.BootURL()
+	}
+	for i := len(c.PXE.Arches) - 1; i >= 0; i-- {
+		if c.PXE.Arches[i].Arch == arch {
+			return c.PXE.Arches[i].File
+		}
+	}
+	return ""
+}
+
+// FromModule builds a Config from an evaluated dnsmasq module: its inputs,
+// with the defaults from variables.tf filled in, and the client-arch rules
+// it declares in local.pxe_arches
+func FromModule(m *tfeval.Module) (*Config, error) {
+	vars, err := tfeval.ToGo(cty.ObjectVal(m.Vars))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read module variables: %w", err)
+	}
+	rules, err := m.Local("pxe_arches")
+	if err != nil {
+		return nil, err
+	}
+	raw, err := tfeval.ToGo(rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read local.pxe_arches: %w", err)
+	}
+	list, _ := raw.([]interface{})
+	arches := make([]ArchBoot, 0, len(list))
+	for i, item := range list {
+		rule := moduleVars{vars: toMap(item)}
+		arches = append(arches, ArchBoot{Tag: rule.string("tag"), Arch: rule.int("arch"), File: rule.string("file")})
+		if len(rule.problems) > 0 {
+			return nil, fmt.Errorf("local.pxe_arches[%d]: %s", i, strings.Join(rule.problems, "; "))
+		}
+	}
+	return FromModuleVars(vars.(map[string]interface{}), arches)
+}
+
+// FromModuleVars builds a Config from every dnsmasq module variable it
+// reads, as tfeval fills them in, and the module's client-arch rules.
+// Numbers may be any Go numeric type; a missing variable is a problem, not
+// a default.
+func FromModuleVars(vars map[string]interface{}, arches []ArchBoot) (*Config, error) {
+	v := moduleVars{vars: vars}
+
+	config := &Config{
+		StaticIP: v.addr("static_ip"),
+		Logging:  v.bool("enable_logging"),
+	}
+	if v.bool("dhcp_enabled") {
+		config.DHCP = &DHCP{
+			RangeStart: v.addr("dhcp_range_start"),
+			RangeEnd:   v.addr("dhcp_range_end"),
+			Router:     v.addr("dhcp_router"),
+			DNSServer:  v.addr("dhcp_dns_server"),
+		}
+	}
+	if v.bool("tftp_enabled") {
+		config.TFTP = &TFTP{Root: TFTPRoot}
+	}
+	if v.bool("pxe_enabled") {
+		port := v.int("matchbox_port")
+		if _, ok := vars["matchbox_port"]; ok && (port < 1 || port > 65535) {
+			v.problems = append(v.problems, fmt.Sprintf("matchbox_port: %d is not a port", port))
+			port = 0
+		}
+		config.PXE = &PXE{
+			Matchbox: netip.AddrPortFrom(v.addr("matchbox_server"), uint16(port)),
+			Arches:   arches,
+		}
+	}
+	switch extra := vars["additional_args"].(type) {
+	case []interface{}:
+		for _, arg := range extra {
+			config.ExtraArgs = append(config.ExtraArgs, fmt.Sprint(arg))
+		}
+	case []string:
+		config.ExtraArgs = append(config.ExtraArgs, extra...)
+	case nil:
+		v.problems = append(v.problems, "additional_args: required")
+	}
+
+	if len(v.problems) > 0 {
+		return nil, &ValidationError{Problems: v.problems}
+	}
+	return config, nil
+}
+
+// section is a group of flags with the comment it gets in dnsmasq.conf
+type section struct {
+	comment string
+	args    []string
+}
+
+func (c *Config) sections() []section {
+	sections := []section{{
+		comment: "Foreground, query logging and no DNS listener, as the container runs",
+		args:    []string{"-d", "-q", "-p0"},
+	}}
+	if c.DHCP != nil {
+		sections = append(sections, section{"DHCP", []string{
+			fmt.Sprintf("--dhcp-range=%s,%s", c.DHCP.RangeStart, c.DHCP.RangeEnd),
+			fmt.Sprintf("--dhcp-option=option:router,%s", c.DHCP.Router),
+			fmt.Sprintf("--dhcp-option=option:dns-server,%s", c.DHCP.DNSServer),
+		}})
+	}
+	if c.TFTP != nil {
+		sections = append(sections, section{"TFTP", []string{
+			"--enable-tftp",
+			"--tftp-root=" + c.TFTP.Root,
+		}})
+	}
+	if c.PXE != nil {
+		var args []string
+		for _, arch := range c.PXE.Arches {
+			args = append(args,
+				fmt.Sprintf("--dhcp-match=set:%s,option:client-arch,%d", arch.Tag, arch.Arch),
+				fmt.Sprintf("--dhcp-boot=tag:%s,%s", arch.Tag, arch.File))
+		}
+		args = append(args,
+			"--dhcp-userclass=set:"+IPXETag+",iPXE",
+			fmt.Sprintf("--dhcp-boot=tag:%s,%s", IPXETag, c.PXE.BootURL()))
+		sections = append(sections, section{"PXE: boot loader by client-arch, then matchbox once in iPXE", args})
+	}
+	if c.Logging {
+		sections = append(sections, section{"Logging", []string{"--log-queries", "--log-dhcp"}})
+	}
+	if len(c.ExtraArgs) > 0 {
+		sections = append(sections, section{"Additional arguments", c.ExtraArgs})
+	}
+	return sections
+}
+
+// Args returns the container command the dnsmasq module builds for the
+// same settings
+func (c *Config) Args() []string {
+	var args []string
+	for _, section := range c.sections() {
+		args = append(args, section.args...)
+	}
+	return args
+}
+
+// shortFlags maps the short flags the module uses to dnsmasq.conf options
+var shortFlags = map[string]string{
+	"-d":  "no-daemon",
+	"-q":  "log-queries",
+	"-p0": "port=0",
+}
+
+// Render writes the settings as a dnsmasq.conf, one option per line,
+// equivalent to Args
+func (c *Config) Render() []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# dnsmasq.conf for %s\n", c.StaticIP)
+
+	seen := make(map[string]bool)
+	for _, section := range c.sections() {
+		fmt.Fprintf(&b, "\n# %s\n", section.comment)
+		for _, arg := range section.args {
+			line, ok := shortFlags[arg]
+			if !ok {
+				line = strings.TrimPrefix(arg, "--")
+			}
+			if seen[line] {
+				fmt.Fprintf(&b, "# %s (already set above)\n", line)
+				continue
+			}
+			seen[line] = true
+			fmt.Fprintln(&b, line)
+		}
+	}
+	return []byte(b.String())
+}
+
+// moduleVars reads module variables, collecting problems as it goes
+type moduleVars struct {
+	vars     map[string]interface{}
+	problems []string
+}
+
+func toMap(value interface{}) map[string]interface{} {
+	m, _ := value.(map[string]interface{})
+	return m
+}
+
+func (v *moduleVars) required(name string) {
+	v.problems = append(v.problems, fmt.Sprintf("%s: required", name))
+}
+
+func (v *moduleVars) string(name string) string {
+	value, ok := v.vars[name].(string)
+	if !ok {
+		v.required(name)
+	}
+	return value
+}
+
+func (v *moduleVars) addr(name string) netip.Addr {
+	raw, ok := v.vars[name].(string)
+	if !ok {
+		v.required(name)
+		return netip.Addr{}
+	}
+	addr, err := netip.ParseAddr(raw)
+	if err != nil {
+		v.problems = append(v.problems, fmt.Sprintf("%s: %v", name, err))
+	}
+	return addr
+}
+
+func (v *moduleVars) bool(name string) bool {
+	value, ok := v.vars[name].(bool)
+	if !ok {
+		v.required(name)
+	}
+	return value
+}
+
+func (v *moduleVars) int(name string) int {
+	switch value := v.vars[name].(type) {
+	case int:
+		return value
+	case int64:
+		return int(value)
+	case float64:
+		return int(value)
+	case string:
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+		v.problems = append(v.problems, fmt.Sprintf("%s: %q is not a number", name, value))
+	default:
+		v.required(name)
+	}
+	return 0
+}
@@ -0,0 +1,126 @@
+package dnsmasq
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ValidationError lists every problem found in a Config
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid dnsmasq configuration:\n  %s", strings.Join(e.Problems, "\n  "))
+}
+
+// Validate checks the settings make sense on the VLAN subnet they serve:
+// every address is a usable host in the subnet, the DHCP range is ordered
+// and leaves out the static, router and DNS addresses, and PXE has the TFTP
+// server its boot loaders come from
+func (c *Config) Validate(subnet netip.Prefix) error {
+	var problems []string
+	subnet = subnet.Masked()
+	inSubnet := func(name string, addr netip.Addr) bool {
+		switch {
+		case !addr.IsValid():
+			problems = append(problems, fmt.Sprintf("%s is not set", name))
+		case !subnet.Contains(addr):
+			problems = append(problems, fmt.Sprintf("%s %s is outside %s", name, addr, subnet))
+		case addr == subnet.Addr() || (addr.Is4() && addr == lastAddr(subnet)):
+			problems = append(problems, fmt.Sprintf("%s %s is the network or broadcast address of %s", name, addr, subnet))
+		default:
+			return true
+		}
+		return false
+	}
+
+	inSubnet("static IP", c.StaticIP)
+
+	if c.DHCP != nil {
+		startOK := inSubnet("DHCP range start", c.DHCP.RangeStart)
+		endOK := inSubnet("DHCP range end", c.DHCP.RangeEnd)
+		inSubnet("router", c.DHCP.Router)
+		inSubnet("DNS server", c.DHCP.DNSServer)
+
+		if startOK && endOK {
+			if c.DHCP.RangeEnd.Less(c.DHCP.RangeStart) {
+				problems = append(problems, fmt.Sprintf("DHCP range %s-%s ends before it starts", c.DHCP.RangeStart, c.DHCP.RangeEnd))
+			}
+			for _, fixed := range []struct {
+				name string
+				addr netip.Addr
+			}{{"static IP", c.StaticIP}, {"router", c.DHCP.Router}, {"DNS server", c.DHCP.DNSServer}} {
+				if c.DHCP.InRange(fixed.addr) {
+					problems = append(problems, fmt.Sprintf("%s %s is inside the DHCP range %s-%s", fixed.name, fixed.addr, c.DHCP.RangeStart, c.DHCP.RangeEnd))
+				}
+			}
+		}
+	}
+
+	if c.PXE != nil {
+		if inSubnet("matchbox server", c.PXE.Matchbox.Addr()) && c.DHCP != nil && c.DHCP.InRange(c.PXE.Matchbox.Addr()) {
+			problems = append(problems, fmt.Sprintf("matchbox server %s is inside the DHCP range", c.PXE.Matchbox.Addr()))
+		}
+		if c.PXE.Matchbox.Port() == 0 {
+			problems = append(problems, "matchbox port is not set")
+		}
+		if c.TFTP == nil {
+			problems = append(problems, "PXE is enabled without TFTP, so clients cannot fetch their boot loaders")
+		}
+		if c.DHCP == nil {
+			problems = append(problems, "PXE is enabled without DHCP, so no client is told where to boot from")
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// InRange reports whether addr is a lease address
+func (d *DHCP) InRange(addr netip.Addr) bool {
+	return addr.IsValid() && !addr.Less(d.RangeStart) && !d.RangeEnd.Less(addr)
+}
+
+// ProbeMatchbox fetches BootURL and checks it is an iPXE script, to catch a
+// matchbox_server/matchbox_port pair that points nowhere
+func (c *Config) ProbeMatchbox(client *http.Client) error {
+	if c.PXE == nil {
+		return fmt.Errorf("PXE is disabled")
+	}
+	url := c.PXE.BootURL()
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("matchbox unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", url, err)
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(string(body)), "#!ipxe") {
+		return fmt.Errorf("%s is not an iPXE script", url)
+	}
+	return nil
+}
+
+// lastAddr is the highest address of an IPv4 prefix, its broadcast address
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Addr().As4()
+	hostBits := 32 - prefix.Bits()
+	for i := 3; i >= 0 && hostBits > 0; i-- {
+		bits := min(hostBits, 8)
+		addr[i] |= byte(1<<bits - 1)
+		hostBits -= bits
+	}
+	return netip.AddrFrom4(addr)
+}
@@ -0,0 +1,122 @@
+package dnsstub
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// Server serves a zone over UDP and TCP on one port
+type Server struct {
+	// Addr is the host:port both transports listen on
+	Addr string
+	Zone *Zone
+
+	mu      sync.Mutex
+	queries map[string]int
+	servers []*dns.Server
+}
+
+// Start serves zone on addr. A zero port picks one free for both UDP and
+// TCP; listen on a Docker network's gateway address to be reachable from
+// its containers.
+func Start(addr string, zone *Zone) (*Server, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+
+	s := &Server{Zone: zone, queries: make(map[string]int)}
+	var udp net.PacketConn
+	var tcp net.Listener
+	for attempt := 0; attempt < 20; attempt++ {
+		if udp, err = net.ListenPacket("udp", net.JoinHostPort(host, port)); err != nil {
+			return nil, fmt.Errorf("failed to listen on %s/udp: %w", addr, err)
+		}
+		s.Addr = udp.LocalAddr().String()
+		if tcp, err = net.Listen("tcp", s.Addr); err == nil {
+			break
+		}
+		udp.Close()
+		if port != "0" {
+			return nil, fmt.Errorf("failed to listen on %s/tcp: %w", addr, err)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find a port free for UDP and TCP: %w", err)
+	}
+
+	var started sync.WaitGroup
+	started.Add(2)
+	s.servers = []*dns.Server{
+		{PacketConn: udp, Net: "udp", Handler: s, NotifyStartedFunc: started.Done},
+		{Listener: tcp, Net: "tcp", Handler: s, NotifyStartedFunc: started.Done},
+	}
+	for _, server := range s.servers {
+		go server.ActivateAndServe()
+	}
+	// Shutdown fails on servers that have not started yet
+	started.Wait()
+	return s, nil
+}
+
+// Port is the port the server listens on
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.Addr)
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// ServeDNS answers from the zone and counts the query
+func (s *Server) ServeDNS(w dns.ResponseWriter, query *dns.Msg) {
+	if len(query.Question) == 1 {
+		q := query.Question[0]
+		s.mu.Lock()
+		s.queries[queryKey(q.Name, q.Qtype)]++
+		s.mu.Unlock()
+	}
+	w.WriteMsg(s.Zone.Reply(query, w.LocalAddr().Network() == "udp"))
+}
+
+// Queries is how many times name was asked for with qtype
+func (s *Server) Queries(name string, qtype uint16) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries[queryKey(name, qtype)]
+}
+
+// Total is how many queries the server has answered
+func (s *Server) Total() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0
+	for _, n := range s.queries {
+		total += n
+	}
+	return total
+}
+
+// Reset forgets the query counts
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries = make(map[string]int)
+}
+
+// Close stops both transports
+func (s *Server) Close() error {
+	var errs []error
+	for _, server := range s.servers {
+		errs = append(errs, server.Shutdown())
+	}
+	return errors.Join(errs...)
+}
+
+func queryKey(name string, qtype uint16) string {
+	return strings.ToLower(dns.Fqdn(name)) + " " + dns.TypeToString[qtype]
+}
@@ -0,0 +1,148 @@
+// Package dnsstub is a stand-in upstream resolver for tests. It answers
+// from fixture zones the way a recursive resolver would, never touches the
+// network, and counts the queries it gets so tests can tell forwarded
+// queries from cached or blocked ones.
+package dnsstub
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// maxChain bounds how many CNAMEs Reply follows within the zone
+const maxChain = 8
+
+// Zone is a set of fixture records, possibly spanning several domains
+type Zone struct {
+	records map[string][]dns.RR
+}
+
+// NewZone returns a zone holding records
+func NewZone(records ...dns.RR) *Zone {
+	z := &Zone{records: make(map[string][]dns.RR)}
+	z.Add(records...)
+	return z
+}
+
+// ParseZone reads records in master file format. Names without a trailing
+// dot are relative to $ORIGIN, which the file must then set.
+func ParseZone(r io.Reader, file string) (*Zone, error) {
+	z := NewZone()
+	parser := dns.NewZoneParser(r, "", file)
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		z.Add(rr)
+	}
+	if err := parser.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse zone: %w", err)
+	}
+	return z, nil
+}
+
+// LoadZone reads a zone file
+func LoadZone(path string) (*Zone, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zone: %w", err)
+	}
+	defer f.Close()
+	return ParseZone(f, path)
+}
+
+// Add adds records to the zone
+func (z *Zone) Add(records ...dns.RR) {
+	for _, rr := range records {
+		name := strings.ToLower(rr.Header().Name)
+		z.records[name] = append(z.records[name], rr)
+	}
+}
+
+// Names are the owner names in the zone
+func (z *Zone) Names() []string {
+	names := make([]string, 0, len(z.records))
+	for name := range z.records {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Reply answers a query from the zone: the records of the asked type,
+// following CNAMEs, NODATA for names without them and NXDOMAIN for names
+// that do not exist, with the enclosing SOA for negative caching. UDP
+// replies are truncated to the query's EDNS0 buffer size, or 512 bytes.
+func (z *Zone) Reply(query *dns.Msg, udp bool) *dns.Msg {
+	reply := new(dns.Msg)
+	reply.SetReply(query)
+	reply.RecursionAvailable = true
+	if len(query.Question) != 1 {
+		reply.Rcode = dns.RcodeFormatError
+		return reply
+	}
+
+	q := query.Question[0]
+	name := strings.ToLower(q.Name)
+	for i := 0; i < maxChain; i++ {
+		records, ok := z.records[name]
+		if !ok {
+			if !z.emptyNonTerminal(name) {
+				reply.Rcode = dns.RcodeNameError
+			}
+			break
+		}
+		var target string
+		for _, rr := range records {
+			switch {
+			case rr.Header().Rrtype == q.Qtype || q.Qtype == dns.TypeANY:
+				reply.Answer = append(reply.Answer, dns.Copy(rr))
+			case rr.Header().Rrtype == dns.TypeCNAME:
+				reply.Answer = append(reply.Answer, dns.Copy(rr))
+				target = strings.ToLower(rr.(*dns.CNAME).Target)
+			}
+		}
+		if target == "" || q.Qtype == dns.TypeCNAME {
+			break
+		}
+		name = target
+	}
+	if len(reply.Answer) == 0 {
+		if soa := z.soa(name); soa != nil {
+			reply.Ns = append(reply.Ns, soa)
+		}
+	}
+
+	size := dns.MinMsgSize
+	if opt := query.IsEdns0(); opt != nil {
+		size = int(opt.UDPSize())
+		reply.SetEdns0(opt.UDPSize(), false)
+	}
+	if udp {
+		reply.Truncate(size)
+	}
+	return reply
+}
+
+// emptyNonTerminal reports whether name only exists as the parent of
+// other names, e.g. _tcp.gmail.com, which has NODATA rather than NXDOMAIN
+func (z *Zone) emptyNonTerminal(name string) bool {
+	for owner := range z.records {
+		if dns.IsSubDomain(name, owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// soa is the SOA of the closest enclosing zone apex, if the zone has one
+func (z *Zone) soa(name string) dns.RR {
+	for _, i := range append(dns.Split(name), len(name)) {
+		for _, rr := range z.records[name[i:]] {
+			if rr.Header().Rrtype == dns.TypeSOA {
+				return dns.Copy(rr)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+// Package exporter collects statistics from Pi-hole instances through the
+// pihole client and serves them to Prometheus. Unlike the third-party
+// exporter image, it authenticates with a v6 session per instance and
+// re-authenticates whenever a scrape fails.
+package exporter
+
+import (
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/yebyen/home-lab-terraform/internal/pihole"
+	"github.com/yebyen/home-lab-terraform/internal/promtext"
+)
+
+// Target is a Pi-hole instance to scrape
+type Target struct {
+	// Name is the value of the pihole label on its series
+	Name     string
+	BaseURL  string
+	Password string
+}
+
+// Exporter scrapes its targets on every collection
+type Exporter struct {
+	Targets []Target
+	// TopClients is how many clients the per-client and per-group series
+	// cover, busiest first
+	TopClients int
+	// Timeout bounds each API request
+	Timeout time.Duration
+	// Now is used for gravity age and defaults to time.Now
+	Now func() time.Time
+
+	mu       sync.Mutex
+	sessions map[Target]*pihole.Session
+}
+
+// New returns an exporter for targets with default settings
+func New(targets []Target) *Exporter {
+	return &Exporter{Targets: targets, TopClients: 10, Timeout: 10 * time.Second}
+}
+
+// Collect scrapes every target concurrently. A target that cannot be
+// scraped reports pihole_up 0 instead of failing the whole collection.
+func (e *Exporter) Collect() promtext.Families {
+	results := make([]promtext.Families, len(e.Targets))
+	var wg sync.WaitGroup
+	for i, target := range e.Targets {
+		wg.Add(1)
+		go func(i int, target Target) {
+			defer wg.Done()
+
+			start := time.Now()
+			families, err := e.collectTarget(target)
+			labels := map[string]string{"pihole": target.Name}
+			up := 1.0
+			if err != nil {
+				log.Printf("exporter: %s: %v", target.Name, err)
+				families, up = make(promtext.Families), 0
+			}
+			families.Add("pihole_up", "gauge", "Whether the last scrape of the Pi-hole API succeeded", up, labels)
+			families.Add("pihole_scrape_duration_seconds", "gauge", "How long the last scrape of the Pi-hole API took",
+				time.Since(start).Seconds(), labels)
+			results[i] = families
+		}(i, target)
+	}
+	wg.Wait()
+
+	all := make(promtext.Families)
+	for _, families := range results {
+		all.Merge(families)
+	}
+	return all
+}
+
+// ServeHTTP serves a fresh collection in the text exposition format
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := promtext.Write(w, e.Collect()); err != nil {
+		log.Printf("exporter: failed to write metrics: %v", err)
+	}
+}
+
+// session returns the cached session for a target, authenticating first
+// if there is none. The lock is not held while authenticating, so a slow
+// Pi-hole does not hold up the others.
+func (e *Exporter) session(target Target) (*pihole.Session, error) {
+	e.mu.Lock()
+	session, ok := e.sessions[target]
+	e.mu.Unlock()
+	if ok {
+		return session, nil
+	}
+
+	session, err := pihole.NewSession(target.BaseURL, target.Password)
+	if err != nil {
+		return nil, err
+	}
+	session.HTTPClient.Timeout = e.Timeout
+
+	e.mu.Lock()
+	cached, ok := e.sessions[target]
+	if !ok {
+		if e.sessions == nil {
+			e.sessions = make(map[Target]*pihole.Session)
+		}
+		e.sessions[target] = session
+	}
+	e.mu.Unlock()
+	if ok {
+		// A concurrent collection authenticated first; keep its session
+		e.logout(target, session)
+		return cached, nil
+	}
+	return session, nil
+}
+
+// forget drops a target's session and logs it out so the next scrape
+// authenticates again, e.g. after the session expired or the Pi-hole
+// restarted. A session another collection already replaced is left alone.
+func (e *Exporter) forget(target Target, session *pihole.Session) {
+	e.mu.Lock()
+	if e.sessions[target] == session {
+		delete(e.sessions, target)
+	}
+	e.mu.Unlock()
+	e.logout(target, session)
+}
+
+// logout frees a session's seat on the Pi-hole. It fails when the session
+// has already expired, which is only worth a log line.
+func (e *Exporter) logout(target Target, session *pihole.Session) {
+	if err := session.Logout(); err != nil {
+		log.Printf("exporter: %s: %v", target.Name, err)
+	}
+}
+
+func (e *Exporter) collectTarget(target Target) (promtext.Families, error) {
+	session, err := e.session(target)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := e.fetch(session)
+	if err != nil {
+		e.forget(target, session)
+		return nil, err
+	}
+
+	now := time.Now
+	if e.Now != nil {
+		now = e.Now
+	}
+	return stats.families(target.Name, now()), nil
+}
+
+// stats is everything one scrape reads from a Pi-hole
+type stats struct {
+	summary    *pihole.Summary
+	blocking   *pihole.Blocking
+	topClients []pihole.TopClient
+	topBlocked []pihole.TopClient
+	clients    []pihole.ConfiguredClient
+	groups     []pihole.Group
+	upstreams  []pihole.Upstream
+}
+
+func (e *Exporter) fetch(session *pihole.Session) (*stats, error) {
+	var s stats
+	var err error
+	if s.summary, err = session.GetSummary(); err != nil {
+		return nil, err
+	}
+	if s.blocking, err = session.GetBlocking(); err != nil {
+		return nil, err
+	}
+	if s.topClients, err = session.GetTopClients(false, e.TopClients); err != nil {
+		return nil, err
+	}
+	if s.topBlocked, err = session.GetTopClients(true, e.TopClients); err != nil {
+		return nil, err
+	}
+	if s.clients, err = session.GetClients(); err != nil {
+		return nil, err
+	}
+	if s.groups, err = session.GetGroups(); err != nil {
+		return nil, err
+	}
+	if s.upstreams, err = session.GetUpstreams(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *stats) families(name string, now time.Time) promtext.Families {
+	families := make(promtext.Families)
+	gauge := func(metric, help string, value float64, labels ...string) {
+		pairs := map[string]string{"pihole": name}
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs[labels[i]] = labels[i+1]
+		}
+		families.Add(metric, "gauge", help, value, pairs)
+	}
+
+	status := 0.0
+	if s.blocking.Enabled() {
+		status = 1
+	}
+	gauge("pihole_status", "Whether blocking is enabled", status)
+
+	// Summary series keep the third-party exporter's names so dashboards
+	// and the metrics contract carry over
+	q := s.summary.Queries
+	gauge("pihole_dns_queries_today", "DNS queries in the last 24 hours", float64(q.Total))
+	gauge("pihole_ads_blocked_today", "Queries blocked in the last 24 hours", float64(q.Blocked))
+	gauge("pihole_ads_percentage_today", "Percentage of queries blocked in the last 24 hours", q.PercentBlocked)
+	gauge("pihole_unique_domains", "Unique domains queried in the last 24 hours", float64(q.UniqueDomains))
+	gauge("pihole_queries_forwarded", "Queries forwarded upstream in the last 24 hours", float64(q.Forwarded))
+	gauge("pihole_queries_cached", "Queries answered from cache in the last 24 hours", float64(q.Cached))
+	gauge("pihole_unique_clients", "Clients seen in the last 24 hours", float64(s.summary.Clients.Active))
+	gauge("pihole_clients_ever_seen", "Clients ever seen", float64(s.summary.Clients.Total))
+	gauge("pihole_domains_being_blocked", "Domains on the gravity blocklist", float64(s.summary.Gravity.DomainsBeingBlocked))
+	for _, key := range slices.Sorted(maps.Keys(q.Types)) {
+		gauge("pihole_query_type", "Queries in the last 24 hours by record type", float64(q.Types[key]), "type", key)
+	}
+	for _, key := range slices.Sorted(maps.Keys(q.Status)) {
+		gauge("pihole_query_status", "Queries in the last 24 hours by FTL status", float64(q.Status[key]), "status", key)
+	}
+	for _, key := range slices.Sorted(maps.Keys(q.Replies)) {
+		gauge("pihole_reply", "Replies in the last 24 hours by type", float64(q.Replies[key]), "type", key)
+	}
+
+	if s.summary.Gravity.LastUpdate > 0 {
+		updated := s.summary.GravityUpdated()
+		gauge("pihole_gravity_last_update_timestamp_seconds", "When gravity was last rebuilt", float64(updated.Unix()))
+		gauge("pihole_gravity_age_seconds", "Seconds since gravity was last rebuilt", now.Sub(updated).Seconds())
+	}
+
+	for _, client := range s.topClients {
+		gauge("pihole_client_queries", "Queries in the last 24 hours from the busiest clients",
+			float64(client.Count), "client", client.IP, "name", client.Name)
+	}
+	for _, client := range s.topBlocked {
+		gauge("pihole_client_blocked_queries", "Blocked queries in the last 24 hours from the most blocked clients",
+			float64(client.Count), "client", client.IP, "name", client.Name)
+	}
+	blockedByGroup := groupBlocked(s.topBlocked, s.clients)
+	for _, group := range s.groups {
+		gauge("pihole_group_blocked_queries", "Blocked queries in the last 24 hours from the most blocked clients, by their groups",
+			float64(blockedByGroup[group.ID]), "group", group.Name)
+	}
+
+	for _, upstream := range s.upstreams {
+		address := upstream.Address()
+		gauge("pihole_upstream_queries", "Queries in the last 24 hours by upstream",
+			float64(upstream.Count), "upstream", address)
+		if upstream.Port <= 0 {
+			continue // blocklist and cache answer locally
+		}
+		gauge("pihole_upstream_response_seconds", "Mean upstream response time",
+			upstream.Statistics.Response, "upstream", address)
+		gauge("pihole_upstream_response_variance_seconds", "Variance of the upstream response time",
+			upstream.Statistics.Variance, "upstream", address)
+	}
+	return families
+}
+
+// groupBlocked sums blocked queries by group ID, crediting each client to
+// the groups of the configured client entry FTL would match it with
+func groupBlocked(blocked []pihole.TopClient, clients []pihole.ConfiguredClient) map[int]int {
+	counts := make(map[int]int)
+	for _, client := range blocked {
+		for _, group := range ClientGroups(clients, client.IP, client.Name) {
+			counts[group] += client.Count
+		}
+	}
+	return counts
+}
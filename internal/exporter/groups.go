@@ -0,0 +1,48 @@
+package exporter
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/yebyen/home-lab-terraform/internal/pihole"
+)
+
+// ClientGroups returns the group IDs FTL applies to a client seen with the
+// given IP and name: those of an entry for the exact IP, else of an entry
+// for its hostname, else of the narrowest subnet entry containing it, else
+// the Default group (0). MAC and interface entries cannot be matched from
+// query statistics and are skipped.
+func ClientGroups(clients []pihole.ConfiguredClient, ip, name string) []int {
+	addr, addrErr := netip.ParseAddr(ip)
+
+	var byName, bySubnet *pihole.ConfiguredClient
+	subnetBits := -1
+	for i, client := range clients {
+		entry := client.Client
+		switch {
+		case addrErr == nil && isAddr(entry, addr):
+			return clients[i].Groups
+		case name != "" && strings.EqualFold(entry, name):
+			if byName == nil {
+				byName = &clients[i]
+			}
+		case addrErr == nil && strings.Contains(entry, "/"):
+			prefix, err := netip.ParsePrefix(entry)
+			if err == nil && prefix.Contains(addr) && prefix.Bits() > subnetBits {
+				bySubnet, subnetBits = &clients[i], prefix.Bits()
+			}
+		}
+	}
+	if byName != nil {
+		return byName.Groups
+	}
+	if bySubnet != nil {
+		return bySubnet.Groups
+	}
+	return []int{0}
+}
+
+func isAddr(entry string, addr netip.Addr) bool {
+	parsed, err := netip.ParseAddr(entry)
+	return err == nil && parsed == addr
+}
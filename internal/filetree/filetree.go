@@ -0,0 +1,24 @@
+// Package filetree writes generated configuration, a set of files keyed by
+// slash-separated relative paths such as mirrors.Files and scrape.Files
+// return, to a directory.
+package filetree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Write writes files under dir, creating directories as needed
+func Write(dir string, files map[string][]byte) error {
+	for path, data := range files {
+		target := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", filepath.Dir(target), err)
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", target, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Package matchbox generates the profiles and groups matchbox serves from
+// its data directory, from an inventory of the machines it netboots, and
+// reads the iPXE scripts matchbox renders for them.
+package matchbox
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Inventory is the machine inventory file: boot profiles and the machines
+// that use them
+type Inventory struct {
+	// MatchboxURL is where machines reach matchbox, e.g.
+	// http://10.17.13.251:8080; config references in kernel args point here
+	MatchboxURL string                 `yaml:"matchbox_url"`
+	Profiles    map[string]ProfileSpec `yaml:"profiles"`
+	Machines    []Machine              `yaml:"machines"`
+
+	// dir resolves config file paths relative to the inventory file
+	dir string
+}
+
+// ProfileSpec is one boot profile in the inventory
+type ProfileSpec struct {
+	Kernel string   `yaml:"kernel"`
+	Initrd []string `yaml:"initrd"`
+	Args   []string `yaml:"args"`
+	// TalosConfig is a Talos machine config served as the profile's generic
+	// config, passed to the kernel as talos.config
+	TalosConfig string `yaml:"talos_config"`
+	// Ignition is an Ignition config passed as ignition.config.url
+	Ignition string `yaml:"ignition"`
+}
+
+// Machine is one netbooted machine, selected by MAC address, UUID or both
+type Machine struct {
+	Name     string            `yaml:"name"`
+	MAC      string            `yaml:"mac"`
+	UUID     string            `yaml:"uuid"`
+	Profile  string            `yaml:"profile"`
+	Metadata map[string]string `yaml:"metadata"`
+}
+
+// LoadInventory reads an inventory file. Config paths in it are relative to
+// the file.
+func LoadInventory(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory: %w", err)
+	}
+	inventory, err := ParseInventory(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	inventory.dir = filepath.Dir(path)
+	return inventory, nil
+}
+
+// ParseInventory decodes an inventory and checks every machine has a unique
+// name and selector and a known profile
+func ParseInventory(data []byte) (*Inventory, error) {
+	var inventory Inventory
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&inventory); err != nil {
+		return nil, fmt.Errorf("failed to parse inventory: %w", err)
+	}
+
+	var problems []string
+	for _, name := range sortedKeys(inventory.Profiles) {
+		spec := inventory.Profiles[name]
+		if !validID(name) {
+			problems = append(problems, fmt.Sprintf("profile %q: name must be letters, digits, '-', '_' or '.'", name))
+		}
+		if spec.Kernel == "" {
+			problems = append(problems, fmt.Sprintf("profile %s: kernel is required", name))
+		}
+		if (spec.TalosConfig != "" || spec.Ignition != "") && inventory.MatchboxURL == "" {
+			problems = append(problems, fmt.Sprintf("profile %s: matchbox_url is required to reference configs", name))
+		}
+	}
+
+	names := make(map[string]bool)
+	selectors := make(map[string]string)
+	for i := range inventory.Machines {
+		machine := &inventory.Machines[i]
+		switch {
+		case machine.Name == "":
+			problems = append(problems, fmt.Sprintf("machine %d: name is required", i+1))
+			continue
+		case !validID(machine.Name):
+			problems = append(problems, fmt.Sprintf("machine %q: name must be letters, digits, '-', '_' or '.'", machine.Name))
+		case names[machine.Name]:
+			problems = append(problems, fmt.Sprintf("machine %s: duplicate name", machine.Name))
+		}
+		names[machine.Name] = true
+
+		if _, ok := inventory.Profiles[machine.Profile]; !ok {
+			problems = append(problems, fmt.Sprintf("machine %s: unknown profile %q", machine.Name, machine.Profile))
+		}
+		if machine.MAC == "" && machine.UUID == "" {
+			problems = append(problems, fmt.Sprintf("machine %s: needs a mac or uuid selector", machine.Name))
+		}
+		if machine.MAC != "" {
+			mac, err := net.ParseMAC(machine.MAC)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("machine %s: %v", machine.Name, err))
+			} else {
+				// matchbox compares MACs in this form
+				machine.MAC = mac.String()
+			}
+		}
+		machine.UUID = strings.ToLower(machine.UUID)
+
+		selector := machine.MAC + "/" + machine.UUID
+		if other, ok := selectors[selector]; ok {
+			problems = append(problems, fmt.Sprintf("machine %s: same selector as %s", machine.Name, other))
+		}
+		selectors[selector] = machine.Name
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid inventory:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return &inventory, nil
+}
+
+// validID reports whether name is safe as a matchbox ID and file name
+func validID(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
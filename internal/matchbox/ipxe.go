@@ -0,0 +1,134 @@
+package matchbox
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// BootScript is what matchbox serves at /boot.ipxe: it chains to /ipxe with
+// the labels groups select on
+const BootScript = "#!ipxe\nchain ipxe?uuid=${uuid}&mac=${mac:hexhyp}&domain=${domain}&hostname=${hostname}&serial=${serial}\n"
+
+// IPXEScript is the script matchbox renders at /ipxe for a profile
+func IPXEScript(profile *Profile) string {
+	var b strings.Builder
+	b.WriteString("#!ipxe\nkernel ")
+	b.WriteString(profile.Boot.Kernel)
+	for _, arg := range profile.Boot.Args {
+		b.WriteString(" " + arg)
+	}
+	b.WriteString("\n")
+	for _, initrd := range profile.Boot.Initrd {
+		b.WriteString("initrd " + initrd + "\n")
+	}
+	b.WriteString("boot\n")
+	return b.String()
+}
+
+// NormalizeLabels puts request labels in the form matchbox compares them:
+// MAC addresses colon-separated and lower case, UUIDs lower case
+func NormalizeLabels(labels url.Values) map[string]string {
+	normalized := make(map[string]string)
+	for key := range labels {
+		value := labels.Get(key)
+		switch key {
+		case "mac":
+			if mac, err := net.ParseMAC(value); err == nil {
+				value = mac.String()
+			}
+		case "uuid":
+			value = strings.ToLower(value)
+		}
+		normalized[key] = value
+	}
+	return normalized
+}
+
+// Select picks the group matchbox would serve for labels: of the groups
+// whose selectors all match, the one with the most selectors, ties going to
+// the highest ID
+func (l *Layout) Select(labels map[string]string) (*Group, bool) {
+	var matches []*Group
+	for i := range l.Groups {
+		group := &l.Groups[i]
+		matched := true
+		for key, value := range group.Selector {
+			if labels[key] != value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			matches = append(matches, group)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, false
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if len(matches[i].Selector) != len(matches[j].Selector) {
+			return len(matches[i].Selector) > len(matches[j].Selector)
+		}
+		return matches[i].ID > matches[j].ID
+	})
+	return matches[0], true
+}
+
+// Client reads matchbox's unauthenticated HTTP endpoints
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a client for a matchbox HTTP endpoint such as
+// http://10.17.13.251:8080
+func NewClient(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), HTTPClient: http.DefaultClient}
+}
+
+// BootScript fetches /boot.ipxe
+func (c *Client) BootScript() (string, error) {
+	return c.get("/boot.ipxe", nil)
+}
+
+// IPXE fetches the iPXE script for a machine's labels, e.g. its mac
+func (c *Client) IPXE(labels url.Values) (string, error) {
+	return c.get("/ipxe", labels)
+}
+
+// Generic fetches the generic config, such as a Talos machine config, for
+// a machine's labels
+func (c *Client) Generic(labels url.Values) (string, error) {
+	return c.get("/generic", labels)
+}
+
+// Ignition fetches the Ignition config for a machine's labels
+func (c *Client) Ignition(labels url.Values) (string, error) {
+	return c.get("/ignition", labels)
+}
+
+func (c *Client) get(path string, query url.Values) (string, error) {
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	resp, err := c.HTTPClient.Get(target)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned status %d: %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return string(body), nil
+}
@@ -0,0 +1,257 @@
+package matchbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Profile is a matchbox profile as stored in profiles/<id>.json
+type Profile struct {
+	ID         string `json:"id"`
+	Name       string `json:"name,omitempty"`
+	Boot       Boot   `json:"boot"`
+	IgnitionID string `json:"ignition_id,omitempty"`
+	GenericID  string `json:"generic_id,omitempty"`
+}
+
+// Boot is the kernel, initrds and kernel arguments a profile network boots
+type Boot struct {
+	Kernel string   `json:"kernel"`
+	Initrd []string `json:"initrd,omitempty"`
+	Args   []string `json:"args,omitempty"`
+}
+
+// Group is a matchbox group as stored in groups/<id>.json; it gives machines
+// matching Selector its profile
+type Group struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name,omitempty"`
+	Profile  string            `json:"profile"`
+	Selector map[string]string `json:"selector,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Layout is the contents of matchbox's data directory, /var/lib/matchbox in
+// the container. Assets are not part of it; kernels and initrds are
+// downloaded into assets/ separately.
+type Layout struct {
+	Profiles []Profile
+	Groups   []Group
+	// Ignition and Generic map config IDs to the files in ignition/ and
+	// generic/
+	Ignition map[string][]byte
+	Generic  map[string][]byte
+}
+
+// Generate builds the layout for an inventory: a profile per inventory
+// profile and a group per machine. Configs are read from the files the
+// profiles reference.
+func Generate(inventory *Inventory) (*Layout, error) {
+	layout := &Layout{
+		Ignition: make(map[string][]byte),
+		Generic:  make(map[string][]byte),
+	}
+	for _, name := range sortedKeys(inventory.Profiles) {
+		spec := inventory.Profiles[name]
+		profile := Profile{
+			ID:   name,
+			Name: name,
+			Boot: Boot{Kernel: spec.Kernel, Initrd: spec.Initrd, Args: append([]string(nil), spec.Args...)},
+		}
+		base := strings.TrimSuffix(inventory.MatchboxURL, "/")
+		if spec.TalosConfig != "" {
+			data, err := inventory.readConfig(spec.TalosConfig)
+			if err != nil {
+				return nil, fmt.Errorf("profile %s: %w", name, err)
+			}
+			profile.GenericID = name + path.Ext(spec.TalosConfig)
+			layout.Generic[profile.GenericID] = data
+			profile.Boot.Args = withArg(profile.Boot.Args, "talos.config", base+"/generic?mac=${mac:hexhyp}")
+		}
+		if spec.Ignition != "" {
+			data, err := inventory.readConfig(spec.Ignition)
+			if err != nil {
+				return nil, fmt.Errorf("profile %s: %w", name, err)
+			}
+			profile.IgnitionID = name + path.Ext(spec.Ignition)
+			layout.Ignition[profile.IgnitionID] = data
+			profile.Boot.Args = withArg(profile.Boot.Args, "ignition.config.url", base+"/ignition?uuid=${uuid}&mac=${mac:hexhyp}")
+		}
+		layout.Profiles = append(layout.Profiles, profile)
+	}
+
+	for _, machine := range inventory.Machines {
+		group := Group{
+			ID:       machine.Name,
+			Name:     machine.Name,
+			Profile:  machine.Profile,
+			Selector: make(map[string]string),
+			Metadata: machine.Metadata,
+		}
+		if machine.MAC != "" {
+			group.Selector["mac"] = machine.MAC
+		}
+		if machine.UUID != "" {
+			group.Selector["uuid"] = machine.UUID
+		}
+		layout.Groups = append(layout.Groups, group)
+	}
+	sort.Slice(layout.Groups, func(i, j int) bool { return layout.Groups[i].ID < layout.Groups[j].ID })
+	return layout, nil
+}
+
+// withArg appends key=value unless the profile already sets key
+func withArg(args []string, key, value string) []string {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, key+"=") {
+			return args
+		}
+	}
+	return append(args, key+"="+value)
+}
+
+func (inventory *Inventory) readConfig(name string) ([]byte, error) {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(inventory.dir, name)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	return data, nil
+}
+
+// Files renders the layout as files keyed by their slash-separated path in
+// the data directory
+func (l *Layout) Files() (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, profile := range l.Profiles {
+		data, err := marshal(profile)
+		if err != nil {
+			return nil, err
+		}
+		files["profiles/"+profile.ID+".json"] = data
+	}
+	for _, group := range l.Groups {
+		data, err := marshal(group)
+		if err != nil {
+			return nil, err
+		}
+		files["groups/"+group.ID+".json"] = data
+	}
+	for id, data := range l.Ignition {
+		files["ignition/"+id] = data
+	}
+	for id, data := range l.Generic {
+		files["generic/"+id] = data
+	}
+	return files, nil
+}
+
+// marshal encodes indented JSON, leaving the '&' in config URLs unescaped
+func marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return nil, fmt.Errorf("failed to encode %T: %w", v, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteTo writes the layout into a matchbox data directory, leaving files
+// it does not generate, such as assets, in place
+func (l *Layout) WriteTo(dir string) error {
+	files, err := l.Files()
+	if err != nil {
+		return err
+	}
+	for name, data := range files {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", filepath.Dir(target), err)
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", target, err)
+		}
+	}
+	return nil
+}
+
+// ReadLayout reads the profiles, groups and configs in a matchbox data
+// directory
+func ReadLayout(dir string) (*Layout, error) {
+	layout := &Layout{
+		Ignition: make(map[string][]byte),
+		Generic:  make(map[string][]byte),
+	}
+	profiles, err := readJSONDir[Profile](filepath.Join(dir, "profiles"))
+	if err != nil {
+		return nil, err
+	}
+	groups, err := readJSONDir[Group](filepath.Join(dir, "groups"))
+	if err != nil {
+		return nil, err
+	}
+	layout.Profiles, layout.Groups = profiles, groups
+	for sub, configs := range map[string]map[string][]byte{"ignition": layout.Ignition, "generic": layout.Generic} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read %s: %w", sub, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, sub, entry.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s/%s: %w", sub, entry.Name(), err)
+			}
+			configs[entry.Name()] = data
+		}
+	}
+	return layout, nil
+}
+
+func readJSONDir[T any](dir string) ([]T, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	var items []T
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Name(), err)
+		}
+		var item T
+		if err := json.Unmarshal(data, &item); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(dir, entry.Name()), err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Profile returns the profile with the given ID
+func (l *Layout) Profile(id string) (*Profile, bool) {
+	for i := range l.Profiles {
+		if l.Profiles[i].ID == id {
+			return &l.Profiles[i], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,244 @@
+package matchbox
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RPCClient manages profiles, groups and configs through matchbox's gRPC
+// API, which requires a TLS client certificate signed by matchbox's CA
+type RPCClient struct {
+	conn *grpc.ClientConn
+}
+
+// LoadClientTLS reads the CA certificate matchbox's server certificate is
+// signed by and the client's certificate and key
+func LoadClientTLS(caFile, certFile, keyFile string) (*tls.Config, error) {
+	var pems [3][]byte
+	for i, path := range []string{caFile, certFile, keyFile} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS file: %w", err)
+		}
+		pems[i] = data
+	}
+	return ClientTLS(pems[0], pems[1], pems[2])
+}
+
+// ClientTLS builds the TLS configuration for the gRPC API from PEM data
+func ClientTLS(caPEM, certPEM, keyPEM []byte) (*tls.Config, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("no CA certificates found")
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+	return &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// DialRPC connects to a matchbox gRPC endpoint such as 10.17.13.251:8081.
+// The connection is made lazily, so errors show up on the first call.
+func DialRPC(address string, tlsConfig *tls.Config) (*RPCClient, error) {
+	conn, err := grpc.Dial(address,
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(rawCodec{})))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to matchbox at %s: %w", address, err)
+	}
+	return &RPCClient{conn: conn}, nil
+}
+
+// Close closes the connection
+func (c *RPCClient) Close() error {
+	return c.conn.Close()
+}
+
+// ProfilePut creates or replaces a profile
+func (c *RPCClient) ProfilePut(ctx context.Context, profile *Profile) error {
+	_, err := c.invoke(ctx, "/rpcpb.Profiles/ProfilePut", appendMessage(nil, 1, profile.marshalProto()))
+	return err
+}
+
+// ProfileGet fetches a profile by ID
+func (c *RPCClient) ProfileGet(ctx context.Context, id string) (*Profile, error) {
+	resp, err := c.invoke(ctx, "/rpcpb.Profiles/ProfileGet", appendString(nil, 1, id))
+	if err != nil {
+		return nil, err
+	}
+	var profile Profile
+	err = parseFields(resp, func(num protowire.Number, value []byte) error {
+		if num == 1 {
+			return profile.unmarshalProto(value)
+		}
+		return nil
+	})
+	return &profile, err
+}
+
+// ProfileList lists every profile
+func (c *RPCClient) ProfileList(ctx context.Context) ([]Profile, error) {
+	resp, err := c.invoke(ctx, "/rpcpb.Profiles/ProfileList", nil)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []Profile
+	err = parseFields(resp, func(num protowire.Number, value []byte) error {
+		if num != 1 {
+			return nil
+		}
+		var profile Profile
+		if err := profile.unmarshalProto(value); err != nil {
+			return err
+		}
+		profiles = append(profiles, profile)
+		return nil
+	})
+	return profiles, err
+}
+
+// ProfileDelete deletes a profile by ID
+func (c *RPCClient) ProfileDelete(ctx context.Context, id string) error {
+	_, err := c.invoke(ctx, "/rpcpb.Profiles/ProfileDelete", appendString(nil, 1, id))
+	return err
+}
+
+// GroupPut creates or replaces a group
+func (c *RPCClient) GroupPut(ctx context.Context, group *Group) error {
+	data, err := group.marshalProto()
+	if err != nil {
+		return err
+	}
+	_, err = c.invoke(ctx, "/rpcpb.Groups/GroupPut", appendMessage(nil, 1, data))
+	return err
+}
+
+// GroupGet fetches a group by ID
+func (c *RPCClient) GroupGet(ctx context.Context, id string) (*Group, error) {
+	resp, err := c.invoke(ctx, "/rpcpb.Groups/GroupGet", appendString(nil, 1, id))
+	if err != nil {
+		return nil, err
+	}
+	var group Group
+	err = parseFields(resp, func(num protowire.Number, value []byte) error {
+		if num == 1 {
+			return group.unmarshalProto(value)
+		}
+		return nil
+	})
+	return &group, err
+}
+
+// GroupList lists every group
+func (c *RPCClient) GroupList(ctx context.Context) ([]Group, error) {
+	resp, err := c.invoke(ctx, "/rpcpb.Groups/GroupList", nil)
+	if err != nil {
+		return nil, err
+	}
+	var groups []Group
+	err = parseFields(resp, func(num protowire.Number, value []byte) error {
+		if num != 1 {
+			return nil
+		}
+		var group Group
+		if err := group.unmarshalProto(value); err != nil {
+			return err
+		}
+		groups = append(groups, group)
+		return nil
+	})
+	return groups, err
+}
+
+// GroupDelete deletes a group by ID
+func (c *RPCClient) GroupDelete(ctx context.Context, id string) error {
+	_, err := c.invoke(ctx, "/rpcpb.Groups/GroupDelete", appendString(nil, 1, id))
+	return err
+}
+
+// GenericPut stores a generic config, such as a Talos machine config
+func (c *RPCClient) GenericPut(ctx context.Context, name string, config []byte) error {
+	_, err := c.invoke(ctx, "/rpcpb.Generic/GenericPut", appendMessage(appendString(nil, 1, name), 2, config))
+	return err
+}
+
+// IgnitionPut stores an Ignition config
+func (c *RPCClient) IgnitionPut(ctx context.Context, name string, config []byte) error {
+	_, err := c.invoke(ctx, "/rpcpb.Ignition/IgnitionPut", appendMessage(appendString(nil, 1, name), 2, config))
+	return err
+}
+
+// Apply stores a generated layout: configs first, then the profiles that
+// reference them, then the groups that select the profiles
+func (c *RPCClient) Apply(ctx context.Context, layout *Layout) error {
+	for _, name := range sortedKeys(layout.Generic) {
+		if err := c.GenericPut(ctx, name, layout.Generic[name]); err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedKeys(layout.Ignition) {
+		if err := c.IgnitionPut(ctx, name, layout.Ignition[name]); err != nil {
+			return err
+		}
+	}
+	for i := range layout.Profiles {
+		if err := c.ProfilePut(ctx, &layout.Profiles[i]); err != nil {
+			return err
+		}
+	}
+	for i := range layout.Groups {
+		if err := c.GroupPut(ctx, &layout.Groups[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *RPCClient) invoke(ctx context.Context, method string, request []byte) ([]byte, error) {
+	var response rawMessage
+	if err := c.conn.Invoke(ctx, method, rawMessage(request), &response); err != nil {
+		return nil, fmt.Errorf("%s failed: %w", method, err)
+	}
+	return response, nil
+}
+
+// rawMessage is an already encoded protobuf message
+type rawMessage []byte
+
+// rawCodec passes encoded messages through as-is. It is named "proto" so
+// the server sees an ordinary application/grpc+proto request.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	message, ok := v.(rawMessage)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	return message, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	message, ok := v.(*rawMessage)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	*message = append((*message)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,175 @@
+package matchbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Protobuf encodings of matchbox's storagepb messages. Field numbers follow
+// matchbox's storage.proto:
+//
+//	message Profile { string id = 1; string name = 2; NetBoot boot = 3;
+//	                  string ignition_id = 5; string generic_id = 6; }
+//	message NetBoot { string kernel = 1; repeated string initrd = 2;
+//	                  repeated string args = 4; }
+//	message Group   { string id = 1; string name = 2; string profile = 3;
+//	                  map<string, string> selector = 4; bytes metadata = 5; }
+
+func appendString(b []byte, num protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+func appendMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+func (p *Profile) marshalProto() []byte {
+	var boot []byte
+	boot = appendString(boot, 1, p.Boot.Kernel)
+	for _, initrd := range p.Boot.Initrd {
+		boot = protowire.AppendTag(boot, 2, protowire.BytesType)
+		boot = protowire.AppendString(boot, initrd)
+	}
+	for _, arg := range p.Boot.Args {
+		boot = protowire.AppendTag(boot, 4, protowire.BytesType)
+		boot = protowire.AppendString(boot, arg)
+	}
+
+	var b []byte
+	b = appendString(b, 1, p.ID)
+	b = appendString(b, 2, p.Name)
+	b = appendMessage(b, 3, boot)
+	b = appendString(b, 5, p.IgnitionID)
+	b = appendString(b, 6, p.GenericID)
+	return b
+}
+
+func (p *Profile) unmarshalProto(data []byte) error {
+	return parseFields(data, func(num protowire.Number, value []byte) error {
+		switch num {
+		case 1:
+			p.ID = string(value)
+		case 2:
+			p.Name = string(value)
+		case 3:
+			return parseFields(value, func(num protowire.Number, value []byte) error {
+				switch num {
+				case 1:
+					p.Boot.Kernel = string(value)
+				case 2:
+					p.Boot.Initrd = append(p.Boot.Initrd, string(value))
+				case 4:
+					p.Boot.Args = append(p.Boot.Args, string(value))
+				}
+				return nil
+			})
+		case 5:
+			p.IgnitionID = string(value)
+		case 6:
+			p.GenericID = string(value)
+		}
+		return nil
+	})
+}
+
+func (g *Group) marshalProto() ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, g.ID)
+	b = appendString(b, 2, g.Name)
+	b = appendString(b, 3, g.Profile)
+	keys := make([]string, 0, len(g.Selector))
+	for key := range g.Selector {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var entry []byte
+		entry = appendString(entry, 1, key)
+		entry = appendString(entry, 2, g.Selector[key])
+		b = appendMessage(b, 4, entry)
+	}
+	// matchbox stores group metadata as a JSON object
+	if len(g.Metadata) > 0 {
+		metadata, err := json.Marshal(g.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("group %s: failed to encode metadata: %w", g.ID, err)
+		}
+		b = appendMessage(b, 5, metadata)
+	}
+	return b, nil
+}
+
+func (g *Group) unmarshalProto(data []byte) error {
+	return parseFields(data, func(num protowire.Number, value []byte) error {
+		switch num {
+		case 1:
+			g.ID = string(value)
+		case 2:
+			g.Name = string(value)
+		case 3:
+			g.Profile = string(value)
+		case 4:
+			var key, entryValue string
+			err := parseFields(value, func(num protowire.Number, value []byte) error {
+				switch num {
+				case 1:
+					key = string(value)
+				case 2:
+					entryValue = string(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if g.Selector == nil {
+				g.Selector = make(map[string]string)
+			}
+			g.Selector[key] = entryValue
+		case 5:
+			if len(value) > 0 {
+				if err := json.Unmarshal(value, &g.Metadata); err != nil {
+					return fmt.Errorf("group %s: failed to decode metadata: %w", g.ID, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// parseFields calls fn with each length-delimited field of a message,
+// skipping fields of other wire types
+func parseFields(data []byte, fn func(num protowire.Number, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return fmt.Errorf("invalid protobuf message: %w", protowire.ParseError(n))
+		}
+		data = data[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return fmt.Errorf("invalid protobuf field %d: %w", num, protowire.ParseError(n))
+			}
+			data = data[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return fmt.Errorf("invalid protobuf field %d: %w", num, protowire.ParseError(n))
+		}
+		data = data[n:]
+		if err := fn(num, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
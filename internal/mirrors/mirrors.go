@@ -0,0 +1,158 @@
+// Package mirrors turns the registry caches an environment deploys into
+// client configuration: Docker's daemon.json, containerd's hosts.toml
+// directories and a Talos machine config patch.
+package mirrors
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yebyen/home-lab-terraform/internal/registry"
+	"gopkg.in/yaml.v3"
+)
+
+// Mirror is a registry cache as clients should address it
+type Mirror struct {
+	// Registry is the upstream clients pull from, e.g. docker.io
+	Registry string
+	// Upstream is the upstream's API URL, e.g. https://registry-1.docker.io
+	Upstream string
+	// Endpoint is the cache's URL, e.g. http://10.17.13.10:5050
+	Endpoint string
+}
+
+// FromCaches builds one mirror per cache. The caches report endpoints as
+// localhost:PORT, which only works on the Docker host itself, so host
+// replaces localhost when set.
+func FromCaches(caches []registry.Cache, host string) ([]Mirror, error) {
+	var mirrors []Mirror
+	for _, cache := range caches {
+		cacheHost, port, err := net.SplitHostPort(cache.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("cache %s: invalid endpoint %q: %w", cache.Name, cache.Endpoint, err)
+		}
+		if host != "" && (cacheHost == "localhost" || cacheHost == "127.0.0.1") {
+			cacheHost = host
+		}
+		if cache.Upstream == "" {
+			return nil, fmt.Errorf("cache %s has no upstream", cache.Name)
+		}
+		if cache.Registry == "" {
+			return nil, fmt.Errorf("cache %s has no upstream_registry", cache.Name)
+		}
+		mirrors = append(mirrors, Mirror{
+			Registry: cache.Registry,
+			Upstream: cache.Upstream,
+			Endpoint: "http://" + net.JoinHostPort(cacheHost, port),
+		})
+	}
+	sort.Slice(mirrors, func(i, j int) bool { return mirrors[i].Registry < mirrors[j].Registry })
+	return mirrors, nil
+}
+
+// hostPort is the endpoint without its scheme, as insecure-registries wants
+func (m Mirror) hostPort() string {
+	return strings.TrimPrefix(strings.TrimPrefix(m.Endpoint, "http://"), "https://")
+}
+
+// DockerDaemon renders the daemon.json keys for the mirrors. Docker only
+// mirrors Docker Hub, so the other caches are listed as insecure registries
+// to be pulled from by name.
+func DockerDaemon(mirrors []Mirror) ([]byte, error) {
+	config := struct {
+		RegistryMirrors    []string `json:"registry-mirrors"`
+		InsecureRegistries []string `json:"insecure-registries"`
+	}{RegistryMirrors: []string{}, InsecureRegistries: []string{}}
+
+	for _, mirror := range mirrors {
+		if mirror.Registry == "docker.io" {
+			config.RegistryMirrors = append(config.RegistryMirrors, mirror.Endpoint)
+		}
+		if strings.HasPrefix(mirror.Endpoint, "http://") {
+			config.InsecureRegistries = append(config.InsecureRegistries, mirror.hostPort())
+		}
+	}
+
+	sort.Strings(config.InsecureRegistries)
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal daemon.json: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// ContainerdHosts renders a hosts.toml per registry, keyed by its path under
+// containerd's config_path, e.g. "docker.io/hosts.toml"
+func ContainerdHosts(mirrors []Mirror) map[string][]byte {
+	files := make(map[string][]byte)
+	for _, mirror := range mirrors {
+		var b strings.Builder
+		fmt.Fprintf(&b, "server = %s\n", strconv.Quote(mirror.Upstream))
+		fmt.Fprintln(&b)
+		fmt.Fprintf(&b, "[host.%s]\n", strconv.Quote(mirror.Endpoint))
+		fmt.Fprintln(&b, `  capabilities = ["pull", "resolve"]`)
+		files[mirror.Registry+"/hosts.toml"] = []byte(b.String())
+	}
+	return files
+}
+
+// TalosPatch renders a machine config patch pointing each registry at its
+// mirror
+func TalosPatch(mirrors []Mirror) ([]byte, error) {
+	type talosMirror struct {
+		Endpoints []string `yaml:"endpoints"`
+	}
+	registries := make(map[string]*talosMirror)
+	for _, mirror := range mirrors {
+		if registries[mirror.Registry] == nil {
+			registries[mirror.Registry] = &talosMirror{}
+		}
+		registries[mirror.Registry].Endpoints = append(registries[mirror.Registry].Endpoints, mirror.Endpoint)
+	}
+	patch := map[string]interface{}{
+		"machine": map[string]interface{}{
+			"registries": map[string]interface{}{"mirrors": registries},
+		},
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(patch); err != nil {
+		return nil, fmt.Errorf("failed to marshal Talos patch: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to marshal Talos patch: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Files renders every format, keyed by path relative to an output
+// directory: daemon.json, containerd/certs.d/<registry>/hosts.toml and
+// talos-registries.yaml
+func Files(mirrors []Mirror) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+
+	daemon, err := DockerDaemon(mirrors)
+	if err != nil {
+		return nil, err
+	}
+	files["daemon.json"] = daemon
+
+	for path, data := range ContainerdHosts(mirrors) {
+		files["containerd/certs.d/"+path] = data
+	}
+
+	talos, err := TalosPatch(mirrors)
+	if err != nil {
+		return nil, err
+	}
+	files["talos-registries.yaml"] = talos
+	return files, nil
+}
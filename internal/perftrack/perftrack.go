@@ -0,0 +1,195 @@
+// Package perftrack keeps a history of test suite timings and flags
+// regressions against a rolling baseline. Timings come from `go test
+// -json` output, including the environment phases (terraform init, apply,
+// readiness wait, assertions, destroy) the test harness logs as markers.
+package perftrack
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Run is one test suite run
+type Run struct {
+	Started time.Time `json:"started"`
+	// Commit is the git revision tested, if known
+	Commit string `json:"commit,omitempty"`
+	// Total is the wall clock time of the slowest package
+	Total time.Duration          `json:"total_ns"`
+	Tests map[string]*TestTiming `json:"tests"`
+	// FailedPackages are the packages whose tests failed, including build
+	// failures and panics that leave no test outcome behind
+	FailedPackages []string `json:"failed_packages,omitempty"`
+}
+
+// TestTiming is one test's duration and outcome
+type TestTiming struct {
+	// Outcome is pass, fail or skip
+	Outcome  string                   `json:"outcome"`
+	Duration time.Duration            `json:"duration_ns"`
+	Phases   map[string]time.Duration `json:"phases_ns,omitempty"`
+}
+
+// PhaseTotals add up each phase across the run's tests, showing where
+// the suite spends its time
+func (r *Run) PhaseTotals() map[string]time.Duration {
+	totals := make(map[string]time.Duration)
+	for _, timing := range r.Tests {
+		for phase, d := range timing.Phases {
+			totals[phase] += d
+		}
+	}
+	return totals
+}
+
+// FailedTests lists the failed tests, leaving out subtests since their
+// parents fail with them
+func (r *Run) FailedTests() []string {
+	var failed []string
+	for name, timing := range r.Tests {
+		if timing.Outcome == "fail" && !strings.Contains(name, "/") {
+			failed = append(failed, name)
+		}
+	}
+	slices.Sort(failed)
+	return failed
+}
+
+// History is the runs recorded so far, oldest first
+type History struct {
+	Runs []*Run `json:"runs"`
+}
+
+// Load reads a history file; a missing file is an empty history
+func Load(path string) (*History, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &History{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	var history History
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("failed to parse history %s: %w", path, err)
+	}
+	return &history, nil
+}
+
+// Save writes the history, keeping at most keep runs (all if keep <= 0)
+func (h *History) Save(path string, keep int) error {
+	if keep > 0 && len(h.Runs) > keep {
+		h.Runs = h.Runs[len(h.Runs)-keep:]
+	}
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal history: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// Baseline is the median timing of each test and phase over recent runs.
+// The suite total is keyed by TotalKey.
+type Baseline map[string]time.Duration
+
+// TotalKey is the baseline key of the suite's wall clock time
+const TotalKey = "(total)"
+
+// Key names a test's phase in a baseline; an empty phase is the whole test
+func Key(test, phase string) string {
+	if phase == "" {
+		return test
+	}
+	return test + " [" + phase + "]"
+}
+
+// Baseline computes medians over the last window runs (all if window <=
+// 0). Only passing tests count: failures stop early and skips take no time.
+func (h *History) Baseline(window int) Baseline {
+	runs := h.Runs
+	if window > 0 && len(runs) > window {
+		runs = runs[len(runs)-window:]
+	}
+	samples := make(map[string][]time.Duration)
+	for _, run := range runs {
+		samples[TotalKey] = append(samples[TotalKey], run.Total)
+		for name, timing := range run.Tests {
+			if timing.Outcome != "pass" {
+				continue
+			}
+			samples[name] = append(samples[name], timing.Duration)
+			for phase, d := range timing.Phases {
+				samples[Key(name, phase)] = append(samples[Key(name, phase)], d)
+			}
+		}
+	}
+
+	baseline := make(Baseline)
+	for key, durations := range samples {
+		slices.Sort(durations)
+		baseline[key] = durations[len(durations)/2]
+	}
+	return baseline
+}
+
+// Thresholds decide what counts as a regression
+type Thresholds struct {
+	// Ratio is how many times slower than the baseline is too slow, e.g. 1.2
+	Ratio float64
+	// MinDelta ignores slowdowns smaller than this, which are noise
+	MinDelta time.Duration
+}
+
+// Regression is a test, phase or suite total slower than its baseline
+type Regression struct {
+	Key      string
+	Baseline time.Duration
+	Current  time.Duration
+}
+
+// Ratio is how many times slower than the baseline the run was
+func (r Regression) Ratio() float64 {
+	return float64(r.Current) / float64(r.Baseline)
+}
+
+// Compare finds what in run is slower than baseline beyond the thresholds,
+// worst first. Tests and phases without a baseline are new and not flagged.
+func Compare(run *Run, baseline Baseline, thresholds Thresholds) []Regression {
+	var regressions []Regression
+	check := func(key string, current time.Duration) {
+		base, ok := baseline[key]
+		if !ok || base <= 0 {
+			return
+		}
+		if current-base >= thresholds.MinDelta && float64(current) > thresholds.Ratio*float64(base) {
+			regressions = append(regressions, Regression{Key: key, Baseline: base, Current: current})
+		}
+	}
+
+	check(TotalKey, run.Total)
+	for name, timing := range run.Tests {
+		if timing.Outcome != "pass" {
+			continue
+		}
+		check(name, timing.Duration)
+		for phase, d := range timing.Phases {
+			check(Key(name, phase), d)
+		}
+	}
+	slices.SortFunc(regressions, func(a, b Regression) int {
+		if c := cmp.Compare(b.Ratio(), a.Ratio()); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	return regressions
+}
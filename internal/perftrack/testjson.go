@@ -0,0 +1,124 @@
+package perftrack
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Phases of a test environment's lifetime, in order
+const (
+	PhaseInit       = "init"
+	PhaseApply      = "apply"
+	PhaseReady      = "ready"
+	PhaseAssertions = "assertions"
+	PhaseDestroy    = "destroy"
+)
+
+// Phases are the phases in report order
+var Phases = []string{PhaseInit, PhaseApply, PhaseReady, PhaseAssertions, PhaseDestroy}
+
+// Marker formats a phase timing for a test log, e.g. with t.Log, where
+// ParseTestJSON finds it in `go test -json` output and attributes it to
+// the test that logged it
+func Marker(phase string, elapsed time.Duration) string {
+	return fmt.Sprintf("perftrack phase=%s elapsed=%s", phase, elapsed.Round(time.Millisecond))
+}
+
+var markerPattern = regexp.MustCompile(`perftrack phase=(\w+) elapsed=(\S+)`)
+
+// testEvent is a line of `go test -json` output (see go doc test2json)
+type testEvent struct {
+	Time    time.Time
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// ParseTestJSON reads `go test -json` output into a run. Tests are keyed
+// by package and name, e.g. "tests.TestPiholeModule/Basic". Phase markers
+// repeated within a test, e.g. from several environments, add up.
+func ParseTestJSON(r io.Reader) (*Run, error) {
+	run := &Run{Tests: make(map[string]*TestTiming)}
+	packages := make(map[string]time.Duration)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(text, "{") {
+			continue // build output interleaved with the events
+		}
+		var event testEvent
+		if err := json.Unmarshal([]byte(text), &event); err != nil {
+			return nil, fmt.Errorf("line %d: failed to parse test event: %w", line, err)
+		}
+		if run.Started.IsZero() || (!event.Time.IsZero() && event.Time.Before(run.Started)) {
+			run.Started = event.Time
+		}
+
+		elapsed := time.Duration(event.Elapsed * float64(time.Second))
+		if event.Test == "" {
+			if event.Action == "pass" || event.Action == "fail" {
+				packages[event.Package] = elapsed
+			}
+			if event.Action == "fail" {
+				run.FailedPackages = append(run.FailedPackages, event.Package)
+			}
+			continue
+		}
+
+		key := testKey(event.Package, event.Test)
+		timing := run.Tests[key]
+		if timing == nil {
+			timing = &TestTiming{}
+			run.Tests[key] = timing
+		}
+		switch event.Action {
+		case "pass", "fail", "skip":
+			timing.Outcome = event.Action
+			timing.Duration = elapsed
+		case "output":
+			match := markerPattern.FindStringSubmatch(event.Output)
+			if match == nil {
+				continue
+			}
+			d, err := time.ParseDuration(match[2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid phase timing %q: %w", line, match[2], err)
+			}
+			if timing.Phases == nil {
+				timing.Phases = make(map[string]time.Duration)
+			}
+			timing.Phases[match[1]] += d
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read test events: %w", err)
+	}
+
+	// Packages are tested concurrently; the slowest bounds the wall clock
+	for _, elapsed := range packages {
+		run.Total = max(run.Total, elapsed)
+	}
+	for key, timing := range run.Tests {
+		if timing.Outcome == "" {
+			delete(run.Tests, key) // still running when the output ended
+		}
+	}
+	if len(run.Tests) == 0 {
+		return nil, fmt.Errorf("no test results in input; run go test with -json")
+	}
+	return run, nil
+}
+
+// testKey names a test by the last element of its package path
+func testKey(pkg, test string) string {
+	return pkg[strings.LastIndex(pkg, "/")+1:] + "." + test
+}
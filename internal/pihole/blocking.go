@@ -0,0 +1,55 @@
+package pihole
+
+import (
+	"fmt"
+	"time"
+)
+
+// Blocking represents the DNS blocking state reported by /api/dns/blocking
+type Blocking struct {
+	// Status is "enabled", "disabled", "failed" or "unknown"
+	Status string `json:"blocking"`
+	// Timer is the number of seconds until the state reverts, nil if permanent
+	Timer *float64 `json:"timer"`
+}
+
+// Enabled reports whether blocking is currently active
+func (b Blocking) Enabled() bool {
+	return b.Status == "enabled"
+}
+
+// Remaining returns how long until the blocking state reverts, or zero if
+// the current state is permanent
+func (b Blocking) Remaining() time.Duration {
+	if b.Timer == nil {
+		return 0
+	}
+	return time.Duration(*b.Timer * float64(time.Second))
+}
+
+// GetBlocking retrieves the current DNS blocking state
+func (s *Session) GetBlocking() (*Blocking, error) {
+	var blocking Blocking
+	if err := s.doJSON("GET", "/api/dns/blocking", nil, &blocking); err != nil {
+		return nil, fmt.Errorf("failed to get blocking state: %w", err)
+	}
+	return &blocking, nil
+}
+
+// SetBlocking enables or disables DNS blocking. A non-zero timer makes the
+// change temporary: Pi-hole reverts to the opposite state once it expires.
+func (s *Session) SetBlocking(enabled bool, timer time.Duration) (*Blocking, error) {
+	payload := map[string]interface{}{
+		"blocking": enabled,
+		"timer":    nil,
+	}
+	if timer > 0 {
+		payload["timer"] = timer.Seconds()
+	}
+
+	var blocking Blocking
+	if err := s.doJSON("POST", "/api/dns/blocking", payload, &blocking); err != nil {
+		return nil, fmt.Errorf("failed to set blocking state: %w", err)
+	}
+	return &blocking, nil
+}
@@ -0,0 +1,74 @@
+package pihole
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// ReadClientsFile loads client definitions (name, IP, MAC, groups, comment)
+// from a JSON array, the format the homelab CLI uses for the hand-maintained
+// device list
+func ReadClientsFile(path string) ([]Client, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read clients file: %w", err)
+	}
+
+	var clients []Client
+	if err := json.Unmarshal(data, &clients); err != nil {
+		return nil, fmt.Errorf("failed to parse clients file %s: %w", path, err)
+	}
+	return clients, nil
+}
+
+// WriteClientsFile stores client definitions in the format ReadClientsFile reads
+func WriteClientsFile(path string, clients []Client) error {
+	data, err := json.MarshalIndent(clients, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal clients: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write clients file: %w", err)
+	}
+	return nil
+}
+
+// ClientsFromConfigured turns /api/clients entries into IP/MAC client
+// definitions. Pi-hole stores one entry per identifier, so a device added
+// by IP and by MAC address is two entries; they are paired by name, or by
+// comment when the name is empty, which then also names the client.
+// Hostname, subnet and interface entries identify no single address and
+// are left out.
+func ClientsFromConfigured(configured []ConfiguredClient) []Client {
+	var clients []Client
+	index := make(map[string]int)
+	for _, entry := range configured {
+		key := entry.Name
+		if key == "" {
+			key = entry.Comment
+		}
+		i, ok := index[key]
+		if !ok || key == "" {
+			clients = append(clients, Client{ID: entry.ID, Name: key, Groups: entry.Groups, Comment: entry.Comment})
+			i = len(clients) - 1
+			index[key] = i
+		}
+		switch {
+		case net.ParseIP(entry.Client) != nil:
+			clients[i].IP = entry.Client
+		case isMAC(entry.Client):
+			clients[i].MAC = strings.ToLower(entry.Client)
+		}
+	}
+
+	paired := clients[:0]
+	for _, client := range clients {
+		if client.IP != "" || client.MAC != "" {
+			paired = append(paired, client)
+		}
+	}
+	return paired
+}
@@ -0,0 +1,174 @@
+package pihole
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Config is the subset of FTL's /api/config tree this home lab manages.
+//
+// Every field is a pointer so the same type serves as a patch: fields left
+// nil are omitted from the JSON and therefore left untouched by PatchConfig.
+type Config struct {
+	DNS       *DNSConfig       `json:"dns,omitempty"`
+	DHCP      *DHCPConfig      `json:"dhcp,omitempty"`
+	Webserver *WebserverConfig `json:"webserver,omitempty"`
+	Misc      *MiscConfig      `json:"misc,omitempty"`
+}
+
+// DNSConfig is the dns section of the FTL configuration
+type DNSConfig struct {
+	Upstreams        *[]string           `json:"upstreams,omitempty"`
+	ListeningMode    *string             `json:"listeningMode,omitempty"`
+	Interface        *string             `json:"interface,omitempty"`
+	Port             *int                `json:"port,omitempty"`
+	Domain           *string             `json:"domain,omitempty"`
+	DomainNeeded     *bool               `json:"domainNeeded,omitempty"`
+	ExpandHosts      *bool               `json:"expandHosts,omitempty"`
+	BogusPriv        *bool               `json:"bogusPriv,omitempty"`
+	DNSSEC           *bool               `json:"dnssec,omitempty"`
+	QueryLogging     *bool               `json:"queryLogging,omitempty"`
+	Hosts            *[]string           `json:"hosts,omitempty"`
+	CNAMERecords     *[]string           `json:"cnameRecords,omitempty"`
+	RevServers       *[]string           `json:"revServers,omitempty"`
+	BlockTTL         *int                `json:"blockTTL,omitempty"`
+	Blocking         *DNSBlockingConfig  `json:"blocking,omitempty"`
+	RateLimit        *DNSRateLimitConfig `json:"rateLimit,omitempty"`
+	CNAMEDeepInspect *bool               `json:"CNAMEdeepInspect,omitempty"`
+}
+
+// DNSBlockingConfig is dns.blocking
+type DNSBlockingConfig struct {
+	Active *bool `json:"active,omitempty"`
+	// Mode is one of NULL, IP-NODATA-AAAA, IP, NX or NODATA
+	Mode *string `json:"mode,omitempty"`
+}
+
+// DNSRateLimitConfig is dns.rateLimit
+type DNSRateLimitConfig struct {
+	Count    *int `json:"count,omitempty"`
+	Interval *int `json:"interval,omitempty"`
+}
+
+// DHCPConfig is the dhcp section of the FTL configuration
+type DHCPConfig struct {
+	Active               *bool     `json:"active,omitempty"`
+	Start                *string   `json:"start,omitempty"`
+	End                  *string   `json:"end,omitempty"`
+	Router               *string   `json:"router,omitempty"`
+	Netmask              *string   `json:"netmask,omitempty"`
+	LeaseTime            *string   `json:"leaseTime,omitempty"`
+	IPv6                 *bool     `json:"ipv6,omitempty"`
+	RapidCommit          *bool     `json:"rapidCommit,omitempty"`
+	Logging              *bool     `json:"logging,omitempty"`
+	IgnoreUnknownClients *bool     `json:"ignoreUnknownClients,omitempty"`
+	Hosts                *[]string `json:"hosts,omitempty"`
+}
+
+// WebserverConfig is the webserver section of the FTL configuration
+type WebserverConfig struct {
+	Domain  *string             `json:"domain,omitempty"`
+	ACL     *string             `json:"acl,omitempty"`
+	Port    *string             `json:"port,omitempty"`
+	Session *WebserverSession   `json:"session,omitempty"`
+	API     *WebserverAPIConfig `json:"api,omitempty"`
+}
+
+// WebserverSession is webserver.session
+type WebserverSession struct {
+	Timeout *int  `json:"timeout,omitempty"`
+	Restore *bool `json:"restore,omitempty"`
+}
+
+// WebserverAPIConfig is webserver.api. FTL never returns the password; it
+// reports "********" when one is set.
+type WebserverAPIConfig struct {
+	Password         *string `json:"password,omitempty"`
+	LocalAPIAuth     *bool   `json:"localAPIauth,omitempty"`
+	MaxSessions      *int    `json:"max_sessions,omitempty"`
+	PrettyJSON       *bool   `json:"prettyJSON,omitempty"`
+	AllowDestructive *bool   `json:"allow_destructive,omitempty"`
+	MaxHistory       *int    `json:"maxHistory,omitempty"`
+	MaxClients       *int    `json:"maxClients,omitempty"`
+}
+
+// MiscConfig is the misc section of the FTL configuration
+type MiscConfig struct {
+	PrivacyLevel *int      `json:"privacylevel,omitempty"`
+	DelayStartup *int      `json:"delay_startup,omitempty"`
+	Nice         *int      `json:"nice,omitempty"`
+	EtcDnsmasqD  *bool     `json:"etc_dnsmasq_d,omitempty"`
+	DnsmasqLines *[]string `json:"dnsmasq_lines,omitempty"`
+	ExtraLogging *bool     `json:"extraLogging,omitempty"`
+	ReadOnly     *bool     `json:"readOnly,omitempty"`
+}
+
+// Bool returns a pointer to v, for building Config patches
+func Bool(v bool) *bool { return &v }
+
+// String returns a pointer to v, for building Config patches
+func String(v string) *string { return &v }
+
+// Int returns a pointer to v, for building Config patches
+func Int(v int) *int { return &v }
+
+// Strings returns a pointer to a slice of values, for building Config patches
+func Strings(v ...string) *[]string {
+	if v == nil {
+		v = []string{}
+	}
+	return &v
+}
+
+// GetConfig retrieves the typed FTL configuration
+func (s *Session) GetConfig() (*Config, error) {
+	var result struct {
+		Config Config `json:"config"`
+	}
+	if err := s.doJSON("GET", "/api/config", nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+	return &result.Config, nil
+}
+
+// GetRawConfig retrieves the complete FTL configuration tree, including the
+// sections Config does not model
+func (s *Session) GetRawConfig() (map[string]interface{}, error) {
+	var result struct {
+		Config map[string]interface{} `json:"config"`
+	}
+	if err := s.doJSON("GET", "/api/config", nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+	return result.Config, nil
+}
+
+// PatchConfig applies the non-nil fields of patch and returns the resulting
+// configuration. Fields left nil keep their current value.
+func (s *Session) PatchConfig(patch *Config) (*Config, error) {
+	payload := map[string]interface{}{"config": patch}
+
+	var result struct {
+		Config Config `json:"config"`
+	}
+	if err := s.doJSON("PATCH", "/api/config", payload, &result); err != nil {
+		return nil, fmt.Errorf("failed to patch config: %w", err)
+	}
+	return &result.Config, nil
+}
+
+// LookupConfig finds a dotted key such as "dns.listeningMode" in a raw
+// configuration tree returned by GetRawConfig
+func LookupConfig(raw map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = raw
+	for _, key := range strings.Split(path, ".") {
+		section, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = section[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,161 @@
+package pihole
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DriftStatus classifies one entry of an env-vs-FTL configuration diff
+type DriftStatus string
+
+const (
+	// DriftMatch means FTL reports the value the environment variable sets
+	DriftMatch DriftStatus = "match"
+	// DriftMismatch means FTL reports a different value
+	DriftMismatch DriftStatus = "drift"
+	// DriftMissing means FTL has no key for the environment variable
+	DriftMissing DriftStatus = "missing"
+	// DriftWriteOnly means FTL hides the value (e.g. the API password)
+	DriftWriteOnly DriftStatus = "write-only"
+)
+
+// redactedValue is what FTL reports instead of a password
+const redactedValue = "********"
+
+// ConfigDrift compares one FTL setting made through the container
+// environment with what the running FTL reports
+type ConfigDrift struct {
+	Env      string
+	Path     string
+	Expected string
+	Actual   string
+	Status   DriftStatus
+}
+
+// legacyEnv maps pre-v6 docker image variables still set by the pihole module
+// to the FTL keys the image translates them into
+var legacyEnv = map[string]string{
+	"PIHOLE_DNS_": "dns.upstreams",
+}
+
+// DiffEnvConfig compares the FTLCONF_* (and legacy PIHOLE_DNS_) variables in
+// env, as set by terraform/modules/pihole, against a raw configuration tree
+// from GetRawConfig. env uses the KEY=value form of `docker inspect`.
+// Variables that are not FTL settings (TZ, PATH, ...) are ignored.
+func DiffEnvConfig(env []string, raw map[string]interface{}) []ConfigDrift {
+	var drifts []ConfigDrift
+
+	for _, entry := range env {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+
+		var path string
+		switch {
+		case legacyEnv[name] != "":
+			path = legacyEnv[name]
+		case strings.HasPrefix(name, "FTLCONF_"):
+			path = resolveEnvPath(raw, strings.Split(strings.TrimPrefix(name, "FTLCONF_"), "_"))
+		default:
+			continue
+		}
+
+		drift := ConfigDrift{Env: name, Path: path, Expected: value}
+		actual, found := LookupConfig(raw, path)
+		switch {
+		case !found:
+			drift.Status = DriftMissing
+		case actual == redactedValue:
+			drift.Actual = redactedValue
+			drift.Status = DriftWriteOnly
+		default:
+			drift.Actual = formatConfigValue(actual)
+			if configValuesEqual(value, actual) {
+				drift.Status = DriftMatch
+			} else {
+				drift.Status = DriftMismatch
+			}
+		}
+		drifts = append(drifts, drift)
+	}
+
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].Path < drifts[j].Path })
+	return drifts
+}
+
+// resolveEnvPath turns the underscore-separated segments of an FTLCONF_
+// variable into a dotted key. FTL keys may themselves contain underscores
+// (misc.delay_startup, webserver.api.max_sessions), so segments are joined
+// greedily against the keys present in raw. Unknown keys fall back to one
+// segment per level.
+func resolveEnvPath(raw map[string]interface{}, segments []string) string {
+	var keys []string
+	current := raw
+
+	for i := 0; i < len(segments); {
+		matched := 0
+		for j := len(segments); j > i; j-- {
+			candidate := strings.Join(segments[i:j], "_")
+			if _, ok := current[candidate]; ok {
+				keys = append(keys, candidate)
+				next, _ := current[candidate].(map[string]interface{})
+				current = next
+				matched = j - i
+				break
+			}
+		}
+		if matched == 0 {
+			keys = append(keys, segments[i:]...)
+			break
+		}
+		i += matched
+	}
+
+	return strings.Join(keys, ".")
+}
+
+// configValuesEqual compares an environment value with an FTL value. Arrays
+// are written as semicolon-separated lists in the environment, and FTL
+// accepts enum values case-insensitively.
+func configValuesEqual(expected string, actual interface{}) bool {
+	if list, ok := actual.([]interface{}); ok {
+		var values []string
+		for _, v := range strings.Split(expected, ";") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		if len(values) != len(list) {
+			return false
+		}
+		for i, v := range list {
+			if fmt.Sprint(v) != values[i] {
+				return false
+			}
+		}
+		return true
+	}
+	return strings.EqualFold(expected, formatConfigValue(actual))
+}
+
+// formatConfigValue renders an FTL value the way it would be written in an
+// environment variable
+func formatConfigValue(v interface{}) string {
+	switch value := v.(type) {
+	case []interface{}:
+		parts := make([]string, len(value))
+		for i, item := range value {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, ";")
+	case float64:
+		if value == float64(int64(value)) {
+			return fmt.Sprintf("%d", int64(value))
+		}
+		return fmt.Sprint(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
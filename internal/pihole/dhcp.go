@@ -0,0 +1,274 @@
+package pihole
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DHCPLease is an active lease from Pi-hole's built-in DHCP server, or from
+// any dnsmasq lease file (FTL embeds dnsmasq and shares its format)
+type DHCPLease struct {
+	// Expires is a Unix timestamp, 0 for infinite leases
+	Expires  int64  `json:"expires"`
+	Name     string `json:"name"`
+	HWAddr   string `json:"hwaddr"`
+	IP       string `json:"ip"`
+	ClientID string `json:"clientid"`
+}
+
+// ExpiresAt returns the lease expiry, or the zero time for infinite leases
+func (l DHCPLease) ExpiresAt() time.Time {
+	if l.Expires == 0 {
+		return time.Time{}
+	}
+	return time.Unix(l.Expires, 0)
+}
+
+// DHCPReservation is a static lease, stored by FTL in dhcp.hosts using the
+// dnsmasq dhcp-host syntax "MAC,IP,hostname"
+type DHCPReservation struct {
+	MAC      string `json:"mac"`
+	IP       string `json:"ip"`
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// String renders the reservation as a dhcp-host entry
+func (r DHCPReservation) String() string {
+	parts := []string{r.MAC, r.IP}
+	if r.Hostname != "" {
+		parts = append(parts, r.Hostname)
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseDHCPReservation parses a dhcp-host entry such as
+// "00:11:22:33:44:55,10.17.12.100,work-laptop"
+func ParseDHCPReservation(entry string) (DHCPReservation, error) {
+	var r DHCPReservation
+	for _, field := range strings.Split(entry, ",") {
+		field = strings.TrimSpace(field)
+		switch {
+		case field == "":
+		case isMAC(field):
+			r.MAC = strings.ToLower(field)
+		case net.ParseIP(field) != nil:
+			r.IP = field
+		default:
+			r.Hostname = field
+		}
+	}
+	if r.MAC == "" && r.IP == "" {
+		return r, fmt.Errorf("dhcp-host entry %q has neither a MAC nor an IP address", entry)
+	}
+	return r, nil
+}
+
+// GetDHCPConfig retrieves the dhcp section of the FTL configuration
+func (s *Session) GetDHCPConfig() (*DHCPConfig, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.DHCP == nil {
+		return &DHCPConfig{}, nil
+	}
+	return config.DHCP, nil
+}
+
+// PatchDHCPConfig applies the non-nil fields of patch to the dhcp section
+func (s *Session) PatchDHCPConfig(patch *DHCPConfig) (*DHCPConfig, error) {
+	config, err := s.PatchConfig(&Config{DHCP: patch})
+	if err != nil {
+		return nil, err
+	}
+	return config.DHCP, nil
+}
+
+// GetDHCPLeases retrieves the active leases of Pi-hole's DHCP server
+func (s *Session) GetDHCPLeases() ([]DHCPLease, error) {
+	var result struct {
+		Leases []DHCPLease `json:"leases"`
+	}
+	if err := s.doJSON("GET", "/api/dhcp/leases", nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to get DHCP leases: %w", err)
+	}
+	return result.Leases, nil
+}
+
+// DeleteDHCPLease removes the active lease for ip
+func (s *Session) DeleteDHCPLease(ip string) error {
+	if err := s.doJSON("DELETE", "/api/dhcp/leases/"+url.PathEscape(ip), nil, nil); err != nil {
+		return fmt.Errorf("failed to delete DHCP lease %s: %w", ip, err)
+	}
+	return nil
+}
+
+// GetDHCPReservations retrieves the static leases from dhcp.hosts
+func (s *Session) GetDHCPReservations() ([]DHCPReservation, error) {
+	dhcp, err := s.GetDHCPConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var reservations []DHCPReservation
+	if dhcp.Hosts == nil {
+		return reservations, nil
+	}
+	for _, entry := range *dhcp.Hosts {
+		r, err := ParseDHCPReservation(entry)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, r)
+	}
+	return reservations, nil
+}
+
+// SetDHCPReservation adds a static lease, replacing any existing
+// reservation for the same MAC address
+func (s *Session) SetDHCPReservation(reservation DHCPReservation) error {
+	reservations, err := s.GetDHCPReservations()
+	if err != nil {
+		return err
+	}
+
+	hosts := []string{}
+	for _, r := range reservations {
+		if !strings.EqualFold(r.MAC, reservation.MAC) {
+			hosts = append(hosts, r.String())
+		}
+	}
+	hosts = append(hosts, reservation.String())
+
+	_, err = s.PatchDHCPConfig(&DHCPConfig{Hosts: &hosts})
+	return err
+}
+
+// RemoveDHCPReservation removes the static lease for mac, if any
+func (s *Session) RemoveDHCPReservation(mac string) error {
+	reservations, err := s.GetDHCPReservations()
+	if err != nil {
+		return err
+	}
+
+	hosts := []string{}
+	for _, r := range reservations {
+		if !strings.EqualFold(r.MAC, mac) {
+			hosts = append(hosts, r.String())
+		}
+	}
+
+	_, err = s.PatchDHCPConfig(&DHCPConfig{Hosts: &hosts})
+	return err
+}
+
+// ParseDnsmasqLeases reads a dnsmasq lease file, e.g. the one the dnsmasq
+// module's container keeps at /var/lib/misc/dnsmasq.leases. Each line is
+// "<expiry> <mac> <ip> <hostname> <client-id>", with "*" for unknown fields.
+func ParseDnsmasqLeases(r io.Reader) ([]DHCPLease, error) {
+	var leases []DHCPLease
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "duid") {
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("lease file line %d: expected at least 3 fields, got %d", line, len(fields))
+		}
+
+		expires, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("lease file line %d: invalid expiry %q", line, fields[0])
+		}
+
+		lease := DHCPLease{Expires: expires, HWAddr: strings.ToLower(fields[1]), IP: fields[2]}
+		if len(fields) > 3 && fields[3] != "*" {
+			lease.Name = fields[3]
+		}
+		if len(fields) > 4 && fields[4] != "*" {
+			lease.ClientID = fields[4]
+		}
+		leases = append(leases, lease)
+	}
+	return leases, scanner.Err()
+}
+
+// LeaseStatus classifies a configured client against the lease table
+type LeaseStatus string
+
+const (
+	// LeaseOK means the client's MAC holds a lease for its configured IP
+	LeaseOK LeaseStatus = "ok"
+	// LeaseDrifted means the client's MAC holds a lease for a different IP
+	LeaseDrifted LeaseStatus = "drifted"
+	// LeaseConflict means the client's configured IP is leased to another MAC
+	LeaseConflict LeaseStatus = "conflict"
+	// LeaseMissing means no lease exists for the client's MAC
+	LeaseMissing LeaseStatus = "no-lease"
+)
+
+// LeaseCheck is one row of a client-vs-lease report
+type LeaseCheck struct {
+	Client  Client
+	Status  LeaseStatus
+	LeaseIP string
+	// LeaseMAC is the MAC holding the client's IP when Status is LeaseConflict
+	LeaseMAC string
+}
+
+// CheckClientLeases cross-checks configured Pi-hole clients (the IP/MAC
+// pairs passed to CreateClient) against a lease table, flagging devices
+// whose IP address drifted away from the one their group rules target.
+// Clients without both a MAC and an IP address cannot be checked and are
+// skipped.
+func CheckClientLeases(clients []Client, leases []DHCPLease) []LeaseCheck {
+	byMAC := make(map[string]DHCPLease)
+	byIP := make(map[string]DHCPLease)
+	for _, lease := range leases {
+		byMAC[strings.ToLower(lease.HWAddr)] = lease
+		byIP[lease.IP] = lease
+	}
+
+	var checks []LeaseCheck
+	for _, client := range clients {
+		if client.MAC == "" || client.IP == "" {
+			continue
+		}
+		check := LeaseCheck{Client: client}
+
+		lease, ok := byMAC[strings.ToLower(client.MAC)]
+		switch {
+		case ok && lease.IP == client.IP:
+			check.Status = LeaseOK
+			check.LeaseIP = lease.IP
+		case ok:
+			check.Status = LeaseDrifted
+			check.LeaseIP = lease.IP
+		default:
+			check.Status = LeaseMissing
+		}
+
+		if other, taken := byIP[client.IP]; taken && !strings.EqualFold(other.HWAddr, client.MAC) {
+			check.Status = LeaseConflict
+			check.LeaseMAC = other.HWAddr
+		}
+		checks = append(checks, check)
+	}
+
+	sort.SliceStable(checks, func(i, j int) bool { return checks[i].Client.Name < checks[j].Client.Name })
+	return checks
+}
+
+// isMAC reports whether s is a colon or dash separated hardware address
+func isMAC(s string) bool {
+	_, err := net.ParseMAC(s)
+	return err == nil && strings.ContainsAny(s, ":-")
+}
@@ -0,0 +1,239 @@
+package pihole
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Group represents a Pi-hole group configuration
+type Group struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// Client represents a Pi-hole client configuration
+type Client struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	IP      string `json:"ip"`
+	MAC     string `json:"mac"`
+	Groups  []int  `json:"groups"`
+	Comment string `json:"comment"`
+}
+
+// Domain represents a Pi-hole domain/regex entry
+type Domain struct {
+	ID      int    `json:"id"`
+	Domain  string `json:"domain"`
+	Type    string `json:"type"` // "regex", "exact", "wildcard"
+	Groups  []int  `json:"groups"`
+	Comment string `json:"comment"`
+	Enabled bool   `json:"enabled"`
+}
+
+// CreateGroup creates a new group via Pi-hole API
+func (s *Session) CreateGroup(name, description string, enabled bool) (*Group, error) {
+	// Pi-hole v6+ group creation endpoint
+	payload := map[string]interface{}{
+		"name":        name,
+		"description": description,
+		"enabled":     enabled,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal group data: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", s.BaseURL+"/api/groups", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create group request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	if s.CSRFToken != "" {
+		req.Header.Set("X-Pi-hole-Token", s.CSRFToken)
+	}
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("group creation request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("group creation failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	var group Group
+	if err := json.Unmarshal(body, &group); err != nil {
+		return nil, fmt.Errorf("failed to parse group response: %v", err)
+	}
+
+	return &group, nil
+}
+
+// GetGroups retrieves all groups from Pi-hole
+func (s *Session) GetGroups() ([]Group, error) {
+	var body json.RawMessage
+	if err := s.doJSON("GET", "/api/groups", nil, &body); err != nil {
+		return nil, fmt.Errorf("failed to get groups: %w", err)
+	}
+
+	var result struct {
+		Groups []Group `json:"groups"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		// Try direct array format
+		var groups []Group
+		if err := json.Unmarshal(body, &groups); err != nil {
+			return nil, fmt.Errorf("failed to parse groups response: %v", err)
+		}
+		return groups, nil
+	}
+
+	return result.Groups, nil
+}
+
+// ConfiguredClient is an entry of /api/clients. Client identifies the
+// device by IP address, CIDR subnet, MAC address, hostname or interface
+// (":eth0").
+type ConfiguredClient struct {
+	ID      int    `json:"id"`
+	Client  string `json:"client"`
+	Name    string `json:"name"`
+	Comment string `json:"comment"`
+	Groups  []int  `json:"groups"`
+}
+
+// GetClients retrieves the clients configured for group management
+func (s *Session) GetClients() ([]ConfiguredClient, error) {
+	var result struct {
+		Clients []ConfiguredClient `json:"clients"`
+	}
+	if err := s.doJSON("GET", "/api/clients", nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to get clients: %w", err)
+	}
+	return result.Clients, nil
+}
+
+// CreateClient creates a new client via Pi-hole API
+func (s *Session) CreateClient(name, ip, mac string, groups []int, comment string) (*Client, error) {
+	payload := map[string]interface{}{
+		"name":    name,
+		"ip":      ip,
+		"mac":     mac,
+		"groups":  groups,
+		"comment": comment,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal client data: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", s.BaseURL+"/api/clients", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	if s.CSRFToken != "" {
+		req.Header.Set("X-Pi-hole-Token", s.CSRFToken)
+	}
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("client creation request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("client creation failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	var client Client
+	if err := json.Unmarshal(body, &client); err != nil {
+		return nil, fmt.Errorf("failed to parse client response: %v", err)
+	}
+
+	return &client, nil
+}
+
+// CreateDomainRegex creates a regex domain entry via Pi-hole API
+func (s *Session) CreateDomainRegex(domain string, groups []int, comment string) (*Domain, error) {
+	payload := map[string]interface{}{
+		"domain":  domain,
+		"type":    "regex",
+		"groups":  groups,
+		"comment": comment,
+		"enabled": true,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal domain data: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", s.BaseURL+"/api/domains", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create domain request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	if s.CSRFToken != "" {
+		req.Header.Set("X-Pi-hole-Token", s.CSRFToken)
+	}
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("domain creation request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("domain creation failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	var domainResult Domain
+	if err := json.Unmarshal(body, &domainResult); err != nil {
+		return nil, fmt.Errorf("failed to parse domain response: %v", err)
+	}
+
+	return &domainResult, nil
+}
+
+// DenyDomain adds an exact domain to the denylist
+func (s *Session) DenyDomain(domain, comment string) error {
+	payload := map[string]interface{}{"domain": domain, "comment": comment}
+	if err := s.doJSON("POST", "/api/domains/deny/exact", payload, nil); err != nil {
+		return fmt.Errorf("failed to deny %s: %w", domain, err)
+	}
+	return nil
+}
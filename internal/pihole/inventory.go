@@ -0,0 +1,175 @@
+package pihole
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InventoryEntry is a device in the inventory, either seen in FTL's network
+// table, configured as a client, or both
+type InventoryEntry struct {
+	MAC        string     `json:"mac"`
+	IPs        []string   `json:"ips"`
+	Hostname   string     `json:"hostname,omitempty"`
+	Vendor     string     `json:"vendor,omitempty"`
+	LastQuery  *time.Time `json:"last_query,omitempty"`
+	NumQueries int        `json:"num_queries"`
+	// Known is true when the device matches a configured client
+	Known bool `json:"known"`
+	// Seen is false for configured clients absent from the network table
+	Seen   bool    `json:"seen"`
+	Client *Client `json:"client,omitempty"`
+}
+
+// BuildInventory marks each device in the network table as known or
+// unknown relative to the configured clients. A device matches a client by
+// MAC address, or by IP address when the client has no MAC. Configured
+// clients that were never seen are included with Seen set to false.
+func BuildInventory(devices []NetworkDevice, clients []Client) []InventoryEntry {
+	matched := make([]bool, len(clients))
+	var entries []InventoryEntry
+
+	for _, device := range devices {
+		entry := InventoryEntry{
+			MAC:        strings.ToLower(device.HWAddr),
+			Hostname:   device.Hostname(),
+			Vendor:     device.MACVendor,
+			NumQueries: device.NumQueries,
+			Seen:       true,
+		}
+		if lastQuery := device.LastQueryAt(); !lastQuery.IsZero() {
+			entry.LastQuery = &lastQuery
+		}
+		for _, ip := range device.IPs {
+			entry.IPs = append(entry.IPs, ip.IP)
+		}
+
+		for i, client := range clients {
+			if matchesClient(entry, client) {
+				c := client
+				entry.Client = &c
+				entry.Known = true
+				matched[i] = true
+				break
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	for i, client := range clients {
+		if matched[i] {
+			continue
+		}
+		c := client
+		entries = append(entries, InventoryEntry{
+			MAC:    strings.ToLower(client.MAC),
+			IPs:    []string{client.IP},
+			Known:  true,
+			Client: &c,
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Known != entries[j].Known {
+			return !entries[i].Known
+		}
+		return entries[i].MAC < entries[j].MAC
+	})
+	return entries
+}
+
+// matchesClient reports whether an inventory entry is the configured client
+func matchesClient(entry InventoryEntry, client Client) bool {
+	if client.MAC != "" {
+		return strings.EqualFold(client.MAC, entry.MAC)
+	}
+	for _, ip := range entry.IPs {
+		if ip == client.IP {
+			return true
+		}
+	}
+	return false
+}
+
+// BootstrapClients turns an inventory into client definitions suitable for
+// ReadClientsFile. Known devices keep their configured definition; unknown
+// devices are named after their hostname (or MAC) and flagged in the comment
+// for review.
+func BootstrapClients(entries []InventoryEntry) []Client {
+	var clients []Client
+	for _, entry := range entries {
+		if entry.Client != nil {
+			clients = append(clients, *entry.Client)
+			continue
+		}
+
+		name := entry.Hostname
+		if name == "" {
+			name = "device-" + strings.ReplaceAll(entry.MAC, ":", "")
+		}
+		client := Client{
+			Name:    name,
+			MAC:     entry.MAC,
+			Comment: "discovered from network table",
+		}
+		if len(entry.IPs) > 0 {
+			client.IP = entry.IPs[0]
+		}
+		if entry.Vendor != "" {
+			client.Comment += " (" + entry.Vendor + ")"
+		}
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// WriteInventoryJSON writes the inventory as an indented JSON array
+func WriteInventoryJSON(w io.Writer, entries []InventoryEntry) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
+
+// WriteInventoryCSV writes the inventory as CSV with a header row
+func WriteInventoryCSV(w io.Writer, entries []InventoryEntry) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"status", "client", "mac", "ips", "hostname", "vendor", "last_query", "num_queries"})
+
+	for _, entry := range entries {
+		status := "unknown"
+		switch {
+		case entry.Known && !entry.Seen:
+			status = "not-seen"
+		case entry.Known:
+			status = "known"
+		}
+
+		clientName := ""
+		if entry.Client != nil {
+			clientName = entry.Client.Name
+		}
+		lastQuery := ""
+		if entry.LastQuery != nil {
+			lastQuery = entry.LastQuery.UTC().Format(time.RFC3339)
+		}
+
+		writer.Write([]string{
+			status,
+			clientName,
+			entry.MAC,
+			strings.Join(entry.IPs, " "),
+			entry.Hostname,
+			entry.Vendor,
+			lastQuery,
+			strconv.Itoa(entry.NumQueries),
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,75 @@
+package pihole
+
+import (
+	"fmt"
+	"time"
+)
+
+// NetworkDevice is an entry of FTL's network table (/api/network/devices)
+type NetworkDevice struct {
+	ID         int              `json:"id"`
+	HWAddr     string           `json:"hwaddr"`
+	Interface  string           `json:"interface"`
+	FirstSeen  int64            `json:"firstSeen"`
+	LastQuery  int64            `json:"lastQuery"`
+	NumQueries int              `json:"numQueries"`
+	MACVendor  string           `json:"macVendor"`
+	IPs        []NetworkAddress `json:"ips"`
+}
+
+// NetworkAddress is an IP address FTL has seen for a device
+type NetworkAddress struct {
+	IP          string `json:"ip"`
+	Name        string `json:"name"`
+	LastSeen    int64  `json:"lastSeen"`
+	NameUpdated int64  `json:"nameUpdated"`
+}
+
+// LastQueryAt returns when the device last sent a DNS query
+func (d NetworkDevice) LastQueryAt() time.Time {
+	if d.LastQuery == 0 {
+		return time.Time{}
+	}
+	return time.Unix(d.LastQuery, 0)
+}
+
+// Hostname returns the first name FTL resolved for any of the device's
+// addresses, or "" if none is known
+func (d NetworkDevice) Hostname() string {
+	for _, ip := range d.IPs {
+		if ip.Name != "" {
+			return ip.Name
+		}
+	}
+	return ""
+}
+
+// NetworkGateway is a default route reported by /api/network/gateway
+type NetworkGateway struct {
+	Family    string   `json:"family"`
+	Interface string   `json:"interface"`
+	Address   string   `json:"address"`
+	Local     []string `json:"local"`
+}
+
+// GetNetworkDevices retrieves FTL's network table
+func (s *Session) GetNetworkDevices() ([]NetworkDevice, error) {
+	var result struct {
+		Devices []NetworkDevice `json:"devices"`
+	}
+	if err := s.doJSON("GET", "/api/network/devices", nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to get network devices: %w", err)
+	}
+	return result.Devices, nil
+}
+
+// GetNetworkGateway retrieves the gateways the Pi-hole host routes through
+func (s *Session) GetNetworkGateway() ([]NetworkGateway, error) {
+	var result struct {
+		Gateway []NetworkGateway `json:"gateway"`
+	}
+	if err := s.doJSON("GET", "/api/network/gateway", nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to get network gateway: %w", err)
+	}
+	return result.Gateway, nil
+}
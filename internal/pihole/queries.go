@@ -0,0 +1,287 @@
+package pihole
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query is an entry of FTL's query log (/api/queries)
+type Query struct {
+	ID       int64       `json:"id"`
+	Time     float64     `json:"time"`
+	Type     string      `json:"type"`
+	Domain   string      `json:"domain"`
+	CNAME    *string     `json:"cname"`
+	Status   string      `json:"status"`
+	Client   QueryClient `json:"client"`
+	DNSSEC   string      `json:"dnssec"`
+	Reply    QueryReply  `json:"reply"`
+	ListID   *int        `json:"list_id"`
+	Upstream *string     `json:"upstream"`
+}
+
+// QueryClient identifies the device that sent a query
+type QueryClient struct {
+	IP   string `json:"ip"`
+	Name string `json:"name"`
+}
+
+// QueryReply describes FTL's answer; Time is in seconds
+type QueryReply struct {
+	Type string  `json:"type"`
+	Time float64 `json:"time"`
+}
+
+// blockedStatuses are the query statuses FTL uses for blocked queries
+var blockedStatuses = map[string]bool{
+	"GRAVITY":               true,
+	"REGEX":                 true,
+	"DENYLIST":              true,
+	"EXTERNAL_BLOCKED_IP":   true,
+	"EXTERNAL_BLOCKED_NULL": true,
+	"EXTERNAL_BLOCKED_NXRA": true,
+	"GRAVITY_CNAME":         true,
+	"REGEX_CNAME":           true,
+	"DENYLIST_CNAME":        true,
+	"SPECIAL_DOMAIN":        true,
+}
+
+// Timestamp returns when FTL received the query
+func (q Query) Timestamp() time.Time {
+	sec, frac := math.Modf(q.Time)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// Blocked reports whether Pi-hole blocked the query
+func (q Query) Blocked() bool {
+	return blockedStatuses[q.Status]
+}
+
+// QueryPage is one response of /api/queries
+type QueryPage struct {
+	Queries         []Query `json:"queries"`
+	Cursor          int64   `json:"cursor"`
+	RecordsTotal    int     `json:"recordsTotal"`
+	RecordsFiltered int     `json:"recordsFiltered"`
+}
+
+// QueryParams are the server-side parameters of /api/queries
+type QueryParams struct {
+	// From and Until bound the query timestamps; zero means unbounded
+	From  time.Time
+	Until time.Time
+	// Length is the maximum number of queries returned, newest first
+	Length int
+	// Cursor pins pagination to a previous page's Cursor
+	Cursor int64
+	Start  int
+}
+
+// GetQueries retrieves a page of the query log, newest first
+func (s *Session) GetQueries(params QueryParams) (*QueryPage, error) {
+	values := url.Values{}
+	if !params.From.IsZero() {
+		values.Set("from", strconv.FormatInt(params.From.Unix(), 10))
+	}
+	if !params.Until.IsZero() {
+		values.Set("until", strconv.FormatInt(params.Until.Unix(), 10))
+	}
+	if params.Length > 0 {
+		values.Set("length", strconv.Itoa(params.Length))
+	}
+	if params.Cursor > 0 {
+		values.Set("cursor", strconv.FormatInt(params.Cursor, 10))
+	}
+	if params.Start > 0 {
+		values.Set("start", strconv.Itoa(params.Start))
+	}
+
+	path := "/api/queries"
+	if len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+
+	var page QueryPage
+	if err := s.doJSON("GET", path, nil, &page); err != nil {
+		return nil, fmt.Errorf("failed to get queries: %w", err)
+	}
+	return &page, nil
+}
+
+// QueryFilter selects queries on the client side
+type QueryFilter struct {
+	// Client matches the client IP exactly or its name as a substring
+	Client string
+	// Domain is matched against the queried domain
+	Domain *regexp.Regexp
+	// Statuses are FTL statuses (e.g. GRAVITY, FORWARDED); the pseudo-status
+	// "blocked" matches every blocking status
+	Statuses []string
+}
+
+// Match reports whether q passes the filter
+func (f QueryFilter) Match(q Query) bool {
+	if f.Client != "" && q.Client.IP != f.Client && !strings.Contains(q.Client.Name, f.Client) {
+		return false
+	}
+	if f.Domain != nil && !f.Domain.MatchString(q.Domain) {
+		return false
+	}
+	if len(f.Statuses) > 0 {
+		matched := false
+		for _, status := range f.Statuses {
+			if strings.EqualFold(status, q.Status) || (strings.EqualFold(status, "blocked") && q.Blocked()) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// QueryTail follows the query log like `tail -f`, returning each query once
+type QueryTail struct {
+	Session *Session
+	Filter  QueryFilter
+	// Since is where the tail starts; zero starts from the first poll
+	Since time.Time
+	// PageSize bounds how many queries a single poll fetches
+	PageSize int
+	// MaxFailures is how many polls in a row may fail before Follow gives
+	// up; zero means 5
+	MaxFailures int
+
+	lastID   int64
+	lastTime time.Time
+}
+
+// Poll fetches queries newer than the previous poll, oldest first. The
+// first poll only establishes the starting point unless Since is set.
+// Bursts larger than PageSize are paged through with the cursor FTL
+// returns, back to the last query already seen, so none are skipped.
+func (t *QueryTail) Poll() ([]Query, error) {
+	pageSize := t.PageSize
+	if pageSize == 0 {
+		pageSize = 1000
+	}
+
+	first := t.lastTime.IsZero()
+	from := t.lastTime
+	if first {
+		from = t.Since
+		if from.IsZero() {
+			// Only the newest query is needed to find the starting point
+			pageSize = 1
+		}
+	}
+
+	var queries []Query
+	seen := make(map[int64]bool)
+	params := QueryParams{From: from, Length: pageSize}
+	for {
+		page, err := t.Session.GetQueries(params)
+		if err != nil {
+			return nil, err
+		}
+
+		caughtUp := len(page.Queries) < pageSize || (first && t.Since.IsZero())
+		added := 0
+		for _, q := range page.Queries {
+			if q.ID <= t.lastID {
+				caughtUp = true
+				continue
+			}
+			if !seen[q.ID] {
+				seen[q.ID] = true
+				queries = append(queries, q)
+				added++
+			}
+		}
+		// A page of nothing new means the server ignored the offset
+		if caughtUp || added == 0 {
+			break
+		}
+		// The cursor pins the log as of the first page, so queries arriving
+		// meanwhile do not shift the offsets of the older pages
+		if params.Cursor == 0 {
+			params.Cursor = page.Cursor
+		}
+		params.Start += len(page.Queries)
+	}
+
+	sort.Slice(queries, func(i, j int) bool { return queries[i].ID < queries[j].ID })
+
+	var fresh []Query
+	for _, q := range queries {
+		t.lastID = q.ID
+		// Only whole seconds can be passed as "from", so step back to the
+		// second of the newest query and rely on lastID to skip repeats
+		t.lastTime = time.Unix(q.Timestamp().Unix(), 0)
+
+		if first && t.Since.IsZero() {
+			continue
+		}
+		if t.Filter.Match(q) {
+			fresh = append(fresh, q)
+		}
+	}
+
+	if t.lastTime.IsZero() {
+		t.lastTime = time.Now()
+	}
+	return fresh, nil
+}
+
+// maxFollowBackoff caps the wait between Follow's retries of failed polls
+const maxFollowBackoff = time.Minute
+
+// Follow polls every interval until ctx is done, handing each new matching
+// query to emit in chronological order. A failed poll is logged and retried
+// after a doubling backoff; Follow gives up after MaxFailures in a row.
+func (t *QueryTail) Follow(ctx context.Context, interval time.Duration, emit func(Query) error) error {
+	maxFailures := t.MaxFailures
+	if maxFailures == 0 {
+		maxFailures = 5
+	}
+
+	failures := 0
+	for {
+		wait := interval
+		queries, err := t.Poll()
+		if err != nil {
+			failures++
+			if failures >= maxFailures {
+				return fmt.Errorf("giving up after %d failed polls: %w", failures, err)
+			}
+			for i := 0; i < failures && wait < maxFollowBackoff; i++ {
+				wait *= 2
+			}
+			wait = max(interval, min(wait, maxFollowBackoff))
+			log.Printf("query tail: poll failed (%d of %d), retrying in %s: %v", failures, maxFailures, wait, err)
+		} else {
+			failures = 0
+		}
+		for _, q := range queries {
+			if err := emit(q); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
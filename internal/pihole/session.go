@@ -0,0 +1,242 @@
+// Package pihole is a small client for the Pi-hole v6+ JSON API.
+//
+// It is shared by the Terratest suite in tests/ and by the homelab CLI in
+// cmd/homelab, so it must not depend on the testing package.
+package pihole
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+)
+
+// Session represents an authenticated Pi-hole session
+type Session struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	SessionID  string
+	CSRFToken  string
+}
+
+// NewSession creates and authenticates a new Pi-hole session
+func NewSession(baseURL, password string) (*Session, error) {
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	session := &Session{
+		BaseURL:    baseURL,
+		HTTPClient: client,
+	}
+
+	// Pi-hole v6+ uses JSON API authentication
+	authPayload := map[string]interface{}{
+		"password": password,
+		"totp":     nil,
+	}
+
+	// Convert to JSON
+	jsonData, err := json.Marshal(authPayload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal auth payload: %v", err)
+	}
+
+	// Create request to /api/auth
+	req, err := http.NewRequest("POST", baseURL+"/api/auth", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create auth request: %v", err)
+	}
+
+	// Set required headers for Pi-hole v6+ API
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("Accept", "application/json, text/javascript, */*; q=0.01")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	req.Header.Set("Referer", baseURL+"/admin/login")
+	req.Header.Set("Origin", baseURL)
+
+	// Make authentication request
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("authentication request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	log.Printf("Authentication response status: %d", resp.StatusCode)
+
+	// Check for successful authentication
+	if resp.StatusCode == 200 {
+		// Check if authentication cookies were set (Pi-hole v6+ uses 'sid' cookie)
+		cookieSet := false
+		for _, cookie := range resp.Cookies() {
+			log.Printf("  Cookie set: %s=%s (first 20 chars)", cookie.Name, cookie.Value[:min(20, len(cookie.Value))])
+			if cookie.Name == "sid" || cookie.Name == "_SSID" {
+				cookieSet = true
+			}
+		}
+
+		if cookieSet {
+			return session, nil
+		}
+
+		// Even if no cookies, check the response body for a successful session
+		body, _ := ioutil.ReadAll(resp.Body)
+		var authResp map[string]interface{}
+		if json.Unmarshal(body, &authResp) == nil {
+			if sessionData, ok := authResp["session"].(map[string]interface{}); ok {
+				if valid, ok := sessionData["valid"].(bool); ok && valid {
+					// Capture CSRF token for subsequent API requests
+					if csrfToken, ok := sessionData["csrf"].(string); ok {
+						session.CSRFToken = csrfToken
+						log.Printf("Captured CSRF token: %s", csrfToken)
+					}
+					if sid, ok := sessionData["sid"].(string); ok {
+						session.SessionID = sid
+						log.Printf("Captured session ID: %s", sid)
+					}
+					log.Printf("Authentication successful via session data")
+					return session, nil
+				}
+			}
+		}
+	}
+
+	// Read response body for debugging
+	body, _ := ioutil.ReadAll(resp.Body)
+	log.Printf("Authentication response body: %s", string(body))
+
+	return nil, fmt.Errorf("authentication failed with status %d", resp.StatusCode)
+}
+
+// Logout deletes the session on the Pi-hole. FTL only allows a few
+// sessions at a time, so long-running clients should log out of sessions
+// they stop using instead of leaving them to expire.
+func (s *Session) Logout() error {
+	if err := s.doJSON("DELETE", "/api/auth", nil, nil); err != nil {
+		return fmt.Errorf("failed to log out: %w", err)
+	}
+	return nil
+}
+
+// GetStats retrieves the /api/stats/summary document as generic JSON; see
+// GetSummary for the typed form
+func (s *Session) GetStats() (map[string]interface{}, error) {
+	var result map[string]interface{}
+	if err := s.doJSON("GET", "/api/stats/summary", nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to get stats: %w", err)
+	}
+	return result, nil
+}
+
+// TestAPIAccess tests that we can access API endpoints with authentication
+func (s *Session) TestAPIAccess() error {
+	// Test basic API access with authenticated session
+	url := s.BaseURL + "/api"
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to access API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Any response that's not a 401 indicates authentication is working
+	if resp.StatusCode == 401 {
+		return fmt.Errorf("API returned 401 - authentication failed")
+	}
+
+	return nil
+}
+
+// GetLists retrieves blocklist configuration
+func (s *Session) GetLists() (map[string]interface{}, error) {
+	endpoints := []string{
+		"/api/lists",
+		"/api",
+	}
+
+	for _, endpoint := range endpoints {
+		resp, err := s.HTTPClient.Get(s.BaseURL + endpoint)
+		if err != nil {
+			continue
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == 200 {
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				continue
+			}
+
+			var result map[string]interface{}
+			if json.Unmarshal(body, &result) == nil {
+				return result, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("failed to get lists configuration")
+}
+
+// doJSON sends an authenticated API request and decodes the JSON response
+// into out. A nil payload sends no body; a nil out discards the response.
+func (s *Session) doJSON(method, path string, payload, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s payload: %w", path, err)
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+
+	req, err := http.NewRequest(method, s.BaseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %w", path, err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.SessionID != "" {
+		req.Header.Set("X-FTL-SID", s.SessionID)
+	}
+	if s.CSRFToken != "" {
+		req.Header.Set("X-Pi-hole-Token", s.CSRFToken)
+	}
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s request failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s response: %w", path, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s returned status %d: %s", method, path, resp.StatusCode, string(respBody))
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse %s response: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package pihole
+
+import (
+	"fmt"
+	"time"
+)
+
+// Summary is the query and client totals from /api/stats/summary
+type Summary struct {
+	Queries struct {
+		Total          int     `json:"total"`
+		Blocked        int     `json:"blocked"`
+		PercentBlocked float64 `json:"percent_blocked"`
+		UniqueDomains  int     `json:"unique_domains"`
+		Forwarded      int     `json:"forwarded"`
+		Cached         int     `json:"cached"`
+		// Types counts queries by record type, e.g. "A" or "AAAA"
+		Types map[string]int `json:"types"`
+		// Status counts queries by outcome, e.g. "GRAVITY" or "FORWARDED"
+		Status map[string]int `json:"status"`
+		// Replies counts replies by type, e.g. "NXDOMAIN"
+		Replies map[string]int `json:"replies"`
+	} `json:"queries"`
+	Clients struct {
+		// Active is clients seen in the last 24 hours; Total is all clients ever seen
+		Active int `json:"active"`
+		Total  int `json:"total"`
+	} `json:"clients"`
+	Gravity struct {
+		DomainsBeingBlocked int `json:"domains_being_blocked"`
+		// LastUpdate is when gravity was last rebuilt, in Unix seconds
+		LastUpdate int64 `json:"last_update"`
+	} `json:"gravity"`
+}
+
+// GravityUpdated returns when gravity was last rebuilt
+func (s Summary) GravityUpdated() time.Time {
+	return time.Unix(s.Gravity.LastUpdate, 0)
+}
+
+// GetSummary retrieves the query and client totals
+func (s *Session) GetSummary() (*Summary, error) {
+	var summary Summary
+	if err := s.doJSON("GET", "/api/stats/summary", nil, &summary); err != nil {
+		return nil, fmt.Errorf("failed to get stats summary: %w", err)
+	}
+	return &summary, nil
+}
+
+// TopClient is a client's query count from /api/stats/top_clients
+type TopClient struct {
+	IP    string `json:"ip"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// GetTopClients retrieves the count clients sending the most queries, or
+// the most blocked queries when blocked is set
+func (s *Session) GetTopClients(blocked bool, count int) ([]TopClient, error) {
+	var result struct {
+		Clients []TopClient `json:"clients"`
+	}
+	path := fmt.Sprintf("/api/stats/top_clients?blocked=%t&count=%d", blocked, count)
+	if err := s.doJSON("GET", path, nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to get top clients: %w", err)
+	}
+	return result.Clients, nil
+}
+
+// Upstream is a destination FTL forwards queries to, from /api/stats/upstreams.
+// FTL also lists the pseudo-upstreams "blocklist" and "cache" with port -1.
+type Upstream struct {
+	IP         string `json:"ip"`
+	Name       string `json:"name"`
+	Port       int    `json:"port"`
+	Count      int    `json:"count"`
+	Statistics struct {
+		// Response is the mean response time and Variance its variance,
+		// both in seconds
+		Response float64 `json:"response"`
+		Variance float64 `json:"variance"`
+	} `json:"statistics"`
+}
+
+// Address renders the upstream as ip#port the way FTL's UI does, or just
+// its name for the blocklist and cache pseudo-upstreams
+func (u Upstream) Address() string {
+	if u.Port <= 0 {
+		if u.Name != "" {
+			return u.Name
+		}
+		return u.IP
+	}
+	return fmt.Sprintf("%s#%d", u.IP, u.Port)
+}
+
+// GetUpstreams retrieves the query counts and response times of each upstream
+func (s *Session) GetUpstreams() ([]Upstream, error) {
+	var result struct {
+		Upstreams []Upstream `json:"upstreams"`
+	}
+	if err := s.doJSON("GET", "/api/stats/upstreams", nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to get upstreams: %w", err)
+	}
+	return result.Upstreams, nil
+}
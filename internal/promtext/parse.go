@@ -0,0 +1,287 @@
+// Package promtext parses the Prometheus text exposition format, so tests
+// and tools can check what an exporter's /metrics endpoint actually serves.
+package promtext
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sample is one line of a metric family
+type Sample struct {
+	// Name may carry a _bucket, _sum, _count, _total or _created suffix of
+	// its family's name
+	Name   string
+	Labels map[string]string
+	Value  float64
+	// Timestamp is in milliseconds, or 0 when the line has none
+	Timestamp int64
+}
+
+// Family is the samples sharing a metric name, with its HELP and TYPE
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Families maps family names to families
+type Families map[string]*Family
+
+var (
+	metricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelName  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	types      = map[string]bool{"counter": true, "gauge": true, "histogram": true, "summary": true, "untyped": true}
+	// suffixes are the sample names histograms and summaries expand to
+	suffixes = []string{"_bucket", "_sum", "_count", "_total", "_created"}
+)
+
+// Parse reads an exposition. It is strict about what it accepts: invalid
+// names, values or label syntax, and a TYPE line after its family's samples
+// are errors, reported with their line number.
+func Parse(r io.Reader) (Families, error) {
+	families := make(Families)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if err := families.parseLine(strings.TrimSpace(scanner.Text())); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read exposition: %w", err)
+	}
+	return families, nil
+}
+
+func (f Families) parseLine(line string) error {
+	if line == "" {
+		return nil
+	}
+	if strings.HasPrefix(line, "#") {
+		fields := strings.SplitN(strings.TrimSpace(line[1:]), " ", 3)
+		if len(fields) < 3 || (fields[0] != "HELP" && fields[0] != "TYPE") {
+			return nil // a plain comment
+		}
+		name := fields[1]
+		if !metricName.MatchString(name) {
+			return fmt.Errorf("invalid metric name %q", name)
+		}
+		family := f.family(name)
+		if fields[0] == "HELP" {
+			family.Help = unescape(fields[2], false)
+			return nil
+		}
+		if !types[fields[2]] {
+			return fmt.Errorf("unknown type %q for %s", fields[2], name)
+		}
+		if family.Type != "" {
+			return fmt.Errorf("second TYPE line for %s", name)
+		}
+		if len(family.Samples) > 0 {
+			return fmt.Errorf("TYPE line for %s after its samples", name)
+		}
+		family.Type = fields[2]
+		return nil
+	}
+
+	sample, err := parseSample(line)
+	if err != nil {
+		return err
+	}
+	family := f.family(f.familyName(sample.Name))
+	family.Samples = append(family.Samples, sample)
+	return nil
+}
+
+// familyName finds the family a sample belongs to: its own name, or the
+// name without a suffix when a family of that name was declared
+func (f Families) familyName(sample string) string {
+	if _, ok := f[sample]; ok {
+		return sample
+	}
+	for _, suffix := range suffixes {
+		base := strings.TrimSuffix(sample, suffix)
+		if family, ok := f[base]; ok && base != sample && family.Type != "" && family.Type != "untyped" {
+			return base
+		}
+	}
+	return sample
+}
+
+func (f Families) family(name string) *Family {
+	family, ok := f[name]
+	if !ok {
+		family = &Family{Name: name}
+		f[name] = family
+	}
+	return family
+}
+
+func parseSample(line string) (Sample, error) {
+	sample := Sample{Labels: make(map[string]string)}
+	end := strings.IndexAny(line, "{ \t")
+	if end < 0 {
+		return sample, fmt.Errorf("sample %q has no value", line)
+	}
+	sample.Name, line = line[:end], line[end:]
+	if !metricName.MatchString(sample.Name) {
+		return sample, fmt.Errorf("invalid metric name %q", sample.Name)
+	}
+
+	if strings.HasPrefix(line, "{") {
+		rest, err := parseLabels(line[1:], sample.Labels)
+		if err != nil {
+			return sample, fmt.Errorf("%s: %w", sample.Name, err)
+		}
+		line = rest
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 || len(fields) > 2 {
+		return sample, fmt.Errorf("%s: expected a value and optional timestamp, got %q", sample.Name, line)
+	}
+	value, err := parseValue(fields[0])
+	if err != nil {
+		return sample, fmt.Errorf("%s: %w", sample.Name, err)
+	}
+	sample.Value = value
+	if len(fields) == 2 {
+		if sample.Timestamp, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+			return sample, fmt.Errorf("%s: invalid timestamp %q", sample.Name, fields[1])
+		}
+	}
+	return sample, nil
+}
+
+// parseLabels reads label pairs up to the closing brace and returns the rest
+// of the line
+func parseLabels(s string, labels map[string]string) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if strings.HasPrefix(s, "}") {
+			return s[1:], nil
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return "", fmt.Errorf("unterminated label set")
+		}
+		name := strings.TrimSpace(s[:eq])
+		if !labelName.MatchString(name) {
+			return "", fmt.Errorf("invalid label name %q", name)
+		}
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		if !strings.HasPrefix(s, `"`) {
+			return "", fmt.Errorf("label %s: value is not quoted", name)
+		}
+
+		// Find the closing quote, skipping escaped characters
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' {
+				i++
+			}
+		}
+		if i >= len(s) {
+			return "", fmt.Errorf("label %s: unterminated value", name)
+		}
+		if _, dup := labels[name]; dup {
+			return "", fmt.Errorf("duplicate label %s", name)
+		}
+		labels[name] = unescape(s[1:i], true)
+		s = strings.TrimLeft(s[i+1:], " \t")
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+		} else if !strings.HasPrefix(s, "}") {
+			return "", fmt.Errorf("expected ',' or '}' after label %s", name)
+		}
+	}
+}
+
+func parseValue(s string) (float64, error) {
+	switch s {
+	case "NaN":
+		return math.NaN(), nil
+	case "+Inf", "Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return value, nil
+}
+
+// unescape undoes \\ and \n, and \" inside label values
+func unescape(s string, quotes bool) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch next := s[i+1]; {
+			case next == 'n':
+				b.WriteByte('\n')
+				i++
+				continue
+			case next == '\\', next == '"' && quotes:
+				b.WriteByte(next)
+				i++
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// Find returns the first sample named name whose labels include every pair
+// in match
+func (f Families) Find(name string, match map[string]string) (Sample, bool) {
+	family, ok := f[f.familyName(name)]
+	if !ok {
+		return Sample{}, false
+	}
+	for _, sample := range family.Samples {
+		if sample.Name != name {
+			continue
+		}
+		matched := true
+		for key, value := range match {
+			if sample.Labels[key] != value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return sample, true
+		}
+	}
+	return Sample{}, false
+}
+
+// Value is the value of the first sample Find returns
+func (f Families) Value(name string, match map[string]string) (float64, bool) {
+	sample, ok := f.Find(name, match)
+	return sample.Value, ok
+}
+
+// Names returns the family names in sorted order
+func (f Families) Names() []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,95 @@
+package promtext
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Add appends a sample to the family called name, declaring the family
+// with help and typ if it is new. Labels are copied.
+func (f Families) Add(name, typ, help string, value float64, labels map[string]string) {
+	family := f.family(name)
+	if family.Type == "" {
+		family.Type, family.Help = typ, help
+	}
+	copied := make(map[string]string, len(labels))
+	for key, value := range labels {
+		copied[key] = value
+	}
+	family.Samples = append(family.Samples, Sample{Name: name, Labels: copied, Value: value})
+}
+
+// Merge adds every sample of other to f
+func (f Families) Merge(other Families) {
+	for _, name := range other.Names() {
+		from := other[name]
+		family := f.family(name)
+		if family.Type == "" {
+			family.Type, family.Help = from.Type, from.Help
+		}
+		family.Samples = append(family.Samples, from.Samples...)
+	}
+}
+
+// Write renders the families in the text exposition format, sorted by
+// name, so that Parse reads back what was written
+func Write(w io.Writer, families Families) error {
+	out := bufio.NewWriter(w)
+	for _, name := range families.Names() {
+		family := families[name]
+		if family.Help != "" {
+			fmt.Fprintf(out, "# HELP %s %s\n", name, escape(family.Help, false))
+		}
+		if family.Type != "" {
+			fmt.Fprintf(out, "# TYPE %s %s\n", name, family.Type)
+		}
+		for _, sample := range family.Samples {
+			out.WriteString(sample.Name)
+			if len(sample.Labels) > 0 {
+				keys := make([]string, 0, len(sample.Labels))
+				for key := range sample.Labels {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+				pairs := make([]string, len(keys))
+				for i, key := range keys {
+					pairs[i] = fmt.Sprintf(`%s="%s"`, key, escape(sample.Labels[key], true))
+				}
+				fmt.Fprintf(out, "{%s}", strings.Join(pairs, ","))
+			}
+			fmt.Fprintf(out, " %s", formatValue(sample.Value))
+			if sample.Timestamp != 0 {
+				fmt.Fprintf(out, " %d", sample.Timestamp)
+			}
+			out.WriteByte('\n')
+		}
+	}
+	return out.Flush()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escape is the inverse of unescape
+func escape(s string, quotes bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quotes {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
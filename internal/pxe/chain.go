@@ -0,0 +1,224 @@
+// Package pxe checks the netboot chain end to end: dnsmasq hands clients a
+// boot loader over TFTP, the boot loader runs iPXE, and iPXE fetches
+// matchbox's boot.ipxe over HTTP.
+package pxe
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yebyen/home-lab-terraform/internal/tfoutput"
+	"github.com/yebyen/home-lab-terraform/internal/tftp"
+)
+
+// Chain is both ends of the netboot chain, as an environment's
+// pxe_boot_chain output reports them
+type Chain struct {
+	Dnsmasq struct {
+		StaticIP string `json:"static_ip"`
+		// TFTP and PXE are null when the service is disabled
+		TFTP *struct {
+			RootPath string `json:"root_path"`
+		} `json:"tftp"`
+		PXE *struct {
+			MatchboxServer string `json:"matchbox_server"`
+			MatchboxPort   int    `json:"matchbox_port"`
+			BootURL        string `json:"boot_url"`
+			// BootLoaders are the files the client-arch rules hand out
+			BootLoaders []string `json:"boot_loaders"`
+		} `json:"pxe"`
+	} `json:"dnsmasq"`
+	Matchbox struct {
+		StaticIP     string `json:"static_ip"`
+		MatchboxPort int    `json:"matchbox_port"`
+		BootIPXEURL  string `json:"boot_ipxe_url"`
+	} `json:"matchbox"`
+}
+
+// FromOutputs reads the pxe_boot_chain output
+func FromOutputs(outputs tfoutput.Outputs) (*Chain, error) {
+	var chain Chain
+	if err := outputs.Decode("pxe_boot_chain", &chain); err != nil {
+		return nil, err
+	}
+	return &chain, nil
+}
+
+// Status is the outcome of checking one hop
+type Status string
+
+const (
+	OK      Status = "ok"
+	Failed  Status = "failed"
+	Skipped Status = "skipped"
+)
+
+// Hop is one link of the chain and what checking it found
+type Hop struct {
+	Name   string
+	Target string
+	Status Status
+	Detail string
+}
+
+// Validator checks a Chain, fetching the boot loaders and boot script from
+// the servers the chain names unless TFTPServer or MatchboxURL override them
+type Validator struct {
+	// TFTPServer is host:port; the default is dnsmasq's static IP, port 69
+	TFTPServer string
+	// MatchboxURL is matchbox's base URL; the default is the one matchbox
+	// reports in boot_ipxe_url
+	MatchboxURL string
+	// BootLoaders are fetched over TFTP; the default is every file the
+	// dnsmasq module's client-arch rules hand out, as its pxe_config output
+	// lists them
+	BootLoaders []string
+	HTTPClient  *http.Client
+	Timeout     time.Duration
+}
+
+// Validate checks every hop, carrying on past failures so the report shows
+// the whole chain
+func (v *Validator) Validate(chain *Chain) []Hop {
+	timeout := v.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	var hops []Hop
+
+	pxe := Hop{Name: "dnsmasq PXE", Target: chain.Dnsmasq.StaticIP, Status: OK}
+	if chain.Dnsmasq.PXE == nil {
+		pxe.Status, pxe.Detail = Failed, "pxe_enabled is false, so clients are not sent a boot loader"
+	} else {
+		pxe.Detail = "dhcp-boot points iPXE at " + chain.Dnsmasq.PXE.BootURL
+	}
+	hops = append(hops, pxe)
+	hops = append(hops, checkConsistency(chain))
+
+	tftpHop := Hop{Name: "dnsmasq TFTP", Target: chain.Dnsmasq.StaticIP, Status: OK}
+	if chain.Dnsmasq.TFTP == nil {
+		tftpHop.Status, tftpHop.Detail = Failed, "tftp_enabled is false, so boot loaders cannot be fetched"
+	} else {
+		tftpHop.Detail = "serving " + chain.Dnsmasq.TFTP.RootPath
+	}
+	hops = append(hops, tftpHop)
+
+	server := v.TFTPServer
+	if server == "" {
+		server = net.JoinHostPort(chain.Dnsmasq.StaticIP, "69")
+	}
+	client := &tftp.Client{Server: server, Timeout: timeout, BlockSize: 1428}
+	for _, file := range v.bootLoaders(chain) {
+		hop := Hop{Name: "TFTP " + file, Target: server}
+		if chain.Dnsmasq.TFTP == nil {
+			hop.Status, hop.Detail = Skipped, "TFTP is disabled"
+		} else {
+			hop.Status, hop.Detail = fetchBootLoader(client, file)
+		}
+		hops = append(hops, hop)
+	}
+
+	bootURL := chain.Matchbox.BootIPXEURL
+	if v.MatchboxURL != "" {
+		bootURL = strings.TrimSuffix(v.MatchboxURL, "/") + "/boot.ipxe"
+	}
+	httpClient := v.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: timeout}
+	}
+	hop := Hop{Name: "HTTP boot.ipxe", Target: bootURL}
+	hop.Status, hop.Detail = fetchBootScript(httpClient, bootURL)
+	return append(hops, hop)
+}
+
+// checkConsistency compares where dnsmasq sends iPXE with where matchbox
+// listens
+func checkConsistency(chain *Chain) Hop {
+	hop := Hop{Name: "dnsmasq → matchbox", Target: chain.Matchbox.BootIPXEURL, Status: OK}
+	if chain.Dnsmasq.PXE == nil {
+		hop.Status, hop.Detail = Skipped, "PXE is disabled"
+		return hop
+	}
+
+	var problems []string
+	pxe := chain.Dnsmasq.PXE
+	if pxe.MatchboxServer != chain.Matchbox.StaticIP {
+		problems = append(problems, fmt.Sprintf("matchbox_server %s is not matchbox's static_ip %s", pxe.MatchboxServer, chain.Matchbox.StaticIP))
+	}
+	if pxe.MatchboxPort != chain.Matchbox.MatchboxPort {
+		problems = append(problems, fmt.Sprintf("matchbox_port %d is not matchbox's port %d", pxe.MatchboxPort, chain.Matchbox.MatchboxPort))
+	}
+	if pxe.BootURL != chain.Matchbox.BootIPXEURL {
+		problems = append(problems, fmt.Sprintf("dnsmasq sends iPXE to %s but matchbox serves %s", pxe.BootURL, chain.Matchbox.BootIPXEURL))
+	}
+	if len(problems) > 0 {
+		hop.Status, hop.Detail = Failed, strings.Join(problems, "; ")
+	} else {
+		hop.Detail = "boot URL, address and port agree"
+	}
+	return hop
+}
+
+func (v *Validator) bootLoaders(chain *Chain) []string {
+	if len(v.BootLoaders) > 0 {
+		return v.BootLoaders
+	}
+	if chain.Dnsmasq.PXE == nil {
+		return nil
+	}
+	return chain.Dnsmasq.PXE.BootLoaders
+}
+
+// fetchBootLoader downloads a boot loader and checks it looks like one:
+// EFI binaries are PE images starting with "MZ"
+func fetchBootLoader(client *tftp.Client, file string) (Status, string) {
+	data, err := client.Get(file)
+	if err != nil {
+		return Failed, err.Error()
+	}
+	if len(data) == 0 {
+		return Failed, "file is empty"
+	}
+	if strings.HasSuffix(file, ".efi") && !bytes.HasPrefix(data, []byte("MZ")) {
+		return Failed, fmt.Sprintf("%d bytes, but not an EFI executable", len(data))
+	}
+	return OK, strconv.Itoa(len(data)) + " bytes"
+}
+
+// fetchBootScript fetches matchbox's boot.ipxe and checks it is an iPXE
+// script
+func fetchBootScript(client *http.Client, url string) (Status, string) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return Failed, err.Error()
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return Failed, fmt.Sprintf("failed to read response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Failed, fmt.Sprintf("status %d", resp.StatusCode)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(string(body)), "#!ipxe") {
+		return Failed, "response is not an iPXE script"
+	}
+	return OK, fmt.Sprintf("iPXE script, %d bytes", len(body))
+}
+
+// AnyFailed reports whether any hop failed
+func AnyFailed(hops []Hop) bool {
+	for _, hop := range hops {
+		if hop.Status == Failed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/yebyen/home-lab-terraform/internal/tfoutput"
+)
+
+// Cache is one registry-cache module instance as an environment reports it
+type Cache struct {
+	// Name is the key in the registry_caches output, e.g. docker_hub
+	Name        string
+	Endpoint    string
+	ContainerID string
+	// Upstream is the URL the cache pulls from, e.g. https://registry-1.docker.io
+	Upstream string
+	// Registry is the module's upstream_registry, the name clients pull
+	// by, e.g. docker.io
+	Registry string
+}
+
+// URL is the cache's base URL for the registry API
+func (c Cache) URL() string {
+	return "http://" + c.Endpoint
+}
+
+// CachesFromOutputs reads the registry_caches output of the registry-caches
+// or metnoom-13net environment. The former names the upstream "upstream",
+// the latter re-exports the module's cache_summary with "upstream_url";
+// both add the module's upstream_registry.
+func CachesFromOutputs(outputs tfoutput.Outputs) ([]Cache, error) {
+	var entries map[string]struct {
+		Endpoint         string `json:"endpoint"`
+		ContainerID      string `json:"container_id"`
+		Upstream         string `json:"upstream"`
+		UpstreamURL      string `json:"upstream_url"`
+		UpstreamRegistry string `json:"upstream_registry"`
+	}
+	if err := outputs.Decode("registry_caches", &entries); err != nil {
+		return nil, err
+	}
+
+	var caches []Cache
+	for name, entry := range entries {
+		if entry.Endpoint == "" {
+			return nil, fmt.Errorf("registry_caches.%s has no endpoint", name)
+		}
+		upstream := entry.Upstream
+		if upstream == "" {
+			upstream = entry.UpstreamURL
+		}
+		caches = append(caches, Cache{
+			Name:        name,
+			Endpoint:    entry.Endpoint,
+			ContainerID: entry.ContainerID,
+			Upstream:    upstream,
+			Registry:    entry.UpstreamRegistry,
+		})
+	}
+	sort.Slice(caches, func(i, j int) bool { return caches[i].Endpoint < caches[j].Endpoint })
+	return caches, nil
+}
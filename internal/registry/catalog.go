@@ -0,0 +1,227 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrDeleteUnsupported is returned by DeleteManifest when the registry does
+// not allow deletes, as is the case for pull-through caches and registries
+// without REGISTRY_STORAGE_DELETE_ENABLED
+var ErrDeleteUnsupported = errors.New("registry does not support deleting manifests")
+
+// repositoryName is the distribution spec's repository name grammar
+var repositoryName = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+
+// ValidRepositoryName reports whether name is a well-formed repository name,
+// which also guarantees it is safe to use as a storage path
+func ValidRepositoryName(name string) bool {
+	return repositoryName.MatchString(name)
+}
+
+// Catalog lists every repository, following the catalog's Link pagination
+func (c *Client) Catalog() ([]string, error) {
+	var repositories []string
+	path := "/v2/_catalog?n=100"
+	for path != "" {
+		var page struct {
+			Repositories []string `json:"repositories"`
+		}
+		next, err := c.getJSON(path, &page)
+		if err != nil {
+			return nil, err
+		}
+		repositories = append(repositories, page.Repositories...)
+		path = next
+	}
+	sort.Strings(repositories)
+	return repositories, nil
+}
+
+// Tags lists the tags of a repository
+func (c *Client) Tags(repository string) ([]string, error) {
+	var tags []string
+	path := "/v2/" + repository + "/tags/list?n=100"
+	for path != "" {
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		next, err := c.getJSON(path, &page)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, page.Tags...)
+		path = next
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// DeleteManifest deletes a manifest by digest. Blobs are only reclaimed by
+// the registry's garbage collector afterwards.
+func (c *Client) DeleteManifest(repository, digest string) error {
+	resp, err := c.do("DELETE", "/v2/"+repository+"/manifests/"+digest, nil, nil)
+	if err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && (statusErr.StatusCode == 405 || strings.Contains(statusErr.Body, "UNSUPPORTED")) {
+			return fmt.Errorf("%s@%s: %w", repository, digest, ErrDeleteUnsupported)
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// getJSON decodes a GET response and returns the path of the next page from
+// its Link header, or "" on the last page
+func (c *Client) getJSON(path string, out interface{}) (string, error) {
+	resp, err := c.do("GET", path, nil, map[string]string{"Accept": "application/json"})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s response: %w", path, err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return "", fmt.Errorf("failed to parse %s response: %w", path, err)
+	}
+	return nextLink(resp.Header.Get("Link")), nil
+}
+
+// nextLink extracts the target of `<...>; rel="next"`
+func nextLink(header string) string {
+	if !strings.Contains(header, `rel="next"`) {
+		return ""
+	}
+	start, end := strings.Index(header, "<"), strings.Index(header, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	link, err := url.Parse(header[start+1 : end])
+	if err != nil {
+		return ""
+	}
+	return link.RequestURI()
+}
+
+// RepositoryUsage is the storage a repository's tags reference
+type RepositoryUsage struct {
+	Repository string
+	Tags       []string
+	// Manifests maps each tag to its manifest digest
+	Manifests map[string]string
+	// Blobs maps the digests of every config and layer to their sizes
+	Blobs map[string]int64
+}
+
+// Size is the total size of the repository's blobs
+func (u *RepositoryUsage) Size() int64 {
+	var size int64
+	for _, blobSize := range u.Blobs {
+		size += blobSize
+	}
+	return size
+}
+
+// Usage is the storage of every repository in one registry
+type Usage struct {
+	Repositories []*RepositoryUsage
+}
+
+// Size counts each blob once, however many repositories reference it, as
+// the registry stores it once
+func (u *Usage) Size() int64 {
+	blobs := make(map[string]int64)
+	for _, repository := range u.Repositories {
+		for digest, size := range repository.Blobs {
+			blobs[digest] = size
+		}
+	}
+	var size int64
+	for _, blobSize := range blobs {
+		size += blobSize
+	}
+	return size
+}
+
+// Without returns the usage left once the repositories are removed
+func (u *Usage) Without(removed []*RepositoryUsage) *Usage {
+	skip := make(map[string]bool, len(removed))
+	for _, repository := range removed {
+		skip[repository.Repository] = true
+	}
+	rest := &Usage{}
+	for _, repository := range u.Repositories {
+		if !skip[repository.Repository] {
+			rest.Repositories = append(rest.Repositories, repository)
+		}
+	}
+	return rest
+}
+
+// Tags counts tags across repositories
+func (u *Usage) Tags() int {
+	tags := 0
+	for _, repository := range u.Repositories {
+		tags += len(repository.Tags)
+	}
+	return tags
+}
+
+// Inspect walks the catalog and every tag's manifest to total up storage.
+// Multi-platform indexes are not followed, since fetching their platform
+// manifests would make a pull-through cache fetch them from upstream, so
+// their layers are not counted.
+func (c *Client) Inspect() (*Usage, error) {
+	repositories, err := c.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &Usage{}
+	for _, repository := range repositories {
+		repoUsage, err := c.RepositoryUsage(repository)
+		if err != nil {
+			return nil, err
+		}
+		usage.Repositories = append(usage.Repositories, repoUsage)
+	}
+	return usage, nil
+}
+
+// RepositoryUsage totals the blobs referenced by one repository's tags
+func (c *Client) RepositoryUsage(repository string) (*RepositoryUsage, error) {
+	tags, err := c.Tags(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &RepositoryUsage{
+		Repository: repository,
+		Tags:       tags,
+		Manifests:  make(map[string]string),
+		Blobs:      make(map[string]int64),
+	}
+	for _, tag := range tags {
+		manifest, digest, err := c.GetManifest(repository, tag)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%s: %w", repository, tag, err)
+		}
+		usage.Manifests[tag] = digest
+		for _, desc := range append([]Descriptor{manifest.Config}, manifest.Layers...) {
+			if desc.Digest != "" {
+				usage.Blobs[desc.Digest] = desc.Size
+			}
+		}
+	}
+	return usage, nil
+}
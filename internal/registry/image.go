@@ -0,0 +1,97 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Image is a single-layer image built in memory, for pushing test content
+// to a registry without a Docker daemon
+type Image struct {
+	Config   []byte
+	Layer    []byte
+	Manifest *Manifest
+}
+
+// NewImage builds an image whose only layer holds files (path to content)
+func NewImage(files map[string]string) (*Image, error) {
+	var tarball bytes.Buffer
+	tw := tar.NewWriter(&tarball)
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		header := &tar.Header{
+			Name:    path,
+			Mode:    0644,
+			Size:    int64(len(files[path])),
+			ModTime: time.Unix(0, 0),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("failed to write %s to layer: %w", path, err)
+		}
+		if _, err := tw.Write([]byte(files[path])); err != nil {
+			return nil, fmt.Errorf("failed to write %s to layer: %w", path, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close layer: %w", err)
+	}
+
+	var layer bytes.Buffer
+	gz := gzip.NewWriter(&layer)
+	if _, err := gz.Write(tarball.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to compress layer: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress layer: %w", err)
+	}
+
+	config, err := json.Marshal(map[string]interface{}{
+		"architecture": "amd64",
+		"os":           "linux",
+		"config":       map[string]interface{}{},
+		"rootfs": map[string]interface{}{
+			"type":     "layers",
+			"diff_ids": []string{fmt.Sprintf("sha256:%x", sha256.Sum256(tarball.Bytes()))},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal image config: %w", err)
+	}
+
+	return &Image{
+		Config: config,
+		Layer:  layer.Bytes(),
+		Manifest: &Manifest{
+			SchemaVersion: 2,
+			MediaType:     MediaTypeManifest,
+			Config:        Descriptor{MediaType: MediaTypeConfig, Size: int64(len(config)), Digest: Digest(config)},
+			Layers:        []Descriptor{{MediaType: MediaTypeLayer, Size: int64(layer.Len()), Digest: Digest(layer.Bytes())}},
+		},
+	}, nil
+}
+
+// Push uploads the layer, config and manifest and returns the manifest
+// digest
+func (c *Client) Push(repository, tag string, image *Image) (string, error) {
+	if _, err := c.PushBlob(repository, MediaTypeLayer, image.Layer); err != nil {
+		return "", fmt.Errorf("failed to push layer: %w", err)
+	}
+	if _, err := c.PushBlob(repository, MediaTypeConfig, image.Config); err != nil {
+		return "", fmt.Errorf("failed to push config: %w", err)
+	}
+	digest, err := c.PutManifest(repository, tag, image.Manifest)
+	if err != nil {
+		return "", fmt.Errorf("failed to push manifest: %w", err)
+	}
+	return digest, nil
+}
@@ -0,0 +1,106 @@
+package registry
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// accessLogLine matches the combined-format request lines registry:2 writes
+// to stdout, e.g.
+//
+//	172.17.0.1 - - [19/Oct/2026:10:00:00 +0000] "GET /v2/library/alpine/manifests/3.19 HTTP/1.1" 200 1638 "" "docker/24.0.7"
+var accessLogLine = regexp.MustCompile(`\[([^\]]+)\] "(GET|HEAD) /v2/(.+)/manifests/[^ ?]+[^"]*" (\d{3}) (?:\S+ "[^"]*" "([^"]*)")?`)
+
+// Pulls records when each repository's manifests were last fetched, as seen
+// in a registry's access log
+type Pulls struct {
+	Last map[string]time.Time
+	// Oldest and Newest bound the log's request lines; a repository can
+	// only be called unused for a window the log covers
+	Oldest time.Time
+	Newest time.Time
+}
+
+// ParseAccessLog reads a registry's access log, e.g. the output of
+// `docker logs registry-docker.io`. Lines other than successful manifest
+// requests are ignored, as are this package's own requests: inspecting a
+// cache fetches every manifest, which is not a pull.
+func ParseAccessLog(r io.Reader) (*Pulls, error) {
+	pulls := &Pulls{Last: make(map[string]time.Time)}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		match := accessLogLine.FindStringSubmatch(scanner.Text())
+		if match == nil || strings.HasPrefix(match[5], UserAgent) {
+			continue
+		}
+		at, err := time.Parse("02/Jan/2006:15:04:05 -0700", match[1])
+		if err != nil {
+			continue
+		}
+		if pulls.Oldest.IsZero() || at.Before(pulls.Oldest) {
+			pulls.Oldest = at
+		}
+		if at.After(pulls.Newest) {
+			pulls.Newest = at
+		}
+		if match[4] != "200" {
+			continue
+		}
+		if repository := match[3]; at.After(pulls.Last[repository]) {
+			pulls.Last[repository] = at
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read access log: %w", err)
+	}
+	return pulls, nil
+}
+
+// Stale returns the repositories not pulled since cutoff. It fails when the
+// log starts after cutoff, since an absent repository may then just have
+// been pulled before the log was rotated.
+func (p *Pulls) Stale(usage *Usage, cutoff time.Time) ([]*RepositoryUsage, error) {
+	if len(usage.Repositories) > 0 {
+		if p.Oldest.IsZero() {
+			return nil, fmt.Errorf("access log has no manifest requests to date pulls by")
+		}
+		if p.Oldest.After(cutoff) {
+			return nil, fmt.Errorf("access log only goes back to %s, after the cutoff %s",
+				p.Oldest.Format(time.RFC3339), cutoff.Format(time.RFC3339))
+		}
+	}
+
+	var stale []*RepositoryUsage
+	for _, repository := range usage.Repositories {
+		if last, ok := p.Last[repository.Repository]; !ok || last.Before(cutoff) {
+			stale = append(stale, repository)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].Repository < stale[j].Repository })
+	return stale, nil
+}
+
+// DeleteRepository deletes every manifest the repository's tags reference.
+// It returns ErrDeleteUnsupported when the registry refuses deletes, in
+// which case the repository has to be removed from the storage directly.
+func (c *Client) DeleteRepository(repository *RepositoryUsage) error {
+	seen := make(map[string]bool)
+	for _, tag := range repository.Tags {
+		digest := repository.Manifests[tag]
+		if digest == "" || seen[digest] {
+			continue
+		}
+		seen[digest] = true
+		if err := c.DeleteManifest(repository.Repository, digest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+// Package registry is a small client for the Docker Registry HTTP API V2, as
+// served by the registry:2 pull-through caches the registry-cache module runs.
+//
+// Besides pushing and pulling images, it totals up what a cache holds,
+// picks stale repositories to prune from the cache's access log, and reads
+// the caches an environment publishes in its Terraform outputs.
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Media types of the image manifests and blobs this client pushes and reads
+const (
+	MediaTypeManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest  = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex     = "application/vnd.oci.image.index.v1+json"
+	MediaTypeConfig       = "application/vnd.docker.container.image.v1+json"
+	MediaTypeLayer        = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+// Descriptor references a blob by digest
+type Descriptor struct {
+	MediaType string `json:"mediaType"`
+	Size      int64  `json:"size"`
+	Digest    string `json:"digest"`
+}
+
+// Manifest is an image manifest (schema 2 or OCI). For a multi-platform
+// manifest list or index only Manifests is set.
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        Descriptor   `json:"config"`
+	Layers        []Descriptor `json:"layers"`
+	Manifests     []Descriptor `json:"manifests,omitempty"`
+}
+
+// UserAgent identifies this client's requests, so that ParseAccessLog can
+// tell inspecting a cache apart from pulling from it
+const UserAgent = "homelab-registry/1"
+
+// Client talks to one registry, e.g. "http://localhost:5050"
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a client for the registry at baseURL
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Digest returns the sha256 digest of data in registry form
+func Digest(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// Ping checks the registry answers GET /v2/
+func (c *Client) Ping() error {
+	resp, err := c.do("GET", "/v2/", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// PushBlob uploads data to repository in a single monolithic upload
+func (c *Client) PushBlob(repository, mediaType string, data []byte) (Descriptor, error) {
+	desc := Descriptor{MediaType: mediaType, Size: int64(len(data)), Digest: Digest(data)}
+
+	resp, err := c.do("POST", "/v2/"+repository+"/blobs/uploads/", nil, nil)
+	if err != nil {
+		return desc, err
+	}
+	resp.Body.Close()
+
+	location, err := resp.Location()
+	if err != nil {
+		return desc, fmt.Errorf("failed to read upload location: %w", err)
+	}
+	query := location.Query()
+	query.Set("digest", desc.Digest)
+	location.RawQuery = query.Encode()
+
+	resp, err = c.do("PUT", location.String(), bytes.NewReader(data), map[string]string{
+		"Content-Type": "application/octet-stream",
+	})
+	if err != nil {
+		return desc, err
+	}
+	resp.Body.Close()
+	return desc, nil
+}
+
+// PutManifest uploads manifest under reference (a tag or digest) and returns
+// its digest
+func (c *Client) PutManifest(repository, reference string, manifest *Manifest) (string, error) {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	mediaType := manifest.MediaType
+	if mediaType == "" {
+		mediaType = MediaTypeManifest
+	}
+
+	resp, err := c.do("PUT", "/v2/"+repository+"/manifests/"+reference, bytes.NewReader(data), map[string]string{
+		"Content-Type": mediaType,
+	})
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return Digest(data), nil
+}
+
+// GetManifest fetches the manifest for reference and returns it with its
+// digest. Lists and indexes are accepted so that registries return them as
+// stored rather than resolving a platform, which on a pull-through cache
+// would fetch from upstream.
+func (c *Client) GetManifest(repository, reference string) (*Manifest, string, error) {
+	path := "/v2/" + repository + "/manifests/" + reference
+	resp, err := c.do("GET", path, nil, map[string]string{
+		"Accept": strings.Join([]string{MediaTypeManifest, MediaTypeOCIManifest, MediaTypeManifestList, MediaTypeOCIIndex}, ", "),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s response: %w", path, err)
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, "", fmt.Errorf("failed to parse %s response: %w", path, err)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = Digest(data)
+	}
+	return manifest, digest, nil
+}
+
+// GetBlob downloads a blob and checks it against its digest
+func (c *Client) GetBlob(repository, digest string) ([]byte, error) {
+	path := "/v2/" + repository + "/blobs/" + digest
+	resp, err := c.do("GET", path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", path, err)
+	}
+	if got := Digest(data); got != digest {
+		return nil, fmt.Errorf("blob %s has digest %s", digest, got)
+	}
+	return data, nil
+}
+
+// do sends a request to path, which may also be an absolute upload URL, and
+// fails on non-2xx responses
+func (c *Client) do(method, path string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	target := path
+	if u, err := url.Parse(path); err != nil || !u.IsAbs() {
+		target = c.BaseURL + path
+	}
+
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s request: %w", path, err)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s request failed: %w", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &StatusError{Method: method, Path: path, StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return resp, nil
+}
+
+// StatusError is returned for non-2xx registry responses
+type StatusError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s returned status %d: %s", e.Method, e.Path, e.StatusCode, strings.TrimSpace(e.Body))
+}
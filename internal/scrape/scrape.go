@@ -0,0 +1,255 @@
+// Package scrape turns the prometheus_targets outputs of the environments
+// into Prometheus configuration: a file_sd target file per job and a
+// scrape config file that reads them.
+package scrape
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/yebyen/home-lab-terraform/internal/tfoutput"
+	"gopkg.in/yaml.v3"
+)
+
+// Target is one module's prometheus_target output
+type Target struct {
+	Job string `json:"job"`
+	// Targets are host:port addresses, or URLs for probed jobs
+	Targets     []string `json:"targets"`
+	MetricsPath string   `json:"metrics_path"`
+	// ScrapeInterval is empty to use Prometheus' global interval
+	ScrapeInterval string `json:"scrape_interval"`
+	// ProbeModule is the blackbox exporter module for services without
+	// metrics of their own, e.g. http_2xx; empty for exporters
+	ProbeModule string            `json:"probe_module"`
+	Labels      map[string]string `json:"labels"`
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// LabelName turns a module tag such as "Environment" into a Prometheus
+// label name ("environment")
+func LabelName(tag string) string {
+	name := invalidLabelChars.ReplaceAllString(strings.ToLower(tag), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// FromOutputs reads an environment's prometheus_targets output, skipping
+// modules that export nothing (null). Tags become labels and every target
+// is labelled env=<env>. An environment without the output has no targets.
+func FromOutputs(env string, outputs tfoutput.Outputs) ([]Target, error) {
+	if _, ok := outputs["prometheus_targets"]; !ok {
+		return nil, nil
+	}
+	var declared []*Target
+	if err := outputs.Decode("prometheus_targets", &declared); err != nil {
+		return nil, err
+	}
+
+	var targets []Target
+	for _, target := range declared {
+		if target == nil {
+			continue
+		}
+		if target.Job == "" || len(target.Targets) == 0 {
+			return nil, fmt.Errorf("%s: prometheus target needs a job and at least one target", env)
+		}
+		labels := map[string]string{"env": env}
+		for tag, value := range target.Labels {
+			name := LabelName(tag)
+			if _, taken := labels[name]; taken {
+				return nil, fmt.Errorf("%s: job %s: tag %q collides with label %q", env, target.Job, tag, name)
+			}
+			labels[name] = value
+		}
+		target.Labels = labels
+		targets = append(targets, *target)
+	}
+	return targets, nil
+}
+
+// Localize replaces localhost in target addresses with host. Modules
+// report Docker-published ports as localhost:PORT, which only works for a
+// Prometheus on the Docker host itself.
+func Localize(targets []Target, host string) ([]Target, error) {
+	if host == "" {
+		return targets, nil
+	}
+	localized := make([]Target, len(targets))
+	for i, target := range targets {
+		target.Targets = slices.Clone(target.Targets)
+		for j, address := range target.Targets {
+			replaced, err := replaceLocalhost(address, host)
+			if err != nil {
+				return nil, fmt.Errorf("job %s: %w", target.Job, err)
+			}
+			target.Targets[j] = replaced
+		}
+		localized[i] = target
+	}
+	return localized, nil
+}
+
+func replaceLocalhost(address, host string) (string, error) {
+	isLocal := func(h string) bool { return h == "localhost" || h == "127.0.0.1" || h == "0.0.0.0" }
+	if strings.Contains(address, "://") {
+		u, err := url.Parse(address)
+		if err != nil {
+			return "", fmt.Errorf("invalid target %q: %w", address, err)
+		}
+		if isLocal(u.Hostname()) {
+			if port := u.Port(); port != "" {
+				u.Host = net.JoinHostPort(host, port)
+			} else {
+				u.Host = host
+			}
+		}
+		return u.String(), nil
+	}
+	targetHost, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid target %q: %w", address, err)
+	}
+	if isLocal(targetHost) {
+		targetHost = host
+	}
+	return net.JoinHostPort(targetHost, port), nil
+}
+
+// Options control the generated scrape config
+type Options struct {
+	// SDDir is the directory Prometheus reads the file_sd files from
+	SDDir string
+	// Blackbox is the blackbox exporter's host:port for probed jobs
+	Blackbox string
+}
+
+// fileSDGroup is an entry of a file_sd target file
+type fileSDGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+type scrapeConfig struct {
+	JobName        string              `yaml:"job_name"`
+	ScrapeInterval string              `yaml:"scrape_interval,omitempty"`
+	MetricsPath    string              `yaml:"metrics_path,omitempty"`
+	Params         map[string][]string `yaml:"params,omitempty"`
+	FileSDConfigs  []fileSDConfig      `yaml:"file_sd_configs"`
+	RelabelConfigs []relabelConfig     `yaml:"relabel_configs,omitempty"`
+}
+
+type fileSDConfig struct {
+	Files []string `yaml:"files"`
+}
+
+type relabelConfig struct {
+	SourceLabels []string `yaml:"source_labels,omitempty,flow"`
+	TargetLabel  string   `yaml:"target_label"`
+	Replacement  string   `yaml:"replacement,omitempty"`
+}
+
+// Files renders a file_sd/<job>.json per job and scrape-configs.yml, a
+// file for Prometheus' scrape_config_files that scrapes every job from
+// its target file. Targets of one job must agree on how to scrape it.
+func Files(targets []Target, opts Options) (map[string][]byte, error) {
+	if opts.SDDir == "" {
+		opts.SDDir = "file_sd"
+	}
+	if opts.Blackbox == "" {
+		opts.Blackbox = "localhost:9115"
+	}
+
+	jobs := make(map[string][]Target)
+	for _, target := range targets {
+		jobs[target.Job] = append(jobs[target.Job], target)
+	}
+	names := make([]string, 0, len(jobs))
+	for name := range jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := make(map[string][]byte)
+	var configs []scrapeConfig
+	for _, name := range names {
+		config, err := jobConfig(name, jobs[name], opts)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
+
+		var groups []fileSDGroup
+		for _, target := range jobs[name] {
+			addresses := slices.Clone(target.Targets)
+			sort.Strings(addresses)
+			groups = append(groups, fileSDGroup{Targets: addresses, Labels: target.Labels})
+		}
+		// The same address can be deployed by several environments
+		sort.SliceStable(groups, func(i, j int) bool {
+			if groups[i].Targets[0] != groups[j].Targets[0] {
+				return groups[i].Targets[0] < groups[j].Targets[0]
+			}
+			return groups[i].Labels["env"] < groups[j].Labels["env"]
+		})
+		data, err := json.MarshalIndent(groups, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s targets: %w", name, err)
+		}
+		files["file_sd/"+name+".json"] = append(data, '\n')
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(map[string]interface{}{"scrape_configs": configs}); err != nil {
+		return nil, fmt.Errorf("failed to marshal scrape configs: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to marshal scrape configs: %w", err)
+	}
+	files["scrape-configs.yml"] = buf.Bytes()
+	return files, nil
+}
+
+// jobConfig builds the scrape config for one job's targets
+func jobConfig(name string, targets []Target, opts Options) (scrapeConfig, error) {
+	first := targets[0]
+	for _, target := range targets[1:] {
+		if target.MetricsPath != first.MetricsPath || target.ProbeModule != first.ProbeModule {
+			return scrapeConfig{}, fmt.Errorf("job %s: targets disagree on metrics_path or probe_module", name)
+		}
+		if target.ScrapeInterval != first.ScrapeInterval {
+			return scrapeConfig{}, fmt.Errorf("job %s: targets disagree on scrape_interval (%q and %q)",
+				name, first.ScrapeInterval, target.ScrapeInterval)
+		}
+	}
+
+	config := scrapeConfig{
+		JobName:        name,
+		ScrapeInterval: first.ScrapeInterval,
+		MetricsPath:    first.MetricsPath,
+		FileSDConfigs:  []fileSDConfig{{Files: []string{path.Join(opts.SDDir, name+".json")}}},
+	}
+	if first.ProbeModule != "" {
+		// Scrape the blackbox exporter, passing each target as the URL to probe
+		config.Params = map[string][]string{"module": {first.ProbeModule}}
+		config.RelabelConfigs = []relabelConfig{
+			{SourceLabels: []string{"__address__"}, TargetLabel: "__param_target"},
+			{SourceLabels: []string{"__param_target"}, TargetLabel: "instance"},
+			{TargetLabel: "__address__", Replacement: opts.Blackbox},
+		}
+	}
+	return config, nil
+}
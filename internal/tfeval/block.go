@@ -0,0 +1,177 @@
+package tfeval
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+// Block is a resource or one of its nested blocks, bound to the context its
+// arguments are evaluated in (including dynamic block iterators)
+type Block struct {
+	Type   string
+	Labels []string
+
+	module *Module
+	body   *hclsyntax.Body
+	ctx    *hcl.EvalContext
+}
+
+// Has reports whether the block sets the argument
+func (b *Block) Has(name string) bool {
+	_, ok := b.body.Attributes[name]
+	return ok
+}
+
+// Attr evaluates an argument of the block
+func (b *Block) Attr(name string) (cty.Value, error) {
+	attr, ok := b.body.Attributes[name]
+	if !ok {
+		return cty.NilVal, fmt.Errorf("%s: argument %q is not set", b.describe(), name)
+	}
+	value, err := b.module.eval(attr.Expr, b.ctx)
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("%s: %w", b.describe(), err)
+	}
+	return value, nil
+}
+
+// String evaluates an argument that must be a known string
+func (b *Block) String(name string) (string, error) {
+	var out string
+	return out, b.decode(name, cty.String, &out)
+}
+
+// Strings evaluates an argument that must be a known list of strings
+func (b *Block) Strings(name string) ([]string, error) {
+	var out []string
+	return out, b.decode(name, cty.List(cty.String), &out)
+}
+
+// Int evaluates an argument that must be a known whole number
+func (b *Block) Int(name string) (int, error) {
+	var out int
+	return out, b.decode(name, cty.Number, &out)
+}
+
+// Bool evaluates an argument that must be a known bool
+func (b *Block) Bool(name string) (bool, error) {
+	var out bool
+	return out, b.decode(name, cty.Bool, &out)
+}
+
+func (b *Block) decode(name string, want cty.Type, out interface{}) error {
+	value, err := b.Attr(name)
+	if err != nil {
+		return err
+	}
+	if !value.IsWhollyKnown() {
+		return fmt.Errorf("%s: %q is not known until apply", b.describe(), name)
+	}
+	if value, err = convert.Convert(value, want); err != nil {
+		return fmt.Errorf("%s: %q: %w", b.describe(), name, err)
+	}
+	if err := gocty.FromCtyValue(value, out); err != nil {
+		return fmt.Errorf("%s: %q: %w", b.describe(), name, err)
+	}
+	return nil
+}
+
+// Blocks returns the nested blocks of a type in source order, with
+// `dynamic` blocks of that type expanded over their for_each
+func (b *Block) Blocks(blockType string) ([]*Block, error) {
+	var blocks []*Block
+	for _, nested := range b.body.Blocks {
+		switch {
+		case nested.Type == blockType:
+			blocks = append(blocks, &Block{Type: blockType, Labels: nested.Labels, module: b.module, body: nested.Body, ctx: b.ctx})
+		case nested.Type == "dynamic" && len(nested.Labels) == 1 && nested.Labels[0] == blockType:
+			expanded, err := b.expandDynamic(nested)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, expanded...)
+		}
+	}
+	return blocks, nil
+}
+
+func (b *Block) expandDynamic(dynamic *hclsyntax.Block) ([]*Block, error) {
+	blockType := dynamic.Labels[0]
+	where := fmt.Sprintf("%s: dynamic %q", b.describe(), blockType)
+
+	forEach, ok := dynamic.Body.Attributes["for_each"]
+	if !ok {
+		return nil, fmt.Errorf("%s has no for_each", where)
+	}
+	collection, err := b.module.eval(forEach.Expr, b.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s for_each: %w", where, err)
+	}
+	if !collection.IsWhollyKnown() {
+		return nil, fmt.Errorf("%s for_each is not known until apply", where)
+	}
+	if collection.IsNull() || !collection.CanIterateElements() {
+		return nil, fmt.Errorf("%s for_each must be a collection", where)
+	}
+
+	iterator := blockType
+	if attr, ok := dynamic.Body.Attributes["iterator"]; ok {
+		traversal, diags := hcl.AbsTraversalForExpr(attr.Expr)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("%s iterator: %w", where, diags)
+		}
+		iterator = traversal.RootName()
+	}
+
+	var content *hclsyntax.Body
+	for _, nested := range dynamic.Body.Blocks {
+		if nested.Type == "content" {
+			content = nested.Body
+		}
+	}
+	if content == nil {
+		return nil, fmt.Errorf("%s has no content block", where)
+	}
+
+	var blocks []*Block
+	for it := collection.ElementIterator(); it.Next(); {
+		key, value := it.Element()
+		ctx := b.ctx.NewChild()
+		ctx.Variables = map[string]cty.Value{
+			iterator: cty.ObjectVal(map[string]cty.Value{"key": key, "value": value}),
+		}
+		blocks = append(blocks, &Block{Type: blockType, module: b.module, body: content, ctx: ctx})
+	}
+	return blocks, nil
+}
+
+// Count is how many instances the block declares: its count, the size of
+// its for_each, or 1
+func (b *Block) Count() (int, error) {
+	if b.Has("count") {
+		return b.Int("count")
+	}
+	if b.Has("for_each") {
+		value, err := b.Attr("for_each")
+		if err != nil {
+			return 0, err
+		}
+		if !value.IsWhollyKnown() {
+			return 0, fmt.Errorf("%s: for_each is not known until apply", b.describe())
+		}
+		return value.LengthInt(), nil
+	}
+	return 1, nil
+}
+
+func (b *Block) describe() string {
+	if b.Type == "resource" || b.Type == "data" {
+		return fmt.Sprintf("%s %s.%s", b.Type, b.Labels[0], b.Labels[1])
+	}
+	return b.Type
+}
@@ -0,0 +1,422 @@
+// Package tfeval evaluates a Terraform module's configuration offline with
+// hcl/v2 and cty: variables, locals, local module calls, outputs and
+// resource arguments, with no terraform binary, provider or Docker. Values
+// only known after apply (computed resource attributes, data sources)
+// evaluate to unknown.
+package tfeval
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/yebyen/home-lab-terraform/internal/tfschema"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Module is a module directory evaluated with a fixed set of inputs
+type Module struct {
+	Dir    string
+	Schema *tfschema.Module
+	// Vars are the inputs after type conversion, with defaults filled in
+	Vars map[string]cty.Value
+
+	locals    map[string]*hclsyntax.Attribute
+	outputs   map[string]*hclsyntax.Block
+	resources map[string]*hclsyntax.Block
+	calls     map[string]*hclsyntax.Block
+
+	localValues map[string]cty.Value
+	children    map[string]*Module
+	evaluating  map[string]bool
+}
+
+// Load parses dir and binds Go inputs, converted as terratest would pass them
+func Load(dir string, vars map[string]interface{}) (*Module, error) {
+	values := make(map[string]cty.Value, len(vars))
+	for name, raw := range vars {
+		value, err := tfschema.ValueFromGo(raw)
+		if err != nil {
+			return nil, fmt.Errorf("variable %q: %w", name, err)
+		}
+		values[name] = value
+	}
+	return LoadValues(dir, values)
+}
+
+// LoadValues parses dir and binds inputs that are already cty values, which
+// is how module calls pass arguments to their children
+func LoadValues(dir string, values map[string]cty.Value) (*Module, error) {
+	schema, err := tfschema.LoadModule(dir)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := schema.InputValues(values)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Module{
+		Dir:         dir,
+		Schema:      schema,
+		Vars:        vars,
+		locals:      make(map[string]*hclsyntax.Attribute),
+		outputs:     make(map[string]*hclsyntax.Block),
+		resources:   make(map[string]*hclsyntax.Block),
+		calls:       make(map[string]*hclsyntax.Block),
+		localValues: make(map[string]cty.Value),
+		children:    make(map[string]*Module),
+		evaluating:  make(map[string]bool),
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list module files: %w", err)
+	}
+	parser := hclparse.NewParser()
+	for _, path := range files {
+		file, diags := parser.ParseHCLFile(path)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, diags)
+		}
+		for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+			switch block.Type {
+			case "locals":
+				for name, attr := range block.Body.Attributes {
+					m.locals[name] = attr
+				}
+			case "output":
+				m.outputs[block.Labels[0]] = block
+			case "resource":
+				m.resources[block.Labels[0]+"."+block.Labels[1]] = block
+			case "data":
+				m.resources["data."+block.Labels[0]+"."+block.Labels[1]] = block
+			case "module":
+				m.calls[block.Labels[0]] = block
+			}
+		}
+	}
+	return m, nil
+}
+
+// Local evaluates local.name
+func (m *Module) Local(name string) (cty.Value, error) {
+	if value, ok := m.localValues[name]; ok {
+		return value, nil
+	}
+	attr, ok := m.locals[name]
+	if !ok {
+		return cty.NilVal, fmt.Errorf("%s: no local %q", m.Dir, name)
+	}
+
+	key := "local." + name
+	if m.evaluating[key] {
+		return cty.NilVal, fmt.Errorf("%s: local %q refers to itself", m.Dir, name)
+	}
+	m.evaluating[key] = true
+	defer delete(m.evaluating, key)
+
+	value, err := m.eval(attr.Expr, m.context())
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("local %q: %w", name, err)
+	}
+	m.localValues[name] = value
+	return value, nil
+}
+
+// Output evaluates an output's value
+func (m *Module) Output(name string) (cty.Value, error) {
+	block, ok := m.outputs[name]
+	if !ok {
+		return cty.NilVal, fmt.Errorf("%s: no output %q", m.Dir, name)
+	}
+	attr, ok := block.Body.Attributes["value"]
+	if !ok {
+		return cty.NilVal, fmt.Errorf("%s: output %q has no value", m.Dir, name)
+	}
+	value, err := m.eval(attr.Expr, m.context())
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("output %q: %w", name, err)
+	}
+	return value, nil
+}
+
+// OutputNames returns the declared outputs in sorted order
+func (m *Module) OutputNames() []string {
+	return sortedKeys(m.outputs)
+}
+
+// Resource returns a resource block by address, e.g. "docker_container.pihole"
+// or "data.docker_network.vlan"
+func (m *Module) Resource(address string) (*Block, error) {
+	block, ok := m.resources[address]
+	if !ok {
+		return nil, fmt.Errorf("%s: no resource %s (have %s)", m.Dir, address, strings.Join(m.Resources(), ", "))
+	}
+
+	ctx := m.context()
+	if _, counted := block.Body.Attributes["count"]; counted {
+		ctx = ctx.NewChild()
+		ctx.Variables = map[string]cty.Value{
+			"count": cty.ObjectVal(map[string]cty.Value{"index": cty.UnknownVal(cty.Number)}),
+		}
+	}
+	if _, each := block.Body.Attributes["for_each"]; each {
+		ctx = ctx.NewChild()
+		ctx.Variables = map[string]cty.Value{
+			"each": cty.ObjectVal(map[string]cty.Value{"key": cty.UnknownVal(cty.String), "value": cty.DynamicVal}),
+		}
+	}
+	return &Block{Type: block.Type, Labels: block.Labels, module: m, body: block.Body, ctx: ctx}, nil
+}
+
+// Resources returns every resource and data source address in sorted order
+func (m *Module) Resources() []string {
+	return sortedKeys(m.resources)
+}
+
+// ModuleCall loads the child module a `module` block calls, with its
+// arguments evaluated in this module. Only local sources are supported.
+func (m *Module) ModuleCall(name string) (*Module, error) {
+	if child, ok := m.children[name]; ok {
+		return child, nil
+	}
+	block, ok := m.calls[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: no module %q", m.Dir, name)
+	}
+
+	key := "module." + name
+	if m.evaluating[key] {
+		return nil, fmt.Errorf("%s: module %q depends on itself", m.Dir, name)
+	}
+	m.evaluating[key] = true
+	defer delete(m.evaluating, key)
+
+	var source string
+	args := make(map[string]cty.Value)
+	for argName, attr := range block.Body.Attributes {
+		switch argName {
+		case "source":
+			value, err := m.eval(attr.Expr, m.context())
+			if err != nil || !value.IsKnown() || !value.Type().Equals(cty.String) {
+				return nil, fmt.Errorf("module %q: source must be a literal string", name)
+			}
+			source = value.AsString()
+		case "version", "count", "for_each", "providers", "depends_on":
+			// Meta-arguments, not inputs
+		default:
+			value, err := m.eval(attr.Expr, m.context())
+			if err != nil {
+				return nil, fmt.Errorf("module %q argument %q: %w", name, argName, err)
+			}
+			args[argName] = value
+		}
+	}
+	if !strings.HasPrefix(source, "./") && !strings.HasPrefix(source, "../") {
+		return nil, fmt.Errorf("module %q: only local sources can be evaluated, got %q", name, source)
+	}
+
+	child, err := LoadValues(filepath.Join(m.Dir, source), args)
+	if err != nil {
+		return nil, fmt.Errorf("module %q: %w", name, err)
+	}
+	m.children[name] = child
+	return child, nil
+}
+
+// ModuleCalls returns the names of the module blocks in sorted order
+func (m *Module) ModuleCalls() []string {
+	return sortedKeys(m.calls)
+}
+
+// context is the root evaluation context of the module
+func (m *Module) context() *hcl.EvalContext {
+	return &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"var": cty.ObjectVal(m.Vars),
+			"path": cty.ObjectVal(map[string]cty.Value{
+				"module": cty.StringVal(m.Dir),
+				"root":   cty.StringVal(m.Dir),
+				"cwd":    cty.StringVal("."),
+			}),
+			"terraform": cty.ObjectVal(map[string]cty.Value{"workspace": cty.StringVal("default")}),
+		},
+		Functions: tfschema.Functions,
+	}
+}
+
+// eval evaluates expr in ctx after resolving exactly the locals, module
+// outputs and resource attributes it refers to
+func (m *Module) eval(expr hcl.Expression, ctx *hcl.EvalContext) (cty.Value, error) {
+	locals := make(map[string]cty.Value)
+	modules := make(map[string]cty.Value)
+	resources := make(map[string]map[string]map[string]cty.Value)
+	data := false
+
+	for _, traversal := range expr.Variables() {
+		root := traversal.RootName()
+		switch {
+		case root == "local":
+			name := attrName(traversal, 1)
+			value, err := m.Local(name)
+			if err != nil {
+				return cty.NilVal, err
+			}
+			locals[name] = value
+		case root == "module":
+			name := attrName(traversal, 1)
+			modules[name] = m.moduleValue(name)
+		case root == "data":
+			data = true
+		case m.hasResourceType(root):
+			name, attr := attrName(traversal, 1), attrName(traversal, 2)
+			if resources[root] == nil {
+				resources[root] = make(map[string]map[string]cty.Value)
+			}
+			if resources[root][name] == nil {
+				resources[root][name] = make(map[string]cty.Value)
+			}
+			if attr != "" {
+				resources[root][name][attr] = m.resourceAttr(root+"."+name, attr)
+			}
+		}
+	}
+
+	scope := ctx.NewChild()
+	scope.Variables = make(map[string]cty.Value)
+	if len(locals) > 0 {
+		scope.Variables["local"] = cty.ObjectVal(locals)
+	}
+	if len(modules) > 0 {
+		scope.Variables["module"] = cty.ObjectVal(modules)
+	}
+	if data {
+		scope.Variables["data"] = cty.DynamicVal
+	}
+	for resourceType, byName := range resources {
+		instances := make(map[string]cty.Value)
+		for name, attrs := range byName {
+			if block := m.resources[resourceType+"."+name]; block != nil && isRepeated(block) {
+				// count/for_each resources are indexed; their shape is not modelled
+				instances[name] = cty.DynamicVal
+				continue
+			}
+			instances[name] = cty.ObjectVal(attrs)
+		}
+		scope.Variables[resourceType] = cty.ObjectVal(instances)
+	}
+
+	value, diags := expr.Value(scope)
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+	return value, nil
+}
+
+// resourceAttr is the configured value of a resource argument, or unknown
+// when the argument is computed by the provider
+func (m *Module) resourceAttr(address, attr string) cty.Value {
+	block := m.resources[address]
+	if block == nil {
+		return cty.DynamicVal
+	}
+	expr, ok := block.Body.Attributes[attr]
+	if !ok {
+		return cty.DynamicVal
+	}
+
+	key := address + "." + attr
+	if m.evaluating[key] {
+		return cty.DynamicVal
+	}
+	m.evaluating[key] = true
+	defer delete(m.evaluating, key)
+
+	value, err := m.eval(expr.Expr, m.context())
+	if err != nil {
+		return cty.DynamicVal
+	}
+	return value
+}
+
+// moduleValue is the object of a child module's outputs as seen by the
+// caller; outputs that can't be evaluated offline are unknown
+func (m *Module) moduleValue(name string) cty.Value {
+	if block := m.calls[name]; block == nil || isRepeated(block) {
+		return cty.DynamicVal
+	}
+	child, err := m.ModuleCall(name)
+	if err != nil {
+		return cty.DynamicVal
+	}
+
+	outputs := make(map[string]cty.Value)
+	for _, output := range child.OutputNames() {
+		value, err := child.Output(output)
+		if err != nil {
+			value = cty.DynamicVal
+		}
+		outputs[output] = value
+	}
+	return cty.ObjectVal(outputs)
+}
+
+func (m *Module) hasResourceType(name string) bool {
+	prefix := name + "."
+	for address := range m.resources {
+		if strings.HasPrefix(address, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isRepeated(block *hclsyntax.Block) bool {
+	_, count := block.Body.Attributes["count"]
+	_, each := block.Body.Attributes["for_each"]
+	return count || each
+}
+
+// attrName returns the attribute name at position i of a traversal, or ""
+func attrName(traversal hcl.Traversal, i int) string {
+	if i >= len(traversal) {
+		return ""
+	}
+	if attr, ok := traversal[i].(hcl.TraverseAttr); ok {
+		return attr.Name
+	}
+	return ""
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ToGo converts a fully known value to plain Go values via JSON: objects
+// and maps become map[string]interface{}, numbers float64
+func ToGo(value cty.Value) (interface{}, error) {
+	if !value.IsWhollyKnown() {
+		return nil, fmt.Errorf("value is not known until apply")
+	}
+	data, err := ctyjson.Marshal(value, value.Type())
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
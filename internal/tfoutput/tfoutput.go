@@ -0,0 +1,76 @@
+// Package tfoutput reads the `output -json` document of a Terraform/OpenTofu
+// root module, such as one of the directories under terraform/environments.
+package tfoutput
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+)
+
+// Output is a single entry of `terraform output -json`
+type Output struct {
+	Sensitive bool            `json:"sensitive"`
+	Type      json.RawMessage `json:"type"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// Outputs maps output names to their values
+type Outputs map[string]Output
+
+// Read runs `<binary> output -json` in dir and parses the result. binary is
+// usually "tofu" or "terraform".
+func Read(binary, dir string) (Outputs, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(binary, "-chdir="+dir, "output", "-json")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s output -json in %s failed: %w: %s", binary, dir, err, stderr.String())
+	}
+
+	return Parse(stdout.Bytes())
+}
+
+// Parse decodes a `terraform output -json` document
+func Parse(data []byte) (Outputs, error) {
+	var outputs Outputs
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		return nil, fmt.Errorf("failed to parse terraform outputs: %w", err)
+	}
+	return outputs, nil
+}
+
+// Names returns the output names in sorted order
+func (o Outputs) Names() []string {
+	names := make([]string, 0, len(o))
+	for name := range o {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Decode unmarshals the value of the named output into v
+func (o Outputs) Decode(name string, v interface{}) error {
+	output, ok := o[name]
+	if !ok {
+		return fmt.Errorf("output %q not found", name)
+	}
+	if err := json.Unmarshal(output.Value, v); err != nil {
+		return fmt.Errorf("failed to decode output %q: %w", name, err)
+	}
+	return nil
+}
+
+// String returns the value of the named output if it is a string
+func (o Outputs) String(name string) (string, bool) {
+	var value string
+	if err := o.Decode(name, &value); err != nil {
+		return "", false
+	}
+	return value, true
+}
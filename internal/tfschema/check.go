@@ -0,0 +1,140 @@
+package tfschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// VarsError lists every problem CheckVars found in a Vars map
+type VarsError struct {
+	Dir      string
+	Problems []string
+}
+
+func (e *VarsError) Error() string {
+	return fmt.Sprintf("invalid variables for %s:\n  %s", e.Dir, strings.Join(e.Problems, "\n  "))
+}
+
+// CheckVars validates a terraform.Options-style Vars map against the module:
+// unknown keys (with a suggestion for near misses), values that don't
+// convert to the declared type, missing required variables, and validation
+// blocks whose condition is false. Conditions that use functions Functions
+// does not provide are skipped rather than reported.
+func (m *Module) CheckVars(vars map[string]interface{}) error {
+	var problems []string
+
+	values := make(map[string]cty.Value, len(vars))
+	for name, raw := range vars {
+		value, err := ValueFromGo(raw)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			value = cty.DynamicVal
+		}
+		values[name] = value
+	}
+
+	_, inputProblems := m.inputValues(values)
+	return m.varsError(append(problems, inputProblems...))
+}
+
+// InputValues converts the values given for a module's variables the way
+// Terraform does and fills in defaults, returning the complete `var` object
+// attributes. The error is a *VarsError with the same checks as CheckVars.
+func (m *Module) InputValues(values map[string]cty.Value) (map[string]cty.Value, error) {
+	inputs, problems := m.inputValues(values)
+	if err := m.varsError(problems); err != nil {
+		return nil, err
+	}
+	return inputs, nil
+}
+
+func (m *Module) inputValues(given map[string]cty.Value) (map[string]cty.Value, []string) {
+	var problems []string
+
+	for name := range given {
+		if _, ok := m.Variables[name]; !ok {
+			problem := fmt.Sprintf("%s: not declared by the module", name)
+			if suggestion := m.Suggest(name); suggestion != "" {
+				problem += fmt.Sprintf(" (did you mean %q?)", suggestion)
+			}
+			problems = append(problems, problem)
+		}
+	}
+
+	values := make(map[string]cty.Value)
+	for _, name := range m.Names() {
+		variable := m.Variables[name]
+
+		value, ok := given[name]
+		if !ok {
+			if variable.Required() {
+				problems = append(problems, fmt.Sprintf("%s: required variable not set", name))
+				continue
+			}
+			values[name] = variable.Default
+			continue
+		}
+
+		value, err := variable.Convert(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if value.IsNull() && !variable.Nullable {
+			problems = append(problems, fmt.Sprintf("%s: must not be null", name))
+			continue
+		}
+		values[name] = value
+	}
+
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{"var": cty.ObjectVal(values)},
+		Functions: Functions,
+	}
+	for _, name := range m.Names() {
+		if _, ok := values[name]; !ok {
+			continue
+		}
+		for _, validation := range m.Variables[name].Validations {
+			result, diags := validation.Condition.Value(ctx)
+			if diags.HasErrors() || !result.IsKnown() || result.IsNull() || !result.Type().Equals(cty.Bool) {
+				continue
+			}
+			if result.False() {
+				problems = append(problems, fmt.Sprintf("%s: %s", name, validation.ErrorMessage))
+			}
+		}
+	}
+	return values, problems
+}
+
+func (m *Module) varsError(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return &VarsError{Dir: m.Dir, Problems: problems}
+}
+
+// ValueFromGo converts a Go value as terratest would pass it on the command
+// line; JSON is the common ground between Go and cty
+func ValueFromGo(v interface{}) (cty.Value, error) {
+	if v == nil {
+		return cty.NullVal(cty.DynamicPseudoType), nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("cannot encode %T: %w", v, err)
+	}
+	ty, err := ctyjson.ImpliedType(data)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	return ctyjson.Unmarshal(data, ty)
+}
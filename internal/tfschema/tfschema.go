@@ -0,0 +1,227 @@
+// Package tfschema reads the variable declarations of a Terraform module so
+// Go callers can check the inputs they pass before Terraform does
+package tfschema
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// Variable is a `variable` block declared by a module
+type Variable struct {
+	Name        string
+	Description string
+	Sensitive   bool
+	Nullable    bool
+	// Type is cty.DynamicPseudoType when the block has no type constraint
+	Type     cty.Type
+	Defaults *typeexpr.Defaults
+	// Default is cty.NilVal for required variables
+	Default     cty.Value
+	Validations []Validation
+	// Range points at the declaration for error messages
+	Range hcl.Range
+}
+
+// Validation is a `validation` block of a variable
+type Validation struct {
+	Condition    hcl.Expression
+	ErrorMessage string
+	Range        hcl.Range
+}
+
+// Required reports whether callers must set the variable
+func (v *Variable) Required() bool {
+	return v.Default.Type() == cty.NilType
+}
+
+// Module is the set of variables declared across a module's .tf files
+type Module struct {
+	Dir       string
+	Variables map[string]*Variable
+}
+
+var fileSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{{Type: "variable", LabelNames: []string{"name"}}},
+}
+
+var variableSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "description"},
+		{Name: "type"},
+		{Name: "default"},
+		{Name: "sensitive"},
+		{Name: "nullable"},
+	},
+	Blocks: []hcl.BlockHeaderSchema{{Type: "validation"}},
+}
+
+var validationSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "condition", Required: true},
+		{Name: "error_message", Required: true},
+	},
+}
+
+// LoadModule parses every .tf file in dir and collects its variable blocks
+func LoadModule(dir string) (*Module, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list module files: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .tf files in %s", dir)
+	}
+
+	module := &Module{Dir: dir, Variables: make(map[string]*Variable)}
+	parser := hclparse.NewParser()
+	for _, path := range files {
+		file, diags := parser.ParseHCLFile(path)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, diags)
+		}
+
+		content, _, diags := file.Body.PartialContent(fileSchema)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed to read %s: %w", path, diags)
+		}
+		for _, block := range content.Blocks {
+			variable, err := decodeVariable(block)
+			if err != nil {
+				return nil, err
+			}
+			if previous, ok := module.Variables[variable.Name]; ok {
+				return nil, fmt.Errorf("%s: duplicate variable %q, first declared at %s", variable.Range, variable.Name, previous.Range)
+			}
+			module.Variables[variable.Name] = variable
+		}
+	}
+	return module, nil
+}
+
+// decodeVariable reads a variable block the way Terraform does: the type is
+// a type constraint, the default must convert to it, and validation
+// conditions are kept as expressions for CheckVars to evaluate
+func decodeVariable(block *hcl.Block) (*Variable, error) {
+	variable := &Variable{
+		Name:     block.Labels[0],
+		Type:     cty.DynamicPseudoType,
+		Nullable: true,
+		Range:    block.DefRange,
+	}
+
+	content, _, diags := block.Body.PartialContent(variableSchema)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("variable %q: %w", variable.Name, diags)
+	}
+	if attr, ok := content.Attributes["description"]; ok {
+		if diags := gohcl.DecodeExpression(attr.Expr, nil, &variable.Description); diags.HasErrors() {
+			return nil, fmt.Errorf("variable %q description: %w", variable.Name, diags)
+		}
+	}
+	if attr, ok := content.Attributes["sensitive"]; ok {
+		if diags := gohcl.DecodeExpression(attr.Expr, nil, &variable.Sensitive); diags.HasErrors() {
+			return nil, fmt.Errorf("variable %q sensitive: %w", variable.Name, diags)
+		}
+	}
+	if attr, ok := content.Attributes["nullable"]; ok {
+		if diags := gohcl.DecodeExpression(attr.Expr, nil, &variable.Nullable); diags.HasErrors() {
+			return nil, fmt.Errorf("variable %q nullable: %w", variable.Name, diags)
+		}
+	}
+	if attr, ok := content.Attributes["type"]; ok {
+		ty, defaults, diags := typeexpr.TypeConstraintWithDefaults(attr.Expr)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("variable %q type: %w", variable.Name, diags)
+		}
+		variable.Type, variable.Defaults = ty, defaults
+	}
+	if attr, ok := content.Attributes["default"]; ok {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("variable %q default: %w", variable.Name, diags)
+		}
+		converted, err := variable.Convert(value)
+		if err != nil {
+			return nil, fmt.Errorf("variable %q default: %w", variable.Name, err)
+		}
+		variable.Default = converted
+	}
+
+	for _, block := range content.Blocks {
+		validation, diags := block.Body.Content(validationSchema)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("variable %q validation: %w", variable.Name, diags)
+		}
+		var message string
+		if diags := gohcl.DecodeExpression(validation.Attributes["error_message"].Expr, nil, &message); diags.HasErrors() {
+			return nil, fmt.Errorf("variable %q validation error_message: %w", variable.Name, diags)
+		}
+		variable.Validations = append(variable.Validations, Validation{
+			Condition:    validation.Attributes["condition"].Expr,
+			ErrorMessage: message,
+			Range:        block.DefRange,
+		})
+	}
+	return variable, nil
+}
+
+// Convert applies the variable's type constraint and optional attribute
+// defaults to value
+func (v *Variable) Convert(value cty.Value) (cty.Value, error) {
+	if v.Defaults != nil {
+		value = v.Defaults.Apply(value)
+	}
+	converted, err := convert.Convert(value, v.Type)
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("want %s: %w", typeexpr.TypeString(v.Type), err)
+	}
+	return converted, nil
+}
+
+// Names returns the declared variable names in sorted order
+func (m *Module) Names() []string {
+	names := make([]string, 0, len(m.Variables))
+	for name := range m.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UnknownVars returns the keys of vars the module does not declare, sorted
+func (m *Module) UnknownVars(vars map[string]interface{}) []string {
+	var unknown []string
+	for name := range vars {
+		if _, ok := m.Variables[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// Suggest returns the declared variable that name most likely meant, or ""
+// when nothing is close. Underscores and case are ignored, which catches
+// slips like "webpassword" for "web_password".
+func (m *Module) Suggest(name string) string {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(s))
+	}
+	want := normalize(name)
+	for _, declared := range m.Names() {
+		if normalize(declared) == want {
+			return declared
+		}
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+// Package tftp is a minimal read-only TFTP client (RFC 1350, with the
+// RFC 2348 blksize option), enough to fetch the boot loaders dnsmasq serves.
+package tftp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	opRRQ   = 1
+	opData  = 3
+	opAck   = 4
+	opError = 5
+	opOACK  = 6
+
+	defaultBlockSize = 512
+)
+
+// Error is an ERROR packet sent by the server, e.g. code 1 for a missing file
+type Error struct {
+	Code    uint16
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("TFTP error %d: %s", e.Code, e.Message)
+}
+
+// Client fetches files from one TFTP server
+type Client struct {
+	// Server is host:port, usually port 69
+	Server string
+	// Timeout is how long to wait for each packet before retransmitting
+	Timeout time.Duration
+	// Retries is how many times a packet is retransmitted before giving up
+	Retries int
+	// BlockSize is requested with the blksize option when set
+	BlockSize int
+}
+
+// Get downloads a file in octet mode
+func (c *Client) Get(filename string) ([]byte, error) {
+	server, err := net.ResolveUDPAddr("udp", c.Server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TFTP server %q: %w", c.Server, err)
+	}
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+	defer conn.Close()
+
+	timeout, retries := c.Timeout, c.Retries
+	if timeout == 0 {
+		timeout = 2 * time.Second
+	}
+	if retries == 0 {
+		retries = 3
+	}
+
+	request := []byte{0, opRRQ}
+	request = append(request, filename...)
+	request = append(request, 0)
+	request = append(request, "octet"...)
+	request = append(request, 0)
+	if c.BlockSize > 0 {
+		request = append(request, "blksize"...)
+		request = append(request, 0)
+		request = append(request, strconv.Itoa(c.BlockSize)...)
+		request = append(request, 0)
+	}
+
+	var (
+		file      bytes.Buffer
+		blockSize = defaultBlockSize
+		expected  = uint16(1)
+		// The server answers from a new port, its transfer ID
+		remote  *net.UDPAddr
+		last    = request
+		lastTo  = server
+		buf     = make([]byte, 65536)
+		attempt = 0
+	)
+	for {
+		if _, err := conn.WriteToUDP(last, lastTo); err != nil {
+			return nil, fmt.Errorf("failed to send to %s: %w", lastTo, err)
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return nil, err
+		}
+
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				if attempt++; attempt > retries {
+					return nil, fmt.Errorf("no reply from %s for %s after %d attempts", c.Server, filename, attempt)
+				}
+				continue
+			}
+			return nil, err
+		}
+		if remote == nil {
+			remote = from
+		} else if from.Port != remote.Port || !from.IP.Equal(remote.IP) {
+			continue
+		}
+		if n < 4 {
+			return nil, fmt.Errorf("short packet from %s", from)
+		}
+		attempt = 0
+
+		packet := buf[:n]
+		switch binary.BigEndian.Uint16(packet) {
+		case opError:
+			return nil, &Error{Code: binary.BigEndian.Uint16(packet[2:]), Message: string(bytes.TrimRight(packet[4:], "\x00"))}
+		case opOACK:
+			// The server accepted options; acknowledging block 0 starts the transfer
+			options := bytes.Split(bytes.TrimRight(packet[2:], "\x00"), []byte{0})
+			for i := 0; i+1 < len(options); i += 2 {
+				if string(bytes.ToLower(options[i])) == "blksize" {
+					size, err := strconv.Atoi(string(options[i+1]))
+					if err != nil || size < 8 {
+						return nil, fmt.Errorf("server sent invalid blksize %q", options[i+1])
+					}
+					blockSize = size
+				}
+			}
+			last, lastTo = ack(0), remote
+		case opData:
+			block := binary.BigEndian.Uint16(packet[2:])
+			// Re-acknowledge a duplicate of the previous block so a server
+			// that missed our ACK moves on
+			if block != expected {
+				last, lastTo = ack(expected-1), remote
+				continue
+			}
+			file.Write(packet[4:])
+			last, lastTo = ack(block), remote
+			if len(packet)-4 < blockSize {
+				conn.WriteToUDP(last, lastTo)
+				return file.Bytes(), nil
+			}
+			expected++
+		default:
+			return nil, fmt.Errorf("unexpected TFTP opcode %d from %s", binary.BigEndian.Uint16(packet), from)
+		}
+	}
+}
+
+func ack(block uint16) []byte {
+	return []byte{0, opAck, byte(block >> 8), byte(block)}
+}
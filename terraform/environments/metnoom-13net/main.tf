@@ -1,35 +1,40 @@
 # METNOOM 13-net Infrastructure Environment
 # Replicates the complete container setup on Synology single-homed in 13-net
 
-# Registry pull-through caches (ports 5050-5054)
+# Registry pull-through caches (ports 5050-5054, metrics on 5060-5064)
 module "docker_cache" {
   source = "../../modules/registry-cache"
   registry_name = "docker.io"
   cache_port    = 5050
+  debug_port    = 5060
 }
 
 module "k8s_cache" {
   source = "../../modules/registry-cache"
   registry_name = "registry.k8s.io"
   cache_port    = 5051
+  debug_port    = 5061
 }
 
 module "quay_cache" {
   source = "../../modules/registry-cache"
   registry_name = "quay.io"
   cache_port    = 5052
+  debug_port    = 5062
 }
 
 module "gcr_cache" {
   source = "../../modules/registry-cache"
   registry_name = "gcr.io"
   cache_port    = 5053
+  debug_port    = 5063
 }
 
 module "ghcr_cache" {
   source = "../../modules/registry-cache"
   registry_name = "ghcr.io"
   cache_port    = 5054
+  debug_port    = 5064
 }
 
 # DNSmasq for DHCP/DNS/TFTP on 13-net VLAN
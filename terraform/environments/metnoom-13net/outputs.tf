@@ -3,11 +3,11 @@
 output "registry_caches" {
   description = "Summary of all registry cache endpoints"
   value = {
-    docker_hub = module.docker_cache.cache_summary
-    kubernetes = module.k8s_cache.cache_summary
-    quay       = module.quay_cache.cache_summary
-    google     = module.gcr_cache.cache_summary
-    github     = module.ghcr_cache.cache_summary
+    docker_hub = merge(module.docker_cache.cache_summary, { upstream_registry = module.docker_cache.upstream_registry })
+    kubernetes = merge(module.k8s_cache.cache_summary, { upstream_registry = module.k8s_cache.upstream_registry })
+    quay       = merge(module.quay_cache.cache_summary, { upstream_registry = module.quay_cache.upstream_registry })
+    google     = merge(module.gcr_cache.cache_summary, { upstream_registry = module.gcr_cache.upstream_registry })
+    github     = merge(module.ghcr_cache.cache_summary, { upstream_registry = module.ghcr_cache.upstream_registry })
   }
 }
 
@@ -21,11 +21,40 @@ output "pxe_boot_server" {
   value = module.matchbox_13net.service_summary
 }
 
+output "pxe_boot_chain" {
+  description = "Both ends of the netboot chain, for checking dnsmasq points at matchbox"
+  value = {
+    dnsmasq = {
+      static_ip = module.dnsmasq_13net.static_ip
+      tftp      = module.dnsmasq_13net.tftp_config
+      pxe       = module.dnsmasq_13net.pxe_config
+    }
+    matchbox = {
+      static_ip     = module.matchbox_13net.static_ip
+      matchbox_port = module.matchbox_13net.matchbox_port
+      boot_ipxe_url = module.matchbox_13net.boot_ipxe_url
+    }
+  }
+}
+
 output "monitoring" {
   description = "Pi-hole monitoring configuration"
   value = module.pihole_exporter.service_summary
 }
 
+output "prometheus_targets" {
+  description = "Scrape targets for the exporter, the caches' metrics and matchbox, for homelab scrape-config"
+  value = [
+    module.pihole_exporter.prometheus_target,
+    module.docker_cache.prometheus_target,
+    module.k8s_cache.prometheus_target,
+    module.quay_cache.prometheus_target,
+    module.gcr_cache.prometheus_target,
+    module.ghcr_cache.prometheus_target,
+    module.matchbox_13net.prometheus_target
+  ]
+}
+
 output "network_topology" {
   description = "Complete 13-net network service topology"
   value = {
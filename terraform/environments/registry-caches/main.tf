@@ -1,12 +1,13 @@
 # Multi-Registry Cache Environment
 # Creates all registry caches matching current METNOOM setup
 
-# Docker Hub cache (port 5050)
+# Docker Hub cache (port 5050, metrics on 5060)
 module "docker_cache" {
   source = "../../modules/registry-cache"
   
   registry_name = "docker.io"
   cache_port    = 5050
+  debug_port    = 5060
   
   tags = {
     Environment = "production"
@@ -15,12 +16,13 @@ module "docker_cache" {
   }
 }
 
-# Kubernetes registry cache (port 5051)
+# Kubernetes registry cache (port 5051, metrics on 5061)
 module "k8s_cache" {
   source = "../../modules/registry-cache"
   
   registry_name = "registry.k8s.io"
   cache_port    = 5051
+  debug_port    = 5061
   
   tags = {
     Environment = "production"
@@ -29,12 +31,13 @@ module "k8s_cache" {
   }
 }
 
-# Quay cache (port 5052)
+# Quay cache (port 5052, metrics on 5062)
 module "quay_cache" {
   source = "../../modules/registry-cache"
   
   registry_name = "quay.io"
   cache_port    = 5052
+  debug_port    = 5062
   
   tags = {
     Environment = "production"
@@ -43,12 +46,13 @@ module "quay_cache" {
   }
 }
 
-# Google Container Registry cache (port 5053)
+# Google Container Registry cache (port 5053, metrics on 5063)
 module "gcr_cache" {
   source = "../../modules/registry-cache"
   
   registry_name = "gcr.io"
   cache_port    = 5053
+  debug_port    = 5063
   
   tags = {
     Environment = "production"
@@ -57,12 +61,13 @@ module "gcr_cache" {
   }
 }
 
-# GitHub Container Registry cache (port 5054)
+# GitHub Container Registry cache (port 5054, metrics on 5064)
 module "ghcr_cache" {
   source = "../../modules/registry-cache"
   
   registry_name = "ghcr.io"
   cache_port    = 5054
+  debug_port    = 5064
   
   tags = {
     Environment = "production"
@@ -4,29 +4,34 @@ output "registry_caches" {
   description = "Summary of all deployed registry caches"
   value = {
     docker_hub = {
-      endpoint     = module.docker_cache.cache_endpoint
-      container_id = module.docker_cache.container_id
-      upstream     = module.docker_cache.upstream_url
+      endpoint          = module.docker_cache.cache_endpoint
+      container_id      = module.docker_cache.container_id
+      upstream          = module.docker_cache.upstream_url
+      upstream_registry = module.docker_cache.upstream_registry
     }
     kubernetes = {
-      endpoint     = module.k8s_cache.cache_endpoint
-      container_id = module.k8s_cache.container_id
-      upstream     = module.k8s_cache.upstream_url
+      endpoint          = module.k8s_cache.cache_endpoint
+      container_id      = module.k8s_cache.container_id
+      upstream          = module.k8s_cache.upstream_url
+      upstream_registry = module.k8s_cache.upstream_registry
     }
     quay = {
-      endpoint     = module.quay_cache.cache_endpoint
-      container_id = module.quay_cache.container_id
-      upstream     = module.quay_cache.upstream_url
+      endpoint          = module.quay_cache.cache_endpoint
+      container_id      = module.quay_cache.container_id
+      upstream          = module.quay_cache.upstream_url
+      upstream_registry = module.quay_cache.upstream_registry
     }
     google = {
-      endpoint     = module.gcr_cache.cache_endpoint
-      container_id = module.gcr_cache.container_id
-      upstream     = module.gcr_cache.upstream_url
+      endpoint          = module.gcr_cache.cache_endpoint
+      container_id      = module.gcr_cache.container_id
+      upstream          = module.gcr_cache.upstream_url
+      upstream_registry = module.gcr_cache.upstream_registry
     }
     github = {
-      endpoint     = module.ghcr_cache.cache_endpoint
-      container_id = module.ghcr_cache.container_id
-      upstream     = module.ghcr_cache.upstream_url
+      endpoint          = module.ghcr_cache.cache_endpoint
+      container_id      = module.ghcr_cache.container_id
+      upstream          = module.ghcr_cache.upstream_url
+      upstream_registry = module.ghcr_cache.upstream_registry
     }
   }
 }
@@ -56,4 +61,15 @@ output "docker_endpoints_config" {
       module.ghcr_cache.cache_endpoint
     ]
   }
-}
\ No newline at end of file
+}
+
+output "prometheus_targets" {
+  description = "Scrape targets for the caches' metrics, for homelab scrape-config"
+  value = [
+    module.docker_cache.prometheus_target,
+    module.k8s_cache.prometheus_target,
+    module.quay_cache.prometheus_target,
+    module.gcr_cache.prometheus_target,
+    module.ghcr_cache.prometheus_target
+  ]
+}
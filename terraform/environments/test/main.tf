@@ -36,6 +36,10 @@ module "primary_pihole" {
     volume_name    = docker_volume.pihole_shared_config.name
     container_path = "/shared"
   }]
+
+  tags = {
+    Role = "primary"
+  }
 }
 
 # Secondary Pi-hole instance  
@@ -53,6 +57,10 @@ module "secondary_pihole" {
     volume_name    = docker_volume.pihole_shared_config.name
     container_path = "/shared"
   }]
+
+  tags = {
+    Role = "secondary"
+  }
 }
 
 # Configure DNS records in primary Pi-hole
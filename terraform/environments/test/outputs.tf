@@ -18,6 +18,14 @@ output "secondary_web_interface" {
   value       = module.secondary_pihole.web_endpoint
 }
 
+output "prometheus_targets" {
+  description = "Prometheus targets of the Pi-hole pair, for homelab scrape-config"
+  value = [
+    module.primary_pihole.prometheus_target,
+    module.secondary_pihole.prometheus_target
+  ]
+}
+
 output "shared_config_volume" {
   description = "Shared configuration volume name"
   value       = docker_volume.pihole_shared_config.name
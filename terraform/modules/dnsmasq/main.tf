@@ -10,6 +10,16 @@ terraform {
   }
 }
 
+locals {
+  # Boot loader handed out by client-arch (DHCP option 93)
+  pxe_arches = [
+    { tag = "bios", arch = 0, file = "undionly.kpxe" },
+    { tag = "efi32", arch = 6, file = "ipxe.efi" },
+    { tag = "efibc", arch = 7, file = "ipxe.efi" },
+    { tag = "efi64", arch = 9, file = "ipxe.efi" },
+  ]
+}
+
 # DNSmasq container for DHCP/DNS/TFTP services
 resource "docker_container" "dnsmasq" {
   name  = var.container_name
@@ -40,19 +50,59 @@ resource "docker_container" "dnsmasq" {
   ] : [], var.tftp_enabled ? [
     "--enable-tftp",
     "--tftp-root=/var/lib/tftpboot"
-  ] : [], var.pxe_enabled ? [
+  ] : [], var.pxe_enabled ? concat(flatten([
     # PXE Boot configuration
-    "--dhcp-match=set:bios,option:client-arch,0",
-    "--dhcp-boot=tag:bios,undionly.kpxe",
-    "--dhcp-match=set:efi32,option:client-arch,6", 
-    "--dhcp-boot=tag:efi32,ipxe.efi",
-    "--dhcp-match=set:efibc,option:client-arch,7",
-    "--dhcp-boot=tag:efibc,ipxe.efi",
-    "--dhcp-match=set:efi64,option:client-arch,9",
-    "--dhcp-boot=tag:efi64,ipxe.efi",
+    for rule in local.pxe_arches : [
+      "--dhcp-match=set:${rule.tag},option:client-arch,${rule.arch}",
+      "--dhcp-boot=tag:${rule.tag},${rule.file}"
+    ]
+  ]), [
     "--dhcp-userclass=set:ipxe,iPXE",
     "--dhcp-boot=tag:ipxe,http://${var.matchbox_server}:${var.matchbox_port}/boot.ipxe"
-  ] : [], var.enable_logging ? [
+  ]) : [], var.enable_logging ? [
     "--log-queries",
     "--log-dhcp"
-  ] : [], var.additional_args)\n  \n  # TFTP volume for PXE boot files\n  dynamic \"volumes\" {\n    for_each = var.tftp_enabled ? [1] : []\n    content {\n      volume_name    = var.tftp_volume_name\n      container_path = \"/var/lib/tftpboot\"\n      read_only      = false\n    }\n  }\n  \n  # Additional volumes\n  dynamic \"volumes\" {\n    for_each = var.additional_volumes\n    content {\n      host_path      = volumes.value.host_path\n      container_path = volumes.value.container_path\n      read_only      = try(volumes.value.read_only, false)\n    }\n  }\n  \n  # Logging configuration\n  log_driver = \"json-file\"\n  log_opts = {\n    max-size = \"10m\"\n    max-file = \"3\"\n  }\n  \n  labels {\n    label = \"purpose\"\n    value = \"dns-dhcp-tftp\"\n  }\n  \n  labels {\n    label = \"network\"\n    value = var.vlan_network_name\n  }\n  \n  labels {\n    label = \"managed_by\"\n    value = \"terraform\"\n  }\n}
\ No newline at end of file
+  ] : [], var.additional_args)
+  
+  # TFTP volume for PXE boot files
+  dynamic "volumes" {
+    for_each = var.tftp_enabled ? [1] : []
+    content {
+      volume_name    = var.tftp_volume_name
+      container_path = "/var/lib/tftpboot"
+      read_only      = false
+    }
+  }
+  
+  # Additional volumes
+  dynamic "volumes" {
+    for_each = var.additional_volumes
+    content {
+      host_path      = volumes.value.host_path
+      container_path = volumes.value.container_path
+      read_only      = try(volumes.value.read_only, false)
+    }
+  }
+  
+  # Logging configuration
+  log_driver = "json-file"
+  log_opts = {
+    max-size = "10m"
+    max-file = "3"
+  }
+  
+  labels {
+    label = "purpose"
+    value = "dns-dhcp-tftp"
+  }
+  
+  labels {
+    label = "network"
+    value = var.vlan_network_name
+  }
+  
+  labels {
+    label = "managed_by"
+    value = "terraform"
+  }
+}
\ No newline at end of file
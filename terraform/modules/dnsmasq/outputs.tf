@@ -45,6 +45,7 @@ output "pxe_config" {
     matchbox_server = var.matchbox_server
     matchbox_port   = var.matchbox_port
     boot_url       = "http://${var.matchbox_server}:${var.matchbox_port}/boot.ipxe"
+    boot_loaders   = distinct([for rule in local.pxe_arches : rule.file])
   } : null
 }
 
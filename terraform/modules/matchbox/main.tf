@@ -24,10 +24,10 @@ resource "docker_container" "matchbox" {
   }
   
   # Matchbox configuration arguments
-  command = [
+  command = concat([
     "-address=:${var.matchbox_port}",
     "-log-level=${var.log_level}"
-  ]
+  ], var.rpc_enabled ? ["-rpc-address=0.0.0.0:${var.rpc_port}"] : [])
   
   # Optional volumes for profiles, groups, and assets
   dynamic "volumes" {
@@ -39,6 +39,20 @@ resource "docker_container" "matchbox" {
     }
   }
   
+  # TLS files for the gRPC API, at the paths matchbox reads by default
+  dynamic "volumes" {
+    for_each = var.rpc_enabled ? {
+      "/etc/matchbox/ca.crt"     = var.ca_file_path
+      "/etc/matchbox/server.crt" = var.cert_file_path
+      "/etc/matchbox/server.key" = var.key_file_path
+    } : {}
+    content {
+      host_path      = volumes.value
+      container_path = volumes.key
+      read_only      = true
+    }
+  }
+  
   # Additional volumes for custom configuration
   dynamic "volumes" {
     for_each = var.additional_volumes
@@ -71,6 +85,13 @@ resource "docker_container" "matchbox" {
     max-file = "3"
   }
   
+  lifecycle {
+    precondition {
+      condition     = !var.rpc_enabled || (var.ca_file_path != null && var.cert_file_path != null && var.key_file_path != null)
+      error_message = "rpc_enabled requires ca_file_path, cert_file_path and key_file_path."
+    }
+  }
+  
   labels {
     label = "purpose"
     value = "pxe-boot-server"
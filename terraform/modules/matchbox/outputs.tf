@@ -25,6 +25,23 @@ output "boot_ipxe_url" {
   value       = "http://${var.static_ip}:${var.matchbox_port}/boot.ipxe"
 }
 
+output "prometheus_target" {
+  description = "Blackbox probe target for Prometheus file_sd, labelled with the module's tags; matchbox serves no metrics of its own"
+  value = {
+    job             = "matchbox"
+    targets         = ["http://${var.static_ip}:${var.matchbox_port}/boot.ipxe"]
+    metrics_path    = "/probe"
+    scrape_interval = null
+    probe_module    = "http_2xx"
+    labels          = var.tags
+  }
+}
+
+output "rpc_endpoint" {
+  description = "Matchbox gRPC API address, or null when gRPC is disabled"
+  value       = var.rpc_enabled ? "${var.static_ip}:${var.rpc_port}" : null
+}
+
 output "matchbox_port" {
   description = "Matchbox server port"
   value       = var.matchbox_port
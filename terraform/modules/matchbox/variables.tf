@@ -78,14 +78,32 @@ variable "enable_https" {
   default     = false
 }
 
+variable "rpc_enabled" {
+  description = "Enable the gRPC API, authenticated with TLS client certificates"
+  type        = bool
+  default     = false
+}
+
+variable "rpc_port" {
+  description = "Port for the Matchbox gRPC API"
+  type        = number
+  default     = 8081
+}
+
+variable "ca_file_path" {
+  description = "Path to the CA certificate gRPC clients' certificates must be signed by (if gRPC enabled)"
+  type        = string
+  default     = null
+}
+
 variable "cert_file_path" {
-  description = "Path to TLS certificate file (if HTTPS enabled)"
+  description = "Path to TLS certificate file (if HTTPS or gRPC enabled)"
   type        = string
   default     = null
 }
 
 variable "key_file_path" {
-  description = "Path to TLS private key file (if HTTPS enabled)"
+  description = "Path to TLS private key file (if HTTPS or gRPC enabled)"
   type        = string
   default     = null
 }
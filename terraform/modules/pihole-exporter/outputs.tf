@@ -37,6 +37,18 @@ output "scrape_config" {
   }
 }
 
+output "prometheus_target" {
+  description = "Scrape target for Prometheus file_sd, labelled with the module's tags"
+  value = {
+    job             = "pihole-exporter"
+    targets         = ["localhost:${var.exporter_port}"]
+    metrics_path    = var.metrics_path
+    scrape_interval = var.scrape_interval
+    probe_module    = null
+    labels          = var.tags
+  }
+}
+
 output "prometheus_labels" {
   description = "Container labels for Prometheus discovery"
   value = var.enable_prometheus_labels ? {
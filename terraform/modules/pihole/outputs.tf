@@ -28,6 +28,18 @@ output "web_endpoint" {
   value       = "http://localhost:${var.web_port}/admin"
 }
 
+output "prometheus_target" {
+  description = "Blackbox probe target for Prometheus file_sd, labelled with the module's tags; Pi-hole serves no metrics of its own"
+  value = {
+    job             = "pihole"
+    targets         = ["http://localhost:${var.web_port}/admin/"]
+    metrics_path    = "/probe"
+    scrape_interval = null
+    probe_module    = "http_2xx"
+    labels          = var.tags
+  }
+}
+
 output "volumes" {
   description = "Created Docker volumes"
   value = {
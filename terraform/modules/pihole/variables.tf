@@ -84,4 +84,9 @@ variable "capabilities" {
   description = "Linux capabilities to add to the container"
   type        = list(string)
   default     = ["NET_ADMIN", "SYS_TIME", "SYS_NICE"]
-}
\ No newline at end of file
+}
+variable "tags" {
+  description = "Tags for the module's Prometheus target, which become its labels"
+  type        = map(string)
+  default     = {}
+}
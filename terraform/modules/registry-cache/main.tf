@@ -59,11 +59,26 @@ resource "docker_container" "registry_cache" {
     ip       = "0.0.0.0"
   }
   
-  env = [
+  # Debug server with Prometheus metrics (optional)
+  dynamic "ports" {
+    for_each = var.debug_port != null ? [var.debug_port] : []
+    content {
+      internal = 5001
+      external = ports.value
+      protocol = "tcp"
+      ip       = "0.0.0.0"
+    }
+  }
+  
+  env = concat([
     "REGISTRY_PROXY_REMOTEURL=${local.upstream_url}",
     "REGISTRY_STORAGE_FILESYSTEM_ROOTDIRECTORY=/var/lib/registry",
     "REGISTRY_HTTP_ADDR=0.0.0.0:5000"
-  ]
+  ], var.debug_port != null ? [
+    "REGISTRY_HTTP_DEBUG_ADDR=0.0.0.0:5001",
+    "REGISTRY_HTTP_DEBUG_PROMETHEUS_ENABLED=true",
+    "REGISTRY_HTTP_DEBUG_PROMETHEUS_PATH=/metrics"
+  ] : [])
   
   volumes {
     volume_name    = docker_volume.registry_cache.name
@@ -15,6 +15,23 @@ output "cache_endpoint" {
   value       = "localhost:${var.cache_port}"
 }
 
+output "metrics_endpoint" {
+  description = "Prometheus metrics endpoint URL (null without debug_port)"
+  value       = var.debug_port != null ? "http://localhost:${var.debug_port}/metrics" : null
+}
+
+output "prometheus_target" {
+  description = "Scrape target for Prometheus file_sd, labelled with the module's tags (null without debug_port)"
+  value = var.debug_port != null ? {
+    job             = "registry-cache"
+    targets         = ["localhost:${var.debug_port}"]
+    metrics_path    = "/metrics"
+    scrape_interval = null
+    probe_module    = null
+    labels          = merge(var.tags, { registry_name = var.registry_name })
+  } : null
+}
+
 output "upstream_registry" {
   description = "Upstream registry being cached"
   value       = var.registry_name
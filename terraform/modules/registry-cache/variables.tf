@@ -26,6 +26,17 @@ variable "cache_port" {
   }
 }
 
+variable "debug_port" {
+  description = "External port for the registry's debug server, which serves Prometheus metrics on /metrics (disabled when null)"
+  type        = number
+  default     = null
+
+  validation {
+    condition     = var.debug_port == null || (var.debug_port >= 1024 && var.debug_port <= 65535)
+    error_message = "Debug port must be between 1024 and 65535."
+  }
+}
+
 variable "upstream_url" {
   description = "Custom upstream registry URL (overrides default for registry_name)"
   type        = string
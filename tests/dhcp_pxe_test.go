@@ -0,0 +1,330 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/dhcp"
+	"github.com/yebyen/home-lab-terraform/internal/dnsmasq"
+)
+
+// netbootClients are the clients the PXE chain has to handle: firmware
+// picking a boot loader by client-arch, then iPXE asking for matchbox
+var netbootClients = []struct {
+	name      string
+	arch      int
+	userClass string
+}{
+	{"BIOS", 0, ""},
+	{"EFI64", 9, ""},
+	{"IPXE_EFI64", 9, "iPXE"},
+}
+
+// fakeDHCPServer answers on loopback the way dnsmasq would for config,
+// leasing addresses from the start of its range in order. A REQUEST for
+// anything but the client's lease, or without option 50, gets a NAK.
+func fakeDHCPServer(t *testing.T, config *dnsmasq.Config) net.Addr {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		next := config.DHCP.RangeStart
+		leases := make(map[string]netip.Addr)
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			request, err := dhcp.Parse(buf[:n])
+			if err != nil {
+				continue
+			}
+			lease, ok := leases[request.CHAddr.String()]
+			if !ok {
+				lease, next = next, next.Next()
+				leases[request.CHAddr.String()] = lease
+			}
+
+			reply := &dhcp.Packet{
+				Op:     2,
+				XID:    request.XID,
+				Flags:  request.Flags,
+				YIAddr: lease,
+				SIAddr: config.StaticIP,
+				CHAddr: request.CHAddr,
+				Options: map[byte][]byte{
+					dhcp.OptionServerID:   config.StaticIP.AsSlice(),
+					dhcp.OptionRouter:     config.DHCP.Router.AsSlice(),
+					dhcp.OptionDNSServers: config.DHCP.DNSServer.AsSlice(),
+				},
+			}
+			arch := -1
+			if value := request.Options[dhcp.OptionClientArch]; len(value) == 2 {
+				arch = int(value[0])<<8 | int(value[1])
+			}
+			// Long boot URLs go in option 67; boot loaders in the file field
+			if file := config.BootFile(arch, string(request.Options[dhcp.OptionUserClass])); strings.Contains(file, "://") {
+				reply.Options[dhcp.OptionBootFileName] = []byte(file)
+			} else {
+				reply.File = file
+			}
+			switch request.MessageType() {
+			case dhcp.Discover:
+				reply.Options[dhcp.OptionMessageType] = []byte{dhcp.Offer}
+			case dhcp.Request:
+				reply.Options[dhcp.OptionMessageType] = []byte{dhcp.Ack}
+				requested := request.Options[dhcp.OptionRequestedIP]
+				if len(requested) != 4 || netip.AddrFrom4([4]byte(requested)) != lease {
+					reply.Options[dhcp.OptionMessageType] = []byte{dhcp.Nak}
+					reply.YIAddr = netip.IPv4Unspecified()
+				}
+			default:
+				continue
+			}
+			conn.WriteTo(reply.Marshal(), from)
+		}
+	}()
+	return conn.LocalAddr()
+}
+
+// TestDHCPClientOffline runs the simulated netboot client against a fake
+// server built from the 13-net dnsmasq settings
+func TestDHCPClientOffline(t *testing.T) {
+	t.Parallel()
+
+	config, _ := metnoom13netDnsmasq(t)
+
+	t.Run("Packet_Round_Trip", func(t *testing.T) {
+		mac, _ := net.ParseMAC("52:54:00:13:00:01")
+		packet := &dhcp.Packet{
+			Op:     1,
+			XID:    0xdeadbeef,
+			Flags:  0x8000,
+			YIAddr: netip.MustParseAddr("10.17.13.3"),
+			CHAddr: mac,
+			File:   "undionly.kpxe",
+			Options: map[byte][]byte{
+				dhcp.OptionMessageType: {dhcp.Discover},
+				dhcp.OptionUserClass:   []byte(strings.Repeat("x", 300)),
+			},
+		}
+		data := packet.Marshal()
+		assert.GreaterOrEqual(t, len(data), 300)
+
+		parsed, err := dhcp.Parse(data)
+		require.NoError(t, err)
+		assert.Equal(t, packet.XID, parsed.XID)
+		assert.Equal(t, packet.YIAddr, parsed.YIAddr)
+		assert.Equal(t, packet.CHAddr, parsed.CHAddr)
+		assert.Equal(t, "undionly.kpxe", parsed.BootFile())
+		assert.Equal(t, dhcp.Discover, parsed.MessageType())
+		assert.Len(t, parsed.Options[dhcp.OptionUserClass], 300, "Split options are joined")
+	})
+
+	t.Run("Overloaded_File_Field", func(t *testing.T) {
+		packet := &dhcp.Packet{Op: 2, Options: map[byte][]byte{dhcp.OptionOverload: {1}}}
+		data := packet.Marshal()
+		// Put option 67 in the file field, as servers short of option space do
+		copy(data[108:], append([]byte{dhcp.OptionBootFileName, 8}, append([]byte("ipxe.efi"), dhcp.OptionEnd)...))
+
+		parsed, err := dhcp.Parse(data)
+		require.NoError(t, err)
+		assert.Equal(t, "ipxe.efi", parsed.BootFile())
+		assert.Empty(t, parsed.File)
+
+		_, err = dhcp.Parse(data[:200])
+		assert.Error(t, err, "Truncated packet")
+	})
+
+	t.Run("Exchange", func(t *testing.T) {
+		bootFiles := map[string]string{
+			"BIOS":       "undionly.kpxe",
+			"EFI64":      "ipxe.efi",
+			"IPXE_EFI64": "http://10.17.13.251:8080/boot.ipxe",
+		}
+		server := fakeDHCPServer(t, config)
+		for i, tc := range netbootClients {
+			conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer conn.Close()
+
+			client := &dhcp.Client{Conn: conn, Server: server, Timeout: 5 * time.Second}
+			mac := net.HardwareAddr{0x52, 0x54, 0x00, 0x13, 0x00, byte(i + 1)}
+			lease, err := client.Exchange(dhcp.ClientOptions{MAC: mac, Arch: tc.arch, UserClass: tc.userClass})
+			require.NoError(t, err, tc.name)
+
+			assert.True(t, config.DHCP.InRange(lease.Ack.YIAddr), "%s: %s in range", tc.name, lease.Ack.YIAddr)
+			assert.Equal(t, lease.Offer.YIAddr, lease.Ack.YIAddr, tc.name)
+			assert.Equal(t, config.DHCP.Router, lease.Ack.Addr(dhcp.OptionRouter), tc.name)
+			assert.Equal(t, bootFiles[tc.name], lease.Offer.BootFile(), tc.name)
+		}
+	})
+
+	t.Run("Request_Without_Lease_Address", func(t *testing.T) {
+		server := fakeDHCPServer(t, config)
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		mac := net.HardwareAddr{0x52, 0x54, 0x00, 0x13, 0x00, 0x10}
+		for name, requested := range map[string][]byte{
+			"Missing":   nil,
+			"Truncated": {10, 17},
+			"Not_Ours":  {10, 17, 13, 250},
+		} {
+			request := &dhcp.Packet{
+				Op:      1,
+				XID:     0x13131313,
+				CHAddr:  mac,
+				Options: map[byte][]byte{dhcp.OptionMessageType: {dhcp.Request}},
+			}
+			if requested != nil {
+				request.Options[dhcp.OptionRequestedIP] = requested
+			}
+			_, err := conn.WriteTo(request.Marshal(), server)
+			require.NoError(t, err)
+
+			buf := make([]byte, 1500)
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			n, _, err := conn.ReadFrom(buf)
+			require.NoError(t, err, "%s: the server should answer rather than crash", name)
+			reply, err := dhcp.Parse(buf[:n])
+			require.NoError(t, err)
+			assert.Equal(t, dhcp.Nak, reply.MessageType(), name)
+		}
+	})
+
+	t.Run("Boot_File_Rules", func(t *testing.T) {
+		assert.Equal(t, "undionly.kpxe", config.BootFile(0, ""))
+		assert.Equal(t, "ipxe.efi", config.BootFile(7, ""))
+		assert.Equal(t, "ipxe.efi", config.BootFile(9, ""))
+		assert.Equal(t, "http://10.17.13.251:8080/boot.ipxe", config.BootFile(0, "iPXE"))
+		assert.Empty(t, config.BootFile(11, ""), "No rule for ARM64")
+	})
+
+	t.Run("No_Reply", func(t *testing.T) {
+		silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer silent.Close()
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		client := &dhcp.Client{Conn: conn, Server: silent.LocalAddr(), Timeout: 100 * time.Millisecond}
+		_, err = client.Exchange(dhcp.ClientOptions{MAC: net.HardwareAddr{0x52, 0x54, 0, 0, 0, 1}, Arch: -1})
+		assert.ErrorContains(t, err, "no reply")
+	})
+}
+
+// dhcpProbeResult is the JSON cmd/dhcpprobe prints
+type dhcpProbeResult struct {
+	Address   string `json:"address"`
+	Router    string `json:"router"`
+	DNSServer string `json:"dns_server"`
+	BootFile  string `json:"boot_file"`
+}
+
+// buildDHCPProbe builds cmd/dhcpprobe to run in a container: for Linux,
+// without cgo
+func buildDHCPProbe(t *testing.T) string {
+	t.Helper()
+
+	probe := filepath.Join(t.TempDir(), "dhcpprobe")
+	build := exec.Command("go", "build", "-o", probe, "../cmd/dhcpprobe")
+	build.Env = append(os.Environ(), "CGO_ENABLED=0", "GOOS=linux")
+	output, err := build.CombinedOutput()
+	require.NoError(t, err, string(output))
+	return probe
+}
+
+// TestDHCPPXEEndToEnd applies the dnsmasq module on an isolated Docker
+// network and runs cmd/dhcpprobe in containers on the same network as
+// BIOS, EFI and iPXE clients, checking each lease and boot file
+func TestDHCPPXEEndToEnd(t *testing.T) {
+	RequireDocker(t)
+
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano()%100000)
+	networkName := "dhcp-pxe-" + suffix
+	subnet := netip.MustParsePrefix(allocateSubnet())
+	host := func(n byte) string {
+		a := subnet.Addr().As4()
+		a[3] = n
+		return netip.AddrFrom4(a).String()
+	}
+
+	options := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: "../terraform/modules/dnsmasq",
+		Vars: map[string]interface{}{
+			"container_name":    "dnsmasq-e2e-" + suffix,
+			"vlan_network_name": networkName,
+			"static_ip":         host(252),
+			"dhcp_range_start":  host(100),
+			"dhcp_range_end":    host(150),
+			"dhcp_router":       host(1),
+			"dhcp_dns_server":   host(254),
+			"tftp_volume_name":  "dnsmasq-e2e-tftp-" + suffix,
+			"matchbox_server":   host(251),
+			"matchbox_port":     8080,
+		},
+		NoColor: true,
+	})
+	RequireValidVars(t, options)
+	RequireTerraform(t, options)
+
+	config, err := dnsmasq.FromModule(LoadModuleOffline(t, options.Vars, "modules", "dnsmasq"))
+	require.NoError(t, err)
+	require.NoError(t, config.Validate(subnet))
+
+	probe := buildDHCPProbe(t)
+
+	// Cleanups run last-in first-out, so terraform removes the container
+	// before the network and volume go
+	t.Cleanup(func() {
+		if os.Getenv("SKIP_CLEANUP") != "true" {
+			runDocker(t, "network", "rm", networkName)
+			runDocker(t, "volume", "rm", "-f", options.Vars["tftp_volume_name"].(string))
+		}
+	})
+	runDocker(t, "network", "create", "--subnet", subnet.String(), "--gateway", host(1), networkName)
+	t.Cleanup(func() {
+		if os.Getenv("SKIP_CLEANUP") != "true" {
+			terraform.Destroy(t, options)
+		}
+	})
+	terraform.InitAndApply(t, options)
+
+	for _, tc := range netbootClients {
+		t.Run(tc.name, func(t *testing.T) {
+			args := []string{"run", "--rm", "--network", networkName,
+				"-v", probe + ":/dhcpprobe:ro", "busybox",
+				"/dhcpprobe", "-arch", fmt.Sprint(tc.arch), "-timeout", "20s"}
+			if tc.userClass != "" {
+				args = append(args, "-user-class", tc.userClass)
+			}
+			var result dhcpProbeResult
+			require.NoError(t, json.Unmarshal([]byte(runDocker(t, args...)), &result))
+
+			addr, err := netip.ParseAddr(result.Address)
+			require.NoError(t, err)
+			assert.True(t, config.DHCP.InRange(addr), "%s is within %s-%s", addr, config.DHCP.RangeStart, config.DHCP.RangeEnd)
+			assert.Equal(t, host(1), result.Router)
+			assert.Equal(t, host(254), result.DNSServer)
+			assert.Equal(t, config.BootFile(tc.arch, tc.userClass), result.BootFile)
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/dnsbench"
+)
+
+// benchNames is a mix of names the stub upstream knows
+var benchNames = map[dnsbench.Category][]string{
+	dnsbench.Cached:   {"google.com", "gmail.com"},
+	dnsbench.Uncached: {"example.com"},
+	dnsbench.Blocked:  {"ads.example.com"},
+	dnsbench.Local:    {"www.example.com"},
+}
+
+// TestDNSBenchOffline runs the benchmark against the stub upstream and
+// against servers that time out or refuse connections
+func TestDNSBenchOffline(t *testing.T) {
+	t.Parallel()
+
+	stub := StartStubUpstream(t, "127.0.0.1:0")
+	addr := stub.Addr
+
+	t.Run("Mix_And_Percentiles", func(t *testing.T) {
+		report, err := dnsbench.Run(context.Background(), dnsbench.Options{
+			Server:   addr,
+			QPS:      200,
+			Duration: time.Second,
+			Names:    benchNames,
+		})
+		require.NoError(t, err)
+
+		assert.InDelta(t, 200, report.Total.Queries, 60, "Queries are sent at the requested rate")
+		assert.Zero(t, report.Total.Errors)
+		assert.Zero(t, report.Total.Timeouts)
+		for _, category := range dnsbench.Categories {
+			stats := report.Categories[category]
+			require.NotNil(t, stats, category)
+			assert.Positive(t, stats.Queries, category)
+			assert.LessOrEqual(t, stats.P50, stats.P95, category)
+			assert.LessOrEqual(t, stats.P95, stats.P99, category)
+			assert.LessOrEqual(t, stats.P99, stats.Max, category)
+		}
+		assert.Greater(t, report.Categories[dnsbench.Cached].Queries, report.Categories[dnsbench.Blocked].Queries, "Default weights favour cached names")
+		assert.Equal(t, report.Categories[dnsbench.Uncached].Queries, report.Categories[dnsbench.Uncached].Rcodes["NXDOMAIN"],
+			"Uncached names get random labels")
+		assert.Equal(t, 2, stub.Queries("google.com", dns.TypeA)+stub.Queries("gmail.com", dns.TypeA)-
+			report.Categories[dnsbench.Cached].Queries, "Cached names are warmed up once each")
+	})
+
+	t.Run("Weights", func(t *testing.T) {
+		report, err := dnsbench.Run(context.Background(), dnsbench.Options{
+			Server:   addr,
+			Net:      "tcp",
+			QPS:      100,
+			Duration: 200 * time.Millisecond,
+			Names:    benchNames,
+			Weights:  map[dnsbench.Category]int{dnsbench.Local: 1},
+		})
+		require.NoError(t, err)
+		assert.Len(t, report.Categories, 1)
+		assert.Equal(t, report.Total.Queries, report.Categories[dnsbench.Local].Queries)
+		assert.Equal(t, "tcp", report.Net)
+	})
+
+	t.Run("Timeouts", func(t *testing.T) {
+		blackhole, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer blackhole.Close()
+
+		report, err := dnsbench.Run(context.Background(), dnsbench.Options{
+			Server:   blackhole.LocalAddr().String(),
+			QPS:      50,
+			Duration: 200 * time.Millisecond,
+			Timeout:  200 * time.Millisecond,
+			Names:    benchNames,
+			Weights:  map[dnsbench.Category]int{dnsbench.Uncached: 1},
+		})
+		require.NoError(t, err)
+		assert.Positive(t, report.Total.Queries)
+		assert.Equal(t, 1.0, report.Total.TimeoutRate())
+		assert.Zero(t, report.Total.ErrorRate())
+		assert.Zero(t, report.Total.Replies)
+
+		var buf bytes.Buffer
+		require.NoError(t, dnsbench.WriteTable(&buf, report))
+		assert.Regexp(t, `(?m)^total +p50 +-$`, buf.String(), "No latency without replies")
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		report, err := dnsbench.Run(context.Background(), dnsbench.Options{
+			Server:   "127.0.0.1:1",
+			Net:      "tcp",
+			QPS:      50,
+			Duration: 100 * time.Millisecond,
+			Names:    benchNames,
+			Weights:  map[dnsbench.Category]int{dnsbench.Blocked: 1},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1.0, report.Total.ErrorRate(), "Connections are refused")
+	})
+
+	t.Run("Invalid_Options", func(t *testing.T) {
+		_, err := dnsbench.Run(context.Background(), dnsbench.Options{Server: addr, QPS: 10, Duration: time.Second})
+		assert.ErrorContains(t, err, "no names")
+		_, err = dnsbench.Run(context.Background(), dnsbench.Options{Server: addr, Duration: time.Second, Names: benchNames})
+		assert.Error(t, err)
+	})
+
+	t.Run("Percentile", func(t *testing.T) {
+		var latencies []time.Duration
+		for i := 1; i <= 100; i++ {
+			latencies = append(latencies, time.Duration(i)*time.Millisecond)
+		}
+		assert.Equal(t, 50*time.Millisecond, dnsbench.Percentile(latencies, 50))
+		assert.Equal(t, 99*time.Millisecond, dnsbench.Percentile(latencies, 99))
+		assert.Equal(t, 100*time.Millisecond, dnsbench.Percentile(latencies, 100))
+		assert.Equal(t, time.Millisecond, dnsbench.Percentile(latencies[:1], 99))
+		assert.Zero(t, dnsbench.Percentile(nil, 50))
+	})
+
+	t.Run("Side_By_Side", func(t *testing.T) {
+		stats := func(queries, timeouts int, p50 time.Duration) *dnsbench.Stats {
+			return &dnsbench.Stats{Queries: queries, Replies: queries - timeouts, Timeouts: timeouts, P50: p50, P95: 2 * p50, P99: 3 * p50, Max: 4 * p50}
+		}
+		bridge := &dnsbench.Report{
+			Name: "bridge", Server: "127.0.0.1:31053", Net: "udp", Duration: 10 * time.Second,
+			Total:      stats(1000, 10, 2*time.Millisecond),
+			Categories: map[dnsbench.Category]*dnsbench.Stats{dnsbench.Cached: stats(1000, 10, 2*time.Millisecond)},
+		}
+		host := &dnsbench.Report{
+			Name: "host", Server: "127.0.0.1:53", Net: "udp", Duration: 10 * time.Second,
+			Total:      stats(1000, 0, 1500*time.Microsecond),
+			Categories: map[dnsbench.Category]*dnsbench.Stats{dnsbench.Cached: stats(1000, 0, 1500*time.Microsecond)},
+		}
+
+		var buf bytes.Buffer
+		require.NoError(t, dnsbench.WriteTable(&buf, bridge, host))
+		assert.Equal(t, strings.Join([]string{
+			"CATEGORY  METRIC    BRIDGE               HOST              CHANGE",
+			"          server    127.0.0.1:31053/udp  127.0.0.1:53/udp",
+			"          qps       100.0                100.0",
+			"total     queries   1000                 1000",
+			"total     p50       2ms                  1.5ms             -25.0%",
+			"total     p95       4ms                  3ms               -25.0%",
+			"total     p99       6ms                  4.5ms             -25.0%",
+			"total     max       8ms                  6ms               -25.0%",
+			"total     errors    0.00%                0.00%",
+			"total     timeouts  1.00%                0.00%",
+			"cached    queries   1000                 1000",
+			"cached    p50       2ms                  1.5ms             -25.0%",
+			"cached    p95       4ms                  3ms               -25.0%",
+			"cached    p99       6ms                  4.5ms             -25.0%",
+			"cached    max       8ms                  6ms               -25.0%",
+			"cached    errors    0.00%                0.00%",
+			"cached    timeouts  1.00%                0.00%",
+			"",
+		}, "\n"), buf.String())
+	})
+}
+
+// TestDNSBenchPihole benchmarks a Pi-hole forwarding to the stub upstream
+func TestDNSBenchPihole(t *testing.T) {
+	RequireDocker(t)
+	t.Parallel()
+
+	env := NewPiholeEnv(t).WithName("bench").Build()
+	require.NoError(t, env.Session.DenyDomain("ads.example.com", "dnsbench test"))
+
+	names := map[dnsbench.Category][]string{
+		dnsbench.Cached:   {"google.com", "gmail.com"},
+		dnsbench.Uncached: {"example.com"},
+		dnsbench.Blocked:  {"ads.example.com"},
+		dnsbench.Local:    {"pi.hole"},
+	}
+	report, err := dnsbench.Run(context.Background(), dnsbench.Options{
+		Server:   env.DNSAddress,
+		QPS:      100,
+		Duration: 5 * time.Second,
+		Names:    names,
+	})
+	require.NoError(t, err)
+	report.Name = "pihole"
+
+	var buf bytes.Buffer
+	require.NoError(t, dnsbench.WriteTable(&buf, report))
+	t.Log("\n" + buf.String())
+
+	assert.Zero(t, report.Total.ErrorRate())
+	assert.Less(t, report.Total.TimeoutRate(), 0.01)
+	assert.Equal(t, report.Categories[dnsbench.Blocked].Queries, report.Categories[dnsbench.Blocked].Rcodes["NOERROR"])
+	assert.Zero(t, env.Upstream.Queries("ads.example.com", dns.TypeA), "Blocked names are answered by FTL")
+	assert.GreaterOrEqual(t, env.Upstream.Total(), report.Categories[dnsbench.Uncached].Queries, "Uncached names are forwarded")
+}
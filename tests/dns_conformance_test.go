@@ -0,0 +1,341 @@
+package tests
+
+import (
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/dnscheck"
+	"github.com/yebyen/home-lab-terraform/internal/dnsstub"
+	"github.com/yebyen/home-lab-terraform/internal/pihole"
+)
+
+// piholeConfigRecords reads the local A and CNAME records pihole-config
+// manages, so the suite checks what the module actually declares
+func piholeConfigRecords(t *testing.T) (records, cnames map[string]string) {
+	t.Helper()
+
+	module := LoadModuleOffline(t, map[string]interface{}{
+		"pihole_base_url": "http://localhost:8080",
+		"pihole_password": "unused",
+	}, "modules", "pihole-config")
+
+	records, cnames = make(map[string]string), make(map[string]string)
+	for _, address := range module.Resources() {
+		resource := RequireResource(t, module, address)
+		domain, err := resource.String("domain")
+		require.NoError(t, err)
+		switch {
+		case strings.HasPrefix(address, "pihole_dns_record."):
+			records[domain], err = resource.String("ip")
+		case strings.HasPrefix(address, "pihole_cname_record."):
+			cnames[domain], err = resource.String("target")
+		}
+		require.NoError(t, err)
+	}
+	return records, cnames
+}
+
+// fakeFTL is an in-process DNS server answering the way Pi-hole's FTL
+// does: local records and CNAMEs, a blocklist in NULL, NX or NODATA mode,
+// and everything else from the upstream fixture zone. It checks the suite
+// itself without Docker.
+type fakeFTL struct {
+	Addr string
+
+	mu      sync.Mutex
+	mode    string
+	blocked map[string]bool
+	records map[string]string
+	cnames  map[string]string
+	zone    *dnsstub.Zone
+}
+
+func newFakeFTL(t *testing.T, records, cnames map[string]string, blocked ...string) *fakeFTL {
+	f := &fakeFTL{
+		mode:    "NULL",
+		blocked: make(map[string]bool),
+		records: make(map[string]string),
+		cnames:  make(map[string]string),
+	}
+	for name, ip := range records {
+		f.records[dns.Fqdn(name)] = ip
+	}
+	for name, target := range cnames {
+		f.cnames[dns.Fqdn(name)] = dns.Fqdn(target)
+	}
+	for _, name := range blocked {
+		f.blocked[dns.Fqdn(name)] = true
+	}
+
+	zone, err := dnsstub.LoadZone(upstreamZone)
+	require.NoError(t, err)
+	f.zone = zone
+
+	server := func(network string) *dns.Server {
+		s := &dns.Server{Net: network, Handler: dns.HandlerFunc(f.serveDNS)}
+		switch network {
+		case "udp":
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			require.NoError(t, err)
+			s.PacketConn = conn
+		case "tcp":
+			listener, err := net.Listen("tcp", f.Addr)
+			require.NoError(t, err)
+			s.Listener = listener
+		}
+		return s
+	}
+	udp := server("udp")
+	f.Addr = udp.PacketConn.LocalAddr().String()
+	tcp := server("tcp")
+	for _, s := range []*dns.Server{udp, tcp} {
+		go s.ActivateAndServe()
+		t.Cleanup(func() { s.Shutdown() })
+	}
+	return f
+}
+
+// SetMode switches the blocking mode like PATCHing dns.blocking.mode
+func (f *fakeFTL) SetMode(mode string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mode = mode
+}
+
+func (f *fakeFTL) serveDNS(w dns.ResponseWriter, query *dns.Msg) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	udp := w.LocalAddr().Network() == "udp"
+	reply := new(dns.Msg)
+	reply.SetReply(query)
+	reply.RecursionAvailable = true
+	q := query.Question[0]
+	name := strings.ToLower(q.Name)
+	header := func(qtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: q.Name, Rrtype: qtype, Class: dns.ClassINET, Ttl: 2}
+	}
+
+	switch ip, local := f.records[name]; {
+	case f.blocked[name]:
+		switch f.mode {
+		case "NX":
+			reply.Rcode = dns.RcodeNameError
+		case "NULL":
+			if q.Qtype == dns.TypeA {
+				reply.Answer = append(reply.Answer, &dns.A{Hdr: header(dns.TypeA), A: net.IPv4zero})
+			} else if q.Qtype == dns.TypeAAAA {
+				reply.Answer = append(reply.Answer, &dns.AAAA{Hdr: header(dns.TypeAAAA), AAAA: net.IPv6zero})
+			}
+		}
+	case local:
+		if q.Qtype == dns.TypeA {
+			reply.Answer = append(reply.Answer, &dns.A{Hdr: header(dns.TypeA), A: net.ParseIP(ip)})
+		}
+	case f.cnames[name] != "":
+		target := f.cnames[name]
+		reply.Answer = append(reply.Answer, &dns.CNAME{Hdr: header(dns.TypeCNAME), Target: target})
+		if ip, ok := f.records[target]; ok && q.Qtype == dns.TypeA {
+			reply.Answer = append(reply.Answer, &dns.A{Hdr: dns.RR_Header{Name: target, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 2}, A: net.ParseIP(ip)})
+		}
+	case q.Qtype == dns.TypePTR:
+		for host, ip := range f.records {
+			if reverse, _ := dns.ReverseAddr(ip); reverse == name {
+				reply.Answer = append(reply.Answer, &dns.PTR{Hdr: header(dns.TypePTR), Ptr: host})
+			}
+		}
+		if len(reply.Answer) == 0 {
+			reply.Rcode = dns.RcodeNameError
+		}
+	default:
+		w.WriteMsg(f.zone.Reply(query, udp))
+		return
+	}
+
+	size := dns.MinMsgSize
+	if opt := query.IsEdns0(); opt != nil {
+		size = int(opt.UDPSize())
+		reply.SetEdns0(opt.UDPSize(), false)
+	}
+	if udp {
+		reply.Truncate(size)
+	}
+	w.WriteMsg(reply)
+}
+
+// upstreamProfile points the suite at names in testdata/dns/upstream.zone,
+// which resolve through the stub upstream resolver (or the internet)
+func upstreamProfile(records, cnames map[string]string, blocked string) dnscheck.Profile {
+	return dnscheck.Profile{
+		Records:  records,
+		CNAMEs:   cnames,
+		External: "google.com",
+		SRV:      "_imaps._tcp.gmail.com",
+		Large:    "google.com",
+		Missing:  "dns-conformance-missing.example.com",
+		Blocked:  blocked,
+	}
+}
+
+// requireConformance runs cases against server with a subtest per case
+func requireConformance(t *testing.T, server string, cases []dnscheck.Case) []dnscheck.Result {
+	t.Helper()
+
+	results := dnscheck.Run(server, cases, 5*time.Second)
+	for _, result := range results {
+		result := result
+		t.Run(result.Case.Name, func(t *testing.T) {
+			assert.True(t, result.OK(), "%s %s over %s: %s", result.Case.Question,
+				dns.TypeToString[result.Case.Type], result.Case.Net, strings.Join(result.Problems, "; "))
+		})
+	}
+	return results
+}
+
+// TestDNSConformanceOffline runs the conformance suite against the fake
+// FTL, and checks it catches servers that do not conform
+func TestDNSConformanceOffline(t *testing.T) {
+	t.Parallel()
+
+	records, cnames := piholeConfigRecords(t)
+	require.Equal(t, map[string]string{
+		"gateway.homelab.local":  "10.17.12.1",
+		"nas.homelab.local":      "10.17.12.100",
+		"registry.homelab.local": "10.17.12.101",
+	}, records)
+	require.Len(t, cnames, 2)
+
+	ftl := newFakeFTL(t, records, cnames, "ads.example.com")
+
+	for _, mode := range []string{"NULL", "NX", "NODATA"} {
+		mode := mode
+		t.Run("Mode_"+mode, func(t *testing.T) {
+			profile := upstreamProfile(records, cnames, "ads.example.com")
+			profile.BlockingMode = mode
+			cases, err := dnscheck.Cases(profile)
+			require.NoError(t, err)
+
+			ftl.SetMode(mode)
+			results := requireConformance(t, ftl.Addr, cases)
+			for _, result := range results {
+				if result.Case.Name == "Truncation_Fallback" {
+					assert.True(t, result.Truncated, "The large TXT set does not fit in 512 bytes")
+					assert.Len(t, result.Reply.Answer, 12, "TCP carries the whole set")
+				}
+			}
+		})
+	}
+
+	t.Run("Case_Table", func(t *testing.T) {
+		cases, err := dnscheck.Cases(upstreamProfile(records, cnames, "ads.example.com"))
+		require.NoError(t, err)
+		names := make(map[string]bool)
+		types := make(map[uint16]bool)
+		for _, c := range cases {
+			assert.False(t, names[c.Name], "Duplicate case %s", c.Name)
+			names[c.Name] = true
+			types[c.Type] = true
+		}
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeCNAME, dns.TypePTR, dns.TypeTXT, dns.TypeMX, dns.TypeSRV} {
+			if qtype == dns.TypeCNAME {
+				continue // CNAMEs are followed by A queries
+			}
+			assert.True(t, types[qtype], dns.TypeToString[qtype])
+		}
+		for _, name := range []string{"A_Local_docker.homelab.local_tcp", "PTR_Local_10.17.12.1_udp", "EDNS0_1232", "A_Blocked_tcp", "AAAA_NODATA_nas.homelab.local_udp"} {
+			assert.True(t, names[name], name)
+		}
+
+		_, err = dnscheck.Cases(dnscheck.Profile{Blocked: "ads.example.com", BlockingMode: "IP"})
+		assert.Error(t, err, "Unsupported blocking mode")
+	})
+
+	t.Run("Detects_Wrong_Blocking_Mode", func(t *testing.T) {
+		profile := upstreamProfile(nil, nil, "ads.example.com")
+		profile.BlockingMode = "NULL"
+		cases, err := dnscheck.Cases(profile)
+		require.NoError(t, err)
+
+		wrong := newFakeFTL(t, nil, nil, "ads.example.com")
+		wrong.SetMode("NX")
+		for _, result := range dnscheck.Run(wrong.Addr, cases, 5*time.Second) {
+			blocked := strings.Contains(result.Case.Name, "Blocked")
+			assert.Equal(t, !blocked, result.OK(), "%s: %v", result.Case.Name, result.Problems)
+		}
+	})
+
+	t.Run("Detects_Missing_Records", func(t *testing.T) {
+		cases, err := dnscheck.Cases(dnscheck.Profile{Records: map[string]string{"printer.homelab.local": "10.17.12.50"}})
+		require.NoError(t, err)
+		for _, result := range dnscheck.Run(ftl.Addr, cases, 5*time.Second) {
+			assert.False(t, result.OK(), result.Case.Name)
+		}
+	})
+
+	t.Run("Unreachable_Server", func(t *testing.T) {
+		cases := []dnscheck.Case{{Name: "A", Question: "google.com", Type: dns.TypeA}}
+		results := dnscheck.Run("127.0.0.1:1", cases, 500*time.Millisecond)
+		assert.False(t, results[0].OK())
+	})
+}
+
+// TestDNSConformance runs the suite against DNS_CONFORMANCE_SERVER
+// (host:port) when set, e.g. a Pi-hole an environment deployed with
+// pihole-config applied, or else against a fresh Pi-hole configured with
+// pihole-config's records through the API and forwarding to the stub
+// upstream. An existing server resolves upstream names from the internet;
+// DNS_CONFORMANCE_BLOCKED and DNS_CONFORMANCE_BLOCKING_MODE name a domain
+// on its blocklist.
+func TestDNSConformance(t *testing.T) {
+	records, cnames := piholeConfigRecords(t)
+	profile := upstreamProfile(records, cnames, "")
+
+	if server := os.Getenv("DNS_CONFORMANCE_SERVER"); server != "" {
+		profile.Blocked = os.Getenv("DNS_CONFORMANCE_BLOCKED")
+		profile.BlockingMode = os.Getenv("DNS_CONFORMANCE_BLOCKING_MODE")
+		cases, err := dnscheck.Cases(profile)
+		require.NoError(t, err)
+		requireConformance(t, server, cases)
+		return
+	}
+
+	RequireDocker(t)
+	env := NewPiholeEnv(t).WithName("conformance").Build()
+
+	var hosts, cnameRecords []string
+	for name, ip := range records {
+		hosts = append(hosts, ip+" "+name)
+	}
+	for name, target := range cnames {
+		cnameRecords = append(cnameRecords, name+","+target)
+	}
+	_, err := env.Session.PatchConfig(&pihole.Config{DNS: &pihole.DNSConfig{
+		Hosts:        pihole.Strings(hosts...),
+		CNAMERecords: pihole.Strings(cnameRecords...),
+	}})
+	require.NoError(t, err)
+	profile.Blocked = "ads.example.com"
+	require.NoError(t, env.Session.DenyDomain(profile.Blocked, "DNS conformance suite"))
+
+	for _, mode := range []string{"NULL", "NX"} {
+		_, err := env.Session.PatchConfig(&pihole.Config{DNS: &pihole.DNSConfig{
+			Blocking: &pihole.DNSBlockingConfig{Mode: pihole.String(mode)},
+		}})
+		require.NoError(t, err)
+
+		profile.BlockingMode = mode
+		cases, err := dnscheck.Cases(profile)
+		require.NoError(t, err)
+		t.Run("Mode_"+mode, func(t *testing.T) {
+			requireConformance(t, env.DNSAddress, cases)
+		})
+	}
+	assert.Zero(t, env.Upstream.Queries(profile.Blocked, dns.TypeA), "Blocked queries are never forwarded")
+}
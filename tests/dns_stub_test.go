@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/dnscheck"
+	"github.com/yebyen/home-lab-terraform/internal/dnsstub"
+)
+
+// stubExchange sends one query to addr over network
+func stubExchange(t *testing.T, addr, network, name string, qtype uint16) *dns.Msg {
+	t.Helper()
+
+	query := new(dns.Msg)
+	query.SetQuestion(dns.Fqdn(name), qtype)
+	client := &dns.Client{Net: network, Timeout: 5 * time.Second}
+	reply, _, err := client.Exchange(query, addr)
+	require.NoError(t, err, "%s %s over %s", name, dns.TypeToString[qtype], network)
+	return reply
+}
+
+// answerData is the data of a reply's answer records
+func answerData(reply *dns.Msg) []string {
+	var data []string
+	for _, rr := range reply.Answer {
+		data = append(data, dnscheck.RData(rr))
+	}
+	return data
+}
+
+// TestDNSStubOffline checks the stub upstream resolver and its fixture zone
+func TestDNSStubOffline(t *testing.T) {
+	t.Parallel()
+
+	stub := StartStubUpstream(t, "127.0.0.1:0")
+	addr := stub.Addr
+
+	t.Run("Fixture_Zone", func(t *testing.T) {
+		zone, err := dnsstub.LoadZone(upstreamZone)
+		require.NoError(t, err)
+		names := zone.Names()
+		for _, name := range []string{"google.com.", "_imaps._tcp.gmail.com.", "ads.example.com."} {
+			assert.Contains(t, names, name)
+		}
+
+		_, err = dnsstub.ParseZone(strings.NewReader("www IN A 192.0.2.1\n"), "relative.zone")
+		assert.Error(t, err, "Relative names need an $ORIGIN")
+	})
+
+	t.Run("Answers", func(t *testing.T) {
+		reply := stubExchange(t, addr, "udp", "google.com", dns.TypeA)
+		assert.Equal(t, []string{"192.0.2.10"}, answerData(reply))
+		assert.True(t, reply.RecursionAvailable, "Pi-hole expects a recursive resolver")
+
+		reply = stubExchange(t, addr, "tcp", "WWW.Google.com", dns.TypeA)
+		assert.Equal(t, []string{"google.com.", "192.0.2.10"}, answerData(reply), "CNAMEs are followed")
+
+		reply = stubExchange(t, addr, "udp", "_imaps._tcp.gmail.com", dns.TypeSRV)
+		assert.Equal(t, []string{"5 0 993 imap.gmail.com."}, answerData(reply))
+	})
+
+	t.Run("Negative_Answers", func(t *testing.T) {
+		reply := stubExchange(t, addr, "udp", "missing.example.com", dns.TypeA)
+		assert.Equal(t, dns.RcodeNameError, reply.Rcode)
+		require.Len(t, reply.Ns, 1, "The SOA lets Pi-hole cache the NXDOMAIN")
+		assert.Equal(t, "example.com.", reply.Ns[0].Header().Name)
+
+		reply = stubExchange(t, addr, "udp", "_tcp.gmail.com", dns.TypeTXT)
+		assert.Equal(t, dns.RcodeSuccess, reply.Rcode, "Empty non-terminals are NODATA")
+		assert.Empty(t, reply.Answer)
+
+		reply = stubExchange(t, addr, "udp", "google.com", dns.TypeSRV)
+		assert.Equal(t, dns.RcodeSuccess, reply.Rcode)
+		assert.Empty(t, reply.Answer)
+
+		reply = stubExchange(t, addr, "udp", "internet.invalid", dns.TypeA)
+		assert.Equal(t, dns.RcodeNameError, reply.Rcode, "Nothing outside the fixture resolves")
+		assert.Empty(t, reply.Ns)
+	})
+
+	t.Run("Truncation", func(t *testing.T) {
+		reply := stubExchange(t, addr, "udp", "google.com", dns.TypeTXT)
+		assert.True(t, reply.Truncated)
+		reply = stubExchange(t, addr, "tcp", "google.com", dns.TypeTXT)
+		assert.False(t, reply.Truncated)
+		assert.Len(t, reply.Answer, 12)
+	})
+
+	t.Run("Conformance", func(t *testing.T) {
+		cases, err := dnscheck.Cases(upstreamProfile(nil, nil, ""))
+		require.NoError(t, err)
+		requireConformance(t, addr, cases)
+	})
+
+	t.Run("Query_Counts", func(t *testing.T) {
+		counted := StartStubUpstream(t, "127.0.0.1:0")
+		counted.Reset()
+		countedAddr := counted.Addr
+		stubExchange(t, countedAddr, "udp", "gmail.com", dns.TypeA)
+		stubExchange(t, countedAddr, "tcp", "Gmail.com.", dns.TypeA)
+		stubExchange(t, countedAddr, "udp", "gmail.com", dns.TypeAAAA)
+
+		assert.Equal(t, 2, counted.Queries("gmail.com", dns.TypeA))
+		assert.Equal(t, 1, counted.Queries("GMAIL.COM.", dns.TypeAAAA))
+		assert.Equal(t, 3, counted.Total())
+		counted.Reset()
+		assert.Zero(t, counted.Total())
+	})
+
+	t.Run("Port_In_Use", func(t *testing.T) {
+		_, err := dnsstub.Start(stub.Addr, dnsstub.NewZone())
+		assert.Error(t, err)
+	})
+}
+
+// TestPiholeStubUpstream checks Pi-hole forwards to, caches from and
+// blocks in front of the stub upstream, with no internet access needed
+func TestPiholeStubUpstream(t *testing.T) {
+	RequireDocker(t)
+	t.Parallel()
+
+	env := NewPiholeEnv(t).WithName("stub").Build()
+	require.NotNil(t, env.Upstream)
+
+	t.Run("Forwarding", func(t *testing.T) {
+		reply := stubExchange(t, env.DNSAddress, "udp", "gmail.com", dns.TypeA)
+		assert.Equal(t, []string{"192.0.2.20"}, answerData(reply))
+		assert.Equal(t, 1, env.Upstream.Queries("gmail.com", dns.TypeA))
+
+		reply = stubExchange(t, env.DNSAddress, "udp", "nxdomain.example.com", dns.TypeA)
+		assert.Equal(t, dns.RcodeNameError, reply.Rcode)
+	})
+
+	t.Run("Caching", func(t *testing.T) {
+		stubExchange(t, env.DNSAddress, "udp", "www.example.com", dns.TypeA)
+		forwarded := env.Upstream.Queries("www.example.com", dns.TypeA)
+		require.Equal(t, 1, forwarded)
+
+		for i := 0; i < 3; i++ {
+			reply := stubExchange(t, env.DNSAddress, "udp", "www.example.com", dns.TypeA)
+			assert.Equal(t, []string{"192.0.2.30"}, answerData(reply))
+		}
+		assert.Equal(t, forwarded, env.Upstream.Queries("www.example.com", dns.TypeA), "Repeats come from the cache")
+	})
+
+	t.Run("Blocking", func(t *testing.T) {
+		require.NoError(t, env.Session.DenyDomain("tracker.example.com", "stub upstream test"))
+
+		reply := stubExchange(t, env.DNSAddress, "udp", "tracker.example.com", dns.TypeA)
+		assert.Equal(t, []string{"0.0.0.0"}, answerData(reply))
+		assert.Zero(t, env.Upstream.Queries("tracker.example.com", dns.TypeA), "Blocked queries are never forwarded")
+	})
+}
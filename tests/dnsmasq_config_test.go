@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/dnsmasq"
+	"github.com/yebyen/home-lab-terraform/internal/tfeval"
+)
+
+// metnoom13netSubnet is the 13-net VLAN dnsmasq serves
+var metnoom13netSubnet = netip.MustParsePrefix("10.17.13.0/24")
+
+// metnoom13netDnsmasq builds the dnsmasq Config from the metnoom-13net
+// environment's dnsmasq_13net module call and returns the evaluated module
+func metnoom13netDnsmasq(t *testing.T) (*dnsmasq.Config, *tfeval.Module) {
+	t.Helper()
+
+	env := LoadModuleOffline(t, map[string]interface{}{"pihole_api_token": "offline-token"}, "environments", "metnoom-13net")
+	module, err := env.ModuleCall("dnsmasq_13net")
+	require.NoError(t, err)
+
+	config, err := dnsmasq.FromModule(module)
+	require.NoError(t, err)
+	return config, module
+}
+
+// TestDnsmasqConfig renders and validates the 13-net dnsmasq settings and
+// checks the model agrees with the flags the module passes
+func TestDnsmasqConfig(t *testing.T) {
+	t.Parallel()
+
+	config, module := metnoom13netDnsmasq(t)
+
+	t.Run("Args_Match_Module_Command", func(t *testing.T) {
+		command, err := RequireResource(t, module, "docker_container.dnsmasq").Strings("command")
+		require.NoError(t, err)
+		assert.Equal(t, command, config.Args())
+	})
+
+	t.Run("Render_Golden", func(t *testing.T) {
+		golden := filepath.Join("testdata", "dnsmasq", "metnoom-13net.conf")
+		if *updateGolden {
+			require.NoError(t, os.MkdirAll(filepath.Dir(golden), 0755))
+			require.NoError(t, os.WriteFile(golden, config.Render(), 0644))
+		}
+		expected, err := os.ReadFile(golden)
+		require.NoError(t, err)
+		assert.Equal(t, string(expected), string(config.Render()))
+	})
+
+	t.Run("Valid_On_13net", func(t *testing.T) {
+		assert.NoError(t, config.Validate(metnoom13netSubnet))
+		assert.Equal(t, "http://10.17.13.251:8080/boot.ipxe", config.PXE.BootURL())
+	})
+
+	t.Run("Invalid_Settings", func(t *testing.T) {
+		addr := netip.MustParseAddr
+		cases := map[string]struct {
+			mutate func(c *dnsmasq.Config)
+			want   string
+		}{
+			"Range_Outside_Subnet": {func(c *dnsmasq.Config) { c.DHCP.RangeEnd = addr("10.17.14.20") }, "DHCP range end 10.17.14.20 is outside 10.17.13.0/24"},
+			"Range_Reversed":       {func(c *dnsmasq.Config) { c.DHCP.RangeStart, c.DHCP.RangeEnd = c.DHCP.RangeEnd, c.DHCP.RangeStart }, "ends before it starts"},
+			"Static_IP_In_Range":   {func(c *dnsmasq.Config) { c.StaticIP = addr("10.17.13.50") }, "static IP 10.17.13.50 is inside the DHCP range"},
+			"Router_In_Range":      {func(c *dnsmasq.Config) { c.DHCP.Router = addr("10.17.13.1"); c.DHCP.RangeStart = addr("10.17.13.1") }, "router 10.17.13.1 is inside the DHCP range"},
+			"DNS_Outside_Subnet":   {func(c *dnsmasq.Config) { c.DHCP.DNSServer = addr("10.17.12.109") }, "DNS server 10.17.12.109 is outside"},
+			"Broadcast_Router":     {func(c *dnsmasq.Config) { c.DHCP.Router = addr("10.17.13.255") }, "network or broadcast address"},
+			"Matchbox_Off_VLAN":    {func(c *dnsmasq.Config) { c.PXE.Matchbox = netip.MustParseAddrPort("10.17.12.251:8080") }, "matchbox server 10.17.12.251 is outside"},
+			"PXE_Without_TFTP":     {func(c *dnsmasq.Config) { c.TFTP = nil }, "PXE is enabled without TFTP"},
+		}
+		for name, tc := range cases {
+			broken, _ := metnoom13netDnsmasq(t)
+			tc.mutate(broken)
+			err := broken.Validate(metnoom13netSubnet)
+			var validationErr *dnsmasq.ValidationError
+			if assert.ErrorAs(t, err, &validationErr, name) {
+				assert.Contains(t, err.Error(), tc.want, name)
+			}
+		}
+	})
+
+	t.Run("Module_Vars_Errors", func(t *testing.T) {
+		_, err := dnsmasq.FromModuleVars(map[string]interface{}{"dhcp_enabled": true, "dhcp_router": "10.17.13"}, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "static_ip: required")
+		assert.Contains(t, err.Error(), "dhcp_range_start: required", "No fallback to the module's default")
+		assert.Contains(t, err.Error(), "dhcp_router")
+	})
+
+	t.Run("Module_Defaults", func(t *testing.T) {
+		module := LoadModuleOffline(t, map[string]interface{}{
+			"container_name":    "dnsmasq-test",
+			"vlan_network_name": "vlan-13net",
+			"static_ip":         "10.17.13.252",
+		}, "modules", "dnsmasq")
+		defaults, err := dnsmasq.FromModule(module)
+		require.NoError(t, err)
+
+		rangeStart := module.Schema.Variables["dhcp_range_start"].Default.AsString()
+		assert.Equal(t, rangeStart, defaults.DHCP.RangeStart.String(), "Defaults come from variables.tf")
+		assert.NotNil(t, defaults.PXE, "pxe_enabled defaults on")
+
+		rules, err := module.Local("pxe_arches")
+		require.NoError(t, err)
+		require.Len(t, defaults.PXE.Arches, rules.LengthInt())
+		assert.Equal(t, dnsmasq.ArchBoot{Tag: "efi64", Arch: 9, File: "ipxe.efi"}, defaults.PXE.Arches[3])
+	})
+
+	t.Run("Probe_Matchbox", func(t *testing.T) {
+		matchbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/boot.ipxe" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte("#!ipxe\nchain ipxe?uuid=${uuid}&mac=${mac:hexhyp}\n"))
+		}))
+		defer matchbox.Close()
+
+		probed, _ := metnoom13netDnsmasq(t)
+		probed.PXE.Matchbox = netip.MustParseAddrPort(matchbox.Listener.Addr().String())
+		assert.NoError(t, probed.ProbeMatchbox(matchbox.Client()))
+
+		probed.PXE.Matchbox = netip.AddrPortFrom(probed.PXE.Matchbox.Addr(), probed.PXE.Matchbox.Port()+1)
+		assert.Error(t, probed.ProbeMatchbox(matchbox.Client()), "Wrong port")
+	})
+}
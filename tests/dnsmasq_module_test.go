@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dnsmasqVars are the 13-net values with the service toggles overridden
+func dnsmasqVars(dhcp, tftp, pxe bool) map[string]interface{} {
+	return map[string]interface{}{
+		"container_name":    "dnsmasq-test",
+		"vlan_network_name": "vlan-13net",
+		"static_ip":         "10.17.13.252",
+		"dhcp_enabled":      dhcp,
+		"tftp_enabled":      tftp,
+		"pxe_enabled":       pxe,
+		"matchbox_server":   "10.17.13.251",
+		"matchbox_port":     8080,
+	}
+}
+
+// TestDnsmasqModuleVariableCombinations checks every combination of the
+// DHCP, TFTP and PXE toggles against the container and the module outputs
+func TestDnsmasqModuleVariableCombinations(t *testing.T) {
+	t.Parallel()
+
+	for _, dhcp := range []bool{true, false} {
+		for _, tftp := range []bool{true, false} {
+			for _, pxe := range []bool{true, false} {
+				dhcp, tftp, pxe := dhcp, tftp, pxe
+				name := "DHCP_" + onOff(dhcp) + "_TFTP_" + onOff(tftp) + "_PXE_" + onOff(pxe)
+				t.Run(name, func(t *testing.T) {
+					t.Parallel()
+
+					module := LoadModuleOffline(t, dnsmasqVars(dhcp, tftp, pxe), "modules", "dnsmasq")
+					container := RequireResource(t, module, "docker_container.dnsmasq")
+
+					command, err := container.Strings("command")
+					require.NoError(t, err)
+					assert.Equal(t, dhcp, slices.Contains(command, "--dhcp-range=10.17.13.3,10.17.13.199"), "dhcp-range flag")
+					assert.Equal(t, tftp, slices.Contains(command, "--enable-tftp"), "enable-tftp flag")
+					assert.Equal(t, pxe, slices.Contains(command, "--dhcp-boot=tag:ipxe,http://10.17.13.251:8080/boot.ipxe"), "iPXE chainload flag")
+
+					volumes, err := container.Blocks("volumes")
+					require.NoError(t, err)
+					if tftp {
+						assert.Len(t, volumes, 1, "TFTP volume is mounted")
+					} else {
+						assert.Empty(t, volumes, "No volumes without TFTP")
+					}
+
+					for output, enabled := range map[string]bool{
+						"dhcp_range":  dhcp,
+						"dhcp_config": dhcp,
+						"tftp_config": tftp,
+						"pxe_config":  pxe,
+					} {
+						value, err := module.Output(output)
+						require.NoError(t, err)
+						assert.Equal(t, !enabled, value.IsNull(), "%s is null only when its service is disabled", output)
+					}
+
+					config, err := module.Output("network_config")
+					require.NoError(t, err)
+					services := config.GetAttr("services")
+					assert.Equal(t, dhcp, services.GetAttr("dhcp").True())
+					assert.Equal(t, tftp, services.GetAttr("tftp").True())
+					assert.Equal(t, pxe, services.GetAttr("pxe").True())
+				})
+			}
+		}
+	}
+
+	t.Run("Logging_Toggle", func(t *testing.T) {
+		t.Parallel()
+
+		for _, logging := range []bool{true, false} {
+			vars := dnsmasqVars(true, true, true)
+			vars["enable_logging"] = logging
+			command, err := RequireResource(t, LoadModuleOffline(t, vars, "modules", "dnsmasq"), "docker_container.dnsmasq").Strings("command")
+			require.NoError(t, err)
+			assert.Equal(t, logging, slices.Contains(command, "--log-queries"), "log-queries with enable_logging=%t", logging)
+			assert.Equal(t, logging, slices.Contains(command, "--log-dhcp"), "log-dhcp with enable_logging=%t", logging)
+		}
+	})
+}
+
+// TestDnsmasqModulePlan plans the module with the 13-net values and with
+// only DNS left on. The VLAN network only has to exist at apply time.
+func TestDnsmasqModulePlan(t *testing.T) {
+	t.Parallel()
+
+	container := "docker_container.dnsmasq"
+
+	t.Run("All_Services", func(t *testing.T) {
+		t.Parallel()
+
+		plan := PlanModule(t, dnsmasqVars(true, true, true), "modules", "dnsmasq")
+		plan.AssertAction(container, PlanCreate)
+		plan.AssertAttributeEquals(container, "networks_advanced.0.ipv4_address", "10.17.13.252")
+		plan.AssertAttributeContains(container, "command", "--enable-tftp")
+		plan.AssertAttributeContains(container, "command", "--dhcp-boot=tag:ipxe,http://10.17.13.251:8080/boot.ipxe")
+		plan.AssertAttributeEquals(container, "volumes.0.container_path", "/var/lib/tftpboot")
+	})
+
+	t.Run("DNS_Only", func(t *testing.T) {
+		t.Parallel()
+
+		plan := PlanModule(t, dnsmasqVars(false, false, false), "modules", "dnsmasq")
+		plan.AssertAction(container, PlanCreate)
+		plan.AssertAttributeEquals(container, "command", []string{"-d", "-q", "-p0", "--log-queries", "--log-dhcp"})
+		plan.AssertAttributeEquals(container, "capabilities.0.add", []string{"NET_ADMIN"})
+	})
+}
+
+// TestDnsmasqModuleApply deploys dnsmasq with DHCP and TFTP on an isolated
+// network and checks both answer a client on that network
+func TestDnsmasqModuleApply(t *testing.T) {
+	RequireDocker(t)
+
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano()%100000)
+	networkName := "dnsmasq-apply-" + suffix
+	volumeName := "dnsmasq-apply-tftp-" + suffix
+	subnet := netip.MustParsePrefix(allocateSubnet())
+	host := func(n byte) string {
+		a := subnet.Addr().As4()
+		a[3] = n
+		return netip.AddrFrom4(a).String()
+	}
+
+	vars := dnsmasqVars(true, true, false)
+	vars["container_name"] = "dnsmasq-apply-" + suffix
+	vars["vlan_network_name"] = networkName
+	vars["static_ip"] = host(252)
+	vars["dhcp_range_start"] = host(100)
+	vars["dhcp_range_end"] = host(150)
+	vars["dhcp_router"] = host(1)
+	vars["dhcp_dns_server"] = host(252)
+	vars["tftp_volume_name"] = volumeName
+	options := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: "../terraform/modules/dnsmasq",
+		Vars:         vars,
+		NoColor:      true,
+	})
+	RequireValidVars(t, options)
+	RequireTerraform(t, options)
+	probe := buildDHCPProbe(t)
+
+	t.Cleanup(func() {
+		if os.Getenv("SKIP_CLEANUP") != "true" {
+			runDocker(t, "network", "rm", networkName)
+			runDocker(t, "volume", "rm", "-f", volumeName)
+		}
+	})
+	runDocker(t, "network", "create", "--subnet", subnet.String(), "--gateway", host(1), networkName)
+	// A boot file for TFTP to serve, in the volume the module mounts
+	runDocker(t, "volume", "create", volumeName)
+	runDocker(t, "run", "--rm", "-v", volumeName+":/tftpboot", "busybox",
+		"sh", "-c", "echo dnsmasq-apply > /tftpboot/undionly.kpxe")
+	t.Cleanup(func() {
+		if os.Getenv("SKIP_CLEANUP") != "true" {
+			terraform.Destroy(t, options)
+		}
+	})
+	terraform.InitAndApply(t, options)
+
+	t.Run("DHCP_Lease", func(t *testing.T) {
+		var result dhcpProbeResult
+		require.NoError(t, json.Unmarshal([]byte(runDocker(t, "run", "--rm", "--network", networkName,
+			"-v", probe+":/dhcpprobe:ro", "busybox", "/dhcpprobe", "-timeout", "20s")), &result))
+
+		addr, err := netip.ParseAddr(result.Address)
+		require.NoError(t, err)
+		assert.True(t, addr.Compare(netip.MustParseAddr(host(100))) >= 0 && addr.Compare(netip.MustParseAddr(host(150))) <= 0,
+			"%s is within the DHCP range", addr)
+		assert.Equal(t, host(1), result.Router)
+		assert.Equal(t, host(252), result.DNSServer)
+	})
+
+	t.Run("TFTP_Transfer", func(t *testing.T) {
+		var output string
+		for deadline := time.Now().Add(30 * time.Second); ; time.Sleep(2 * time.Second) {
+			out, err := exec.Command("docker", "run", "--rm", "--network", networkName, "busybox",
+				"tftp", "-g", "-r", "undionly.kpxe", "-l", "/dev/stdout", host(252)).CombinedOutput()
+			output = string(out)
+			if err == nil || time.Now().After(deadline) {
+				require.NoError(t, err, output)
+				break
+			}
+		}
+		assert.Equal(t, "dnsmasq-apply\n", output)
+	})
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "On"
+	}
+	return "Off"
+}
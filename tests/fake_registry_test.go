@@ -0,0 +1,212 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yebyen/home-lab-terraform/internal/registry"
+)
+
+// fakeRegistry is an in-process stand-in for a registry:2 server. It keeps
+// blobs and manifests in memory and implements enough of the V2 API for the
+// registry client to push, pull, list and delete. Like a pull-through
+// cache, it refuses deletes unless DeleteEnabled is set. Requests are
+// logged in registry:2's access log format.
+type fakeRegistry struct {
+	*httptest.Server
+	DeleteEnabled bool
+	// PageSize caps list pages below the client's requested n
+	PageSize int
+
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string]map[string][]byte
+	uploads   int
+	accessLog []string
+}
+
+// accessLogWriter records the status of a response for the access log
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = 200
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+	return n, err
+}
+
+// newFakeRegistry starts a fake registry that is shut down when the test ends
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	fake := &fakeRegistry{
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string]map[string][]byte),
+	}
+	fake.Server = httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// AccessLog returns the requests served so far, as `docker logs` would
+func (f *fakeRegistry) AccessLog() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return strings.Join(f.accessLog, "\n") + "\n"
+}
+
+func (f *fakeRegistry) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	logged := &accessLogWriter{ResponseWriter: w}
+	f.route(logged, r)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if logged.status == 0 {
+		logged.status = 200
+	}
+	f.accessLog = append(f.accessLog, fmt.Sprintf(`172.17.0.1 - - [%s] "%s %s %s" %d %d "" "%s"`,
+		time.Now().Format("02/Jan/2006:15:04:05 -0700"), r.Method, r.URL.RequestURI(), r.Proto,
+		logged.status, logged.size, r.UserAgent()))
+}
+
+func (f *fakeRegistry) route(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	if path == "" {
+		w.WriteHeader(200)
+		return
+	}
+
+	switch {
+	case path == "_catalog":
+		var repositories []string
+		for repository := range f.manifests {
+			repositories = append(repositories, repository)
+		}
+		sort.Strings(repositories)
+		f.writePage(w, r, "_catalog", "repositories", repositories)
+
+	case strings.HasSuffix(path, "/tags/list"):
+		repository := strings.TrimSuffix(path, "/tags/list")
+		var tags []string
+		for reference := range f.manifests[repository] {
+			if !strings.HasPrefix(reference, "sha256:") {
+				tags = append(tags, reference)
+			}
+		}
+		sort.Strings(tags)
+		f.writePage(w, r, path, "tags", tags)
+
+	case r.Method == "POST" && strings.HasSuffix(path, "/blobs/uploads/"):
+		f.uploads++
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s%d", path, f.uploads))
+		w.WriteHeader(202)
+
+	case r.Method == "PUT" && strings.Contains(path, "/blobs/uploads/"):
+		data, _ := io.ReadAll(r.Body)
+		digest := r.URL.Query().Get("digest")
+		if registry.Digest(data) != digest {
+			http.Error(w, `{"errors":[{"code":"DIGEST_INVALID"}]}`, 400)
+			return
+		}
+		f.blobs[digest] = data
+		w.WriteHeader(201)
+
+	case strings.Contains(path, "/blobs/"):
+		digest := path[strings.LastIndex(path, "/")+1:]
+		data, ok := f.blobs[digest]
+		if !ok {
+			http.Error(w, `{"errors":[{"code":"BLOB_UNKNOWN"}]}`, 404)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.Write(data)
+
+	case strings.Contains(path, "/manifests/"):
+		i := strings.Index(path, "/manifests/")
+		repository, reference := path[:i], path[i+len("/manifests/"):]
+		if r.Method == "DELETE" {
+			if !f.DeleteEnabled {
+				http.Error(w, `{"errors":[{"code":"UNSUPPORTED"}]}`, 405)
+				return
+			}
+			data, ok := f.manifests[repository][reference]
+			if !ok {
+				http.Error(w, `{"errors":[{"code":"MANIFEST_UNKNOWN"}]}`, 404)
+				return
+			}
+			for ref, manifest := range f.manifests[repository] {
+				if string(manifest) == string(data) {
+					delete(f.manifests[repository], ref)
+				}
+			}
+			if len(f.manifests[repository]) == 0 {
+				delete(f.manifests, repository)
+			}
+			w.WriteHeader(202)
+			return
+		}
+		if r.Method == "PUT" {
+			data, _ := io.ReadAll(r.Body)
+			if f.manifests[repository] == nil {
+				f.manifests[repository] = make(map[string][]byte)
+			}
+			f.manifests[repository][reference] = data
+			f.manifests[repository][registry.Digest(data)] = data
+			w.WriteHeader(201)
+			return
+		}
+		data, ok := f.manifests[repository][reference]
+		if !ok {
+			http.Error(w, `{"errors":[{"code":"MANIFEST_UNKNOWN"}]}`, 404)
+			return
+		}
+		w.Header().Set("Content-Type", registry.MediaTypeManifest)
+		w.Header().Set("Docker-Content-Digest", registry.Digest(data))
+		w.Write(data)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// writePage serves one page of a list, paginated with n and last and a Link
+// header the way registry:2 does
+func (f *fakeRegistry) writePage(w http.ResponseWriter, r *http.Request, path, key string, items []string) {
+	start := 0
+	if last := r.URL.Query().Get("last"); last != "" {
+		start = sort.SearchStrings(items, last) + 1
+		if start > len(items) {
+			start = len(items)
+		}
+	}
+	end := len(items)
+	n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+	if f.PageSize > 0 && (n <= 0 || n > f.PageSize) {
+		n = f.PageSize
+	}
+	if n > 0 && start+n < end {
+		end = start + n
+		w.Header().Set("Link", fmt.Sprintf(`</v2/%s?n=%d&last=%s>; rel="next"`, path, n, items[end-1]))
+	}
+	writeJSON(w, 200, map[string]interface{}{key: items[start:end]})
+}
@@ -0,0 +1,215 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/tfeval"
+)
+
+// matchboxVars are the 13-net values for the matchbox module
+func matchboxVars() map[string]interface{} {
+	return map[string]interface{}{
+		"container_name":    "matchbox-test",
+		"vlan_network_name": "vlan-13net",
+		"static_ip":         "10.17.13.251",
+		"matchbox_port":     8080,
+	}
+}
+
+// TestMatchboxModuleVariableCombinations checks the matchbox container and
+// outputs as the optional volume, environment and HTTPS inputs change
+func TestMatchboxModuleVariableCombinations(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Defaults", func(t *testing.T) {
+		module := LoadModuleOffline(t, matchboxVars(), "modules", "matchbox")
+		container := RequireResource(t, module, "docker_container.matchbox")
+
+		command, err := container.Strings("command")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"-address=:8080", "-log-level=debug"}, command)
+
+		volumes, err := container.Blocks("volumes")
+		require.NoError(t, err)
+		assert.Empty(t, volumes, "No data volume unless data_volume_name is set")
+
+		bootURL, err := module.Output("boot_ipxe_url")
+		require.NoError(t, err)
+		assert.Equal(t, "http://10.17.13.251:8080/boot.ipxe", bootURL.AsString())
+	})
+
+	t.Run("Data_Volume_And_Env", func(t *testing.T) {
+		vars := matchboxVars()
+		vars["data_volume_name"] = "matchbox-data"
+		vars["log_level"] = "info"
+		vars["additional_env_vars"] = []string{"MATCHBOX_RPC_ADDRESS=0.0.0.0:8081"}
+		module := LoadModuleOffline(t, vars, "modules", "matchbox")
+		container := RequireResource(t, module, "docker_container.matchbox")
+
+		volumes, err := container.Blocks("volumes")
+		require.NoError(t, err)
+		require.Len(t, volumes, 1)
+		name, err := volumes[0].String("volume_name")
+		require.NoError(t, err)
+		assert.Equal(t, "matchbox-data", name)
+
+		env, err := container.Strings("env")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"MATCHBOX_ADDRESS=0.0.0.0:8080",
+			"MATCHBOX_LOG_LEVEL=info",
+			"MATCHBOX_RPC_ADDRESS=0.0.0.0:8081",
+		}, env)
+	})
+
+	// enable_https is only reported in server_config; the container is
+	// started the same way either way
+	t.Run("Enable_HTTPS", func(t *testing.T) {
+		for _, https := range []bool{false, true} {
+			vars := matchboxVars()
+			vars["enable_https"] = https
+			module := LoadModuleOffline(t, vars, "modules", "matchbox")
+
+			config, err := module.Output("server_config")
+			require.NoError(t, err)
+			assert.Equal(t, https, config.GetAttr("https_enabled").True())
+
+			command, err := RequireResource(t, module, "docker_container.matchbox").Strings("command")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"-address=:8080", "-log-level=debug"}, command, "enable_https=%t", https)
+		}
+	})
+
+	t.Run("RPC_Enabled", func(t *testing.T) {
+		vars := matchboxVars()
+		vars["rpc_enabled"] = true
+		vars["ca_file_path"] = "/etc/homelab/matchbox/ca.crt"
+		vars["cert_file_path"] = "/etc/homelab/matchbox/server.crt"
+		vars["key_file_path"] = "/etc/homelab/matchbox/server.key"
+		module := LoadModuleOffline(t, vars, "modules", "matchbox")
+		container := RequireResource(t, module, "docker_container.matchbox")
+
+		command, err := container.Strings("command")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"-address=:8080", "-log-level=debug", "-rpc-address=0.0.0.0:8081"}, command)
+
+		volumes, err := container.Blocks("volumes")
+		require.NoError(t, err)
+		mounts := make(map[string]string)
+		for _, volume := range volumes {
+			hostPath, err := volume.String("host_path")
+			require.NoError(t, err)
+			containerPath, err := volume.String("container_path")
+			require.NoError(t, err)
+			readOnly, err := volume.Bool("read_only")
+			require.NoError(t, err)
+			assert.True(t, readOnly, containerPath)
+			mounts[containerPath] = hostPath
+		}
+		assert.Equal(t, map[string]string{
+			"/etc/matchbox/ca.crt":     "/etc/homelab/matchbox/ca.crt",
+			"/etc/matchbox/server.crt": "/etc/homelab/matchbox/server.crt",
+			"/etc/matchbox/server.key": "/etc/homelab/matchbox/server.key",
+		}, mounts)
+
+		endpoint, err := module.Output("rpc_endpoint")
+		require.NoError(t, err)
+		assert.Equal(t, "10.17.13.251:8081", endpoint.AsString())
+
+		endpoint, err = LoadModuleOffline(t, matchboxVars(), "modules", "matchbox").Output("rpc_endpoint")
+		require.NoError(t, err)
+		assert.True(t, endpoint.IsNull(), "No gRPC endpoint unless rpc_enabled")
+	})
+
+	t.Run("Rejected_Values", func(t *testing.T) {
+		for name, override := range map[string]map[string]interface{}{
+			"Unsupported_Image": {"matchbox_image": "quay.io/poseidon/matchbox:latest"},
+			"Bad_Log_Level":     {"log_level": "trace"},
+		} {
+			vars := matchboxVars()
+			for key, value := range override {
+				vars[key] = value
+			}
+			_, err := tfeval.Load("../terraform/modules/matchbox", vars)
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+// TestMatchboxModulePlan plans matchbox with and without a data volume
+func TestMatchboxModulePlan(t *testing.T) {
+	t.Parallel()
+
+	container := "docker_container.matchbox"
+
+	t.Run("Defaults", func(t *testing.T) {
+		t.Parallel()
+
+		plan := PlanModule(t, matchboxVars(), "modules", "matchbox")
+		plan.AssertAction(container, PlanCreate)
+		plan.AssertAttributeEquals(container, "image", "kingdonb/matchbox:v1.10.5-cozy-spin-tailscale")
+		plan.AssertAttributeEquals(container, "networks_advanced.0.ipv4_address", "10.17.13.251")
+		plan.AssertAttributeEquals(container, "command", []string{"-address=:8080", "-log-level=debug"})
+	})
+
+	t.Run("Data_Volume_HTTPS", func(t *testing.T) {
+		t.Parallel()
+
+		vars := matchboxVars()
+		vars["data_volume_name"] = "matchbox-data"
+		vars["enable_https"] = true
+		plan := PlanModule(t, vars, "modules", "matchbox")
+		plan.AssertAttributeEquals(container, "volumes.0.volume_name", "matchbox-data")
+		plan.AssertAttributeEquals(container, "volumes.0.container_path", "/var/lib/matchbox")
+	})
+}
+
+// TestMatchboxModuleApply deploys matchbox with its defaults on an isolated
+// network and fetches the iPXE entry point machines chainload
+func TestMatchboxModuleApply(t *testing.T) {
+	RequireDocker(t)
+
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano()%100000)
+	networkName := "matchbox-apply-" + suffix
+	subnet := allocateSubnet()
+	staticIP := strings.TrimSuffix(subnet, "0/24") + "251"
+
+	vars := matchboxVars()
+	vars["container_name"] = "matchbox-apply-" + suffix
+	vars["vlan_network_name"] = networkName
+	vars["static_ip"] = staticIP
+	options := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: "../terraform/modules/matchbox",
+		Vars:         vars,
+		NoColor:      true,
+	})
+	RequireValidVars(t, options)
+	RequireTerraform(t, options)
+
+	t.Cleanup(func() {
+		if os.Getenv("SKIP_CLEANUP") != "true" {
+			runDocker(t, "network", "rm", networkName)
+		}
+	})
+	runDocker(t, "network", "create", "--subnet", subnet, networkName)
+	t.Cleanup(func() {
+		if os.Getenv("SKIP_CLEANUP") != "true" {
+			terraform.Destroy(t, options)
+		}
+	})
+	terraform.InitAndApply(t, options)
+
+	// wget exits non-zero unless the response is a 2xx
+	bootURL := terraform.Output(t, options, "boot_ipxe_url")
+	assert.Equal(t, fmt.Sprintf("http://%s:8080/boot.ipxe", staticIP), bootURL)
+	script, err := wgetOnNetwork(networkName, bootURL, 60*time.Second)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(script, "#!ipxe"), "boot.ipxe is an iPXE script:\n%s", script)
+}
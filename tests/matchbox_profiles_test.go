@@ -0,0 +1,274 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/matchbox"
+)
+
+// loadMatchboxInventory generates the layout for the testdata inventory
+func loadMatchboxInventory(t *testing.T) *matchbox.Layout {
+	t.Helper()
+
+	inventory, err := matchbox.LoadInventory(filepath.Join("testdata", "matchbox", "inventory.yaml"))
+	require.NoError(t, err)
+	layout, err := matchbox.Generate(inventory)
+	require.NoError(t, err)
+	return layout
+}
+
+// fakeMatchbox serves /boot.ipxe, /ipxe and /generic from a data directory
+// the way matchbox does, selecting groups by the request's labels
+func fakeMatchbox(t *testing.T, dataDir string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/boot.ipxe" {
+			fmt.Fprint(w, matchbox.BootScript)
+			return
+		}
+		layout, err := matchbox.ReadLayout(dataDir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		group, ok := layout.Select(matchbox.NormalizeLabels(r.URL.Query()))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		profile, ok := layout.Profile(group.Profile)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Path {
+		case "/ipxe":
+			fmt.Fprint(w, matchbox.IPXEScript(profile))
+		case "/generic":
+			w.Write(layout.Generic[profile.GenericID])
+		case "/ignition":
+			w.Write(layout.Ignition[profile.IgnitionID])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// wgetOnNetwork fetches url from a container attached to network, for
+// services only reachable on their VLAN, retrying until timeout
+func wgetOnNetwork(network, url string, timeout time.Duration) (string, error) {
+	var output []byte
+	var err error
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(2 * time.Second) {
+		output, err = exec.Command("docker", "run", "--rm", "--network", network, "busybox", "wget", "-qO-", url).CombinedOutput()
+		if err == nil {
+			return string(output), nil
+		}
+	}
+	return "", fmt.Errorf("GET %s: %v\n%s", url, err, output)
+}
+
+// TestMatchboxProfilesOffline generates profiles and groups from the
+// testdata inventory and serves them from a fake matchbox
+func TestMatchboxProfilesOffline(t *testing.T) {
+	t.Parallel()
+
+	layout := loadMatchboxInventory(t)
+	files, err := layout.Files()
+	require.NoError(t, err)
+
+	t.Run("Golden_Files", func(t *testing.T) {
+		golden := filepath.Join("testdata", "matchbox", "golden")
+		if *updateGolden {
+			require.NoError(t, os.RemoveAll(golden))
+			require.NoError(t, layout.WriteTo(golden))
+		}
+		assertGoldenDir(t, golden, files)
+	})
+
+	t.Run("Config_References", func(t *testing.T) {
+		controlplane, ok := layout.Profile("talos-controlplane")
+		require.True(t, ok)
+		assert.Equal(t, "talos-controlplane.yaml", controlplane.GenericID)
+		assert.Contains(t, controlplane.Boot.Args, "talos.config=http://10.17.13.251:8080/generic?mac=${mac:hexhyp}")
+		assert.Contains(t, string(layout.Generic["talos-controlplane.yaml"]), "type: controlplane")
+
+		flatcar, ok := layout.Profile("flatcar-stable")
+		require.True(t, ok)
+		assert.Equal(t, "flatcar-stable.ign", flatcar.IgnitionID)
+		assert.Empty(t, flatcar.GenericID)
+		assert.Contains(t, flatcar.Boot.Args, "ignition.config.url=http://10.17.13.251:8080/ignition?uuid=${uuid}&mac=${mac:hexhyp}")
+	})
+
+	t.Run("Selectors", func(t *testing.T) {
+		cases := map[string]struct {
+			labels url.Values
+			group  string
+		}{
+			"MAC_Hex_Hyphens":      {url.Values{"mac": {"52-54-00-13-01-01"}}, "cp1"},
+			"MAC_Normalized":       {url.Values{"mac": {"52:54:00:13:02:01"}}, "worker1"},
+			"MAC_And_UUID":         {url.Values{"mac": {"52-54-00-13-02-02"}, "uuid": {"8e9a4c5f-1b2d-4e3f-9a0b-1c2d3e4f5a6b"}}, "worker2"},
+			"UUID_Upper_Case":      {url.Values{"uuid": {"3F1C2B4A-5D6E-4F70-8192-A3B4C5D6E7F8"}, "mac": {"52-54-00-99-99-99"}}, "bastion"},
+			"Extra_Labels_Ignored": {url.Values{"mac": {"52-54-00-13-01-01"}, "hostname": {"cp1"}, "serial": {""}}, "cp1"},
+		}
+		for name, tc := range cases {
+			group, ok := layout.Select(matchbox.NormalizeLabels(tc.labels))
+			if assert.True(t, ok, name) {
+				assert.Equal(t, tc.group, group.ID, name)
+			}
+		}
+
+		_, ok := layout.Select(matchbox.NormalizeLabels(url.Values{"mac": {"52-54-00-13-02-02"}}))
+		assert.False(t, ok, "worker2 needs both its MAC and UUID")
+	})
+
+	t.Run("Most_Specific_Group_Wins", func(t *testing.T) {
+		specific := *layout
+		specific.Groups = append([]matchbox.Group{{ID: "default", Profile: "talos-worker"}}, layout.Groups...)
+		group, ok := specific.Select(map[string]string{"mac": "52:54:00:13:01:01"})
+		require.True(t, ok)
+		assert.Equal(t, "cp1", group.ID)
+
+		group, ok = specific.Select(map[string]string{"mac": "52:54:00:ff:ff:ff"})
+		require.True(t, ok)
+		assert.Equal(t, "default", group.ID, "A group without selectors matches every machine")
+	})
+
+	t.Run("Invalid_Inventories", func(t *testing.T) {
+		cases := map[string]struct {
+			inventory string
+			want      string
+		}{
+			"Unknown_Profile":    {"profiles: {p: {kernel: k}}\nmachines: [{name: m, mac: '52:54:00:00:00:01', profile: q}]", `unknown profile "q"`},
+			"No_Selector":        {"profiles: {p: {kernel: k}}\nmachines: [{name: m, profile: p}]", "needs a mac or uuid"},
+			"Bad_MAC":            {"profiles: {p: {kernel: k}}\nmachines: [{name: m, mac: '52:54:00', profile: p}]", "invalid MAC address"},
+			"Duplicate_MAC":      {"profiles: {p: {kernel: k}}\nmachines: [{name: a, mac: '52:54:00:00:00:01', profile: p}, {name: b, mac: '52-54-00-00-00-01', profile: p}]", "machine b: same selector as a"},
+			"Path_In_Name":       {"profiles: {p: {kernel: k}}\nmachines: [{name: ../m, mac: '52:54:00:00:00:01', profile: p}]", "name must be"},
+			"No_Kernel":          {"profiles: {p: {initrd: [i]}}", "profile p: kernel is required"},
+			"Config_Without_URL": {"profiles: {p: {kernel: k, talos_config: c.yaml}}", "matchbox_url is required"},
+			"Unknown_Field":      {"profiles: {p: {kernel: k, kernal_args: [a]}}", "kernal_args"},
+		}
+		for name, tc := range cases {
+			_, err := matchbox.ParseInventory([]byte(tc.inventory))
+			if assert.Error(t, err, name) {
+				assert.Contains(t, err.Error(), tc.want, name)
+			}
+		}
+	})
+
+	t.Run("Served_By_Fake_Matchbox", func(t *testing.T) {
+		dataDir := t.TempDir()
+		require.NoError(t, layout.WriteTo(dataDir))
+		client := matchbox.NewClient(fakeMatchbox(t, dataDir).URL)
+
+		script, err := client.BootScript()
+		require.NoError(t, err)
+		assert.Equal(t, matchbox.BootScript, script)
+
+		script, err = client.IPXE(url.Values{"mac": {"52-54-00-13-01-01"}})
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(script, "#!ipxe\nkernel /assets/talos/v1.7.6/vmlinuz-amd64 initrd=initramfs-amd64.xz"))
+		assert.Contains(t, script, "\ninitrd /assets/talos/v1.7.6/initramfs-amd64.xz\nboot\n")
+
+		config, err := client.Generic(url.Values{"mac": {"52-54-00-13-01-01"}})
+		require.NoError(t, err)
+		assert.Contains(t, config, "type: controlplane")
+
+		_, err = client.IPXE(url.Values{"mac": {"52-54-00-ff-ff-ff"}})
+		assert.ErrorContains(t, err, "status 404")
+	})
+}
+
+// TestMatchboxBootScripts runs the matchbox module with a generated data
+// directory mounted and fetches the iPXE scripts machines would boot from
+func TestMatchboxBootScripts(t *testing.T) {
+	RequireDocker(t)
+
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano()%100000)
+	networkName := "matchbox-boot-" + suffix
+	subnet := allocateSubnet()
+	staticIP := strings.TrimSuffix(subnet, "0/24") + "251"
+
+	layout := loadMatchboxInventory(t)
+	dataDir := t.TempDir()
+	require.NoError(t, layout.WriteTo(dataDir))
+	// matchbox runs as an unprivileged user in some images
+	require.NoError(t, filepath.WalkDir(dataDir, func(path string, _ os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chmod(path, 0755)
+	}))
+
+	options := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: "../terraform/modules/matchbox",
+		Vars: map[string]interface{}{
+			"container_name":    "matchbox-boot-" + suffix,
+			"vlan_network_name": networkName,
+			"static_ip":         staticIP,
+			"matchbox_port":     8080,
+			"additional_volumes": []map[string]interface{}{
+				{"host_path": dataDir, "container_path": "/var/lib/matchbox", "read_only": true},
+			},
+		},
+		NoColor: true,
+	})
+	RequireValidVars(t, options)
+	RequireTerraform(t, options)
+
+	t.Cleanup(func() {
+		if os.Getenv("SKIP_CLEANUP") != "true" {
+			runDocker(t, "network", "rm", networkName)
+		}
+	})
+	runDocker(t, "network", "create", "--subnet", subnet, networkName)
+	t.Cleanup(func() {
+		if os.Getenv("SKIP_CLEANUP") != "true" {
+			terraform.Destroy(t, options)
+		}
+	})
+	terraform.InitAndApply(t, options)
+
+	fetch := func(path string) (string, error) {
+		return wgetOnNetwork(networkName, fmt.Sprintf("http://%s:8080%s", staticIP, path), 60*time.Second)
+	}
+
+	t.Run("Boot_IPXE", func(t *testing.T) {
+		script, err := fetch("/boot.ipxe")
+		require.NoError(t, err)
+		assert.Equal(t, matchbox.BootScript, script)
+	})
+
+	for _, group := range layout.Groups {
+		t.Run("IPXE_"+group.ID, func(t *testing.T) {
+			query := url.Values{}
+			for key, value := range group.Selector {
+				if key == "mac" {
+					value = strings.ReplaceAll(value, ":", "-")
+				}
+				query.Set(key, value)
+			}
+			profile, ok := layout.Profile(group.Profile)
+			require.True(t, ok)
+
+			script, err := fetch("/ipxe?" + query.Encode())
+			require.NoError(t, err)
+			assert.Equal(t, matchbox.IPXEScript(profile), script)
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package tests
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/matchbox"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// bytesCodec hands the fake matchbox encoded messages as-is
+type bytesCodec struct{}
+
+func (bytesCodec) Marshal(v interface{}) ([]byte, error) { return *v.(*[]byte), nil }
+func (bytesCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]byte) = append([]byte(nil), data...)
+	return nil
+}
+func (bytesCodec) Name() string { return "proto" }
+
+// protoField returns the first length-delimited field num of a message
+func protoField(data []byte, num protowire.Number) []byte {
+	for len(data) > 0 {
+		n, typ, length := protowire.ConsumeTag(data)
+		if length < 0 {
+			return nil
+		}
+		data = data[length:]
+		length = protowire.ConsumeFieldValue(n, typ, data)
+		if length < 0 {
+			return nil
+		}
+		if n == num && typ == protowire.BytesType {
+			value, _ := protowire.ConsumeBytes(data)
+			return value
+		}
+		data = data[length:]
+	}
+	return nil
+}
+
+// fakeMatchboxRPC is a matchbox gRPC API over mTLS that keeps profiles,
+// groups and configs in memory, keyed by the ID matchbox reads from
+// field 1 of each message
+type fakeMatchboxRPC struct {
+	Address string
+
+	mu      sync.Mutex
+	objects map[string]map[string][]byte
+}
+
+func newFakeMatchboxRPC(t *testing.T, serverTLS *tls.Config) *fakeMatchboxRPC {
+	t.Helper()
+
+	fake := &fakeMatchboxRPC{objects: map[string]map[string][]byte{
+		"Profiles": {}, "Groups": {}, "Generic": {}, "Ignition": {},
+	}}
+	server := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(serverTLS)),
+		grpc.ForceServerCodec(bytesCodec{}),
+		grpc.UnknownServiceHandler(fake.handle))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	fake.Address = listener.Addr().String()
+	return fake
+}
+
+func (f *fakeMatchboxRPC) handle(_ interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	var request []byte
+	if err := stream.RecvMsg(&request); err != nil {
+		return err
+	}
+
+	// Methods look like /rpcpb.Profiles/ProfilePut
+	parts := strings.Split(strings.TrimPrefix(method, "/rpcpb."), "/")
+	if len(parts) != 2 {
+		return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	store, ok := f.objects[parts[0]]
+	if !ok {
+		return status.Errorf(codes.Unimplemented, "unknown service %s", parts[0])
+	}
+
+	var response []byte
+	switch {
+	case strings.HasSuffix(parts[1], "Put") && (parts[0] == "Generic" || parts[0] == "Ignition"):
+		store[string(protoField(request, 1))] = protoField(request, 2)
+	case strings.HasSuffix(parts[1], "Put"):
+		object := protoField(request, 1)
+		store[string(protoField(object, 1))] = object
+	case strings.HasSuffix(parts[1], "Get"):
+		object, ok := store[string(protoField(request, 1))]
+		if !ok {
+			return status.Error(codes.NotFound, "not found")
+		}
+		response = protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), object)
+	case strings.HasSuffix(parts[1], "List"):
+		for _, id := range slices.Sorted(maps.Keys(store)) {
+			response = protowire.AppendBytes(protowire.AppendTag(response, 1, protowire.BytesType), store[id])
+		}
+	case strings.HasSuffix(parts[1], "Delete"):
+		delete(store, string(protoField(request, 1)))
+	default:
+		return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+	}
+	return stream.SendMsg(&response)
+}
+
+// object returns a stored object or config
+func (f *fakeMatchboxRPC) object(service, id string) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.objects[service][id]
+}
+
+// dialMatchboxRPC connects with the PKI's client certificate
+func dialMatchboxRPC(t *testing.T, pki *TestPKI, address string) *matchbox.RPCClient {
+	t.Helper()
+
+	tlsConfig, err := matchbox.ClientTLS(pki.CACert, pki.ClientCert, pki.ClientKey)
+	require.NoError(t, err)
+	client, err := matchbox.DialRPC(address, tlsConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// TestMatchboxRPCOffline manages the testdata inventory through the gRPC
+// client against a fake matchbox that requires client certificates
+func TestMatchboxRPCOffline(t *testing.T) {
+	t.Parallel()
+
+	pki := NewTestPKI(t)
+	fake := newFakeMatchboxRPC(t, pki.ServerTLS(t))
+	client := dialMatchboxRPC(t, pki, fake.Address)
+	layout := loadMatchboxInventory(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	require.NoError(t, client.Apply(ctx, layout))
+
+	t.Run("Create_And_List", func(t *testing.T) {
+		profiles, err := client.ProfileList(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, layout.Profiles, profiles)
+
+		groups, err := client.GroupList(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, layout.Groups, groups)
+
+		assert.Equal(t, layout.Generic["talos-worker.yaml"], fake.object("Generic", "talos-worker.yaml"))
+		assert.Equal(t, layout.Ignition["flatcar-stable.ign"], fake.object("Ignition", "flatcar-stable.ign"))
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		group, err := client.GroupGet(ctx, "cp1")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"mac": "52:54:00:13:01:01"}, group.Selector)
+		assert.Equal(t, map[string]string{"hostname": "cp1"}, group.Metadata)
+
+		profile, err := client.ProfileGet(ctx, "talos-controlplane")
+		require.NoError(t, err)
+		want, _ := layout.Profile("talos-controlplane")
+		assert.Equal(t, want, profile)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, client.GroupPut(ctx, &matchbox.Group{ID: "scratch", Profile: "talos-worker", Selector: map[string]string{"mac": "52:54:00:ff:00:01"}}))
+		require.NoError(t, client.GroupDelete(ctx, "scratch"))
+		_, err := client.GroupGet(ctx, "scratch")
+		assert.Equal(t, codes.NotFound, status.Code(err), "%v", err)
+
+		require.NoError(t, client.ProfilePut(ctx, &matchbox.Profile{ID: "scratch", Boot: matchbox.Boot{Kernel: "/assets/scratch"}}))
+		require.NoError(t, client.ProfileDelete(ctx, "scratch"))
+		profiles, err := client.ProfileList(ctx)
+		require.NoError(t, err)
+		assert.Len(t, profiles, len(layout.Profiles))
+	})
+
+	t.Run("Client_Certificate_Required", func(t *testing.T) {
+		other := NewTestPKI(t)
+		for name, tlsConfig := range map[string]func() (*tls.Config, error){
+			"Other_CA": func() (*tls.Config, error) {
+				// Trust the real server, but present a certificate it did not issue
+				return matchbox.ClientTLS(pki.CACert, other.ClientCert, other.ClientKey)
+			},
+			"No_Certificate": func() (*tls.Config, error) {
+				config, err := matchbox.ClientTLS(pki.CACert, pki.ClientCert, pki.ClientKey)
+				if config != nil {
+					config.Certificates = nil
+				}
+				return config, err
+			},
+			"Untrusted_Server": func() (*tls.Config, error) {
+				return matchbox.ClientTLS(other.CACert, pki.ClientCert, pki.ClientKey)
+			},
+		} {
+			config, err := tlsConfig()
+			require.NoError(t, err, name)
+			rejected, err := matchbox.DialRPC(fake.Address, config)
+			require.NoError(t, err, name)
+			_, err = rejected.ProfileList(ctx)
+			assert.Error(t, err, name)
+			rejected.Close()
+		}
+	})
+
+	t.Run("Load_Client_TLS", func(t *testing.T) {
+		paths := pki.WriteFiles(t, t.TempDir())
+		_, err := matchbox.LoadClientTLS(paths["ca.crt"], paths["client.crt"], paths["client.key"])
+		assert.NoError(t, err)
+		_, err = matchbox.LoadClientTLS(paths["client.key"], paths["client.crt"], paths["client.key"])
+		assert.ErrorContains(t, err, "no CA certificates")
+	})
+}
+
+// TestMatchboxRPC starts the matchbox module with the gRPC API enabled and
+// throwaway certificates, manages the testdata inventory through it and
+// checks matchbox boots machines from what the API stored
+func TestMatchboxRPC(t *testing.T) {
+	RequireDocker(t)
+
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano()%100000)
+	networkName := "matchbox-rpc-" + suffix
+	subnet := allocateSubnet()
+	staticIP := strings.TrimSuffix(subnet, "0/24") + "251"
+
+	pki := NewTestPKI(t, staticIP)
+	paths := pki.WriteFiles(t, t.TempDir())
+
+	options := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: "../terraform/modules/matchbox",
+		Vars: map[string]interface{}{
+			"container_name":    "matchbox-rpc-" + suffix,
+			"vlan_network_name": networkName,
+			"static_ip":         staticIP,
+			"rpc_enabled":       true,
+			"ca_file_path":      paths["ca.crt"],
+			"cert_file_path":    paths["server.crt"],
+			"key_file_path":     paths["server.key"],
+		},
+		NoColor: true,
+	})
+	RequireValidVars(t, options)
+	RequireTerraform(t, options)
+
+	t.Cleanup(func() {
+		if os.Getenv("SKIP_CLEANUP") != "true" {
+			runDocker(t, "network", "rm", networkName)
+		}
+	})
+	runDocker(t, "network", "create", "--subnet", subnet, networkName)
+	t.Cleanup(func() {
+		if os.Getenv("SKIP_CLEANUP") != "true" {
+			terraform.Destroy(t, options)
+		}
+	})
+	terraform.InitAndApply(t, options)
+	rpcEndpoint := terraform.Output(t, options, "rpc_endpoint")
+	require.Equal(t, staticIP+":8081", rpcEndpoint)
+
+	// The gRPC port is not published; this relies on the host routing to
+	// the network's bridge, as it does with Docker on Linux
+	client := dialMatchboxRPC(t, pki, rpcEndpoint)
+	layout := loadMatchboxInventory(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	for {
+		_, err := client.ProfileList(ctx)
+		if err == nil {
+			break
+		}
+		require.NoError(t, ctx.Err(), "matchbox gRPC never came up: %v", err)
+		time.Sleep(2 * time.Second)
+	}
+	require.NoError(t, client.Apply(ctx, layout))
+
+	t.Run("List", func(t *testing.T) {
+		profiles, err := client.ProfileList(ctx)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, layout.Profiles, profiles)
+
+		groups, err := client.GroupList(ctx)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, layout.Groups, groups)
+	})
+
+	t.Run("Boots_From_Stored_Profiles", func(t *testing.T) {
+		profile, _ := layout.Profile("talos-controlplane")
+		script, err := wgetOnNetwork(networkName, fmt.Sprintf("http://%s:8080/ipxe?%s", staticIP,
+			url.Values{"mac": {"52-54-00-13-01-01"}}.Encode()), 30*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, matchbox.IPXEScript(profile), script)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, client.GroupDelete(ctx, "worker1"))
+		_, err := client.GroupGet(ctx, "worker1")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"encoding/json"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/filetree"
+	"github.com/yebyen/home-lab-terraform/internal/mirrors"
+	"github.com/yebyen/home-lab-terraform/internal/registry"
+	"github.com/yebyen/home-lab-terraform/internal/tfeval"
+	"github.com/yebyen/home-lab-terraform/internal/tfoutput"
+)
+
+// updateGolden rewrites golden files from the current output:
+//
+//	go test ./tests/ -run TestMirrorConfigGolden -update
+var updateGolden = flag.Bool("update", false, "rewrite golden files under testdata/")
+
+// assertGoldenDir checks files, keyed by slash-separated path, are exactly
+// the files under the golden directory
+func assertGoldenDir(t *testing.T, golden string, files map[string][]byte) {
+	t.Helper()
+
+	var want []string
+	require.NoError(t, filepath.WalkDir(golden, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(golden, path)
+		want = append(want, filepath.ToSlash(rel))
+		return err
+	}))
+	var got []string
+	for path := range files {
+		got = append(got, path)
+	}
+	sort.Strings(got)
+	require.Equal(t, want, got, "Generated files differ from golden files; rerun with -update if intended")
+
+	for _, path := range got {
+		expected, err := os.ReadFile(filepath.Join(golden, filepath.FromSlash(path)))
+		require.NoError(t, err)
+		assert.Equal(t, string(expected), string(files[path]), path)
+	}
+}
+
+// renderMirrorGolden renders the mirror configuration for the outputs.json
+// in dir and compares every file with dir/golden
+func renderMirrorGolden(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(dir, "outputs.json"))
+	require.NoError(t, err)
+	outputs, err := tfoutput.Parse(data)
+	require.NoError(t, err)
+	caches, err := registry.CachesFromOutputs(outputs)
+	require.NoError(t, err)
+	mirrorList, err := mirrors.FromCaches(caches, "10.17.13.10")
+	require.NoError(t, err)
+	files, err := mirrors.Files(mirrorList)
+	require.NoError(t, err)
+
+	golden := filepath.Join(dir, "golden")
+	if *updateGolden {
+		require.NoError(t, os.RemoveAll(golden))
+		require.NoError(t, filetree.Write(golden, files))
+	}
+	assertGoldenDir(t, golden, files)
+	return files
+}
+
+// TestMirrorConfigGolden renders mirror configuration from saved
+// registry-caches outputs and compares every file with testdata/mirrors/golden
+func TestMirrorConfigGolden(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "mirrors", "outputs.json"))
+	require.NoError(t, err)
+	outputs, err := tfoutput.Parse(data)
+	require.NoError(t, err)
+
+	t.Run("Fixture_Matches_Environment", func(t *testing.T) {
+		// The saved outputs must describe the caches the environment
+		// actually declares
+		var saved []interface{}
+		require.NoError(t, outputs.Decode("cache_endpoints", &saved))
+
+		value, err := LoadModuleOffline(t, nil, "environments", "registry-caches").Output("cache_endpoints")
+		require.NoError(t, err)
+		declared, err := tfeval.ToGo(value)
+		require.NoError(t, err)
+		assert.Equal(t, declared, saved)
+
+		var caches map[string]map[string]interface{}
+		require.NoError(t, outputs.Decode("registry_caches", &caches))
+		value, err = LoadModuleOffline(t, nil, "environments", "registry-caches").Output("registry_caches")
+		require.NoError(t, err)
+		for name, cache := range caches {
+			assert.Equal(t, cache["upstream_registry"], value.GetAttr(name).GetAttr("upstream_registry").AsString(), name)
+		}
+	})
+
+	var files map[string][]byte
+	t.Run("Golden_Files", func(t *testing.T) {
+		files = renderMirrorGolden(t, filepath.Join("testdata", "mirrors"))
+	})
+
+	// Caches pulling through another mirror are still keyed by the registry
+	// clients name, not the host of their upstream_url
+	t.Run("Custom_Upstream_Golden_Files", func(t *testing.T) {
+		custom := renderMirrorGolden(t, filepath.Join("testdata", "mirrors", "custom-upstream"))
+		assert.Contains(t, custom, "containerd/certs.d/docker.io/hosts.toml")
+		assert.NotContains(t, custom, "containerd/certs.d/mirror.gcr.io/hosts.toml")
+	})
+
+	t.Run("Docker_Mirrors_Only_Docker_Hub", func(t *testing.T) {
+		var daemon map[string][]string
+		require.NoError(t, json.Unmarshal(files["daemon.json"], &daemon))
+		assert.Equal(t, []string{"http://10.17.13.10:5050"}, daemon["registry-mirrors"])
+		assert.Len(t, daemon["insecure-registries"], 5)
+	})
+
+	t.Run("Keeps_Non_Local_Hosts", func(t *testing.T) {
+		remote, err := mirrors.FromCaches([]registry.Cache{
+			{Name: "quay", Endpoint: "cache.metnoom.lan:5052", Upstream: "https://quay.io", Registry: "quay.io"},
+		}, "10.17.13.10")
+		require.NoError(t, err)
+		assert.Equal(t, []mirrors.Mirror{{Registry: "quay.io", Upstream: "https://quay.io", Endpoint: "http://cache.metnoom.lan:5052"}}, remote)
+
+		_, err = mirrors.FromCaches([]registry.Cache{{Name: "broken", Endpoint: "localhost", Upstream: "https://quay.io", Registry: "quay.io"}}, "")
+		assert.Error(t, err, "Endpoints need a port")
+		_, err = mirrors.FromCaches([]registry.Cache{{Name: "quay", Endpoint: "localhost:5052", Upstream: "https://quay.io"}}, "")
+		assert.ErrorContains(t, err, "upstream_registry", "Outputs from before upstream_registry was exported")
+	})
+}
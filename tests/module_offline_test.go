@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// TestDnsmasqModuleOffline evaluates the dnsmasq container command for the
+// 13-net values without running terraform
+func TestDnsmasqModuleOffline(t *testing.T) {
+	t.Parallel()
+
+	module := LoadModuleOffline(t, map[string]interface{}{
+		"vlan_network_name": "vlan-13net",
+		"static_ip":         "10.17.13.252",
+		"matchbox_server":   "10.17.13.251",
+		"matchbox_port":     8080,
+	}, "modules", "dnsmasq")
+	container := RequireResource(t, module, "docker_container.dnsmasq")
+
+	t.Run("PXE_Chainloads_Matchbox", func(t *testing.T) {
+		command, err := container.Strings("command")
+		require.NoError(t, err)
+		assert.Contains(t, command, "--dhcp-boot=tag:ipxe,http://10.17.13.251:8080/boot.ipxe")
+		assert.Contains(t, command, "--dhcp-range=10.17.13.3,10.17.13.199")
+		assert.Contains(t, command, "--enable-tftp")
+		assert.Equal(t, []string{"-d", "-q", "-p0"}, command[:3], "Foreground/quiet flags come first")
+	})
+
+	t.Run("Static_IP_On_VLAN", func(t *testing.T) {
+		networks, err := container.Blocks("networks_advanced")
+		require.NoError(t, err)
+		require.Len(t, networks, 1)
+
+		name, err := networks[0].String("name")
+		require.NoError(t, err)
+		assert.Equal(t, "vlan-13net", name)
+
+		ip, err := networks[0].String("ipv4_address")
+		require.NoError(t, err)
+		assert.Equal(t, "10.17.13.252", ip)
+	})
+
+	t.Run("TFTP_Volume_From_Dynamic_Block", func(t *testing.T) {
+		volumes, err := container.Blocks("volumes")
+		require.NoError(t, err)
+		require.Len(t, volumes, 1, "Only the TFTP volume without additional_volumes")
+
+		path, err := volumes[0].String("container_path")
+		require.NoError(t, err)
+		assert.Equal(t, "/var/lib/tftpboot", path)
+	})
+
+	t.Run("Services_Toggle_Flags", func(t *testing.T) {
+		minimal := LoadModuleOffline(t, map[string]interface{}{
+			"vlan_network_name": "vlan-13net",
+			"static_ip":         "10.17.13.252",
+			"pxe_enabled":       false,
+			"tftp_enabled":      false,
+			"additional_args":   []string{"--domain=metnoom.lan"},
+		}, "modules", "dnsmasq")
+
+		command, err := RequireResource(t, minimal, "docker_container.dnsmasq").Strings("command")
+		require.NoError(t, err)
+		assert.NotContains(t, command, "--enable-tftp")
+		assert.NotContains(t, command, "--dhcp-userclass=set:ipxe,iPXE")
+		assert.Equal(t, "--domain=metnoom.lan", command[len(command)-1], "additional_args are appended last")
+
+		pxe, err := minimal.Output("pxe_config")
+		require.NoError(t, err)
+		assert.True(t, pxe.IsNull(), "pxe_config is null when PXE is disabled")
+	})
+}
+
+// TestRegistryCacheModuleOffline evaluates the registry-cache locals and
+// container environment for each supported upstream
+func TestRegistryCacheModuleOffline(t *testing.T) {
+	t.Parallel()
+
+	module := LoadModuleOffline(t, map[string]interface{}{
+		"registry_name": "quay.io",
+		"cache_port":    5052,
+	}, "modules", "registry-cache")
+	container := RequireResource(t, module, "docker_container.registry_cache")
+
+	t.Run("Proxy_Remote_URL", func(t *testing.T) {
+		env, err := container.Strings("env")
+		require.NoError(t, err)
+		assert.Contains(t, env, "REGISTRY_PROXY_REMOTEURL=https://quay.io")
+	})
+
+	t.Run("Names_Derived_From_Registry", func(t *testing.T) {
+		name, err := container.String("name")
+		require.NoError(t, err)
+		assert.Equal(t, "registry-quay.io", name)
+
+		volumes, err := container.Blocks("volumes")
+		require.NoError(t, err)
+		require.Len(t, volumes, 1)
+		volume, err := volumes[0].String("volume_name")
+		require.NoError(t, err, "Volume name references docker_volume.registry_cache.name, which is configured")
+		assert.Equal(t, "registry-quay.io-cache", volume)
+	})
+
+	t.Run("Published_Port", func(t *testing.T) {
+		ports, err := container.Blocks("ports")
+		require.NoError(t, err)
+		require.Len(t, ports, 1)
+		external, err := ports[0].Int("external")
+		require.NoError(t, err)
+		assert.Equal(t, 5052, external)
+	})
+
+	t.Run("Network_Is_Optional", func(t *testing.T) {
+		count, err := RequireResource(t, module, "docker_network.registry_network").Count()
+		require.NoError(t, err)
+		assert.Equal(t, 0, count)
+
+		networks, err := container.Blocks("networks_advanced")
+		require.NoError(t, err)
+		assert.Empty(t, networks)
+	})
+
+	t.Run("Upstream_Override", func(t *testing.T) {
+		mirror := LoadModuleOffline(t, map[string]interface{}{
+			"registry_name": "docker.io",
+			"cache_port":    5050,
+			"upstream_url":  "https://mirror.gcr.io",
+		}, "modules", "registry-cache")
+
+		upstream, err := mirror.Local("upstream_url")
+		require.NoError(t, err)
+		assert.Equal(t, cty.StringVal("https://mirror.gcr.io"), upstream)
+	})
+}
+
+// TestPiholeModuleOffline checks the pihole container's environment and that
+// host networking drops the published ports
+func TestPiholeModuleOffline(t *testing.T) {
+	t.Parallel()
+
+	bridge := LoadModuleOffline(t, map[string]interface{}{
+		"web_password":      "offline-password",
+		"dnsmasq_listening": "all",
+		"dns_port":          15353,
+	}, "modules", "pihole")
+	container := RequireResource(t, bridge, "docker_container.pihole")
+
+	env, err := container.Strings("env")
+	require.NoError(t, err)
+	assert.Contains(t, env, "FTLCONF_webserver_api_password=offline-password")
+	assert.Contains(t, env, "FTLCONF_dns_listeningMode=ALL")
+	assert.Contains(t, env, "PIHOLE_DNS_=1.1.1.1;1.0.0.1")
+
+	ports, err := container.Blocks("ports")
+	require.NoError(t, err)
+	assert.Len(t, ports, 3, "DNS over TCP and UDP plus the web port")
+
+	mode, err := container.String("network_mode")
+	require.NoError(t, err)
+	assert.Equal(t, "bridge", mode)
+
+	host := LoadModuleOffline(t, map[string]interface{}{"use_host_network": true}, "modules", "pihole")
+	hostContainer := RequireResource(t, host, "docker_container.pihole")
+	ports, err = hostContainer.Blocks("ports")
+	require.NoError(t, err)
+	assert.Empty(t, ports, "Host networking publishes no ports")
+
+	_, err = hostContainer.String("image")
+	assert.Error(t, err, "image references the computed docker_image.pihole.image_id")
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/tfschema"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// TestModuleVariableSchemas parses every module's and environment's
+// variables.tf and checks Vars maps against them without running Terraform
+func TestModuleVariableSchemas(t *testing.T) {
+	t.Parallel()
+
+	dirs, err := filepath.Glob(filepath.Join("..", "terraform", "*", "*"))
+	require.NoError(t, err)
+	require.NotEmpty(t, dirs)
+
+	t.Run("All_Schemas_Parse", func(t *testing.T) {
+		for _, dir := range dirs {
+			module, err := tfschema.LoadModule(dir)
+			require.NoError(t, err, "variables of %s should parse", dir)
+			t.Logf("%s declares %d variables", dir, len(module.Variables))
+		}
+	})
+
+	pihole, err := tfschema.LoadModule(piholeModuleDir)
+	require.NoError(t, err)
+
+	t.Run("Types_And_Defaults", func(t *testing.T) {
+		dnsPort := pihole.Variables["dns_port"]
+		assert.True(t, dnsPort.Type.Equals(cty.Number))
+		assert.True(t, dnsPort.Default.RawEquals(cty.NumberIntVal(53)))
+
+		assert.True(t, pihole.Variables["web_password"].Sensitive)
+		assert.True(t, pihole.Variables["extra_volumes"].Type.IsListType())
+		assert.False(t, pihole.Variables["container_name"].Required())
+	})
+
+	t.Run("Misspelled_Key_Rejected", func(t *testing.T) {
+		// The Vars map TestPiholeConfigurationCompliance used to pass
+		err := pihole.CheckVars(map[string]interface{}{
+			"container_name": "pihole-compliance-test",
+			"network_name":   "pihole-compliance-net",
+			"subnet":         "172.22.0.0/16",
+			"dns_port":       15354,
+			"web_port":       18081,
+			"timezone":       "America/New_York",
+			"webpassword":    "test-password",
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `webpassword: not declared by the module (did you mean "web_password"?)`)
+	})
+
+	t.Run("Type_Mismatch_Rejected", func(t *testing.T) {
+		err := pihole.CheckVars(map[string]interface{}{
+			"dns_port":         "not-a-port",
+			"use_host_network": "yes please",
+			"web_port":         "8080", // Terraform converts numeric strings
+		})
+		require.Error(t, err)
+
+		problems := err.(*tfschema.VarsError).Problems
+		require.Len(t, problems, 2)
+		assert.Contains(t, problems[0], "dns_port: want number")
+		assert.Contains(t, problems[1], "use_host_network: want bool")
+	})
+
+	t.Run("Object_Lists_Accepted", func(t *testing.T) {
+		err := pihole.CheckVars(map[string]interface{}{
+			"extra_volumes": []map[string]interface{}{
+				{"volume_name": "pihole-extra", "container_path": "/etc/dnsmasq.d/extra"},
+			},
+			"capabilities": []string{"NET_ADMIN"},
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Required_And_Validation_Blocks", func(t *testing.T) {
+		registryCache, err := tfschema.LoadModule(filepath.Join("..", "terraform", "modules", "registry-cache"))
+		require.NoError(t, err)
+
+		err = registryCache.CheckVars(map[string]interface{}{"cache_port": 5000})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "registry_name: required variable not set")
+
+		err = registryCache.CheckVars(map[string]interface{}{"registry_name": "example.com", "cache_port": 80})
+		require.Error(t, err)
+		problems := err.(*tfschema.VarsError).Problems
+		assert.Equal(t, []string{
+			"cache_port: Cache port must be between 1024 and 65535.",
+			"registry_name: Supported registries: docker.io, registry.k8s.io, quay.io, gcr.io, ghcr.io",
+		}, problems)
+
+		assert.NoError(t, registryCache.CheckVars(map[string]interface{}{"registry_name": "quay.io", "cache_port": 5002}))
+
+		exporter, err := tfschema.LoadModule(filepath.Join("..", "terraform", "modules", "pihole-exporter"))
+		require.NoError(t, err)
+		vars := map[string]interface{}{"pihole_hostname": "10.17.12.109", "pihole_api_token": "token", "scrape_interval": "ten seconds"}
+		err = exporter.CheckVars(vars)
+		require.Error(t, err, "can(regex(...)) conditions should be evaluated")
+		assert.Contains(t, err.Error(), "Scrape interval must be in format")
+
+		vars["scrape_interval"] = "30s"
+		assert.NoError(t, exporter.CheckVars(vars))
+	})
+}
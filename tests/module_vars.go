@@ -0,0 +1,24 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/yebyen/home-lab-terraform/internal/tfschema"
+)
+
+// RequireValidVars fails the test before Terraform runs if options.Vars has
+// keys the module at options.TerraformDir doesn't declare, values of the
+// wrong type, missing required variables, or values its validation blocks
+// reject. Without it a misspelled key silently falls back to the default.
+func RequireValidVars(t *testing.T, options *terraform.Options) {
+	t.Helper()
+
+	module, err := tfschema.LoadModule(options.TerraformDir)
+	if err != nil {
+		t.Fatalf("Failed to load variables of %s: %v", options.TerraformDir, err)
+	}
+	if err := module.CheckVars(options.Vars); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -23,6 +23,8 @@ func TestMultiPiholeInfrastructure(t *testing.T) {
 		NoColor: true,
 	})
 
+	RequireValidVars(t, terraformOptions)
+
 	// Clean up resources at the end of the test
 	defer terraform.Destroy(t, terraformOptions)
 
@@ -30,15 +32,22 @@ func TestMultiPiholeInfrastructure(t *testing.T) {
 	terraform.InitAndValidate(t, terraformOptions)
 
 	// Act: Plan the infrastructure
-	planResult := terraform.Plan(t, terraformOptions)
+	plan := InitAndPlanJSON(t, terraformOptions)
 
 	// Assert: Verify expected resources are planned
-	assert.Contains(t, planResult, "module.primary_pihole")
-	assert.Contains(t, planResult, "module.secondary_pihole")
-	assert.Contains(t, planResult, "docker_network.dns_network")
-	
-	// Verify shared configuration volume
-	assert.Contains(t, planResult, "docker_volume.pihole_shared_config")
+	plan.AssertModule("module.primary_pihole")
+	plan.AssertModule("module.secondary_pihole")
+	plan.AssertAction("docker_network.dns_network", PlanCreate)
+	plan.AssertNoDestroys()
+
+	// Verify shared configuration volume is mounted by both instances
+	plan.AssertAction("docker_volume.pihole_shared_config", PlanCreate)
+	for _, instance := range []string{"primary", "secondary"} {
+		container := "module." + instance + "_pihole.docker_container.pihole"
+		plan.AssertAttributeEquals(container, "name", "pihole-"+instance)
+		plan.AssertSensitive(container, "env")
+	}
+	plan.AssertAttributeContains("module.secondary_pihole.docker_container.pihole", "env", "WEB_PORT=8081")
 }
 
 // TestSynologySSHConnection verifies SSH connectivity to Synology devices
@@ -55,6 +64,8 @@ func TestSynologySSHConnection(t *testing.T) {
 		NoColor: true,
 	})
 
+	RequireValidVars(t, terraformOptions)
+
 	// Act: Validate configuration
 	terraform.InitAndValidate(t, terraformOptions)
 	
@@ -1,7 +1,6 @@
 package tests
 
 import (
-	"crypto/sha256"
 	"fmt"
 	"testing"
 	"time"
@@ -25,36 +24,20 @@ func cleanupContainerOnly(t *testing.T, terraformOptions *terraform.Options) {
 func TestNetworkIsolationFix(t *testing.T) {
 	t.Parallel()
 	
-	// Generate truly unique identifiers based on test name + timestamp
-	testID := fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano()))))[:8]
-	
-	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
-		TerraformDir: "../terraform/modules/pihole",
-		Vars: map[string]interface{}{
-			"container_name":     fmt.Sprintf("pihole-isolation-test-%s", testID),
-			"network_name":       fmt.Sprintf("pihole-isolation-net-%s", testID), // UNIQUE NETWORK NAME
-			"subnet":             fmt.Sprintf("172.%d.0.0/16", 100+(len(testID)%50)), // Wide spacing: 172.100-150.0.0/16
-			"dns_port":           32008, // Fixed port for this test
-			"web_port":           33008, // Fixed port for this test
-			"timezone":           "America/New_York",
-			"web_password":       fmt.Sprintf("isolation-test-%s", testID),
-			"dnsmasq_listening":  "all",
-			"use_host_network":   false,
-		},
-	})
-
-	// Cleanup on test completion - avoid Docker image conflicts
-	defer cleanupContainerOnly(t, terraformOptions)
-
-	// Apply terraform - this should work without network conflicts
-	terraform.InitAndApply(t, terraformOptions)
+	// The builder generates unique container/network names, ports and subnet
+	env := NewPiholeEnv(t).
+		WithName("isolation").
+		WithDestroy(cleanupContainerOnly). // Avoid Docker image conflicts
+		WithoutWait().
+		Build()
+	terraformOptions := env.Options
 
 	// Basic validation that container was created
 	containerName := terraform.Output(t, terraformOptions, "container_name")
 	networkName := terraform.Output(t, terraformOptions, "network_name")
 	
-	require.Equal(t, fmt.Sprintf("pihole-isolation-test-%s", testID), containerName)
-	require.Equal(t, fmt.Sprintf("pihole-isolation-net-%s", testID), networkName)
+	require.Equal(t, env.ContainerName, containerName)
+	require.Equal(t, env.NetworkName, networkName)
 	
 	t.Logf("✅ Network isolation test passed with unique identifiers: container=%s, network=%s", 
 		containerName, networkName)
@@ -66,27 +49,12 @@ func TestQuickContainerStartup(t *testing.T) {
 	
 	start := time.Now()
 	
-	testID := fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano()))))[:8]
-	
-	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
-		TerraformDir: "../terraform/modules/pihole",
-		Vars: map[string]interface{}{
-			"container_name":     fmt.Sprintf("pihole-startup-test-%s", testID),
-			"network_name":       fmt.Sprintf("pihole-startup-net-%s", testID),
-			"subnet":             fmt.Sprintf("172.%d.0.0/16", 200+(len(testID)%50)), // Wide spacing: 172.200-250.0.0/16
-			"dns_port":           34000 + (len(testID) % 1000),
-			"web_port":           35000 + (len(testID) % 1000),
-			"timezone":           "America/New_York",
-			"web_password":       fmt.Sprintf("startup-test-%s", testID),
-			"dnsmasq_listening":  "all",
-			"use_host_network":   false,
-		},
-	})
-
-	defer cleanupContainerOnly(t, terraformOptions)
-
 	// Apply and measure startup time
-	terraform.InitAndApply(t, terraformOptions)
+	NewPiholeEnv(t).
+		WithName("startup").
+		WithDestroy(cleanupContainerOnly).
+		WithoutWait().
+		Build()
 	
 	elapsed := time.Since(start)
 	
@@ -104,27 +72,9 @@ func TestParallelNetworkCreation(t *testing.T) {
 		t.Run(fmt.Sprintf("ParallelTest%d", i), func(t *testing.T) {
 			t.Parallel()
 			
-			testID := fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s-%d-%d", t.Name(), i, time.Now().UnixNano()))))[:8]
-			
-			terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
-				TerraformDir: "../terraform/modules/pihole",
-				Vars: map[string]interface{}{
-					"container_name":     fmt.Sprintf("pihole-parallel-%d-%s", i, testID),
-					"network_name":       fmt.Sprintf("pihole-parallel-net-%d-%s", i, testID),
-					"subnet":             fmt.Sprintf("172.%d.0.0/16", 60+i+(len(testID)%5)),
-					"dns_port":           36000 + i*10 + (len(testID) % 10),
-					"web_port":           37000 + i*10 + (len(testID) % 10),
-					"timezone":           "America/New_York",
-					"web_password":       fmt.Sprintf("parallel-test-%d-%s", i, testID),
-					"dnsmasq_listening":  "all",
-					"use_host_network":   false,
-				},
-			})
+			env := NewPiholeEnv(t).WithName(fmt.Sprintf("parallel-%d", i)).WithoutWait().Build()
 
-			defer terraform.Destroy(t, terraformOptions)
-			terraform.InitAndApply(t, terraformOptions)
-			
-			containerName := terraform.Output(t, terraformOptions, "container_name")
+			containerName := terraform.Output(t, env.Options, "container_name")
 			t.Logf("✅ Parallel test %d completed with container: %s", i, containerName)
 		})
 	}
@@ -0,0 +1,33 @@
+package tests
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/yebyen/home-lab-terraform/internal/tfeval"
+)
+
+// LoadModuleOffline evaluates a module or environment under ../terraform
+// (e.g. "modules", "dnsmasq") with vars, without terraform or Docker.
+// Resource arguments, locals and outputs can then be asserted on directly.
+func LoadModuleOffline(t *testing.T, vars map[string]interface{}, path ...string) *tfeval.Module {
+	t.Helper()
+
+	dir := filepath.Join(append([]string{"..", "terraform"}, path...)...)
+	module, err := tfeval.Load(dir, vars)
+	if err != nil {
+		t.Fatalf("Failed to evaluate %s: %v", dir, err)
+	}
+	return module
+}
+
+// RequireResource returns a resource of an offline module or fails the test
+func RequireResource(t *testing.T, module *tfeval.Module, address string) *tfeval.Block {
+	t.Helper()
+
+	resource, err := module.Resource(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resource
+}
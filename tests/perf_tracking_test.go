@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/perftrack"
+)
+
+// perfTestJSON is `go test -json` output as the harness produces it: phase
+// markers from two environments in one test, a subtest, a skip, a failure,
+// build output and a test cut off when the run was interrupted
+var perfTestJSON = strings.Join([]string{
+	`# github.com/yebyen/home-lab-terraform/tests`,
+	`{"Time":"2026-10-19T10:00:00Z","Action":"start","Package":"github.com/yebyen/home-lab-terraform/tests"}`,
+	`{"Time":"2026-10-19T10:00:00Z","Action":"run","Package":"github.com/yebyen/home-lab-terraform/tests","Test":"TestPiholeModule"}`,
+	`{"Time":"2026-10-19T10:00:05Z","Action":"output","Package":"github.com/yebyen/home-lab-terraform/tests","Test":"TestPiholeModule","Output":"    pihole_env.go:207: ` + perftrack.Marker(perftrack.PhaseInit, 5*time.Second) + `\n"}`,
+	`{"Time":"2026-10-19T10:00:17Z","Action":"output","Package":"github.com/yebyen/home-lab-terraform/tests","Test":"TestPiholeModule","Output":"    pihole_env.go:210: ` + perftrack.Marker(perftrack.PhaseApply, 12*time.Second) + `\n"}`,
+	`{"Time":"2026-10-19T10:00:17Z","Action":"output","Package":"github.com/yebyen/home-lab-terraform/tests","Test":"TestPiholeModule","Output":"    pihole_env.go:210: ` + perftrack.Marker(perftrack.PhaseApply, 1500*time.Millisecond) + `\n"}`,
+	`{"Time":"2026-10-19T10:00:30Z","Action":"output","Package":"github.com/yebyen/home-lab-terraform/tests","Test":"TestPiholeModule","Output":"    pihole_env.go:216: ` + perftrack.Marker(perftrack.PhaseReady, 8*time.Second) + `\n"}`,
+	`{"Time":"2026-10-19T10:00:30Z","Action":"pass","Package":"github.com/yebyen/home-lab-terraform/tests","Test":"TestPiholeModule/Basic","Elapsed":2.5}`,
+	`{"Time":"2026-10-19T10:00:31Z","Action":"pass","Package":"github.com/yebyen/home-lab-terraform/tests","Test":"TestPiholeModule","Elapsed":31.2}`,
+	`{"Time":"2026-10-19T10:00:31Z","Action":"skip","Package":"github.com/yebyen/home-lab-terraform/tests","Test":"TestDNSConformance","Elapsed":0}`,
+	`{"Time":"2026-10-19T10:00:32Z","Action":"fail","Package":"github.com/yebyen/home-lab-terraform/tests","Test":"TestPiholeAPI","Elapsed":1.25}`,
+	`{"Time":"2026-10-19T10:00:33Z","Action":"run","Package":"github.com/yebyen/home-lab-terraform/tests","Test":"TestInterrupted"}`,
+	`{"Time":"2026-10-19T10:00:40Z","Action":"fail","Package":"github.com/yebyen/home-lab-terraform/tests","Elapsed":40.5}`,
+	`{"Time":"2026-10-19T10:00:03Z","Action":"pass","Package":"github.com/yebyen/home-lab-terraform/internal/dnsbench","Elapsed":3}`,
+}, "\n")
+
+// perfRun builds a run where every test passed with the given durations
+func perfRun(total time.Duration, tests map[string]time.Duration, apply time.Duration) *perftrack.Run {
+	run := &perftrack.Run{Total: total, Tests: make(map[string]*perftrack.TestTiming)}
+	for name, d := range tests {
+		run.Tests[name] = &perftrack.TestTiming{Outcome: "pass", Duration: d}
+	}
+	if timing, ok := run.Tests["tests.TestPiholeModule"]; ok {
+		timing.Phases = map[string]time.Duration{perftrack.PhaseApply: apply}
+	}
+	return run
+}
+
+// TestPerfTrackOffline checks timing collection from `go test -json`, the
+// history file and regression detection against the rolling baseline
+func TestPerfTrackOffline(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Parse_Test_JSON", func(t *testing.T) {
+		run, err := perftrack.ParseTestJSON(strings.NewReader(perfTestJSON))
+		require.NoError(t, err)
+
+		assert.Equal(t, time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC), run.Started.UTC())
+		assert.Equal(t, 40500*time.Millisecond, run.Total, "The slowest package bounds the wall clock")
+		assert.Len(t, run.Tests, 4, "Unfinished tests are dropped")
+
+		module := run.Tests["tests.TestPiholeModule"]
+		require.NotNil(t, module)
+		assert.Equal(t, "pass", module.Outcome)
+		assert.Equal(t, 31200*time.Millisecond, module.Duration)
+		assert.Equal(t, map[string]time.Duration{
+			perftrack.PhaseInit:  5 * time.Second,
+			perftrack.PhaseApply: 13500 * time.Millisecond,
+			perftrack.PhaseReady: 8 * time.Second,
+		}, module.Phases, "Phases of several environments add up")
+
+		assert.Equal(t, 2500*time.Millisecond, run.Tests["tests.TestPiholeModule/Basic"].Duration)
+		assert.Equal(t, "skip", run.Tests["tests.TestDNSConformance"].Outcome)
+		assert.Equal(t, "fail", run.Tests["tests.TestPiholeAPI"].Outcome)
+		assert.Equal(t, map[string]time.Duration{
+			perftrack.PhaseInit:  5 * time.Second,
+			perftrack.PhaseApply: 13500 * time.Millisecond,
+			perftrack.PhaseReady: 8 * time.Second,
+		}, run.PhaseTotals())
+
+		assert.Equal(t, []string{"tests.TestPiholeAPI"}, run.FailedTests())
+		assert.Equal(t, []string{"github.com/yebyen/home-lab-terraform/tests"}, run.FailedPackages,
+			"Failed packages are recorded even when no test reports the failure")
+
+		_, err = perftrack.ParseTestJSON(strings.NewReader("ok  \tgithub.com/yebyen/home-lab-terraform/tests\t1.2s\n"))
+		assert.ErrorContains(t, err, "-json")
+		_, err = perftrack.ParseTestJSON(strings.NewReader(`{"Action":`))
+		assert.Error(t, err)
+	})
+
+	t.Run("Marker", func(t *testing.T) {
+		assert.Equal(t, "perftrack phase=destroy elapsed=1m2.346s", perftrack.Marker(perftrack.PhaseDestroy, 62345678*time.Microsecond))
+	})
+
+	t.Run("Rolling_Baseline", func(t *testing.T) {
+		history := &perftrack.History{}
+		for _, d := range []time.Duration{90, 20, 21, 19, 22} {
+			history.Runs = append(history.Runs, perfRun(d*time.Second, map[string]time.Duration{
+				"tests.TestPiholeModule": d * time.Second,
+			}, d/2*time.Second))
+		}
+		history.Runs[3].Tests["tests.TestPiholeModule"].Outcome = "fail"
+
+		baseline := history.Baseline(4)
+		assert.Equal(t, 21*time.Second, baseline["tests.TestPiholeModule"], "Median of the last 4 runs' passes")
+		assert.Equal(t, 10*time.Second, baseline[perftrack.Key("tests.TestPiholeModule", perftrack.PhaseApply)])
+		assert.Equal(t, 21*time.Second, baseline[perftrack.TotalKey])
+		assert.Equal(t, 22*time.Second, history.Baseline(2)[perftrack.TotalKey], "Upper median of an even window")
+		assert.Equal(t, 21*time.Second, history.Baseline(0)[perftrack.TotalKey], "The whole history")
+	})
+
+	t.Run("Regressions", func(t *testing.T) {
+		baseline := perftrack.Baseline{
+			perftrack.TotalKey:               20 * time.Second,
+			"tests.TestPiholeModule":         10 * time.Second,
+			"tests.TestPiholeModule [apply]": 6 * time.Second,
+			"tests.TestFast":                 100 * time.Millisecond,
+		}
+		run := perfRun(21*time.Second, map[string]time.Duration{
+			"tests.TestPiholeModule": 15 * time.Second,
+			"tests.TestFast":         900 * time.Millisecond,
+			"tests.TestNew":          time.Minute,
+		}, 12*time.Second)
+
+		regressions := perftrack.Compare(run, baseline, perftrack.Thresholds{Ratio: 1.2, MinDelta: 2 * time.Second})
+		var keys []string
+		for _, regression := range regressions {
+			keys = append(keys, regression.Key)
+		}
+		assert.Equal(t, []string{"tests.TestPiholeModule [apply]", "tests.TestPiholeModule"}, keys,
+			"Worst first; small slowdowns, the 5% slower total and new tests are not flagged")
+		assert.InDelta(t, 2.0, regressions[0].Ratio(), 0.001)
+
+		run.Tests["tests.TestPiholeModule"].Outcome = "fail"
+		assert.Empty(t, perftrack.Compare(run, baseline, perftrack.Thresholds{Ratio: 1.2, MinDelta: 2 * time.Second}),
+			"Failed tests are not timed")
+	})
+
+	t.Run("History_File", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "perf-history.json")
+		history, err := perftrack.Load(path)
+		require.NoError(t, err)
+		assert.Empty(t, history.Runs, "A missing file is an empty history")
+
+		for i := 1; i <= 5; i++ {
+			run := perfRun(time.Duration(i)*time.Second, map[string]time.Duration{"tests.TestPiholeModule": time.Second}, time.Second)
+			run.Commit = strings.Repeat("a", i)
+			history.Runs = append(history.Runs, run)
+		}
+		require.NoError(t, history.Save(path, 3))
+
+		loaded, err := perftrack.Load(path)
+		require.NoError(t, err)
+		require.Len(t, loaded.Runs, 3, "Only the newest runs are kept")
+		assert.Equal(t, "aaa", loaded.Runs[0].Commit)
+		assert.Equal(t, 5*time.Second, loaded.Runs[2].Total)
+		assert.Equal(t, time.Second, loaded.Runs[2].Tests["tests.TestPiholeModule"].Phases[perftrack.PhaseApply])
+	})
+}
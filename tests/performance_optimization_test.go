@@ -13,9 +13,8 @@ import (
 
 // TestPerformanceOptimizationResults measures actual performance improvements
 func TestPerformanceOptimizationResults(t *testing.T) {
-	// Performance target: <30 seconds for test suite execution
-	performanceTarget := 30 * time.Second
-	
+	// The <30 second suite target is measured on real runs by `make
+	// test-perf`, which records timings and flags regressions
 	t.Run("SharedEnvironment_Performance", func(t *testing.T) {
 		// Measure time to set up shared environment (one-time cost)
 		start := time.Now()
@@ -82,77 +81,6 @@ func TestPerformanceOptimizationResults(t *testing.T) {
 		// For reference only - dedicated tests run when isolation is needed
 		t.Logf("Dedicated environment provides isolation at cost of %v setup time", setupTime)
 	})
-	
-	t.Run("ParallelExecution_Performance", func(t *testing.T) {
-		// Measure parallel vs sequential execution
-		
-		// Sequential execution simulation
-		start := time.Now()
-		for i := 0; i < 3; i++ {
-			time.Sleep(500 * time.Millisecond) // Simulate test work
-		}
-		sequentialTime := time.Since(start)
-		
-		// Parallel execution simulation 
-		start = time.Now()
-		done := make(chan bool, 3)
-		for i := 0; i < 3; i++ {
-			go func() {
-				time.Sleep(500 * time.Millisecond)
-				done <- true
-			}()
-		}
-		for i := 0; i < 3; i++ {
-			<-done
-		}
-		parallelTime := time.Since(start)
-		
-		t.Logf("Sequential simulation: %v", sequentialTime)
-		t.Logf("Parallel simulation: %v", parallelTime)
-		
-		// Parallel should be ~3x faster
-		speedup := float64(sequentialTime) / float64(parallelTime)
-		t.Logf("Parallel speedup: %.1fx", speedup)
-		assert.Greater(t, speedup, 2.0, "Parallel execution should provide significant speedup")
-	})
-	
-	t.Run("OverallPerformanceTarget", func(t *testing.T) {
-		// Simulate a realistic test suite execution
-		start := time.Now()
-		
-		// Shared environment setup (one-time cost)
-		env := GetSharedPiholeEnvironment()
-		if !env.Initialized {
-			// Simulate setup time (in reality this would happen once)
-			time.Sleep(2 * time.Second) // Simulated setup overhead
-		}
-		
-		// Multiple parallel read-only tests (using shared env)
-		done := make(chan bool, 5)
-		for i := 0; i < 5; i++ {
-			go func() {
-				time.Sleep(200 * time.Millisecond) // Simulated API test
-				done <- true
-			}()
-		}
-		for i := 0; i < 5; i++ {
-			<-done
-		}
-		
-		// One dedicated test (when isolation needed)
-		time.Sleep(3 * time.Second) // Simulated dedicated environment test
-		
-		totalTime := time.Since(start)
-		t.Logf("Simulated optimized test suite execution: %v", totalTime)
-		
-		// Should meet our performance target
-		assert.Less(t, totalTime, performanceTarget, 
-			"Optimized test suite should execute in less than %v", performanceTarget)
-		
-		// Calculate efficiency
-		efficiency := (float64(performanceTarget) - float64(totalTime)) / float64(performanceTarget) * 100
-		t.Logf("Performance efficiency: %.1f%% under target", efficiency)
-	})
 }
 
 // TestActualTestSuitePerformance runs a subset of real tests to measure performance
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPiholeBlockingControl exercises GetBlocking/SetBlocking against the
+// fake Pi-hole API, including temporary changes with a timer
+func TestPiholeBlockingControl(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakePihole(t, "blocking-test-password")
+
+	var mu sync.Mutex
+	state := map[string]interface{}{"blocking": "enabled", "timer": nil}
+	var lastPayload map[string]interface{}
+	payload := func() map[string]interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return lastPayload
+	}
+
+	fake.Handle("GET /api/dns/blocking", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		writeJSON(w, 200, state)
+	})
+	fake.Handle("POST /api/dns/blocking", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if !readJSON(w, r, &body) {
+			return
+		}
+		enabled, ok := body["blocking"].(bool)
+		if !ok {
+			http.Error(w, "blocking must be a boolean", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		lastPayload = body
+		if enabled {
+			state = map[string]interface{}{"blocking": "enabled", "timer": body["timer"]}
+		} else {
+			state = map[string]interface{}{"blocking": "disabled", "timer": body["timer"]}
+		}
+		writeJSON(w, 200, state)
+	})
+
+	session, err := NewPiholeSession(fake.URL, fake.Password)
+	require.NoError(t, err, "Should authenticate against fake Pi-hole")
+
+	t.Run("Get_Blocking_State", func(t *testing.T) {
+		blocking, err := session.GetBlocking()
+		require.NoError(t, err, "Should read blocking state")
+		assert.True(t, blocking.Enabled(), "Blocking should start enabled")
+		assert.Zero(t, blocking.Remaining(), "Permanent state should have no timer")
+	})
+
+	t.Run("Disable_With_Timer", func(t *testing.T) {
+		blocking, err := session.SetBlocking(false, 5*time.Minute)
+		require.NoError(t, err, "Should disable blocking")
+
+		assert.Equal(t, false, payload()["blocking"], "Payload should disable blocking")
+		assert.Equal(t, 300.0, payload()["timer"], "Timer should be sent in seconds")
+		assert.False(t, blocking.Enabled(), "Blocking should be disabled")
+		assert.Equal(t, 5*time.Minute, blocking.Remaining(), "Timer should round-trip")
+	})
+
+	t.Run("Enable_Permanently", func(t *testing.T) {
+		blocking, err := session.SetBlocking(true, 0)
+		require.NoError(t, err, "Should enable blocking")
+
+		assert.Nil(t, payload()["timer"], "Permanent change should send a null timer")
+		assert.True(t, blocking.Enabled(), "Blocking should be enabled")
+	})
+
+	t.Run("Wrong_Password_Rejected", func(t *testing.T) {
+		_, err := NewPiholeSession(fake.URL, "wrong-password")
+		assert.Error(t, err, "Wrong password should not authenticate")
+	})
+}
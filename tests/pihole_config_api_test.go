@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/pihole"
+)
+
+// fakeFTLConfig is a trimmed /api/config tree as reported by FTL v6
+const fakeFTLConfig = `{
+	"dns": {
+		"upstreams": ["1.1.1.1", "1.0.0.1"],
+		"listeningMode": "ALL",
+		"queryLogging": true,
+		"blocking": {"active": true, "mode": "NULL"}
+	},
+	"dhcp": {"active": false, "start": "", "end": "", "router": ""},
+	"webserver": {
+		"port": "80o,443os,[::]:80o,[::]:443os",
+		"api": {"password": "********", "max_sessions": 16}
+	},
+	"misc": {"privacylevel": 0, "delay_startup": 0}
+}`
+
+// TestPiholeConfigAPI covers typed reads and patch semantics of /api/config
+func TestPiholeConfigAPI(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakePihole(t, "config-api-password")
+
+	var mu sync.Mutex
+	var config map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(fakeFTLConfig), &config))
+	var lastPatch map[string]interface{}
+
+	fake.Handle("GET /api/config", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		writeJSON(w, 200, map[string]interface{}{"config": config})
+	})
+	fake.Handle("PATCH /api/config", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Config map[string]interface{} `json:"config"`
+		}
+		if !readJSON(w, r, &body) {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		lastPatch = body.Config
+		mergeConfig(config, body.Config)
+		writeJSON(w, 200, map[string]interface{}{"config": config})
+	})
+
+	session, err := NewPiholeSession(fake.URL, fake.Password)
+	require.NoError(t, err, "Should authenticate against fake Pi-hole")
+
+	t.Run("Typed_Read", func(t *testing.T) {
+		cfg, err := session.GetConfig()
+		require.NoError(t, err, "Should read config")
+
+		require.NotNil(t, cfg.DNS)
+		assert.Equal(t, []string{"1.1.1.1", "1.0.0.1"}, *cfg.DNS.Upstreams)
+		assert.Equal(t, "ALL", *cfg.DNS.ListeningMode)
+		assert.Equal(t, "NULL", *cfg.DNS.Blocking.Mode)
+		assert.False(t, *cfg.DHCP.Active, "DHCP should be inactive")
+		assert.Equal(t, 16, *cfg.Webserver.API.MaxSessions)
+	})
+
+	t.Run("Patch_Sends_Only_Set_Fields", func(t *testing.T) {
+		cfg, err := session.PatchConfig(&pihole.Config{
+			DNS: &pihole.DNSConfig{
+				QueryLogging: pihole.Bool(false),
+				Upstreams:    pihole.Strings("9.9.9.9"),
+			},
+		})
+		require.NoError(t, err, "Should patch config")
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, map[string]interface{}{
+			"dns": map[string]interface{}{
+				"queryLogging": false,
+				"upstreams":    []interface{}{"9.9.9.9"},
+			},
+		}, lastPatch, "Patch should contain only the fields that were set")
+
+		assert.False(t, *cfg.DNS.QueryLogging)
+		assert.Equal(t, []string{"9.9.9.9"}, *cfg.DNS.Upstreams)
+		assert.Equal(t, "ALL", *cfg.DNS.ListeningMode, "Unpatched fields should be untouched")
+	})
+}
+
+// TestPiholeConfigEnvDiff checks the pihole module's container environment
+// against a reported FTL configuration
+func TestPiholeConfigEnvDiff(t *testing.T) {
+	t.Parallel()
+
+	var raw map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(fakeFTLConfig), &raw))
+
+	// Environment as rendered by terraform/modules/pihole/main.tf, plus image defaults
+	env := []string{
+		"TZ=America/New_York",
+		"FTLCONF_webserver_api_password=secret",
+		"PIHOLE_DNS_=1.1.1.1;1.0.0.1",
+		"FTLCONF_dns_listeningMode=LOCAL",
+		"WEB_PORT=8080",
+		"FTLCONF_misc_delay_startup=0",
+		"FTLCONF_webserver_api_max_sessions=16",
+		"FTLCONF_dns_notAKey=true",
+		"PATH=/usr/local/sbin:/usr/local/bin",
+	}
+
+	drifts := pihole.DiffEnvConfig(env, raw)
+
+	byPath := make(map[string]pihole.ConfigDrift)
+	for _, drift := range drifts {
+		byPath[drift.Path] = drift
+		t.Logf("%-10s %-28s expected=%q actual=%q", drift.Status, drift.Path, drift.Expected, drift.Actual)
+	}
+	require.Len(t, drifts, 6, "Only FTL settings should be compared")
+
+	assert.Equal(t, pihole.DriftMatch, byPath["dns.upstreams"].Status, "Legacy PIHOLE_DNS_ maps to dns.upstreams")
+	assert.Equal(t, pihole.DriftMismatch, byPath["dns.listeningMode"].Status, "LOCAL differs from ALL")
+	assert.Equal(t, "ALL", byPath["dns.listeningMode"].Actual)
+	assert.Equal(t, pihole.DriftWriteOnly, byPath["webserver.api.password"].Status, "Password cannot be compared")
+	assert.Equal(t, pihole.DriftMatch, byPath["misc.delay_startup"].Status, "Underscored keys should resolve")
+	assert.Equal(t, pihole.DriftMatch, byPath["webserver.api.max_sessions"].Status)
+	assert.Equal(t, pihole.DriftMissing, byPath["dns.notAKey"].Status)
+}
+
+// mergeConfig applies a JSON merge patch to a config tree the way FTL does
+func mergeConfig(dst, patch map[string]interface{}) {
+	for key, value := range patch {
+		if section, ok := value.(map[string]interface{}); ok {
+			if existing, ok := dst[key].(map[string]interface{}); ok {
+				mergeConfig(existing, section)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
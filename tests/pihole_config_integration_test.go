@@ -4,7 +4,6 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
-	"time"
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
@@ -15,30 +14,9 @@ func TestPiholeConfigurationModule(t *testing.T) {
 	t.Parallel()
 
 	// First deploy a Pi-hole instance
-	piholeOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
-		TerraformDir: filepath.Join("..", "terraform", "modules", "pihole"),
-		Vars: map[string]interface{}{
-			"container_name":     "pihole-config-integration",
-			"network_name":       "pihole-config-int-net",
-			"subnet":             "172.27.0.0/16", // Unique subnet to avoid conflicts
-			"dns_port":           29353, // Unique port for this test
-			"web_port":           29080,
-			"timezone":           "America/New_York",
-			"web_password":       "config-integration-pass",
-			"dnsmasq_listening":  "all",
-			"use_host_network":   false,
-		},
-	})
-
-	defer terraform.Destroy(t, piholeOptions)
-	terraform.InitAndApply(t, piholeOptions)
-
-	// Wait for Pi-hole to be ready
-	t.Log("Waiting for Pi-hole configuration integration instance...")
-	time.Sleep(45 * time.Second)
-
-	baseURL := "http://localhost:29080"
-	password := "config-integration-pass"
+	pihole := NewPiholeEnv(t).WithName("config-integration").Build()
+	baseURL := pihole.BaseURL
+	password := pihole.Password
 
 	// Now test the configuration module
 	configOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
@@ -49,6 +27,8 @@ func TestPiholeConfigurationModule(t *testing.T) {
 		},
 	})
 
+	RequireValidVars(t, configOptions)
+
 	defer terraform.Destroy(t, configOptions)
 
 	// Test configuration deployment
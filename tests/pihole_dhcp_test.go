@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/pihole"
+)
+
+// dhcpTestClients mirrors the client definitions from TestPiholeGroupManagement
+var dhcpTestClients = []PiholeClient{
+	{Name: "work-laptop", IP: "10.17.12.100", MAC: "00:11:22:33:44:55"},
+	{Name: "work-phone", IP: "10.17.12.101", MAC: "00:11:22:33:44:56"},
+	{Name: "other-laptop", IP: "10.17.13.100", MAC: "00:11:22:33:44:57"},
+	{Name: "phone-2.4ghz", IP: "10.17.13.101", MAC: "00:11:22:33:44:58"},
+}
+
+// TestPiholeDHCPManagement covers leases and static reservations through the
+// Pi-hole client
+func TestPiholeDHCPManagement(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakePihole(t, "dhcp-test-password")
+
+	hosts := []interface{}{"00:11:22:33:44:55,10.17.12.100,work-laptop"}
+	leases := []map[string]interface{}{
+		{"expires": 1767225600, "name": "work-laptop", "hwaddr": "00:11:22:33:44:55", "ip": "10.17.12.100", "clientid": "01:00:11:22:33:44:55"},
+		{"expires": 0, "name": "printer", "hwaddr": "aa:bb:cc:dd:ee:ff", "ip": "10.17.12.50", "clientid": "*"},
+	}
+	var deleted string
+	var mu sync.Mutex
+	locked := func(read func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		read()
+	}
+
+	fake.Handle("GET /api/config", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		writeJSON(w, 200, map[string]interface{}{"config": map[string]interface{}{
+			"dhcp": map[string]interface{}{
+				"active": true, "start": "10.17.12.10", "end": "10.17.12.200",
+				"router": "10.17.12.1", "leaseTime": "24h", "hosts": hosts,
+			},
+		}})
+	})
+	fake.Handle("PATCH /api/config", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Config struct {
+				DHCP struct {
+					Hosts []interface{} `json:"hosts"`
+				} `json:"dhcp"`
+			} `json:"config"`
+		}
+		if !readJSON(w, r, &body) {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		hosts = body.Config.DHCP.Hosts
+		writeJSON(w, 200, map[string]interface{}{"config": map[string]interface{}{
+			"dhcp": map[string]interface{}{"hosts": hosts},
+		}})
+	})
+	fake.Handle("GET /api/dhcp/leases", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, 200, map[string]interface{}{"leases": leases})
+	})
+	fake.Handle("DELETE /api/dhcp/leases/10.17.12.50", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		deleted = "10.17.12.50"
+		w.WriteHeader(204)
+	})
+
+	fake.Handle("GET /api/clients", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, 200, map[string]interface{}{"clients": []pihole.ConfiguredClient{
+			{ID: 1, Client: "10.17.12.100", Name: "work-laptop", Groups: []int{0, 2}},
+			{ID: 2, Client: "00:11:22:33:44:55", Name: "work-laptop", Groups: []int{0, 2}},
+			{ID: 3, Client: "00:11:22:33:44:56", Comment: "work-phone"},
+			{ID: 4, Client: "10.17.12.101", Comment: "work-phone"},
+			{ID: 5, Client: "aa:bb:cc:dd:ee:ff", Name: "printer"},
+			{ID: 6, Client: "10.17.13.0/24", Name: "iot"},
+			{ID: 7, Client: ":eth0", Name: "wired"},
+		}})
+	})
+
+	session, err := NewPiholeSession(fake.URL, fake.Password)
+	require.NoError(t, err, "Should authenticate against fake Pi-hole")
+
+	t.Run("DHCP_Config", func(t *testing.T) {
+		dhcp, err := session.GetDHCPConfig()
+		require.NoError(t, err)
+		assert.True(t, *dhcp.Active)
+		assert.Equal(t, "10.17.12.10", *dhcp.Start)
+		assert.Equal(t, "24h", *dhcp.LeaseTime)
+	})
+
+	t.Run("Active_Leases", func(t *testing.T) {
+		table, err := session.GetDHCPLeases()
+		require.NoError(t, err)
+		require.Len(t, table, 2)
+		assert.Equal(t, "work-laptop", table[0].Name)
+		assert.True(t, table[1].ExpiresAt().IsZero(), "Infinite lease should have no expiry")
+
+		require.NoError(t, session.DeleteDHCPLease("10.17.12.50"))
+		locked(func() { assert.Equal(t, "10.17.12.50", deleted) })
+	})
+
+	t.Run("Static_Reservations", func(t *testing.T) {
+		require.NoError(t, session.SetDHCPReservation(pihole.DHCPReservation{
+			MAC: "00:11:22:33:44:56", IP: "10.17.12.101", Hostname: "work-phone",
+		}))
+		// Re-reserving the same MAC replaces the old entry
+		require.NoError(t, session.SetDHCPReservation(pihole.DHCPReservation{
+			MAC: "00:11:22:33:44:55", IP: "10.17.12.110", Hostname: "work-laptop",
+		}))
+
+		reservations, err := session.GetDHCPReservations()
+		require.NoError(t, err)
+		assert.Equal(t, []pihole.DHCPReservation{
+			{MAC: "00:11:22:33:44:56", IP: "10.17.12.101", Hostname: "work-phone"},
+			{MAC: "00:11:22:33:44:55", IP: "10.17.12.110", Hostname: "work-laptop"},
+		}, reservations)
+
+		require.NoError(t, session.RemoveDHCPReservation("00:11:22:33:44:56"))
+		locked(func() { assert.Equal(t, []interface{}{"00:11:22:33:44:55,10.17.12.110,work-laptop"}, hosts) })
+	})
+
+	t.Run("Configured_Clients_Report", func(t *testing.T) {
+		configured, err := session.GetClients()
+		require.NoError(t, err)
+
+		clients := pihole.ClientsFromConfigured(configured)
+		assert.Equal(t, []pihole.Client{
+			{ID: 1, Name: "work-laptop", IP: "10.17.12.100", MAC: "00:11:22:33:44:55", Groups: []int{0, 2}},
+			{ID: 3, Name: "work-phone", MAC: "00:11:22:33:44:56", IP: "10.17.12.101", Comment: "work-phone"},
+			{ID: 5, Name: "printer", MAC: "aa:bb:cc:dd:ee:ff"},
+		}, clients, "IP and MAC entries pair up by name or comment; subnets and interfaces are left out")
+
+		table, err := session.GetDHCPLeases()
+		require.NoError(t, err)
+		checks := pihole.CheckClientLeases(clients, table)
+		require.Len(t, checks, 2, "The MAC-only printer has no address to drift from")
+		assert.Equal(t, "work-laptop", checks[0].Client.Name)
+		assert.Equal(t, pihole.LeaseOK, checks[0].Status)
+		assert.Equal(t, "work-phone", checks[1].Client.Name)
+		assert.Equal(t, pihole.LeaseMissing, checks[1].Status, "work-phone holds no lease")
+	})
+}
+
+// TestDHCPClientDriftReport checks configured clients against a lease table
+// read from a dnsmasq lease file
+func TestDHCPClientDriftReport(t *testing.T) {
+	t.Parallel()
+
+	leaseFile := `1767225600 00:11:22:33:44:55 10.17.12.100 work-laptop 01:00:11:22:33:44:55
+1767225600 00:11:22:33:44:56 10.17.12.142 work-phone *
+1767225600 AA:BB:CC:DD:EE:01 10.17.13.100 * *
+duid 00:01:00:01:2c:5f:3a:1b:00:11:22:33:44:99
+`
+	leases, err := pihole.ParseDnsmasqLeases(strings.NewReader(leaseFile))
+	require.NoError(t, err, "Should parse dnsmasq lease file")
+	require.Len(t, leases, 3, "DUID line should be skipped")
+	assert.Equal(t, "aa:bb:cc:dd:ee:01", leases[2].HWAddr, "MACs should be normalised to lower case")
+	assert.Empty(t, leases[2].Name, "Unknown hostname should be empty")
+
+	checks := pihole.CheckClientLeases(dhcpTestClients, leases)
+	require.Len(t, checks, 4)
+
+	status := make(map[string]pihole.LeaseCheck)
+	for _, check := range checks {
+		status[check.Client.Name] = check
+		t.Logf("%-9s %-14s %s lease=%s", check.Status, check.Client.Name, check.Client.IP, check.LeaseIP)
+	}
+
+	assert.Equal(t, pihole.LeaseOK, status["work-laptop"].Status)
+	assert.Equal(t, pihole.LeaseDrifted, status["work-phone"].Status)
+	assert.Equal(t, "10.17.12.142", status["work-phone"].LeaseIP)
+	assert.Equal(t, pihole.LeaseConflict, status["other-laptop"].Status)
+	assert.Equal(t, "aa:bb:cc:dd:ee:01", status["other-laptop"].LeaseMAC)
+	assert.Equal(t, pihole.LeaseMissing, status["phone-2.4ghz"].Status)
+}
@@ -0,0 +1,385 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/yebyen/home-lab-terraform/internal/dnsstub"
+	"github.com/yebyen/home-lab-terraform/internal/perftrack"
+)
+
+// piholeModuleDir is the module every Pi-hole test environment deploys
+var piholeModuleDir = filepath.Join("..", "terraform", "modules", "pihole")
+
+// upstreamZone is the fixture zone the stub upstream resolver serves
+var upstreamZone = filepath.Join("testdata", "dns", "upstream.zone")
+
+// PiholeEnvBuilder assembles the terraform.Options for a dedicated Pi-hole
+// test instance. Ports, subnet, names and password are allocated per test
+// unless overridden; every variable is checked against the module's
+// variables.tf (see RequireValidVars) before Terraform runs. Unless
+// WithUpstreamDNS is used, Pi-hole forwards to a stub resolver serving
+// testdata/dns/upstream.zone, so tests never depend on the internet.
+type PiholeEnvBuilder struct {
+	t            *testing.T
+	dir          string
+	name         string
+	vars         map[string]interface{}
+	readyTimeout time.Duration
+	wait         bool
+	destroy      func(*testing.T, *terraform.Options)
+	// stubAddr is where Build starts the stub upstream, if Options
+	// reserved one
+	stubAddr string
+}
+
+// PiholeEnv is a deployed Pi-hole instance
+type PiholeEnv struct {
+	Options       *terraform.Options
+	ContainerName string
+	NetworkName   string
+	Password      string
+	DNSPort       int
+	WebPort       int
+	// BaseURL is the web server root, e.g. http://localhost:31081
+	BaseURL string
+	// DNSAddress is host:port for DNS queries, e.g. 127.0.0.1:31080
+	DNSAddress string
+	// Session is authenticated once the instance is ready; nil with WithoutWait
+	Session *PiholeSession
+	// Upstream is the stub resolver Pi-hole forwards to; nil with WithUpstreamDNS
+	Upstream *dnsstub.Server
+}
+
+// NewPiholeEnv starts a builder with the defaults every Pi-hole test used to
+// copy: bridge networking, listening on all interfaces, America/New_York
+func NewPiholeEnv(t *testing.T) *PiholeEnvBuilder {
+	return &PiholeEnvBuilder{
+		t:    t,
+		dir:  piholeModuleDir,
+		name: "env",
+		vars: map[string]interface{}{
+			"timezone":          "America/New_York",
+			"dnsmasq_listening": "all",
+			"use_host_network":  false,
+		},
+		readyTimeout: 90 * time.Second,
+		wait:         true,
+		destroy: func(t *testing.T, options *terraform.Options) {
+			terraform.Destroy(t, options)
+		},
+	}
+}
+
+// WithName sets the prefix of the container and network names
+func (b *PiholeEnvBuilder) WithName(name string) *PiholeEnvBuilder {
+	b.name = name
+	return b
+}
+
+// WithVersion pins the pihole/pihole image tag
+func (b *PiholeEnvBuilder) WithVersion(version string) *PiholeEnvBuilder {
+	return b.WithVar("pihole_version", version)
+}
+
+// WithHostNetwork runs the container in host networking mode, where Pi-hole
+// binds the standard ports 53 and 80 instead of mapped ones
+func (b *PiholeEnvBuilder) WithHostNetwork() *PiholeEnvBuilder {
+	return b.WithVar("use_host_network", true)
+}
+
+// WithPassword sets the web/API password instead of a generated one
+func (b *PiholeEnvBuilder) WithPassword(password string) *PiholeEnvBuilder {
+	return b.WithVar("web_password", password)
+}
+
+// WithPorts fixes the published DNS and web ports instead of allocating free ones
+func (b *PiholeEnvBuilder) WithPorts(dnsPort, webPort int) *PiholeEnvBuilder {
+	return b.WithVar("dns_port", dnsPort).WithVar("web_port", webPort)
+}
+
+// WithSubnet fixes the Docker network subnet instead of allocating one
+func (b *PiholeEnvBuilder) WithSubnet(cidr string) *PiholeEnvBuilder {
+	return b.WithVar("subnet", cidr)
+}
+
+// WithUpstreamDNS sets the servers Pi-hole forwards to instead of the stub
+// resolver, e.g. public resolvers for tests that need the real internet
+func (b *PiholeEnvBuilder) WithUpstreamDNS(servers ...string) *PiholeEnvBuilder {
+	return b.WithVar("upstream_dns", strings.Join(servers, ";"))
+}
+
+// WithVar sets any other module variable; the name is checked at Build time
+func (b *PiholeEnvBuilder) WithVar(name string, value interface{}) *PiholeEnvBuilder {
+	b.vars[name] = value
+	return b
+}
+
+// WithReadyTimeout bounds how long Build waits for the API to accept logins
+func (b *PiholeEnvBuilder) WithReadyTimeout(timeout time.Duration) *PiholeEnvBuilder {
+	b.readyTimeout = timeout
+	return b
+}
+
+// WithoutWait makes Build return as soon as Terraform has applied
+func (b *PiholeEnvBuilder) WithoutWait() *PiholeEnvBuilder {
+	b.wait = false
+	return b
+}
+
+// WithDestroy replaces terraform.Destroy as the cleanup step, e.g. with
+// cleanupContainerOnly to keep the shared image
+func (b *PiholeEnvBuilder) WithDestroy(destroy func(*testing.T, *terraform.Options)) *PiholeEnvBuilder {
+	b.destroy = destroy
+	return b
+}
+
+// Options fills in the per-test allocations, validates the variables and
+// returns the terraform.Options without applying them
+func (b *PiholeEnvBuilder) Options() *terraform.Options {
+	b.t.Helper()
+
+	testID := fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s-%d", b.t.Name(), time.Now().UnixNano()))))[:8]
+	b.setDefault("container_name", fmt.Sprintf("pihole-%s-%s", b.name, testID))
+	b.setDefault("network_name", fmt.Sprintf("pihole-%s-net-%s", b.name, testID))
+	b.setDefault("web_password", fmt.Sprintf("%s-password-%s", b.name, testID))
+	if _, ok := b.vars["subnet"]; !ok {
+		b.vars["subnet"] = allocateSubnet()
+	}
+	if _, ok := b.vars["dns_port"]; !ok {
+		b.vars["dns_port"] = allocatePort(b.t, true)
+	}
+	if _, ok := b.vars["web_port"]; !ok {
+		b.vars["web_port"] = allocatePort(b.t, false)
+	}
+	if _, ok := b.vars["upstream_dns"]; !ok {
+		b.vars["upstream_dns"] = b.reserveStubUpstream()
+	}
+
+	options := terraform.WithDefaultRetryableErrors(b.t, &terraform.Options{
+		TerraformDir: b.dir,
+		Vars:         b.vars,
+		NoColor:      true,
+	})
+	RequireValidVars(b.t, options)
+	return options
+}
+
+// Build applies the module, registers its destruction with t.Cleanup and,
+// unless WithoutWait was used, waits until the API accepts a login
+func (b *PiholeEnvBuilder) Build() *PiholeEnv {
+	b.t.Helper()
+
+	options := b.Options()
+	env := &PiholeEnv{
+		Options:       options,
+		ContainerName: requireVar[string](b.t, options.Vars, "container_name"),
+		NetworkName:   requireVar[string](b.t, options.Vars, "network_name"),
+		Password:      requireVar[string](b.t, options.Vars, "web_password"),
+		DNSPort:       requireVar[int](b.t, options.Vars, "dns_port"),
+		WebPort:       requireVar[int](b.t, options.Vars, "web_port"),
+	}
+	if hostNetwork, _ := options.Vars["use_host_network"].(bool); hostNetwork {
+		env.DNSPort, env.WebPort = 53, 80
+	}
+	env.BaseURL = fmt.Sprintf("http://localhost:%d", env.WebPort)
+	env.DNSAddress = fmt.Sprintf("127.0.0.1:%d", env.DNSPort)
+
+	// Each phase is logged for `homelab perf`; assertions are whatever the
+	// test does between readiness and cleanup
+	destroy := b.destroy
+	var ready time.Time
+	b.t.Cleanup(func() {
+		if !ready.IsZero() {
+			logPhase(b.t, perftrack.PhaseAssertions, ready)
+		}
+		if os.Getenv("SKIP_CLEANUP") == "true" {
+			b.t.Logf("Skipping cleanup of %s", env.ContainerName)
+			return
+		}
+		start := time.Now()
+		destroy(b.t, options)
+		logPhase(b.t, perftrack.PhaseDestroy, start)
+	})
+	start := time.Now()
+	terraform.Init(b.t, options)
+	logPhase(b.t, perftrack.PhaseInit, start)
+	start = time.Now()
+	terraform.Apply(b.t, options)
+	logPhase(b.t, perftrack.PhaseApply, start)
+
+	// The gateway address only exists on the host once Terraform has
+	// created the network, so the stub starts now; Pi-hole retries
+	// upstreams it could not reach while starting up
+	if b.stubAddr != "" {
+		env.Upstream = StartStubUpstream(b.t, b.stubAddr)
+	}
+	if b.wait {
+		start = time.Now()
+		env.Session = waitForPihole(b.t, env.BaseURL, env.Password, b.readyTimeout)
+		logPhase(b.t, perftrack.PhaseReady, start)
+	}
+	ready = time.Now()
+	return env
+}
+
+// moduleVar reads a variable the harness needs as a Go value of type T.
+// WithVar accepts anything, so e.g. an int64 port is an error here rather
+// than a panic.
+func moduleVar[T any](vars map[string]interface{}, name string) (T, error) {
+	value, ok := vars[name].(T)
+	if !ok {
+		return value, fmt.Errorf("variable %q must be a %T, got %T (%v)", name, value, vars[name], vars[name])
+	}
+	return value, nil
+}
+
+// requireVar is moduleVar failing the test on a mismatch
+func requireVar[T any](t *testing.T, vars map[string]interface{}, name string) T {
+	t.Helper()
+	value, err := moduleVar[T](vars, name)
+	if err != nil {
+		t.Fatalf("Invalid module variables: %v", err)
+	}
+	return value
+}
+
+// logPhase logs how long a phase has taken since start in the form
+// internal/perftrack reads back from `go test -json` output
+func logPhase(t *testing.T, phase string, start time.Time) {
+	t.Helper()
+	t.Log(perftrack.Marker(phase, time.Since(start)))
+}
+
+// waitForPihole polls until a session can be established and used
+func waitForPihole(t *testing.T, baseURL, password string, timeout time.Duration) *PiholeSession {
+	t.Helper()
+	t.Logf("Waiting up to %s for Pi-hole at %s...", timeout, baseURL)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		session, err := NewPiholeSession(baseURL, password)
+		if err == nil {
+			if err = session.TestAPIAccess(); err == nil {
+				return session
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Pi-hole at %s not ready after %s: %v", baseURL, timeout, err)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// reserveStubUpstream picks the address the stub resolver will listen on,
+// as Pi-hole sees it: the Docker network's gateway, or localhost with host
+// networking. It returns the upstream_dns value; Build starts the stub.
+func (b *PiholeEnvBuilder) reserveStubUpstream() string {
+	b.t.Helper()
+
+	host, err := stubUpstreamHost(b.vars)
+	if err != nil {
+		b.t.Fatalf("Failed to find the gateway for the stub upstream: %v", err)
+	}
+	port := allocatePort(b.t, true)
+	b.stubAddr = net.JoinHostPort(host, fmt.Sprint(port))
+	return fmt.Sprintf("%s#%d", host, port)
+}
+
+// stubUpstreamHost is the one address the stub upstream listens on, so it
+// is reachable from the Pi-hole's network and no other
+func stubUpstreamHost(vars map[string]interface{}) (string, error) {
+	if hostNetwork, _ := vars["use_host_network"].(bool); hostNetwork {
+		return "127.0.0.1", nil
+	}
+	subnet, err := moduleVar[string](vars, "subnet")
+	if err != nil {
+		return "", err
+	}
+	return subnetGateway(subnet)
+}
+
+// StartStubUpstream serves testdata/dns/upstream.zone on addr, e.g.
+// 127.0.0.1:0, until the test ends
+func StartStubUpstream(t *testing.T, addr string) *dnsstub.Server {
+	t.Helper()
+
+	zone, err := dnsstub.LoadZone(upstreamZone)
+	if err != nil {
+		t.Fatalf("Failed to load the upstream fixture zone: %v", err)
+	}
+	server, err := dnsstub.Start(addr, zone)
+	if err != nil {
+		t.Fatalf("Failed to start the stub upstream: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+// subnetGateway is the address Docker gives a network's gateway by
+// default, the first in its subnet, where containers reach the host
+func subnetGateway(cidr string) (string, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return "", err
+	}
+	return prefix.Masked().Addr().Next().String(), nil
+}
+
+func (b *PiholeEnvBuilder) setDefault(name string, value interface{}) {
+	if _, ok := b.vars[name]; !ok {
+		b.vars[name] = value
+	}
+}
+
+var (
+	subnetMu   sync.Mutex
+	nextSubnet int
+)
+
+// allocateSubnet hands out a distinct /24 per environment in this process.
+// The second octet varies with the PID so concurrent `go test` processes
+// rarely collide, and stays clear of the home lab's 10.17.x networks.
+func allocateSubnet() string {
+	subnetMu.Lock()
+	defer subnetMu.Unlock()
+	subnet := fmt.Sprintf("10.%d.%d.0/24", 200+os.Getpid()%50, nextSubnet%256)
+	nextSubnet++
+	return subnet
+}
+
+// allocatePort finds a free TCP port on the host; DNS ports must also be
+// free for UDP since the module publishes both
+func allocatePort(t *testing.T, udp bool) int {
+	t.Helper()
+
+	for attempt := 0; attempt < 20; attempt++ {
+		listener, err := net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatalf("Failed to allocate port: %v", err)
+		}
+		port := listener.Addr().(*net.TCPAddr).Port
+		if !udp {
+			listener.Close()
+			return port
+		}
+
+		conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+		listener.Close()
+		if err == nil {
+			conn.Close()
+			return port
+		}
+	}
+	t.Fatalf("Failed to allocate a port free for both TCP and UDP")
+	return 0
+}
@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/tfschema"
+)
+
+// TestPiholeEnvBuilderOptions checks the builder's allocations and variable
+// validation without deploying anything
+func TestPiholeEnvBuilderOptions(t *testing.T) {
+	t.Parallel()
+
+	first := NewPiholeEnv(t).WithName("builder").WithVersion("2025.11.0").Options()
+	second := NewPiholeEnv(t).WithName("builder").WithHostNetwork().WithPassword("fixed").Options()
+
+	t.Run("Allocations_Are_Unique", func(t *testing.T) {
+		assert.NotEqual(t, first.Vars["container_name"], second.Vars["container_name"])
+		assert.NotEqual(t, first.Vars["network_name"], second.Vars["network_name"])
+		assert.NotEqual(t, first.Vars["subnet"], second.Vars["subnet"])
+		assert.NotEqual(t, first.Vars["dns_port"], first.Vars["web_port"])
+		assert.NotEqual(t, first.Vars["dns_port"], second.Vars["dns_port"])
+	})
+
+	t.Run("Overrides_Applied", func(t *testing.T) {
+		assert.Equal(t, "2025.11.0", first.Vars["pihole_version"])
+		assert.Equal(t, false, first.Vars["use_host_network"])
+		assert.Equal(t, true, second.Vars["use_host_network"])
+		assert.Equal(t, "fixed", second.Vars["web_password"])
+	})
+
+	t.Run("Stub_Upstream_By_Default", func(t *testing.T) {
+		gateway, err := subnetGateway(first.Vars["subnet"].(string))
+		require.NoError(t, err)
+		assert.Regexp(t, `^`+regexp.QuoteMeta(gateway)+`#\d+$`, first.Vars["upstream_dns"], "Containers reach the stub through the network gateway")
+		assert.Regexp(t, `^127\.0\.0\.1#\d+$`, second.Vars["upstream_dns"], "Host networking reaches it on localhost")
+
+		_, port, _ := strings.Cut(second.Vars["upstream_dns"].(string), "#")
+		conn, err := net.ListenPacket("udp", "127.0.0.1:"+port)
+		require.NoError(t, err, "Options only reserves the port; Build starts the stub")
+		conn.Close()
+
+		public := NewPiholeEnv(t).WithUpstreamDNS("1.1.1.1", "1.0.0.1").Options()
+		assert.Equal(t, "1.1.1.1;1.0.0.1", public.Vars["upstream_dns"])
+
+		gateway, err = subnetGateway("10.201.7.0/24")
+		require.NoError(t, err)
+		assert.Equal(t, "10.201.7.1", gateway)
+	})
+
+	t.Run("Stub_Starts_Once_Address_Is_Free", func(t *testing.T) {
+		port := allocatePort(t, true)
+		addr := net.JoinHostPort("127.0.0.1", fmt.Sprint(port))
+		// Stands in for the gateway address Terraform has not created yet
+		occupant, err := net.ListenPacket("udp", addr)
+		require.NoError(t, err)
+		require.NoError(t, startStubUpstreamOnNetwork(t, addr))
+
+		query := new(dns.Msg)
+		query.SetQuestion("google.com.", dns.TypeA)
+		client := &dns.Client{Timeout: 200 * time.Millisecond}
+		_, _, err = client.Exchange(query, addr)
+		assert.Error(t, err, "Nothing answers while the address is taken")
+
+		occupant.Close()
+		assert.Eventually(t, func() bool {
+			reply, _, err := client.Exchange(query, addr)
+			return err == nil && len(reply.Answer) == 1
+		}, 5*time.Second, 100*time.Millisecond)
+	})
+
+	t.Run("Typed_Variables", func(t *testing.T) {
+		port, err := moduleVar[int](first.Vars, "dns_port")
+		require.NoError(t, err)
+		assert.Equal(t, first.Vars["dns_port"], port)
+
+		vars := map[string]interface{}{"dns_port": int64(5353), "web_port": "8080"}
+		_, err = moduleVar[int](vars, "dns_port")
+		assert.EqualError(t, err, `variable "dns_port" must be a int, got int64 (5353)`)
+		_, err = moduleVar[int](vars, "web_port")
+		assert.EqualError(t, err, `variable "web_port" must be a int, got string (8080)`)
+		_, err = moduleVar[string](vars, "web_password")
+		assert.EqualError(t, err, `variable "web_password" must be a string, got <nil> (<nil>)`)
+	})
+
+	t.Run("Variables_Declared_By_Module", func(t *testing.T) {
+		module, err := tfschema.LoadModule(piholeModuleDir)
+		require.NoError(t, err, "Should parse the pihole module's variables")
+
+		assert.Empty(t, module.UnknownVars(first.Vars))
+		assert.Empty(t, module.UnknownVars(second.Vars))
+	})
+
+	t.Run("Misspelled_Variable_Suggestion", func(t *testing.T) {
+		module, err := tfschema.LoadModule(piholeModuleDir)
+		require.NoError(t, err)
+
+		vars := map[string]interface{}{"container_name": "pihole", "webpassword": "test-password"}
+		assert.Equal(t, []string{"webpassword"}, module.UnknownVars(vars))
+		assert.Equal(t, "web_password", module.Suggest("webpassword"))
+		assert.Empty(t, module.Suggest("admin_password"), "Unrelated names get no suggestion")
+	})
+}
@@ -0,0 +1,315 @@
+package tests
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/pihole"
+	"github.com/yebyen/home-lab-terraform/internal/promtext"
+)
+
+// exporterSeries are the series the pihole-exporter must serve and the
+// GetSummary/GetBlocking value each must track
+var exporterSeries = []struct {
+	name  string
+	value func(*pihole.Summary, *pihole.Blocking) float64
+}{
+	{"pihole_dns_queries_today", func(s *pihole.Summary, _ *pihole.Blocking) float64 { return float64(s.Queries.Total) }},
+	{"pihole_ads_blocked_today", func(s *pihole.Summary, _ *pihole.Blocking) float64 { return float64(s.Queries.Blocked) }},
+	{"pihole_ads_percentage_today", func(s *pihole.Summary, _ *pihole.Blocking) float64 { return s.Queries.PercentBlocked }},
+	{"pihole_unique_clients", func(s *pihole.Summary, _ *pihole.Blocking) float64 { return float64(s.Clients.Active) }},
+	{"pihole_clients_ever_seen", func(s *pihole.Summary, _ *pihole.Blocking) float64 { return float64(s.Clients.Total) }},
+	{"pihole_domains_being_blocked", func(s *pihole.Summary, _ *pihole.Blocking) float64 {
+		return float64(s.Gravity.DomainsBeingBlocked)
+	}},
+	{"pihole_status", func(_ *pihole.Summary, b *pihole.Blocking) float64 {
+		if b.Enabled() {
+			return 1
+		}
+		return 0
+	}},
+}
+
+// exporterContractProblems checks scraped metrics against the contract:
+// every required series is present with sane values that match what the
+// Pi-hole API reports
+func exporterContractProblems(families promtext.Families, summary *pihole.Summary, blocking *pihole.Blocking) []string {
+	var problems []string
+	values := make(map[string]float64)
+	for _, series := range exporterSeries {
+		value, ok := families.Value(series.name, nil)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s is missing", series.name))
+			continue
+		}
+		values[series.name] = value
+		if math.IsNaN(value) || value < 0 {
+			problems = append(problems, fmt.Sprintf("%s is %v", series.name, value))
+		}
+		if want := series.value(summary, blocking); math.Abs(value-want) > 0.01 {
+			problems = append(problems, fmt.Sprintf("%s is %v but the API reports %v", series.name, value, want))
+		}
+	}
+
+	if values["pihole_ads_blocked_today"] > values["pihole_dns_queries_today"] {
+		problems = append(problems, "more queries blocked than made")
+	}
+	if values["pihole_ads_percentage_today"] > 100 {
+		problems = append(problems, "blocked percentage is over 100")
+	}
+	if status := values["pihole_status"]; status != 0 && status != 1 {
+		problems = append(problems, fmt.Sprintf("pihole_status is %v, not 0 or 1", status))
+	}
+	return problems
+}
+
+// fakePiholeStats serves one set of counters as both the v6 stats API and
+// the v5 api.php the ekofr/pihole-exporter image scrapes
+type fakePiholeStats struct {
+	mu       sync.Mutex
+	summary  pihole.Summary
+	blocking bool
+}
+
+func newFakePiholeStats(fake *fakePihole, token string) *fakePiholeStats {
+	stats := &fakePiholeStats{blocking: true}
+	stats.summary.Queries.Total = 21345
+	stats.summary.Queries.Blocked = 2345
+	stats.summary.Queries.UniqueDomains = 1234
+	stats.summary.Queries.Forwarded = 15000
+	stats.summary.Queries.Cached = 4000
+	stats.summary.Clients.Active = 17
+	stats.summary.Clients.Total = 23
+	stats.summary.Gravity.DomainsBeingBlocked = 123456
+	stats.summary.Gravity.LastUpdate = 1760000000
+	stats.recalculate()
+
+	fake.Handle("GET /api/stats/summary", func(w http.ResponseWriter, r *http.Request) {
+		stats.mu.Lock()
+		defer stats.mu.Unlock()
+		writeJSON(w, 200, stats.summary)
+	})
+	fake.Handle("GET /api/dns/blocking", func(w http.ResponseWriter, r *http.Request) {
+		stats.mu.Lock()
+		defer stats.mu.Unlock()
+		writeJSON(w, 200, map[string]interface{}{"blocking": map[bool]string{true: "enabled", false: "disabled"}[stats.blocking], "timer": nil})
+	})
+	fake.HandlePublic("GET /admin/api.php", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("auth") != token {
+			writeJSON(w, 200, []interface{}{})
+			return
+		}
+		stats.mu.Lock()
+		defer stats.mu.Unlock()
+		s := stats.summary
+		writeJSON(w, 200, map[string]interface{}{
+			"domains_being_blocked": s.Gravity.DomainsBeingBlocked,
+			"dns_queries_today":     s.Queries.Total,
+			"ads_blocked_today":     s.Queries.Blocked,
+			"ads_percentage_today":  s.Queries.PercentBlocked,
+			"unique_domains":        s.Queries.UniqueDomains,
+			"queries_forwarded":     s.Queries.Forwarded,
+			"queries_cached":        s.Queries.Cached,
+			"clients_ever_seen":     s.Clients.Total,
+			"unique_clients":        s.Clients.Active,
+			"dns_queries_all_types": s.Queries.Total,
+			"status":                map[bool]string{true: "enabled", false: "disabled"}[stats.blocking],
+			"top_queries":           map[string]int{},
+			"top_ads":               map[string]int{},
+			"top_sources":           map[string]int{},
+			"forward_destinations":  map[string]float64{},
+			"querytypes":            map[string]float64{},
+		})
+	})
+	return stats
+}
+
+// add records more queries, some of them blocked
+func (s *fakePiholeStats) add(queries, blocked int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary.Queries.Total += queries
+	s.summary.Queries.Blocked += blocked
+	s.recalculate()
+}
+
+func (s *fakePiholeStats) recalculate() {
+	s.summary.Queries.PercentBlocked = 100 * float64(s.summary.Queries.Blocked) / float64(s.summary.Queries.Total)
+}
+
+// TestPiholeExporterMetricsOffline parses an exposition in the exporter's
+// format and checks the contract against the fake Pi-hole's API
+func TestPiholeExporterMetricsOffline(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakePihole(t, "exporter-password")
+	newFakePiholeStats(fake, "exporter-token")
+	session, err := NewPiholeSession(fake.URL, "exporter-password")
+	require.NoError(t, err)
+	summary, err := session.GetSummary()
+	require.NoError(t, err)
+	blocking, err := session.GetBlocking()
+	require.NoError(t, err)
+
+	data, err := os.ReadFile("testdata/pihole-exporter/metrics.txt")
+	require.NoError(t, err)
+	families, err := promtext.Parse(strings.NewReader(string(data)))
+	require.NoError(t, err)
+
+	t.Run("Contract_Holds", func(t *testing.T) {
+		assert.Empty(t, exporterContractProblems(families, summary, blocking))
+		assert.Equal(t, "gauge", families["pihole_status"].Type)
+		source, ok := families.Find("pihole_top_sources", nil)
+		require.True(t, ok)
+		assert.Equal(t, "nas.lan|10.17.12.20", source.Labels["source"])
+	})
+
+	t.Run("GetStats_Matches_Summary", func(t *testing.T) {
+		stats, err := session.GetStats()
+		require.NoError(t, err)
+		queries := stats["queries"].(map[string]interface{})
+		assert.Equal(t, float64(summary.Queries.Total), queries["total"])
+		assert.Equal(t, float64(summary.Queries.Blocked), queries["blocked"])
+	})
+
+	t.Run("Contract_Violations", func(t *testing.T) {
+		broken, err := promtext.Parse(strings.NewReader(strings.NewReplacer(
+			`pihole_unique_clients{hostname="127.0.0.1"} 17`, "",
+			`pihole_ads_blocked_today{hostname="127.0.0.1"} 2345`, `pihole_ads_blocked_today{hostname="127.0.0.1"} 30000`,
+			`pihole_status{hostname="127.0.0.1"} 1`, `pihole_status{hostname="127.0.0.1"} 2`,
+		).Replace(string(data))))
+		require.NoError(t, err)
+		problems := strings.Join(exporterContractProblems(broken, summary, blocking), "\n")
+		assert.Contains(t, problems, "pihole_unique_clients is missing")
+		assert.Contains(t, problems, "pihole_ads_blocked_today is 30000 but the API reports 2345")
+		assert.Contains(t, problems, "more queries blocked than made")
+		assert.Contains(t, problems, "pihole_status is 2, not 0 or 1")
+	})
+
+	t.Run("Parser", func(t *testing.T) {
+		parsed, err := promtext.Parse(strings.NewReader(`# A comment
+# HELP rpc_duration_seconds RPC latency\nin seconds
+# TYPE rpc_duration_seconds histogram
+rpc_duration_seconds_bucket{le="0.1"} 3
+rpc_duration_seconds_bucket{le="+Inf"} 5
+rpc_duration_seconds_sum 1.25
+rpc_duration_seconds_count 5
+escaped{path="C:\\dir",quote="say \"hi\"",newline="a\nb"} NaN 1700000000000
+no_type_total +Inf
+`))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"escaped", "no_type_total", "rpc_duration_seconds"}, parsed.Names())
+		assert.Equal(t, "RPC latency\nin seconds", parsed["rpc_duration_seconds"].Help)
+		assert.Len(t, parsed["rpc_duration_seconds"].Samples, 4, "Buckets, sum and count join their histogram")
+		count, ok := parsed.Value("rpc_duration_seconds_count", nil)
+		assert.True(t, ok)
+		assert.Equal(t, 5.0, count)
+		inf, ok := parsed.Value("rpc_duration_seconds_bucket", map[string]string{"le": "+Inf"})
+		assert.True(t, ok)
+		assert.Equal(t, 5.0, inf)
+
+		sample, ok := parsed.Find("escaped", nil)
+		require.True(t, ok)
+		assert.Equal(t, map[string]string{"path": `C:\dir`, "quote": `say "hi"`, "newline": "a\nb"}, sample.Labels)
+		assert.True(t, math.IsNaN(sample.Value))
+		assert.Equal(t, int64(1700000000000), sample.Timestamp)
+		assert.True(t, math.IsInf(parsed["no_type_total"].Samples[0].Value, 1))
+
+		for name, exposition := range map[string]string{
+			"Bad_Value":         "up one",
+			"Bad_Name":          "1up 1",
+			"Unquoted_Label":    "up{job=api} 1",
+			"Unterminated":      `up{job="api} 1`,
+			"Duplicate_Label":   `up{job="a",job="b"} 1`,
+			"Type_After_Sample": "up 1\n# TYPE up gauge",
+			"Unknown_Type":      "# TYPE up meter",
+			"Missing_Value":     "up",
+		} {
+			_, err := promtext.Parse(strings.NewReader(exposition))
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+// TestPiholeExporterMetrics runs the pihole-exporter module against a fake
+// Pi-hole, scrapes metrics_endpoint and checks the series track the API as
+// the counters change
+func TestPiholeExporterMetrics(t *testing.T) {
+	RequireDocker(t)
+
+	// The exporter runs with host networking, so it reaches the fake
+	// Pi-hole on the host's loopback
+	fake := newFakePihole(t, "exporter-password")
+	stats := newFakePiholeStats(fake, "exporter-token")
+	session, err := NewPiholeSession(fake.URL, "exporter-password")
+	require.NoError(t, err)
+	piholePort := fake.Listener.Addr().(*net.TCPAddr).Port
+
+	port := allocatePort(t, false)
+	vars := exporterVars()
+	vars["container_name"] = fmt.Sprintf("pihole-exporter-metrics-%d", port)
+	vars["pihole_hostname"] = "127.0.0.1"
+	vars["pihole_api_token"] = "exporter-token"
+	vars["exporter_port"] = port
+	vars["scrape_interval"] = "1s"
+	vars["additional_env_vars"] = []string{fmt.Sprintf("PIHOLE_PORT=%d", piholePort)}
+	options := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: "../terraform/modules/pihole-exporter",
+		Vars:         vars,
+		NoColor:      true,
+	})
+	RequireValidVars(t, options)
+	RequireTerraform(t, options)
+
+	t.Cleanup(func() {
+		if os.Getenv("SKIP_CLEANUP") != "true" {
+			terraform.Destroy(t, options)
+		}
+	})
+	terraform.InitAndApply(t, options)
+	endpoint := terraform.Output(t, options, "metrics_endpoint")
+
+	// scrapeUntil polls the exporter until its metrics satisfy the contract
+	// for what the API currently reports
+	scrapeUntil := func(t *testing.T) {
+		t.Helper()
+
+		var problems []string
+		for deadline := time.Now().Add(60 * time.Second); time.Now().Before(deadline); time.Sleep(time.Second) {
+			summary, err := session.GetSummary()
+			require.NoError(t, err)
+			blocking, err := session.GetBlocking()
+			require.NoError(t, err)
+
+			resp, err := http.Get(endpoint)
+			if err != nil {
+				problems = []string{err.Error()}
+				continue
+			}
+			families, err := promtext.Parse(resp.Body)
+			resp.Body.Close()
+			require.NoError(t, err, "Exporter serves invalid exposition format")
+			if problems = exporterContractProblems(families, summary, blocking); len(problems) == 0 {
+				return
+			}
+		}
+		t.Fatalf("Metrics never matched the Pi-hole API:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	t.Run("Required_Series", scrapeUntil)
+
+	t.Run("Tracks_Counters", func(t *testing.T) {
+		stats.add(1000, 400)
+		scrapeUntil(t)
+	})
+}
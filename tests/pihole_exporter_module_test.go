@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/tfeval"
+)
+
+// exporterVars are the 13-net values for the pihole-exporter module
+func exporterVars() map[string]interface{} {
+	return map[string]interface{}{
+		"container_name":   "pihole-exporter-test",
+		"pihole_hostname":  "10.17.12.109",
+		"pihole_api_token": "exporter-test-token",
+		"exporter_port":    9617,
+	}
+}
+
+// TestPiholeExporterModuleVariableCombinations checks the exporter
+// environment, the Prometheus label toggle and the input validations
+func TestPiholeExporterModuleVariableCombinations(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Environment", func(t *testing.T) {
+		vars := exporterVars()
+		vars["scrape_interval"] = "30s"
+		vars["additional_env_vars"] = []string{"PIHOLE_PROTOCOL=https"}
+		container := RequireResource(t, LoadModuleOffline(t, vars, "modules", "pihole-exporter"), "docker_container.pihole_exporter")
+
+		env, err := container.Strings("env")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"PIHOLE_HOSTNAME=10.17.12.109",
+			"PIHOLE_API_TOKEN=exporter-test-token",
+			"INTERVAL=30s",
+			"PORT=9617",
+			"PIHOLE_PROTOCOL=https",
+		}, env)
+
+		mode, err := container.String("network_mode")
+		require.NoError(t, err)
+		assert.Equal(t, "host", mode)
+	})
+
+	// enable_prometheus_labels only drives the prometheus_labels output; the
+	// container's discovery labels are always set
+	t.Run("Prometheus_Labels", func(t *testing.T) {
+		for _, enabled := range []bool{true, false} {
+			vars := exporterVars()
+			vars["enable_prometheus_labels"] = enabled
+			vars["metrics_path"] = "/custom"
+			module := LoadModuleOffline(t, vars, "modules", "pihole-exporter")
+
+			labels, err := module.Output("prometheus_labels")
+			require.NoError(t, err)
+			if !enabled {
+				assert.True(t, labels.IsNull(), "prometheus_labels is null when disabled")
+			} else {
+				got, err := tfeval.ToGo(labels)
+				require.NoError(t, err)
+				assert.Equal(t, map[string]interface{}{
+					"prometheus.io/scrape": "true",
+					"prometheus.io/port":   "9617",
+					"prometheus.io/path":   "/custom",
+				}, got)
+			}
+
+			containerLabels, err := RequireResource(t, module, "docker_container.pihole_exporter").Blocks("labels")
+			require.NoError(t, err)
+			assert.Len(t, containerLabels, 5, "enable_prometheus_labels=%t", enabled)
+		}
+	})
+
+	t.Run("Scrape_Config", func(t *testing.T) {
+		module := LoadModuleOffline(t, exporterVars(), "modules", "pihole-exporter")
+		config, err := module.Output("scrape_config")
+		require.NoError(t, err)
+		got, err := tfeval.ToGo(config)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"job_name":        "pihole-exporter",
+			"static_configs":  []interface{}{map[string]interface{}{"targets": []interface{}{"localhost:9617"}}},
+			"metrics_path":    "/metrics",
+			"scrape_interval": "10s",
+		}, got)
+	})
+
+	t.Run("Rejected_Values", func(t *testing.T) {
+		for name, override := range map[string]map[string]interface{}{
+			"Bad_Interval":    {"scrape_interval": "10 seconds"},
+			"Privileged_Port": {"exporter_port": 80},
+		} {
+			vars := exporterVars()
+			for key, value := range override {
+				vars[key] = value
+			}
+			_, err := tfeval.Load("../terraform/modules/pihole-exporter", vars)
+			assert.Error(t, err, name)
+		}
+
+		vars := exporterVars()
+		delete(vars, "pihole_api_token")
+		_, err := tfeval.Load("../terraform/modules/pihole-exporter", vars)
+		assert.Error(t, err, "pihole_api_token is required")
+	})
+}
+
+// TestPiholeExporterModulePlan plans the exporter and checks the API token
+// stays sensitive in the plan
+func TestPiholeExporterModulePlan(t *testing.T) {
+	t.Parallel()
+
+	plan := PlanModule(t, exporterVars(), "modules", "pihole-exporter")
+
+	container := "docker_container.pihole_exporter"
+	plan.AssertAction(container, PlanCreate)
+	plan.AssertAttributeEquals(container, "network_mode", "host")
+	plan.AssertAttributeEquals(container, "image", "ekofr/pihole-exporter:v0.4.0")
+	plan.AssertSensitive(container, "env")
+}
+
+// TestPiholeExporterModuleApply runs the exporter on a free port against an
+// unreachable Pi-hole and checks the metrics endpoint still comes up
+func TestPiholeExporterModuleApply(t *testing.T) {
+	RequireDocker(t)
+
+	port := allocatePort(t, false)
+	vars := exporterVars()
+	vars["container_name"] = fmt.Sprintf("pihole-exporter-test-%d", port)
+	vars["pihole_hostname"] = "127.0.0.1"
+	vars["exporter_port"] = port
+	options := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: "../terraform/modules/pihole-exporter",
+		Vars:         vars,
+		NoColor:      true,
+	})
+	RequireValidVars(t, options)
+	RequireTerraform(t, options)
+
+	t.Cleanup(func() {
+		if os.Getenv("SKIP_CLEANUP") == "true" {
+			t.Logf("Skipping cleanup of %s", vars["container_name"])
+			return
+		}
+		terraform.Destroy(t, options)
+	})
+	terraform.InitAndApply(t, options)
+
+	assert.Equal(t, fmt.Sprintf("http://localhost:%d/metrics", port), terraform.Output(t, options, "metrics_endpoint"))
+	waitForHTTP(t, fmt.Sprintf("http://localhost:%d/metrics", port), 200, 60*time.Second)
+}
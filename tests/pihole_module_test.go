@@ -27,6 +27,8 @@ func TestPiholeModuleGeneratesValidConfig(t *testing.T) {
 		NoColor: true,
 	})
 
+	RequireValidVars(t, terraformOptions)
+
 	// Clean up resources at the end of the test
 	defer terraform.Destroy(t, terraformOptions)
 
@@ -34,12 +36,14 @@ func TestPiholeModuleGeneratesValidConfig(t *testing.T) {
 	terraform.InitAndValidate(t, terraformOptions)
 	
 	// Act: Plan the infrastructure
-	planResult := terraform.Plan(t, terraformOptions)
+	plan := InitAndPlanJSON(t, terraformOptions)
 	
 	// Assert: Verify expected resources are planned
-	assert.Contains(t, planResult, "docker_container.pihole")
-	assert.Contains(t, planResult, "docker_network.pihole_network")
-	assert.Contains(t, planResult, "docker_volume.pihole_data")
+	plan.AssertAction("docker_container.pihole", PlanCreate)
+	plan.AssertAction("docker_network.pihole_network", PlanCreate)
+	plan.AssertAction("docker_volume.pihole_data", PlanCreate)
+	plan.AssertAttributeEquals("docker_network.pihole_network", "ipam_config.0.subnet", "172.23.0.0/16")
+	plan.AssertAttributeContains("docker_container.pihole", "env", "TZ=America/New_York")
 }
 
 // TestPiholeDockerComposeIntegration tests the Docker Compose setup
@@ -0,0 +1,281 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/exporter"
+	"github.com/yebyen/home-lab-terraform/internal/pihole"
+	"github.com/yebyen/home-lab-terraform/internal/promtext"
+)
+
+// newExporterPihole starts a fake Pi-hole serving the counters of
+// newFakePiholeStats plus clients, groups and upstreams
+func newExporterPihole(t *testing.T, password string) (*fakePihole, *fakePiholeStats) {
+	fake := newFakePihole(t, password)
+	stats := newFakePiholeStats(fake, "unused-token")
+	stats.summary.Queries.Types = map[string]int{"A": 15000, "AAAA": 6345}
+	stats.summary.Queries.Status = map[string]int{"FORWARDED": 15000, "CACHE": 4000, "GRAVITY": 2345}
+	stats.summary.Queries.Replies = map[string]int{"IP": 19000, "NXDOMAIN": 45}
+
+	fake.Handle("GET /api/stats/top_clients", func(w http.ResponseWriter, r *http.Request) {
+		clients := []pihole.TopClient{
+			{IP: "10.17.12.20", Name: "nas.lan", Count: 8021},
+			{IP: "10.17.12.100", Name: "laptop.lan", Count: 5000},
+			{IP: "10.17.14.7", Name: "", Count: 3000},
+		}
+		if r.URL.Query().Get("blocked") == "true" {
+			clients = []pihole.TopClient{
+				{IP: "10.17.12.100", Name: "laptop.lan", Count: 1200},
+				{IP: "10.17.14.7", Name: "", Count: 900},
+				{IP: "10.17.12.20", Name: "nas.lan", Count: 200},
+				{IP: "10.17.12.55", Name: "tv.lan", Count: 45},
+			}
+		}
+		writeJSON(w, 200, map[string]interface{}{"clients": clients})
+	})
+	fake.Handle("GET /api/clients", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, 200, map[string]interface{}{"clients": []pihole.ConfiguredClient{
+			{ID: 1, Client: "10.17.12.100", Name: "laptop", Groups: []int{1}},
+			{ID: 2, Client: "10.17.14.0/24", Comment: "IoT VLAN", Groups: []int{2}},
+			{ID: 3, Client: "nas.lan", Groups: []int{0, 1}},
+		}})
+	})
+	fake.Handle("GET /api/groups", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, 200, map[string]interface{}{"groups": []pihole.Group{
+			{ID: 0, Name: "Default", Enabled: true},
+			{ID: 1, Name: "work", Enabled: true},
+			{ID: 2, Name: "iot", Enabled: true},
+			{ID: 3, Name: "guests", Enabled: true},
+		}})
+	})
+	fake.Handle("GET /api/stats/upstreams", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, 200, map[string]interface{}{"upstreams": []map[string]interface{}{
+			{"ip": "blocklist", "name": "blocklist", "port": -1, "count": 2345, "statistics": map[string]float64{"response": 0, "variance": 0}},
+			{"ip": "cache", "name": "cache", "port": -1, "count": 4000, "statistics": map[string]float64{"response": 0, "variance": 0}},
+			{"ip": "10.17.12.1", "name": "router.lan", "port": 53, "count": 15000, "statistics": map[string]float64{"response": 0.0125, "variance": 0.0004}},
+		}})
+	})
+	return fake, stats
+}
+
+// TestPiholeNativeExporterOffline scrapes fake Pi-holes with the exporter
+// command's collector and checks the series it serves
+func TestPiholeNativeExporterOffline(t *testing.T) {
+	t.Parallel()
+
+	fake, stats := newExporterPihole(t, "exporter-password")
+	now := time.Unix(stats.summary.Gravity.LastUpdate, 0).Add(36 * time.Hour)
+	newExporter := func(targets ...exporter.Target) *exporter.Exporter {
+		exp := exporter.New(targets)
+		exp.Now = func() time.Time { return now }
+		return exp
+	}
+	primary := exporter.Target{Name: "primary", BaseURL: fake.URL, Password: "exporter-password"}
+
+	// scrape reads /metrics the way Prometheus would
+	scrape := func(t *testing.T, exp *exporter.Exporter) promtext.Families {
+		t.Helper()
+
+		server := httptest.NewServer(exp)
+		defer server.Close()
+		resp, err := http.Get(server.URL + "/metrics")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Contains(t, resp.Header.Get("Content-Type"), "text/plain; version=0.0.4")
+		families, err := promtext.Parse(resp.Body)
+		require.NoError(t, err, "Exporter serves invalid exposition format")
+		return families
+	}
+
+	session, err := NewPiholeSession(fake.URL, "exporter-password")
+	require.NoError(t, err)
+
+	t.Run("Summary_Contract", func(t *testing.T) {
+		families := scrape(t, newExporter(primary))
+		summary, err := session.GetSummary()
+		require.NoError(t, err)
+		blocking, err := session.GetBlocking()
+		require.NoError(t, err)
+		assert.Empty(t, exporterContractProblems(families, summary, blocking))
+
+		up, _ := families.Value("pihole_up", map[string]string{"pihole": "primary"})
+		assert.Equal(t, 1.0, up)
+		gauge, ok := families.Value("pihole_query_status", map[string]string{"status": "GRAVITY"})
+		assert.True(t, ok)
+		assert.Equal(t, 2345.0, gauge)
+		gauge, _ = families.Value("pihole_reply", map[string]string{"type": "NXDOMAIN"})
+		assert.Equal(t, 45.0, gauge)
+	})
+
+	t.Run("Per_Client_And_Group", func(t *testing.T) {
+		families := scrape(t, newExporter(primary))
+
+		queries, ok := families.Value("pihole_client_queries", map[string]string{"client": "10.17.12.20", "name": "nas.lan"})
+		assert.True(t, ok)
+		assert.Equal(t, 8021.0, queries)
+		blocked, _ := families.Value("pihole_client_blocked_queries", map[string]string{"client": "10.17.12.100"})
+		assert.Equal(t, 1200.0, blocked)
+
+		groups := make(map[string]float64)
+		for _, sample := range families["pihole_group_blocked_queries"].Samples {
+			groups[sample.Labels["group"]] = sample.Value
+		}
+		assert.Equal(t, map[string]float64{
+			"Default": 200 + 45, // nas.lan by name, tv.lan unconfigured
+			"work":    1200 + 200,
+			"iot":     900, // by subnet
+			"guests":  0,
+		}, groups)
+	})
+
+	t.Run("Upstreams_And_Gravity", func(t *testing.T) {
+		families := scrape(t, newExporter(primary))
+
+		latency, ok := families.Value("pihole_upstream_response_seconds", map[string]string{"upstream": "10.17.12.1#53"})
+		assert.True(t, ok)
+		assert.Equal(t, 0.0125, latency)
+		_, ok = families.Find("pihole_upstream_response_seconds", map[string]string{"upstream": "cache"})
+		assert.False(t, ok, "Cache has no upstream latency")
+		cached, _ := families.Value("pihole_upstream_queries", map[string]string{"upstream": "cache"})
+		assert.Equal(t, 4000.0, cached)
+
+		age, ok := families.Value("pihole_gravity_age_seconds", nil)
+		assert.True(t, ok)
+		assert.Equal(t, (36 * time.Hour).Seconds(), age)
+	})
+
+	t.Run("Tracks_Counters", func(t *testing.T) {
+		exp := newExporter(primary)
+		before, _ := scrape(t, exp).Value("pihole_dns_queries_today", nil)
+		stats.add(100, 10)
+		after, _ := scrape(t, exp).Value("pihole_dns_queries_today", nil)
+		assert.Equal(t, before+100, after)
+	})
+
+	t.Run("Multiple_Instances", func(t *testing.T) {
+		secondary, _ := newExporterPihole(t, "secondary-password")
+		families := scrape(t, newExporter(
+			primary,
+			exporter.Target{Name: "secondary", BaseURL: secondary.URL, Password: "secondary-password"},
+			exporter.Target{Name: "broken", BaseURL: secondary.URL, Password: "wrong"},
+		))
+
+		for name, want := range map[string]float64{"primary": 1, "secondary": 1, "broken": 0} {
+			up, ok := families.Value("pihole_up", map[string]string{"pihole": name})
+			assert.True(t, ok, name)
+			assert.Equal(t, want, up, name)
+		}
+		_, ok := families.Find("pihole_dns_queries_today", map[string]string{"pihole": "secondary"})
+		assert.True(t, ok)
+		_, ok = families.Find("pihole_dns_queries_today", map[string]string{"pihole": "broken"})
+		assert.False(t, ok, "A failed scrape serves no stale stats")
+	})
+
+	t.Run("Reauthenticates_After_Failure", func(t *testing.T) {
+		flaky, _ := newExporterPihole(t, "flaky-password")
+		var fail atomic.Bool
+		flaky.Handle("GET /api/dns/blocking", func(w http.ResponseWriter, r *http.Request) {
+			if fail.Load() {
+				writeJSON(w, 401, map[string]interface{}{"error": map[string]interface{}{"key": "unauthorized"}})
+				return
+			}
+			writeJSON(w, 200, map[string]interface{}{"blocking": "enabled", "timer": nil})
+		})
+		authRequests := func() int {
+			flaky.mu.Lock()
+			defer flaky.mu.Unlock()
+			count := 0
+			for _, r := range flaky.Requests {
+				if r.Method == "POST" && r.URL.Path == "/api/auth" {
+					count++
+				}
+			}
+			return count
+		}
+
+		exp := newExporter(exporter.Target{Name: "flaky", BaseURL: flaky.URL, Password: "flaky-password"})
+		scrape(t, exp)
+		scrape(t, exp)
+		assert.Equal(t, 1, authRequests(), "The session is reused between scrapes")
+
+		fail.Store(true)
+		up, _ := scrape(t, exp).Value("pihole_up", nil)
+		assert.Equal(t, 0.0, up)
+
+		fail.Store(false)
+		up, _ = scrape(t, exp).Value("pihole_up", nil)
+		assert.Equal(t, 1.0, up)
+		assert.Equal(t, 2, authRequests(), "A failed scrape drops the session")
+		assert.Equal(t, 1, flaky.LiveSessions(), "The dropped session is logged out")
+	})
+
+	t.Run("No_Leaked_Sessions", func(t *testing.T) {
+		leaky, _ := newExporterPihole(t, "leaky-password")
+		var fail atomic.Bool
+		leaky.Handle("GET /api/dns/blocking", func(w http.ResponseWriter, r *http.Request) {
+			if fail.Load() {
+				writeJSON(w, 500, map[string]interface{}{"error": map[string]interface{}{"key": "database_error"}})
+				return
+			}
+			writeJSON(w, 200, map[string]interface{}{"blocking": "enabled", "timer": nil})
+		})
+
+		exp := newExporter(exporter.Target{Name: "leaky", BaseURL: leaky.URL, Password: "leaky-password"})
+		fail.Store(true)
+		for i := 0; i < 5; i++ {
+			scrape(t, exp)
+		}
+		assert.Equal(t, 0, leaky.LiveSessions(), "Every failed scrape logs its session out")
+
+		fail.Store(false)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				exp.Collect()
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, 1, leaky.LiveSessions(), "Concurrent collections settle on one session")
+	})
+
+	t.Run("Client_Groups", func(t *testing.T) {
+		clients := []pihole.ConfiguredClient{
+			{Client: "10.0.0.0/8", Groups: []int{1}},
+			{Client: "10.17.0.0/16", Groups: []int{2}},
+			{Client: "Laptop.lan", Groups: []int{3}},
+			{Client: "10.17.12.100", Groups: []int{4}},
+			{Client: "aa:bb:cc:dd:ee:ff", Groups: []int{5}},
+			{Client: ":eth0", Groups: []int{6}},
+		}
+		assert.Equal(t, []int{4}, exporter.ClientGroups(clients, "10.17.12.100", "laptop.lan"), "Exact IP wins")
+		assert.Equal(t, []int{3}, exporter.ClientGroups(clients, "10.17.12.101", "laptop.lan"), "Then hostname")
+		assert.Equal(t, []int{2}, exporter.ClientGroups(clients, "10.17.12.102", ""), "Then the narrowest subnet")
+		assert.Equal(t, []int{1}, exporter.ClientGroups(clients, "10.1.2.3", ""))
+		assert.Equal(t, []int{0}, exporter.ClientGroups(clients, "192.168.1.1", "phone.lan"), "Else Default")
+		assert.Equal(t, []int{0}, exporter.ClientGroups(clients, "fe80::1", ""))
+	})
+
+	t.Run("Exposition_Round_Trip", func(t *testing.T) {
+		families := make(promtext.Families)
+		families.Add("odd_labels", "gauge", "Help with a \\ and\na newline", 1.5,
+			map[string]string{"quote": `say "hi"`, "path": `C:\dir`})
+		families.Add("odd_labels", "gauge", "", 2, map[string]string{"quote": "", "path": ""})
+		families.Add("no_labels_total", "counter", "", 3e9, nil)
+
+		var out strings.Builder
+		require.NoError(t, promtext.Write(&out, families))
+		parsed, err := promtext.Parse(strings.NewReader(out.String()))
+		require.NoError(t, err)
+		assert.Equal(t, families, parsed)
+	})
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/pihole"
+)
+
+// TestPiholeNetworkInventory reads the network table through the client and
+// checks the known/unknown inventory, its exports, and client bootstrapping
+func TestPiholeNetworkInventory(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakePihole(t, "inventory-test-password")
+	fake.Handle("GET /api/network/devices", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, 200, map[string]interface{}{"devices": []map[string]interface{}{
+			{
+				"id": 1, "hwaddr": "00:11:22:33:44:55", "interface": "eth0",
+				"firstSeen": 1767000000, "lastQuery": 1767225600, "numQueries": 4200,
+				"macVendor": "Dell Inc.",
+				"ips": []map[string]interface{}{{"ip": "10.17.12.100", "name": "work-laptop.lan"}},
+			},
+			{
+				"id": 2, "hwaddr": "AA:BB:CC:DD:EE:01", "interface": "eth0",
+				"firstSeen": 1767100000, "lastQuery": 1767225000, "numQueries": 12,
+				"macVendor": "Espressif Inc.",
+				"ips": []map[string]interface{}{{"ip": "10.17.13.150", "name": ""}},
+			},
+		}})
+	})
+	fake.Handle("GET /api/network/gateway", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, 200, map[string]interface{}{"gateway": []map[string]interface{}{
+			{"family": "inet", "interface": "eth0", "address": "10.17.12.249", "local": []string{"10.17.12.109"}},
+		}})
+	})
+
+	fake.Handle("GET /api/clients", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, 200, map[string]interface{}{"clients": []pihole.ConfiguredClient{
+			{ID: 1, Client: "10.17.12.100", Name: "work-laptop"},
+			{ID: 2, Client: "00:11:22:33:44:55", Name: "work-laptop"},
+			{ID: 3, Client: "10.17.13.0/24", Name: "iot"},
+		}})
+	})
+
+	session, err := NewPiholeSession(fake.URL, fake.Password)
+	require.NoError(t, err, "Should authenticate against fake Pi-hole")
+
+	devices, err := session.GetNetworkDevices()
+	require.NoError(t, err, "Should read network devices")
+	require.Len(t, devices, 2)
+	assert.Equal(t, "work-laptop.lan", devices[0].Hostname())
+
+	gateways, err := session.GetNetworkGateway()
+	require.NoError(t, err, "Should read network gateway")
+	require.Len(t, gateways, 1)
+	assert.Equal(t, "10.17.12.249", gateways[0].Address)
+
+	clients := []PiholeClient{
+		{Name: "work-laptop", IP: "10.17.12.100", MAC: "00:11:22:33:44:55"},
+		{Name: "phone-2.4ghz", IP: "10.17.13.101", MAC: "00:11:22:33:44:58"},
+	}
+	entries := pihole.BuildInventory(devices, clients)
+	require.Len(t, entries, 3, "Two seen devices plus one configured client never seen")
+
+	t.Run("Known_And_Unknown", func(t *testing.T) {
+		// Unknown devices sort first so they stand out
+		assert.False(t, entries[0].Known)
+		assert.Equal(t, "aa:bb:cc:dd:ee:01", entries[0].MAC)
+
+		assert.True(t, entries[1].Known)
+		assert.Equal(t, "work-laptop", entries[1].Client.Name)
+		assert.True(t, entries[1].Seen)
+
+		assert.True(t, entries[2].Known)
+		assert.False(t, entries[2].Seen, "phone-2.4ghz is configured but not in the network table")
+	})
+
+	t.Run("Configured_Clients", func(t *testing.T) {
+		configured, err := session.GetClients()
+		require.NoError(t, err)
+
+		// Without -clients, homelab inventory checks devices against these
+		entries := pihole.BuildInventory(devices, pihole.ClientsFromConfigured(configured))
+		require.Len(t, entries, 2, "The iot subnet names no single device")
+		assert.False(t, entries[0].Known)
+		assert.Equal(t, "aa:bb:cc:dd:ee:01", entries[0].MAC)
+		assert.True(t, entries[1].Known)
+		assert.Equal(t, "work-laptop", entries[1].Client.Name)
+	})
+
+	t.Run("Export_CSV", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, pihole.WriteInventoryCSV(&buf, entries))
+
+		rows, err := csv.NewReader(&buf).ReadAll()
+		require.NoError(t, err, "CSV export should be valid")
+		require.Len(t, rows, 4, "Header plus one row per entry")
+		assert.Equal(t, []string{"unknown", "", "aa:bb:cc:dd:ee:01", "10.17.13.150", "", "Espressif Inc.", "2025-12-31T23:50:00Z", "12"}, rows[1], "Unknown device row")
+		assert.Equal(t, "known", rows[2][0])
+		assert.Equal(t, "not-seen", rows[3][0])
+	})
+
+	t.Run("Export_JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, pihole.WriteInventoryJSON(&buf, entries))
+
+		var decoded []pihole.InventoryEntry
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded), "JSON export should round-trip")
+		assert.Equal(t, entries[1].IPs, decoded[1].IPs)
+		assert.Nil(t, decoded[2].LastQuery, "Unseen client should have no last query")
+	})
+
+	t.Run("Bootstrap_Client_Definitions", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "clients.json")
+		require.NoError(t, pihole.WriteClientsFile(path, pihole.BootstrapClients(entries)))
+
+		bootstrapped, err := pihole.ReadClientsFile(path)
+		require.NoError(t, err, "Bootstrapped file should be readable as client definitions")
+		require.Len(t, bootstrapped, 3)
+
+		assert.Equal(t, "device-aabbccddee01", bootstrapped[0].Name, "Unnamed device falls back to its MAC")
+		assert.Equal(t, "10.17.13.150", bootstrapped[0].IP)
+		assert.Contains(t, bootstrapped[0].Comment, "Espressif")
+		assert.Equal(t, clients[0], bootstrapped[1], "Known clients keep their definition")
+	})
+}
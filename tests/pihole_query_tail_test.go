@@ -0,0 +1,222 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/pihole"
+)
+
+// fakeQueryLog serves /api/queries from a growing in-memory log, honouring
+// the from, length, cursor and start parameters the way FTL does (newest
+// first). The next failures requests get a 500.
+type fakeQueryLog struct {
+	mu       sync.Mutex
+	queries  []pihole.Query
+	froms    []string
+	requests int
+	failures int
+}
+
+func (l *fakeQueryLog) add(domain, client, status string, at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.queries = append(l.queries, pihole.Query{
+		ID:     int64(len(l.queries) + 1),
+		Time:   float64(at.UnixNano()) / 1e9,
+		Type:   "A",
+		Domain: domain,
+		Status: status,
+		Client: pihole.QueryClient{IP: client},
+	})
+}
+
+func (l *fakeQueryLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	from, _ := strconv.ParseInt(r.URL.Query().Get("from"), 10, 64)
+	length, _ := strconv.Atoi(r.URL.Query().Get("length"))
+	start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+	cursor, _ := strconv.ParseInt(r.URL.Query().Get("cursor"), 10, 64)
+	l.froms = append(l.froms, r.URL.Query().Get("from"))
+	l.requests++
+	if l.failures > 0 {
+		l.failures--
+		writeJSON(w, 500, map[string]interface{}{"error": map[string]interface{}{"key": "database_error"}})
+		return
+	}
+	if cursor == 0 {
+		cursor = int64(len(l.queries))
+	}
+
+	var page []pihole.Query
+	for _, q := range l.queries {
+		if int64(q.Time) >= from && q.ID <= cursor {
+			page = append(page, q)
+		}
+	}
+	sort.Slice(page, func(i, j int) bool { return page[i].ID > page[j].ID })
+	filtered := len(page)
+	page = page[min(start, len(page)):]
+	if length > 0 && len(page) > length {
+		page = page[:length]
+	}
+	writeJSON(w, 200, pihole.QueryPage{Queries: page, Cursor: cursor, RecordsTotal: len(l.queries), RecordsFiltered: filtered})
+}
+
+// TestPiholeQueryTail checks that the query tail emits each new query exactly
+// once, in order, and applies the client, domain and status filters
+func TestPiholeQueryTail(t *testing.T) {
+	t.Parallel()
+
+	log := &fakeQueryLog{}
+	fake := newFakePihole(t, "tail-test-password")
+	fake.Handle("GET /api/queries", log.ServeHTTP)
+
+	session, err := NewPiholeSession(fake.URL, fake.Password)
+	require.NoError(t, err, "Should authenticate against fake Pi-hole")
+
+	base := time.Unix(1767225600, 0)
+	log.add("old.example.com", "10.17.12.100", "FORWARDED", base)
+
+	domains := func(queries []pihole.Query) []string {
+		var names []string
+		for _, q := range queries {
+			names = append(names, q.Domain)
+		}
+		return names
+	}
+
+	t.Run("Follows_New_Queries_Once", func(t *testing.T) {
+		tail := &pihole.QueryTail{Session: session}
+
+		queries, err := tail.Poll()
+		require.NoError(t, err)
+		assert.Empty(t, queries, "First poll only establishes the starting point")
+
+		// Same second as the baseline query, so the next poll must dedupe by ID
+		log.add("first.example.com", "10.17.12.100", "FORWARDED", base.Add(200*time.Millisecond))
+		log.add("second.example.com", "10.17.12.101", "CACHE", base.Add(1500*time.Millisecond))
+
+		queries, err = tail.Poll()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"first.example.com", "second.example.com"}, domains(queries), "New queries oldest first")
+
+		queries, err = tail.Poll()
+		require.NoError(t, err)
+		assert.Empty(t, queries, "Nothing new since the last poll")
+
+		log.mu.Lock()
+		lastFrom := log.froms[len(log.froms)-1]
+		log.mu.Unlock()
+		assert.Equal(t, strconv.FormatInt(base.Unix()+1, 10), lastFrom, "Polls resume from the newest query's second")
+	})
+
+	t.Run("Bursts_Larger_Than_A_Page", func(t *testing.T) {
+		burst := &fakeQueryLog{}
+		burstFake := newFakePihole(t, "tail-burst-password")
+		burstFake.Handle("GET /api/queries", burst.ServeHTTP)
+		burstSession, err := NewPiholeSession(burstFake.URL, burstFake.Password)
+		require.NoError(t, err)
+
+		burst.add("start.example.com", "10.17.12.100", "FORWARDED", base)
+		tail := &pihole.QueryTail{Session: burstSession, PageSize: 10}
+		queries, err := tail.Poll()
+		require.NoError(t, err)
+		require.Empty(t, queries)
+
+		var want []string
+		for i := 0; i < 25; i++ {
+			domain := "burst-" + strconv.Itoa(i) + ".example.com"
+			burst.add(domain, "10.17.12.100", "GRAVITY", base.Add(time.Duration(i)*100*time.Millisecond))
+			want = append(want, domain)
+		}
+
+		burst.mu.Lock()
+		before := burst.requests
+		burst.mu.Unlock()
+		queries, err = tail.Poll()
+		require.NoError(t, err)
+		assert.Equal(t, want, domains(queries), "Every query of the burst, oldest first")
+
+		burst.mu.Lock()
+		assert.Equal(t, 3, burst.requests-before, "25 new queries take three pages of 10")
+		burst.mu.Unlock()
+
+		queries, err = tail.Poll()
+		require.NoError(t, err)
+		assert.Empty(t, queries)
+	})
+
+	t.Run("Follow_Retries_Failed_Polls", func(t *testing.T) {
+		flaky := &fakeQueryLog{}
+		flakyFake := newFakePihole(t, "tail-flaky-password")
+		flakyFake.Handle("GET /api/queries", flaky.ServeHTTP)
+		flakySession, err := NewPiholeSession(flakyFake.URL, flakyFake.Password)
+		require.NoError(t, err)
+
+		flaky.add("before.example.com", "10.17.12.100", "FORWARDED", base)
+		flaky.add("during.example.com", "10.17.12.100", "FORWARDED", base.Add(time.Second))
+		flaky.mu.Lock()
+		flaky.failures = 2
+		flaky.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		var followed []string
+		tail := &pihole.QueryTail{Session: flakySession, Since: base, MaxFailures: 3}
+		err = tail.Follow(ctx, 10*time.Millisecond, func(q pihole.Query) error {
+			followed = append(followed, q.Domain)
+			cancel()
+			return nil
+		})
+		require.NoError(t, err, "Two failed polls in a row are retried")
+		assert.Equal(t, []string{"before.example.com", "during.example.com"}, followed)
+
+		flaky.mu.Lock()
+		flaky.failures = 3
+		flaky.mu.Unlock()
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err = tail.Follow(ctx, 10*time.Millisecond, func(q pihole.Query) error { return nil })
+		assert.ErrorContains(t, err, "giving up after 3 failed polls", "MaxFailures in a row stop the follow")
+		assert.NoError(t, ctx.Err(), "Follow should stop on its own, not at the deadline")
+	})
+
+	t.Run("Since_Includes_Backlog", func(t *testing.T) {
+		tail := &pihole.QueryTail{Session: session, Since: base}
+
+		queries, err := tail.Poll()
+		require.NoError(t, err)
+		assert.Contains(t, domains(queries), "old.example.com", "Since should replay queries already in the log")
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		log.add("ads.doubleclick.net", "10.17.12.100", "GRAVITY", base.Add(2*time.Second))
+		log.add("tracker.example.org", "10.17.12.100", "REGEX", base.Add(2*time.Second))
+		log.add("ads.doubleclick.net", "10.17.12.101", "GRAVITY", base.Add(3*time.Second))
+		log.add("github.com", "10.17.12.100", "FORWARDED", base.Add(3*time.Second))
+
+		tail := &pihole.QueryTail{
+			Session: session,
+			Since:   base.Add(2 * time.Second),
+			Filter:  pihole.QueryFilter{Client: "10.17.12.100", Statuses: []string{"blocked"}},
+		}
+		queries, err := tail.Poll()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ads.doubleclick.net", "tracker.example.org"}, domains(queries), "Blocked queries from the work laptop")
+
+		filter := pihole.QueryFilter{Domain: regexp.MustCompile(`(^|\.)doubleclick\.net$`), Statuses: []string{"gravity"}}
+		assert.True(t, filter.Match(queries[0]), "Status matching is case-insensitive")
+		assert.False(t, filter.Match(queries[1]), "Domain regex should exclude other domains")
+	})
+}
@@ -0,0 +1,25 @@
+package tests
+
+import (
+	"github.com/yebyen/home-lab-terraform/internal/pihole"
+)
+
+// The Pi-hole v6+ API client lives in internal/pihole so the homelab CLI can
+// share it. These aliases keep the test suite's existing names working.
+
+// PiholeSession represents an authenticated Pi-hole session
+type PiholeSession = pihole.Session
+
+// PiholeGroup represents a Pi-hole group configuration
+type PiholeGroup = pihole.Group
+
+// PiholeClient represents a Pi-hole client configuration
+type PiholeClient = pihole.Client
+
+// PiholeDomain represents a Pi-hole domain/regex entry
+type PiholeDomain = pihole.Domain
+
+// NewPiholeSession creates and authenticates a new Pi-hole session
+func NewPiholeSession(baseURL, password string) (*PiholeSession, error) {
+	return pihole.NewSession(baseURL, password)
+}
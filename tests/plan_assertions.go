@@ -0,0 +1,301 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// PlanAction is the kind of change planned for a resource
+type PlanAction string
+
+const (
+	PlanCreate  PlanAction = "create"
+	PlanUpdate  PlanAction = "update"
+	PlanReplace PlanAction = "replace"
+	PlanDelete  PlanAction = "delete"
+	PlanNoOp    PlanAction = "no-op"
+	PlanRead    PlanAction = "read"
+)
+
+// planT is the part of *testing.T the plan assertions need, so they can be
+// exercised against a recorder
+type planT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	FailNow()
+}
+
+// Plan is a parsed `terraform show -json` plan with typed assertions. Each
+// Assert method reports a failure on t and returns whether it passed.
+type Plan struct {
+	t       planT
+	Raw     *tfjson.Plan
+	changes map[string]*tfjson.ResourceChange
+}
+
+// InitAndPlanJSON runs init, `plan -out` to a temporary file and `show -json`
+// on it, then parses the result
+func InitAndPlanJSON(t *testing.T, options *terraform.Options) *Plan {
+	t.Helper()
+
+	planOptions := *options
+	planOptions.PlanFilePath = filepath.Join(t.TempDir(), "plan.out")
+	return ParsePlanJSON(t, []byte(terraform.InitAndPlanAndShow(t, &planOptions)))
+}
+
+// ParsePlanJSON parses the output of `terraform show -json <planfile>`
+func ParsePlanJSON(t planT, data []byte) *Plan {
+	t.Helper()
+
+	raw := &tfjson.Plan{}
+	if err := json.Unmarshal(data, raw); err != nil {
+		t.Errorf("Failed to parse plan JSON: %v", err)
+		t.FailNow()
+		return nil
+	}
+
+	plan := &Plan{t: t, Raw: raw, changes: make(map[string]*tfjson.ResourceChange)}
+	for _, change := range raw.ResourceChanges {
+		plan.changes[change.Address] = change
+	}
+	return plan
+}
+
+// Addresses returns every resource address in the plan, sorted
+func (p *Plan) Addresses() []string {
+	addresses := make([]string, 0, len(p.changes))
+	for address := range p.changes {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// Change returns the planned change for a resource address, or nil
+func (p *Plan) Change(address string) *tfjson.ResourceChange {
+	return p.changes[address]
+}
+
+// AssertResourceExists checks the plan has a change for the address
+func (p *Plan) AssertResourceExists(address string) bool {
+	p.t.Helper()
+	return p.resource(address) != nil
+}
+
+// AssertModule checks the plan has at least one resource in the module,
+// e.g. "module.primary_pihole"
+func (p *Plan) AssertModule(module string) bool {
+	p.t.Helper()
+	for _, change := range p.changes {
+		if change.ModuleAddress == module || strings.HasPrefix(change.ModuleAddress, module+".") {
+			return true
+		}
+	}
+	p.t.Errorf("Plan has no resources in %s", module)
+	return false
+}
+
+// AssertAction checks the change planned for the address
+func (p *Plan) AssertAction(address string, want PlanAction) bool {
+	p.t.Helper()
+	change := p.resource(address)
+	if change == nil {
+		return false
+	}
+	if got := actionOf(change.Change.Actions); got != want {
+		p.t.Errorf("%s: planned action is %s (%v), want %s", address, got, change.Change.Actions, want)
+		return false
+	}
+	return true
+}
+
+// AssertNoDestroys checks nothing is deleted or replaced
+func (p *Plan) AssertNoDestroys() bool {
+	p.t.Helper()
+	var destroyed []string
+	for _, address := range p.Addresses() {
+		if p.changes[address].Change.Actions.Delete() || p.changes[address].Change.Actions.Replace() {
+			destroyed = append(destroyed, fmt.Sprintf("%s (%s)", address, actionOf(p.changes[address].Change.Actions)))
+		}
+	}
+	if len(destroyed) > 0 {
+		p.t.Errorf("Plan destroys resources: %s", strings.Join(destroyed, ", "))
+		return false
+	}
+	return true
+}
+
+// AssertAttributeEquals checks a planned attribute. The path is dotted with
+// list indexes as numbers, e.g. "ports.0.external". Expected values compare
+// as JSON would decode them, except that Go ints are accepted for numbers.
+func (p *Plan) AssertAttributeEquals(address, path string, expected interface{}) bool {
+	p.t.Helper()
+	actual, ok := p.attribute(address, path)
+	if !ok {
+		return false
+	}
+	if !reflect.DeepEqual(normalizeJSON(expected), actual) {
+		p.t.Errorf("%s: %s is %#v, want %#v", address, path, actual, expected)
+		return false
+	}
+	return true
+}
+
+// AssertAttributeContains checks a planned list attribute has the element,
+// or a string attribute has the substring
+func (p *Plan) AssertAttributeContains(address, path string, element interface{}) bool {
+	p.t.Helper()
+	actual, ok := p.attribute(address, path)
+	if !ok {
+		return false
+	}
+	switch actual := actual.(type) {
+	case []interface{}:
+		want := normalizeJSON(element)
+		for _, item := range actual {
+			if reflect.DeepEqual(item, want) {
+				return true
+			}
+		}
+	case string:
+		if substring, ok := element.(string); ok && strings.Contains(actual, substring) {
+			return true
+		}
+	}
+	p.t.Errorf("%s: %s is %#v, which does not contain %#v", address, path, actual, element)
+	return false
+}
+
+// AssertSensitive checks the planned attribute at path is marked sensitive,
+// either itself or through an enclosing value
+func (p *Plan) AssertSensitive(address, path string) bool {
+	p.t.Helper()
+	change := p.resource(address)
+	if change == nil {
+		return false
+	}
+
+	marks := change.Change.AfterSensitive
+	for _, segment := range splitPath(path) {
+		if marks == true {
+			return true
+		}
+		next, ok := step(marks, segment)
+		if !ok {
+			marks = nil
+			break
+		}
+		marks = next
+	}
+	if marks == true {
+		return true
+	}
+	p.t.Errorf("%s: %s is not marked sensitive", address, path)
+	return false
+}
+
+func (p *Plan) resource(address string) *tfjson.ResourceChange {
+	p.t.Helper()
+	change, ok := p.changes[address]
+	if !ok {
+		p.t.Errorf("Plan has no resource %s (have %s)", address, strings.Join(p.Addresses(), ", "))
+		return nil
+	}
+	return change
+}
+
+// attribute navigates the planned (after) value, failing on unknowns
+func (p *Plan) attribute(address, path string) (interface{}, bool) {
+	p.t.Helper()
+	change := p.resource(address)
+	if change == nil {
+		return nil, false
+	}
+
+	value, unknown := change.Change.After, change.Change.AfterUnknown
+	for _, segment := range splitPath(path) {
+		if unknown == true {
+			break
+		}
+		next, ok := step(value, segment)
+		if !ok {
+			if u, _ := step(unknown, segment); u == true {
+				unknown = true
+				break
+			}
+			p.t.Errorf("%s: no planned attribute %s", address, path)
+			return nil, false
+		}
+		value = next
+		unknown, _ = step(unknown, segment)
+	}
+	if unknown == true {
+		p.t.Errorf("%s: %s is known only after apply", address, path)
+		return nil, false
+	}
+	return value, true
+}
+
+// step indexes a decoded JSON value by a map key or list index
+func step(value interface{}, segment string) (interface{}, bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		next, ok := value[segment]
+		return next, ok
+	case []interface{}:
+		i, err := strconv.Atoi(segment)
+		if err != nil || i < 0 || i >= len(value) {
+			return nil, false
+		}
+		return value[i], true
+	}
+	return nil, false
+}
+
+func splitPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+// actionOf names an action list the way `terraform plan` summarises it
+func actionOf(actions tfjson.Actions) PlanAction {
+	switch {
+	case actions.Replace():
+		return PlanReplace
+	case actions.Create():
+		return PlanCreate
+	case actions.Update():
+		return PlanUpdate
+	case actions.Delete():
+		return PlanDelete
+	case actions.Read():
+		return PlanRead
+	default:
+		return PlanNoOp
+	}
+}
+
+// normalizeJSON round-trips a Go value through JSON so it compares equal to
+// values decoded from the plan
+func normalizeJSON(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePlanJSON is trimmed `show -json` output for the pihole module with an
+// existing network being replaced
+const fakePlanJSON = `{
+  "format_version": "1.2",
+  "terraform_version": "1.6.6",
+  "resource_changes": [
+    {
+      "address": "module.primary_pihole.docker_container.pihole",
+      "module_address": "module.primary_pihole",
+      "mode": "managed",
+      "type": "docker_container",
+      "name": "pihole",
+      "change": {
+        "actions": ["create"],
+        "before": null,
+        "after": {
+          "name": "pihole-primary",
+          "network_mode": "bridge",
+          "env": ["TZ=America/New_York", "FTLCONF_webserver_api_password=secret", "WEB_PORT=8080"],
+          "ports": [{"internal": 53, "external": 53, "protocol": "tcp"}],
+          "image": null
+        },
+        "after_unknown": {"id": true, "image": true, "ports": [{}]},
+        "before_sensitive": false,
+        "after_sensitive": {"env": true, "ports": [{}]}
+      }
+    },
+    {
+      "address": "docker_network.dns_network",
+      "mode": "managed",
+      "type": "docker_network",
+      "name": "dns_network",
+      "change": {
+        "actions": ["delete", "create"],
+        "before": {"name": "dns-infrastructure"},
+        "after": {"name": "dns-infrastructure"},
+        "after_unknown": {"id": true},
+        "before_sensitive": {},
+        "after_sensitive": {}
+      }
+    },
+    {
+      "address": "docker_volume.pihole_shared_config",
+      "mode": "managed",
+      "type": "docker_volume",
+      "name": "pihole_shared_config",
+      "change": {
+        "actions": ["no-op"],
+        "before": {"name": "pihole-shared-blocklists"},
+        "after": {"name": "pihole-shared-blocklists"},
+        "after_unknown": {},
+        "before_sensitive": {},
+        "after_sensitive": {}
+      }
+    }
+  ]
+}`
+
+// recordingT collects assertion failures instead of failing the test
+type recordingT struct {
+	errors []string
+	failed bool
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingT) FailNow() { r.failed = true }
+
+// TestPlanAssertions exercises the plan JSON assertions against a fixture so
+// they are trustworthy before they are pointed at real plans
+func TestPlanAssertions(t *testing.T) {
+	t.Parallel()
+
+	container := "module.primary_pihole.docker_container.pihole"
+
+	t.Run("Passing_Assertions", func(t *testing.T) {
+		plan := ParsePlanJSON(t, []byte(fakePlanJSON))
+
+		plan.AssertResourceExists(container)
+		plan.AssertModule("module.primary_pihole")
+		plan.AssertAction(container, PlanCreate)
+		plan.AssertAction("docker_network.dns_network", PlanReplace)
+		plan.AssertAction("docker_volume.pihole_shared_config", PlanNoOp)
+		plan.AssertAttributeEquals(container, "name", "pihole-primary")
+		plan.AssertAttributeEquals(container, "ports.0.external", 53)
+		plan.AssertAttributeContains(container, "env", "WEB_PORT=8080")
+		plan.AssertAttributeContains(container, "network_mode", "bridge")
+		plan.AssertSensitive(container, "env")
+		plan.AssertSensitive(container, "env.1")
+	})
+
+	t.Run("Failing_Assertions", func(t *testing.T) {
+		recorder := &recordingT{}
+		plan := ParsePlanJSON(recorder, []byte(fakePlanJSON))
+
+		checks := []struct {
+			name   string
+			passed bool
+			want   string
+		}{
+			{"Missing_Resource", plan.AssertResourceExists("docker_container.missing"), "no resource docker_container.missing"},
+			{"Missing_Module", plan.AssertModule("module.secondary_pihole"), "no resources in module.secondary_pihole"},
+			{"Wrong_Action", plan.AssertAction(container, PlanUpdate), "planned action is create"},
+			{"Destroys", plan.AssertNoDestroys(), "docker_network.dns_network (replace)"},
+			{"Wrong_Value", plan.AssertAttributeEquals(container, "name", "pihole-secondary"), `name is "pihole-primary"`},
+			{"Unknown_Value", plan.AssertAttributeEquals(container, "image", "pihole/pihole:latest"), "known only after apply"},
+			{"Missing_Element", plan.AssertAttributeContains(container, "env", "TZ=UTC"), "does not contain"},
+			{"Not_Sensitive", plan.AssertSensitive(container, "name"), "name is not marked sensitive"},
+		}
+
+		require.Len(t, recorder.errors, len(checks), "Each failing assertion should report exactly once")
+		for i, check := range checks {
+			assert.False(t, check.passed, check.name)
+			assert.Contains(t, recorder.errors[i], check.want, check.name)
+		}
+	})
+
+	t.Run("Invalid_JSON", func(t *testing.T) {
+		recorder := &recordingT{}
+		assert.Nil(t, ParsePlanJSON(recorder, []byte(`{"format_version": "9.0"}`)))
+		assert.True(t, recorder.failed, "Unsupported plan format versions should fail the test")
+	})
+}
@@ -0,0 +1,232 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/pxe"
+	"github.com/yebyen/home-lab-terraform/internal/tfeval"
+	"github.com/yebyen/home-lab-terraform/internal/tfoutput"
+	"github.com/yebyen/home-lab-terraform/internal/tftp"
+)
+
+// fakeTFTP serves files read-only, each transfer from its own port as real
+// servers do. Blocks of files named in duplicate are sent twice, as when an
+// ACK is lost.
+func fakeTFTP(t *testing.T, files map[string][]byte, duplicate ...string) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, client, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			fields := bytes.Split(bytes.TrimRight(buf[2:n], "\x00"), []byte{0})
+			if binary.BigEndian.Uint16(buf) != 1 || len(fields) < 2 {
+				continue
+			}
+			name, blockSize := string(fields[0]), 512
+			for i := 2; i+1 < len(fields); i += 2 {
+				if string(fields[i]) == "blksize" {
+					blockSize, _ = strconv.Atoi(string(fields[i+1]))
+				}
+			}
+			go serveTFTP(client, files[name], name, blockSize, len(fields) > 2, slices.Contains(duplicate, name))
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func serveTFTP(client net.Addr, data []byte, name string, blockSize int, oack, duplicate bool) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if data == nil {
+		conn.WriteTo(append([]byte{0, 5, 0, 1}, "File not found\x00"...), client)
+		return
+	}
+	buf := make([]byte, 16)
+	awaitAck := func(block uint16) bool {
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return false
+			}
+			if n == 4 && binary.BigEndian.Uint16(buf) == 4 && binary.BigEndian.Uint16(buf[2:]) == block {
+				return true
+			}
+		}
+	}
+	if oack {
+		conn.WriteTo([]byte(fmt.Sprintf("\x00\x06blksize\x00%d\x00", blockSize)), client)
+		if !awaitAck(0) {
+			return
+		}
+	}
+	for block := uint16(1); ; block++ {
+		start := int(block-1) * blockSize
+		end := min(start+blockSize, len(data))
+		packet := append([]byte{0, 3, byte(block >> 8), byte(block)}, data[start:end]...)
+		conn.WriteTo(packet, client)
+		if duplicate && block == 1 {
+			conn.WriteTo(packet, client)
+		}
+		if !awaitAck(block) || end-start < blockSize {
+			return
+		}
+	}
+}
+
+// outputsFromModule evaluates root outputs offline into the document
+// `terraform output -json` would print for them
+func outputsFromModule(t *testing.T, module *tfeval.Module, names ...string) tfoutput.Outputs {
+	t.Helper()
+
+	doc := make(map[string]interface{})
+	for _, name := range names {
+		value, err := module.Output(name)
+		require.NoError(t, err)
+		goValue, err := tfeval.ToGo(value)
+		require.NoError(t, err)
+		doc[name] = map[string]interface{}{"sensitive": false, "type": "dynamic", "value": goValue}
+	}
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	outputs, err := tfoutput.Parse(data)
+	require.NoError(t, err)
+	return outputs
+}
+
+// TestPXEBootChainOffline validates the 13-net boot chain from the
+// environment's outputs against fake TFTP and matchbox servers
+func TestPXEBootChainOffline(t *testing.T) {
+	t.Parallel()
+
+	env := LoadModuleOffline(t, map[string]interface{}{"pihole_api_token": "offline-token"}, "environments", "metnoom-13net")
+	loadChain := func(t *testing.T) *pxe.Chain {
+		chain, err := pxe.FromOutputs(outputsFromModule(t, env, "pxe_boot_chain"))
+		require.NoError(t, err)
+		return chain
+	}
+
+	efi := append([]byte("MZ"), bytes.Repeat([]byte{0x90}, 4000)...)
+	kpxe := bytes.Repeat([]byte{0xeb}, 1428*2) // an exact multiple of the block size
+	tftpServer := fakeTFTP(t, map[string][]byte{"undionly.kpxe": kpxe, "ipxe.efi": efi, "grub.efi": []byte("not a PE")}, "ipxe.efi")
+	matchbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/boot.ipxe" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "#!ipxe\nchain ipxe?uuid=${uuid}&mac=${mac:hexhyp}\n")
+	}))
+	t.Cleanup(matchbox.Close)
+
+	statuses := func(hops []pxe.Hop) map[string]pxe.Status {
+		got := make(map[string]pxe.Status)
+		for _, hop := range hops {
+			got[hop.Name] = hop.Status
+		}
+		return got
+	}
+	validator := &pxe.Validator{TFTPServer: tftpServer, MatchboxURL: matchbox.URL, Timeout: time.Second}
+
+	t.Run("Environment_Chain", func(t *testing.T) {
+		chain := loadChain(t)
+		assert.Equal(t, "10.17.13.252", chain.Dnsmasq.StaticIP)
+		assert.Equal(t, "/var/lib/tftpboot", chain.Dnsmasq.TFTP.RootPath)
+		assert.Equal(t, "http://10.17.13.251:8080/boot.ipxe", chain.Matchbox.BootIPXEURL)
+		assert.Equal(t, []string{"undionly.kpxe", "ipxe.efi"}, chain.Dnsmasq.PXE.BootLoaders)
+
+		hops := validator.Validate(chain)
+		assert.Equal(t, map[string]pxe.Status{
+			"dnsmasq PXE":        pxe.OK,
+			"dnsmasq → matchbox": pxe.OK,
+			"dnsmasq TFTP":       pxe.OK,
+			"TFTP undionly.kpxe": pxe.OK,
+			"TFTP ipxe.efi":      pxe.OK,
+			"HTTP boot.ipxe":     pxe.OK,
+		}, statuses(hops), "%+v", hops)
+		assert.False(t, pxe.AnyFailed(hops))
+		assert.Equal(t, "TFTP undionly.kpxe", hops[3].Name, "Hops are reported in boot order")
+		assert.Equal(t, "2856 bytes", hops[3].Detail)
+	})
+
+	t.Run("Mismatched_Matchbox", func(t *testing.T) {
+		chain := loadChain(t)
+		chain.Dnsmasq.PXE.MatchboxPort = 8081
+		chain.Dnsmasq.PXE.BootURL = "http://10.17.13.251:8081/boot.ipxe"
+
+		hops := validator.Validate(chain)
+		assert.True(t, pxe.AnyFailed(hops))
+		assert.Equal(t, pxe.Failed, hops[1].Status)
+		assert.Contains(t, hops[1].Detail, "matchbox_port 8081 is not matchbox's port 8080")
+		assert.Contains(t, hops[1].Detail, "dnsmasq sends iPXE to http://10.17.13.251:8081/boot.ipxe")
+	})
+
+	t.Run("Bad_Boot_Loaders", func(t *testing.T) {
+		bad := *validator
+		bad.BootLoaders = []string{"missing.kpxe", "grub.efi"}
+		hops := bad.Validate(loadChain(t))
+		got := statuses(hops)
+		assert.Equal(t, pxe.Failed, got["TFTP missing.kpxe"])
+		assert.Equal(t, pxe.Failed, got["TFTP grub.efi"])
+		assert.Contains(t, hops[3].Detail, "TFTP error 1: File not found")
+		assert.Contains(t, hops[4].Detail, "not an EFI executable")
+	})
+
+	t.Run("Services_Down", func(t *testing.T) {
+		silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer silent.Close()
+
+		down := &pxe.Validator{TFTPServer: silent.LocalAddr().String(), MatchboxURL: "http://127.0.0.1:1", Timeout: 100 * time.Millisecond}
+		got := statuses(down.Validate(loadChain(t)))
+		assert.Equal(t, pxe.Failed, got["TFTP ipxe.efi"])
+		assert.Equal(t, pxe.Failed, got["HTTP boot.ipxe"])
+		assert.Equal(t, pxe.OK, got["dnsmasq → matchbox"], "Consistency does not depend on the servers")
+	})
+
+	t.Run("TFTP_And_PXE_Disabled", func(t *testing.T) {
+		chain := loadChain(t)
+		chain.Dnsmasq.TFTP = nil
+		chain.Dnsmasq.PXE = nil
+		got := statuses(validator.Validate(chain))
+		assert.Equal(t, pxe.Failed, got["dnsmasq PXE"])
+		assert.Equal(t, pxe.Skipped, got["dnsmasq → matchbox"])
+		assert.Equal(t, pxe.Failed, got["dnsmasq TFTP"])
+		assert.NotContains(t, got, "TFTP ipxe.efi", "No client-arch rules, so no boot loaders to fetch")
+
+		chain = loadChain(t)
+		chain.Dnsmasq.TFTP = nil
+		got = statuses(validator.Validate(chain))
+		assert.Equal(t, pxe.Skipped, got["TFTP ipxe.efi"])
+	})
+
+	t.Run("TFTP_Without_Options", func(t *testing.T) {
+		client := &tftp.Client{Server: tftpServer, Timeout: time.Second}
+		data, err := client.Get("ipxe.efi")
+		require.NoError(t, err)
+		assert.Equal(t, efi, data, "512-byte blocks, with a duplicate block")
+	})
+}
@@ -0,0 +1,198 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/registry"
+	"github.com/yebyen/home-lab-terraform/internal/tfoutput"
+)
+
+// registryAccessLog is `docker logs` output from a registry:2 cache, with
+// application log lines mixed in among the access log
+const registryAccessLog = `time="2026-09-01T08:00:00Z" level=info msg="listening on [::]:5000"
+172.17.0.1 - - [01/Sep/2026:08:00:05 +0000] "GET /v2/ HTTP/1.1" 200 2 "" "containerd/1.7"
+172.17.0.1 - - [01/Sep/2026:08:00:06 +0000] "HEAD /v2/library/alpine/manifests/3.19 HTTP/1.1" 200 1638 "" "containerd/1.7"
+172.17.0.1 - - [02/Sep/2026:09:30:00 +0000] "GET /v2/library/busybox/manifests/latest HTTP/1.1" 200 528 "" "docker/24.0.7"
+172.17.0.1 - - [10/Oct/2026:12:00:00 +0000] "GET /v2/library/alpine/manifests/sha256:0123 HTTP/1.1" 200 1638 "" "containerd/1.7"
+172.17.0.1 - - [11/Oct/2026:12:00:00 +0000] "GET /v2/library/nginx/manifests/1.27 HTTP/1.1" 404 96 "" "docker/24.0.7"
+time="2026-10-11T12:00:00Z" level=error msg="response completed with error" err.code="manifest unknown"
+`
+
+// TestRegistryCacheInspection covers the catalog walk, access log parsing and
+// pruning decisions behind `homelab registry`
+func TestRegistryCacheInspection(t *testing.T) {
+	t.Parallel()
+
+	// pushImages fills a fake registry: alpine has two tags of one image,
+	// busybox shares nothing and mirror re-uses alpine's blobs
+	pushImages := func(t *testing.T, fake *fakeRegistry) (alpine, busybox *registry.Image) {
+		client := registry.NewClient(fake.URL)
+		var err error
+		alpine, err = registry.NewImage(map[string]string{"etc/alpine-release": "3.19.1"})
+		require.NoError(t, err)
+		busybox, err = registry.NewImage(map[string]string{"bin/busybox": strings.Repeat("b", 4096)})
+		require.NoError(t, err)
+
+		for _, push := range []struct {
+			repository, tag string
+			image           *registry.Image
+		}{
+			{"library/alpine", "3.19", alpine},
+			{"library/alpine", "latest", alpine},
+			{"library/busybox", "latest", busybox},
+			{"mirror/alpine", "3.19", alpine},
+		} {
+			_, err := client.Push(push.repository, push.tag, push.image)
+			require.NoError(t, err)
+		}
+		return alpine, busybox
+	}
+	imageSize := func(image *registry.Image) int64 {
+		return int64(len(image.Config) + len(image.Layer))
+	}
+
+	t.Run("Inspect_Counts_And_Sizes", func(t *testing.T) {
+		fake := newFakeRegistry(t)
+		alpine, busybox := pushImages(t, fake)
+
+		usage, err := registry.NewClient(fake.URL).Inspect()
+		require.NoError(t, err)
+		require.Len(t, usage.Repositories, 3)
+		assert.Equal(t, 4, usage.Tags())
+
+		repositories := make(map[string]*registry.RepositoryUsage)
+		for _, repository := range usage.Repositories {
+			repositories[repository.Repository] = repository
+		}
+		assert.Equal(t, []string{"3.19", "latest"}, repositories["library/alpine"].Tags)
+		assert.Equal(t, imageSize(alpine), repositories["library/alpine"].Size(), "Tags of one image count its blobs once")
+		assert.Equal(t, imageSize(busybox), repositories["library/busybox"].Size())
+		assert.Equal(t, imageSize(alpine)+imageSize(busybox), usage.Size(), "Blobs shared across repositories count once")
+
+		rest := usage.Without([]*registry.RepositoryUsage{repositories["library/alpine"]})
+		assert.Equal(t, usage.Size(), rest.Size(), "mirror/alpine still holds alpine's blobs")
+	})
+
+	t.Run("Catalog_Pagination", func(t *testing.T) {
+		fake := newFakeRegistry(t)
+		fake.PageSize = 2
+		client := registry.NewClient(fake.URL)
+		image, err := registry.NewImage(map[string]string{"hello": "world"})
+		require.NoError(t, err)
+
+		var want []string
+		for i := 0; i < 5; i++ {
+			repository := fmt.Sprintf("paged/repo%d", i)
+			want = append(want, repository)
+			_, err := client.Push(repository, "v1", image)
+			require.NoError(t, err)
+		}
+
+		repositories, err := client.Catalog()
+		require.NoError(t, err)
+		assert.Equal(t, want, repositories)
+	})
+
+	t.Run("Access_Log", func(t *testing.T) {
+		pulls, err := registry.ParseAccessLog(strings.NewReader(registryAccessLog))
+		require.NoError(t, err)
+
+		assert.Equal(t, time.Date(2026, 9, 1, 8, 0, 6, 0, time.UTC), pulls.Oldest.UTC(), "Only manifest requests bound the log")
+		assert.Equal(t, time.Date(2026, 10, 11, 12, 0, 0, 0, time.UTC), pulls.Newest.UTC())
+		assert.Equal(t, time.Date(2026, 10, 10, 12, 0, 0, 0, time.UTC), pulls.Last["library/alpine"].UTC(), "Pulls by digest count")
+		assert.Equal(t, time.Date(2026, 9, 2, 9, 30, 0, 0, time.UTC), pulls.Last["library/busybox"].UTC())
+		assert.NotContains(t, pulls.Last, "library/nginx", "Failed pulls do not count")
+	})
+
+	t.Run("Stale_Repositories", func(t *testing.T) {
+		fake := newFakeRegistry(t)
+		pushImages(t, fake)
+		usage, err := registry.NewClient(fake.URL).Inspect()
+		require.NoError(t, err)
+		pulls, err := registry.ParseAccessLog(strings.NewReader(registryAccessLog))
+		require.NoError(t, err)
+
+		stale, err := pulls.Stale(usage, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC))
+		require.NoError(t, err)
+		var names []string
+		for _, repository := range stale {
+			names = append(names, repository.Repository)
+		}
+		assert.Equal(t, []string{"library/busybox", "mirror/alpine"}, names, "Pulled before the cutoff or never")
+
+		_, err = pulls.Stale(usage, time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC))
+		assert.ErrorContains(t, err, "only goes back to 2026-09-01", "A cutoff before the log starts cannot be trusted")
+
+		// Inspecting fetches every manifest, which must not count as a pull
+		inspected, err := registry.ParseAccessLog(strings.NewReader(registryAccessLog + fake.AccessLog()))
+		require.NoError(t, err)
+		assert.Contains(t, fake.AccessLog(), `"GET /v2/library/busybox/manifests/latest HTTP/1.1" 200`)
+		assert.Equal(t, pulls.Last, inspected.Last)
+		stale, err = inspected.Stale(usage, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC))
+		require.NoError(t, err)
+		require.Len(t, stale, 2)
+		assert.Equal(t, "library/busybox", stale[0].Repository, "An inspected repository is still stale")
+
+		pulled, err := registry.ParseAccessLog(strings.NewReader(strings.ReplaceAll(fake.AccessLog(), registry.UserAgent, "docker/24.0.7")))
+		require.NoError(t, err)
+		assert.Contains(t, pulled.Last, "library/busybox", "Other clients' manifest requests are pulls")
+
+		empty, err := registry.ParseAccessLog(strings.NewReader(""))
+		require.NoError(t, err)
+		_, err = empty.Stale(usage, time.Now())
+		assert.Error(t, err)
+	})
+
+	t.Run("Delete_Repository", func(t *testing.T) {
+		fake := newFakeRegistry(t)
+		pushImages(t, fake)
+		client := registry.NewClient(fake.URL)
+		alpine, err := client.RepositoryUsage("library/alpine")
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, client.DeleteRepository(alpine), registry.ErrDeleteUnsupported, "Pull-through caches refuse deletes")
+
+		fake.DeleteEnabled = true
+		require.NoError(t, client.DeleteRepository(alpine))
+		repositories, err := client.Catalog()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"library/busybox", "mirror/alpine"}, repositories)
+	})
+
+	t.Run("Caches_From_Outputs", func(t *testing.T) {
+		// registry-caches exports "upstream", metnoom-13net the module's
+		// cache_summary with "upstream_url"; both add "upstream_registry"
+		for name, document := range map[string]string{
+			"Registry_Caches": `{"registry_caches": {"sensitive": false, "type": "object", "value": {
+				"docker_hub": {"endpoint": "localhost:5050", "container_id": "abc", "upstream": "https://registry-1.docker.io", "upstream_registry": "docker.io"},
+				"quay": {"endpoint": "localhost:5052", "container_id": "def", "upstream": "https://quay.io", "upstream_registry": "quay.io"}}}}`,
+			"Metnoom_13net": `{"registry_caches": {"sensitive": false, "type": "object", "value": {
+				"docker_hub": {"registry_name": "docker.io", "cache_port": 5050, "endpoint": "localhost:5050", "container_id": "abc", "upstream_url": "https://registry-1.docker.io", "volume": "registry-docker.io-cache", "upstream_registry": "docker.io"},
+				"quay": {"registry_name": "quay.io", "cache_port": 5052, "endpoint": "localhost:5052", "container_id": "def", "upstream_url": "https://quay.io", "volume": "registry-quay.io-cache", "upstream_registry": "quay.io"}}}}`,
+		} {
+			outputs, err := tfoutput.Parse([]byte(document))
+			require.NoError(t, err, name)
+			caches, err := registry.CachesFromOutputs(outputs)
+			require.NoError(t, err, name)
+			require.Len(t, caches, 2, name)
+
+			assert.Equal(t, registry.Cache{Name: "docker_hub", Endpoint: "localhost:5050", ContainerID: "abc", Upstream: "https://registry-1.docker.io", Registry: "docker.io"}, caches[0], name)
+			assert.Equal(t, "http://localhost:5052", caches[1].URL(), name)
+			assert.Equal(t, "quay.io", caches[1].Registry, name)
+		}
+	})
+
+	t.Run("Repository_Names", func(t *testing.T) {
+		for _, name := range []string{"library/alpine", "siderolabs/installer", "a/b-c/d__e.f"} {
+			assert.True(t, registry.ValidRepositoryName(name), name)
+		}
+		for _, name := range []string{"../etc", "library/../../", "Library/Alpine", "/abs", "a//b", ""} {
+			assert.False(t, registry.ValidRepositoryName(name), name)
+		}
+	})
+}
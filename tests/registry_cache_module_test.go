@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/tfeval"
+)
+
+// registryUpstreams are the upstreams registry-cache knows without an
+// explicit upstream_url
+var registryUpstreams = map[string]string{
+	"docker.io":       "https://registry-1.docker.io",
+	"registry.k8s.io": "https://registry.k8s.io",
+	"quay.io":         "https://quay.io",
+	"gcr.io":          "https://gcr.io",
+	"ghcr.io":         "https://ghcr.io",
+}
+
+// TestRegistryCacheModuleVariableCombinations checks each supported registry
+// with and without the optional network
+func TestRegistryCacheModuleVariableCombinations(t *testing.T) {
+	t.Parallel()
+
+	for registry, upstream := range registryUpstreams {
+		for _, createNetwork := range []bool{false, true} {
+			registry, upstream, createNetwork := registry, upstream, createNetwork
+			t.Run(fmt.Sprintf("%s_Network_%s", registry, onOff(createNetwork)), func(t *testing.T) {
+				t.Parallel()
+
+				module := LoadModuleOffline(t, map[string]interface{}{
+					"registry_name":  registry,
+					"cache_port":     5050,
+					"create_network": createNetwork,
+					"network_name":   "registry-cache-test",
+				}, "modules", "registry-cache")
+
+				count, err := RequireResource(t, module, "docker_network.registry_network").Count()
+				require.NoError(t, err)
+				assert.Equal(t, map[bool]int{false: 0, true: 1}[createNetwork], count)
+
+				container := RequireResource(t, module, "docker_container.registry_cache")
+				env, err := container.Strings("env")
+				require.NoError(t, err)
+				assert.Contains(t, env, "REGISTRY_PROXY_REMOTEURL="+upstream)
+
+				networks, err := container.Blocks("networks_advanced")
+				if createNetwork {
+					assert.Error(t, err, "The attachment references the counted network, known after apply")
+				} else {
+					require.NoError(t, err)
+					assert.Empty(t, networks)
+				}
+
+				networkID, err := module.Output("network_id")
+				require.NoError(t, err)
+				assert.Equal(t, !createNetwork, networkID.IsNull(), "network_id is null without create_network")
+
+				summary, err := module.Output("cache_summary")
+				require.NoError(t, err)
+				assert.Equal(t, "localhost:5050", summary.GetAttr("endpoint").AsString())
+				assert.Equal(t, upstream, summary.GetAttr("upstream_url").AsString())
+				assert.False(t, summary.GetAttr("container_id").IsKnown(), "container_id is known after apply")
+			})
+		}
+	}
+
+	t.Run("Rejected_Values", func(t *testing.T) {
+		t.Parallel()
+
+		for name, vars := range map[string]map[string]interface{}{
+			"Unknown_Registry": {"registry_name": "public.ecr.aws", "cache_port": 5050},
+			"Privileged_Port":  {"registry_name": "docker.io", "cache_port": 443},
+		} {
+			_, err := tfeval.Load("../terraform/modules/registry-cache", vars)
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+// TestRegistryCacheModulePlan plans a cache with its own network
+func TestRegistryCacheModulePlan(t *testing.T) {
+	t.Parallel()
+
+	plan := PlanModule(t, map[string]interface{}{
+		"registry_name":  "ghcr.io",
+		"cache_port":     5054,
+		"create_network": true,
+		"network_name":   "registry-cache-plan",
+		"network_subnet": "172.31.54.0/24",
+	}, "modules", "registry-cache")
+
+	container := "docker_container.registry_cache"
+	plan.AssertAction(container, PlanCreate)
+	plan.AssertAction("docker_volume.registry_cache", PlanCreate)
+	plan.AssertAction("docker_network.registry_network[0]", PlanCreate)
+	plan.AssertAttributeEquals("docker_network.registry_network[0]", "ipam_config.0.subnet", "172.31.54.0/24")
+	plan.AssertAttributeEquals(container, "name", "registry-ghcr.io")
+	plan.AssertAttributeEquals(container, "ports.0.external", 5054)
+	plan.AssertAttributeContains(container, "env", "REGISTRY_PROXY_REMOTEURL=https://ghcr.io")
+	plan.AssertAttributeEquals(container, "networks_advanced.0.name", "registry-cache-plan")
+}
+
+// TestRegistryCacheModuleApply deploys a cache on a free port and checks the
+// registry API answers. Container names are fixed per registry, so it is
+// skipped when a gcr.io cache is already running on this host.
+func TestRegistryCacheModuleApply(t *testing.T) {
+	RequireDocker(t)
+	if dockerContainerExists("registry-gcr.io") {
+		t.Skip("registry-gcr.io already exists on this host")
+	}
+
+	port := allocatePort(t, false)
+	options := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: "../terraform/modules/registry-cache",
+		Vars: map[string]interface{}{
+			"registry_name": "gcr.io",
+			"cache_port":    port,
+		},
+		NoColor: true,
+	})
+	RequireValidVars(t, options)
+	RequireTerraform(t, options)
+
+	t.Cleanup(func() {
+		if os.Getenv("SKIP_CLEANUP") == "true" {
+			t.Log("Skipping cleanup of registry-gcr.io")
+			return
+		}
+		terraform.Destroy(t, options)
+	})
+	terraform.InitAndApply(t, options)
+
+	assert.Equal(t, fmt.Sprintf("localhost:%d", port), terraform.Output(t, options, "cache_endpoint"))
+	assert.Equal(t, "https://gcr.io", terraform.Output(t, options, "upstream_url"))
+	waitForHTTP(t, fmt.Sprintf("http://localhost:%d/v2/", port), 200, 60*time.Second)
+}
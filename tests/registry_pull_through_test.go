@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/registry"
+)
+
+// TestRegistryClientRoundTrip pushes a generated image to a fake registry
+// and pulls it back by tag and by digest
+func TestRegistryClientRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeRegistry(t)
+	client := registry.NewClient(fake.URL)
+	require.NoError(t, client.Ping())
+
+	image, err := registry.NewImage(map[string]string{"etc/homelab": "round-trip"})
+	require.NoError(t, err)
+	digest, err := client.Push("homelab/test", "v1", image)
+	require.NoError(t, err)
+
+	manifest, got, err := client.GetManifest("homelab/test", "v1")
+	require.NoError(t, err)
+	assert.Equal(t, digest, got)
+	assert.Equal(t, image.Manifest, manifest)
+
+	_, got, err = client.GetManifest("homelab/test", digest)
+	require.NoError(t, err)
+	assert.Equal(t, digest, got)
+
+	layer, err := client.GetBlob("homelab/test", manifest.Layers[0].Digest)
+	require.NoError(t, err)
+	assert.Equal(t, image.Layer, layer)
+
+	_, err = client.GetBlob("homelab/test", registry.Digest([]byte("missing")))
+	var statusErr *registry.StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, 404, statusErr.StatusCode)
+}
+
+// TestRegistryCachePullThrough points a registry-cache at a local registry:2
+// upstream on a shared network, pulls a generated image through the cache and
+// checks it is still served from the cache volume once the upstream is gone
+func TestRegistryCachePullThrough(t *testing.T) {
+	RequireDocker(t)
+	// The cache container is named after registry_name, so use one that the
+	// home lab hosts are unlikely to be running
+	cacheContainer := "registry-quay.io"
+	if dockerContainerExists(cacheContainer) {
+		t.Skipf("%s already exists on this host", cacheContainer)
+	}
+
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano()%100000)
+	networkName := "registry-pull-through-" + suffix
+	upstreamName := "registry-upstream-" + suffix
+	upstreamPort := allocatePort(t, false)
+	cachePort := allocatePort(t, false)
+
+	options := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: "../terraform/modules/registry-cache",
+		Vars: map[string]interface{}{
+			"registry_name":  "quay.io",
+			"cache_port":     cachePort,
+			"upstream_url":   fmt.Sprintf("http://%s:5000", upstreamName),
+			"create_network": true,
+			"network_name":   networkName,
+			"network_subnet": allocateSubnet(),
+		},
+		NoColor: true,
+	})
+	RequireValidVars(t, options)
+	RequireTerraform(t, options)
+
+	// Cleanups run last-in first-out, so the upstream leaves the network
+	// before terraform destroys it
+	t.Cleanup(func() {
+		if os.Getenv("SKIP_CLEANUP") == "true" {
+			t.Logf("Skipping cleanup of %s", cacheContainer)
+			return
+		}
+		terraform.Destroy(t, options)
+	})
+	terraform.InitAndApply(t, options)
+
+	t.Cleanup(func() {
+		if os.Getenv("SKIP_CLEANUP") != "true" {
+			runDocker(t, "rm", "-f", upstreamName)
+		}
+	})
+	runDocker(t, "run", "-d", "--name", upstreamName, "--network", networkName,
+		"-p", fmt.Sprintf("%d:5000", upstreamPort), "registry:2")
+
+	upstream := registry.NewClient(fmt.Sprintf("http://localhost:%d", upstreamPort))
+	cache := registry.NewClient(fmt.Sprintf("http://localhost:%d", cachePort))
+	waitForHTTP(t, upstream.BaseURL+"/v2/", 200, 60*time.Second)
+	waitForHTTP(t, cache.BaseURL+"/v2/", 200, 60*time.Second)
+
+	repository := "homelab/pull-through"
+	image, err := registry.NewImage(map[string]string{"etc/pull-through": suffix})
+	require.NoError(t, err)
+	digest, err := upstream.Push(repository, "v1", image)
+	require.NoError(t, err)
+
+	var manifest *registry.Manifest
+	t.Run("Pull_Through_Cache", func(t *testing.T) {
+		var got string
+		manifest, got, err = cache.GetManifest(repository, "v1")
+		require.NoError(t, err)
+		assert.Equal(t, digest, got, "Cache serves the upstream manifest")
+
+		for _, desc := range append([]registry.Descriptor{manifest.Config}, manifest.Layers...) {
+			_, err := cache.GetBlob(repository, desc.Digest)
+			require.NoError(t, err, desc.Digest)
+		}
+	})
+	require.NotNil(t, manifest, "Pull through the cache failed")
+
+	runDocker(t, "stop", upstreamName)
+	require.Error(t, upstream.Ping(), "Upstream should be down")
+
+	t.Run("Served_From_Cache_Volume", func(t *testing.T) {
+		_, got, err := cache.GetManifest(repository, digest)
+		require.NoError(t, err)
+		assert.Equal(t, digest, got)
+
+		layer, err := cache.GetBlob(repository, manifest.Layers[0].Digest)
+		require.NoError(t, err)
+		assert.Equal(t, image.Layer, layer)
+
+		// The blob must be on the cache's volume, not just in memory
+		hex := strings.TrimPrefix(manifest.Layers[0].Digest, "sha256:")
+		runDocker(t, "exec", cacheContainer, "test", "-f",
+			fmt.Sprintf("/var/lib/registry/docker/registry/v2/blobs/sha256/%s/%s/data", hex[:2], hex))
+	})
+}
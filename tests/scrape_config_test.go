@@ -0,0 +1,248 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/filetree"
+	"github.com/yebyen/home-lab-terraform/internal/scrape"
+	"github.com/yebyen/home-lab-terraform/internal/tfeval"
+	"github.com/yebyen/home-lab-terraform/internal/tfoutput"
+	"gopkg.in/yaml.v3"
+)
+
+// scrapeEnvironments are the environments with saved prometheus_targets
+// outputs and the variables they need to evaluate offline
+var scrapeEnvironments = map[string]map[string]interface{}{
+	"metnoom-13net":   {"pihole_api_token": "unused"},
+	"registry-caches": nil,
+	"test":            nil,
+}
+
+// TestScrapeConfigOffline renders Prometheus configuration from saved
+// environment outputs and compares it with testdata/scrape/golden
+func TestScrapeConfigOffline(t *testing.T) {
+	t.Parallel()
+
+	var targets []scrape.Target
+	for env := range scrapeEnvironments {
+		data, err := os.ReadFile(filepath.Join("testdata", "scrape", "outputs", env+".json"))
+		require.NoError(t, err)
+		outputs, err := tfoutput.Parse(data)
+		require.NoError(t, err)
+		found, err := scrape.FromOutputs(env, outputs)
+		require.NoError(t, err)
+		targets = append(targets, found...)
+	}
+	require.Len(t, targets, 14, "The exporter, matchbox and ten caches, plus the test Pi-holes")
+
+	t.Run("Fixtures_Match_Environments", func(t *testing.T) {
+		for env, vars := range scrapeEnvironments {
+			data, err := os.ReadFile(filepath.Join("testdata", "scrape", "outputs", env+".json"))
+			require.NoError(t, err)
+			outputs, err := tfoutput.Parse(data)
+			require.NoError(t, err)
+			var saved []interface{}
+			require.NoError(t, outputs.Decode("prometheus_targets", &saved))
+
+			value, err := LoadModuleOffline(t, vars, "environments", env).Output("prometheus_targets")
+			require.NoError(t, err)
+			declared, err := tfeval.ToGo(value)
+			require.NoError(t, err)
+			assert.Equal(t, declared, saved, env)
+		}
+	})
+
+	localized, err := scrape.Localize(targets, "10.17.13.10")
+	require.NoError(t, err)
+	files, err := scrape.Files(localized, scrape.Options{SDDir: "/etc/prometheus/file_sd", Blackbox: "10.17.13.10:9115"})
+	require.NoError(t, err)
+
+	golden := filepath.Join("testdata", "scrape", "golden")
+	if *updateGolden {
+		require.NoError(t, os.RemoveAll(golden))
+		require.NoError(t, filetree.Write(golden, files))
+	}
+
+	t.Run("Golden_Files", func(t *testing.T) {
+		assertGoldenDir(t, golden, files)
+	})
+
+	t.Run("Scrape_Configs", func(t *testing.T) {
+		var config struct {
+			ScrapeConfigs []struct {
+				JobName        string              `yaml:"job_name"`
+				ScrapeInterval string              `yaml:"scrape_interval"`
+				MetricsPath    string              `yaml:"metrics_path"`
+				Params         map[string][]string `yaml:"params"`
+				FileSDConfigs  []struct {
+					Files []string `yaml:"files"`
+				} `yaml:"file_sd_configs"`
+				RelabelConfigs []map[string]interface{} `yaml:"relabel_configs"`
+			} `yaml:"scrape_configs"`
+		}
+		require.NoError(t, yaml.Unmarshal(files["scrape-configs.yml"], &config))
+
+		jobs := make(map[string]int)
+		for i, job := range config.ScrapeConfigs {
+			jobs[job.JobName] = i
+			require.Len(t, job.FileSDConfigs, 1)
+			assert.Equal(t, []string{"/etc/prometheus/file_sd/" + job.JobName + ".json"}, job.FileSDConfigs[0].Files)
+			assert.Contains(t, files, "file_sd/"+job.JobName+".json")
+		}
+		require.Len(t, jobs, 4)
+
+		exporter := config.ScrapeConfigs[jobs["pihole-exporter"]]
+		assert.Equal(t, "10s", exporter.ScrapeInterval)
+		assert.Empty(t, exporter.RelabelConfigs)
+
+		matchbox := config.ScrapeConfigs[jobs["matchbox"]]
+		assert.Equal(t, "/probe", matchbox.MetricsPath)
+		assert.Equal(t, map[string][]string{"module": {"http_2xx"}}, matchbox.Params)
+		assert.Equal(t, "10.17.13.10:9115", matchbox.RelabelConfigs[2]["replacement"], "Probes are scraped from the blackbox exporter")
+
+		pihole := config.ScrapeConfigs[jobs["pihole"]]
+		assert.Equal(t, map[string][]string{"module": {"http_2xx"}}, pihole.Params)
+	})
+
+	t.Run("Every_Module_Exports_A_Target", func(t *testing.T) {
+		for env, vars := range scrapeEnvironments {
+			value, err := LoadModuleOffline(t, vars, "environments", env).Output("prometheus_targets")
+			require.NoError(t, err)
+			declared, err := tfeval.ToGo(value)
+			require.NoError(t, err)
+			for i, target := range declared.([]interface{}) {
+				assert.NotNil(t, target, "%s: prometheus_targets[%d] is null and would be dropped", env, i)
+			}
+		}
+
+		caches := make(map[string][]string)
+		for _, target := range localized {
+			if target.Job == "registry-cache" && target.Labels["env"] == "metnoom-13net" {
+				caches[target.Labels["registry_name"]] = target.Targets
+			}
+		}
+		assert.Equal(t, map[string][]string{
+			"docker.io":       {"10.17.13.10:5060"},
+			"registry.k8s.io": {"10.17.13.10:5061"},
+			"quay.io":         {"10.17.13.10:5062"},
+			"gcr.io":          {"10.17.13.10:5063"},
+			"ghcr.io":         {"10.17.13.10:5064"},
+		}, caches)
+
+		var piholes []string
+		for _, target := range localized {
+			if target.Job == "pihole" {
+				assert.Equal(t, "test", target.Labels["env"])
+				piholes = append(piholes, target.Labels["role"]+" "+target.Targets[0])
+			}
+		}
+		assert.ElementsMatch(t, []string{
+			"primary http://10.17.13.10:8080/admin/",
+			"secondary http://10.17.13.10:8081/admin/",
+		}, piholes)
+	})
+
+	t.Run("Tags_Become_Labels", func(t *testing.T) {
+		for _, target := range localized {
+			if target.Job != "registry-cache" || target.Labels["env"] != "registry-caches" || target.Labels["registry_name"] != "docker.io" {
+				continue
+			}
+			assert.Equal(t, map[string]string{
+				"env":           "registry-caches",
+				"environment":   "production",
+				"purpose":       "container-registry-cache",
+				"registry":      "docker-hub",
+				"registry_name": "docker.io",
+			}, target.Labels)
+			assert.Equal(t, []string{"10.17.13.10:5060"}, target.Targets)
+			return
+		}
+		t.Fatal("No docker.io cache target")
+	})
+
+	t.Run("Localize", func(t *testing.T) {
+		localized, err := scrape.Localize([]scrape.Target{{
+			Job:     "mixed",
+			Targets: []string{"localhost:9617", "127.0.0.1:5060", "10.17.12.109:9617", "http://localhost:8080/boot.ipxe", "http://10.17.13.251:8080/boot.ipxe"},
+		}}, "nas.lan")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"nas.lan:9617", "nas.lan:5060", "10.17.12.109:9617", "http://nas.lan:8080/boot.ipxe", "http://10.17.13.251:8080/boot.ipxe"}, localized[0].Targets)
+
+		_, err = scrape.Localize([]scrape.Target{{Job: "broken", Targets: []string{"localhost"}}}, "nas.lan")
+		assert.Error(t, err, "Targets need a port")
+	})
+
+	t.Run("Label_Names", func(t *testing.T) {
+		for tag, want := range map[string]string{
+			"Environment": "environment",
+			"cost-center": "cost_center",
+			"Team Name":   "team_name",
+			"2fa":         "_2fa",
+		} {
+			assert.Equal(t, want, scrape.LabelName(tag), tag)
+		}
+	})
+
+	t.Run("Rejected_Targets", func(t *testing.T) {
+		_, err := scrape.Files([]scrape.Target{
+			{Job: "pihole-exporter", Targets: []string{"a:9617"}, MetricsPath: "/metrics", ScrapeInterval: "10s"},
+			{Job: "pihole-exporter", Targets: []string{"b:9617"}, MetricsPath: "/metrics", ScrapeInterval: "1m"},
+		}, scrape.Options{})
+		assert.ErrorContains(t, err, "disagree on scrape_interval")
+
+		outputs, err := tfoutput.Parse([]byte(`{"prometheus_targets": {"value": [
+			{"job": "registry-cache", "targets": ["localhost:5060"], "labels": {"Env": "prod"}}
+		]}}`))
+		require.NoError(t, err)
+		_, err = scrape.FromOutputs("registry-caches", outputs)
+		assert.ErrorContains(t, err, `collides with label "env"`)
+	})
+
+	t.Run("Environment_Without_Targets", func(t *testing.T) {
+		found, err := scrape.FromOutputs("staging", tfoutput.Outputs{})
+		require.NoError(t, err)
+		assert.Empty(t, found)
+	})
+
+	t.Run("Registry_Cache_Debug_Port", func(t *testing.T) {
+		for _, debugPort := range []interface{}{nil, 5060} {
+			vars := map[string]interface{}{"registry_name": "quay.io", "cache_port": 5052}
+			if debugPort != nil {
+				vars["debug_port"] = debugPort
+			}
+			module := LoadModuleOffline(t, vars, "modules", "registry-cache")
+			container := RequireResource(t, module, "docker_container.registry_cache")
+			env, err := container.Strings("env")
+			require.NoError(t, err)
+			ports, err := container.Blocks("ports")
+			require.NoError(t, err)
+			target, err := module.Output("prometheus_target")
+			require.NoError(t, err)
+
+			if debugPort == nil {
+				assert.NotContains(t, env, "REGISTRY_HTTP_DEBUG_ADDR=0.0.0.0:5001")
+				assert.Len(t, ports, 1)
+				assert.True(t, target.IsNull(), "No metrics without a debug port")
+				continue
+			}
+			assert.Contains(t, env, "REGISTRY_HTTP_DEBUG_ADDR=0.0.0.0:5001")
+			assert.Contains(t, env, "REGISTRY_HTTP_DEBUG_PROMETHEUS_ENABLED=true")
+			require.Len(t, ports, 2)
+			external, err := ports[1].Int("external")
+			require.NoError(t, err)
+			assert.Equal(t, 5060, external)
+			endpoint, err := module.Output("metrics_endpoint")
+			require.NoError(t, err)
+			assert.Equal(t, "http://localhost:5060/metrics", endpoint.AsString())
+		}
+
+		_, err := tfeval.Load("../terraform/modules/registry-cache", map[string]interface{}{
+			"registry_name": "quay.io", "cache_port": 5052, "debug_port": 80,
+		})
+		assert.Error(t, err, "Privileged debug port")
+	})
+}
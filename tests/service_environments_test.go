@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yebyen/home-lab-terraform/internal/tfeval"
+)
+
+// cacheModules are the registry-cache module calls shared by the
+// registry-caches and metnoom-13net environments, in port order
+var cacheModules = []struct {
+	name     string
+	registry string
+	port     int
+}{
+	{"docker_cache", "docker.io", 5050},
+	{"k8s_cache", "registry.k8s.io", 5051},
+	{"quay_cache", "quay.io", 5052},
+	{"gcr_cache", "gcr.io", 5053},
+	{"ghcr_cache", "ghcr.io", 5054},
+}
+
+// TestRegistryCachesEnvironmentOffline checks the five caches and the
+// client configuration the environment outputs
+func TestRegistryCachesEnvironmentOffline(t *testing.T) {
+	t.Parallel()
+
+	env := LoadModuleOffline(t, nil, "environments", "registry-caches")
+
+	var endpoints []interface{}
+	for _, cache := range cacheModules {
+		module, err := env.ModuleCall(cache.name)
+		require.NoError(t, err, cache.name)
+		assert.Equal(t, cache.registry, module.Vars["registry_name"].AsString(), cache.name)
+		endpoints = append(endpoints, fmt.Sprintf("localhost:%d", cache.port))
+	}
+
+	value, err := env.Output("cache_endpoints")
+	require.NoError(t, err)
+	got, err := tfeval.ToGo(value)
+	require.NoError(t, err)
+	assert.Equal(t, endpoints, got)
+
+	value, err = env.Output("docker_endpoints_config")
+	require.NoError(t, err)
+	got, err = tfeval.ToGo(value)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"registry-mirrors":    []interface{}{"http://localhost:5050"},
+		"insecure-registries": endpoints,
+	}, got)
+}
+
+// TestMetnoom13netEnvironmentOffline checks the 13-net services are wired to
+// each other and that the hand-written topology outputs match the modules
+func TestMetnoom13netEnvironmentOffline(t *testing.T) {
+	t.Parallel()
+
+	env := LoadModuleOffline(t, map[string]interface{}{
+		"pihole_api_token": "offline-token",
+	}, "environments", "metnoom-13net")
+
+	dnsmasq, err := env.ModuleCall("dnsmasq_13net")
+	require.NoError(t, err)
+	matchbox, err := env.ModuleCall("matchbox_13net")
+	require.NoError(t, err)
+
+	t.Run("PXE_Chain", func(t *testing.T) {
+		pxe, err := dnsmasq.Output("pxe_config")
+		require.NoError(t, err)
+		bootURL, err := matchbox.Output("boot_ipxe_url")
+		require.NoError(t, err)
+		assert.Equal(t, bootURL.AsString(), pxe.GetAttr("boot_url").AsString(), "dnsmasq chainloads matchbox")
+
+		prerequisites, err := env.Output("kubernetes_prerequisites")
+		require.NoError(t, err)
+		assert.Equal(t, bootURL.AsString(), prerequisites.GetAttr("pxe_infrastructure").GetAttr("boot_url").AsString())
+	})
+
+	t.Run("Topology_Matches_Modules", func(t *testing.T) {
+		topology, err := env.Output("network_topology")
+		require.NoError(t, err)
+		services := topology.GetAttr("services")
+
+		dhcpRange, err := dnsmasq.Output("dhcp_range")
+		require.NoError(t, err)
+		assert.Equal(t, dhcpRange.AsString(), services.GetAttr("dnsmasq").GetAttr("dhcp_range").AsString())
+		assert.Equal(t, dnsmasq.Vars["static_ip"].AsString(), services.GetAttr("dnsmasq").GetAttr("ip").AsString())
+		assert.Equal(t, matchbox.Vars["static_ip"].AsString(), services.GetAttr("matchbox").GetAttr("ip").AsString())
+
+		ports, err := tfeval.ToGo(services.GetAttr("registry_caches").GetAttr("ports"))
+		require.NoError(t, err)
+		var want []interface{}
+		for _, cache := range cacheModules {
+			module, err := env.ModuleCall(cache.name)
+			require.NoError(t, err)
+			port, _ := module.Vars["cache_port"].AsBigFloat().Int64()
+			want = append(want, float64(port))
+		}
+		assert.Equal(t, want, ports)
+	})
+
+	t.Run("Service_Summaries", func(t *testing.T) {
+		dns, err := env.Output("dns_dhcp_tftp")
+		require.NoError(t, err)
+		assert.Equal(t, "http://10.17.13.251:8080", dns.GetAttr("matchbox_url").AsString())
+		assert.True(t, dns.GetAttr("services").GetAttr("logging_enabled").True())
+
+		monitoring, err := env.Output("monitoring")
+		require.NoError(t, err)
+		assert.Equal(t, "10.17.12.109", monitoring.GetAttr("pihole_target").AsString())
+		assert.Equal(t, "http://localhost:9617/metrics", monitoring.GetAttr("metrics_endpoint").AsString())
+
+		caches, err := env.Output("registry_caches")
+		require.NoError(t, err)
+		assert.Equal(t, "https://registry-1.docker.io", caches.GetAttr("docker_hub").GetAttr("upstream_url").AsString())
+		assert.Equal(t, "docker.io", caches.GetAttr("docker_hub").GetAttr("upstream_registry").AsString())
+	})
+}
+
+// TestServiceEnvironmentsPlan plans both environments and checks every
+// service module is created
+func TestServiceEnvironmentsPlan(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Registry_Caches", func(t *testing.T) {
+		t.Parallel()
+
+		plan := PlanModule(t, nil, "environments", "registry-caches")
+		for _, cache := range cacheModules {
+			container := fmt.Sprintf("module.%s.docker_container.registry_cache", cache.name)
+			plan.AssertAction(container, PlanCreate)
+			plan.AssertAttributeEquals(container, "ports.0.external", cache.port)
+		}
+		plan.AssertNoDestroys()
+	})
+
+	t.Run("Metnoom_13net", func(t *testing.T) {
+		t.Parallel()
+
+		plan := PlanModule(t, map[string]interface{}{
+			"pihole_api_token": "plan-token",
+		}, "environments", "metnoom-13net")
+		for _, cache := range cacheModules {
+			plan.AssertModule("module." + cache.name)
+		}
+		plan.AssertAction("module.dnsmasq_13net.docker_container.dnsmasq", PlanCreate)
+		plan.AssertAction("module.matchbox_13net.docker_container.matchbox", PlanCreate)
+		plan.AssertAction("module.pihole_exporter.docker_container.pihole_exporter", PlanCreate)
+		plan.AssertSensitive("module.pihole_exporter.docker_container.pihole_exporter", "env")
+		plan.AssertNoDestroys()
+	})
+}
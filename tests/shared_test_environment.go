@@ -3,12 +3,15 @@ package tests
 import (
 	"crypto/sha256"
 	"fmt"
+	"net"
 	"os"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/yebyen/home-lab-terraform/internal/dnsstub"
+	"github.com/yebyen/home-lab-terraform/internal/perftrack"
 )
 
 // SharedPiholeEnvironment manages a shared Pi-hole instance for non-destructive tests
@@ -21,7 +24,9 @@ type SharedPiholeEnvironment struct {
 	ContainerName    string
 	NetworkName      string
 	Initialized      bool
-	mu               sync.Mutex
+	// Upstream is the stub resolver the shared Pi-hole forwards to
+	Upstream *dnsstub.Server
+	mu       sync.Mutex
 }
 
 var (
@@ -81,12 +86,36 @@ func (env *SharedPiholeEnvironment) Setup(t *testing.T) error {
 		return nil
 	}
 
+	// Forward to the stub upstream instead of the internet. It listens on
+	// the network's gateway, which exists once Terraform has applied, and
+	// outlives this test, so it is started directly and stopped by Cleanup.
+	zone, err := dnsstub.LoadZone(upstreamZone)
+	if err != nil {
+		return err
+	}
+	host, err := stubUpstreamHost(env.TerraformOptions.Vars)
+	if err != nil {
+		return err
+	}
+	port := allocatePort(t, true)
+	env.TerraformOptions.Vars["upstream_dns"] = fmt.Sprintf("%s#%d", host, port)
+
 	// Initialize and apply terraform
-	terraform.InitAndApply(t, env.TerraformOptions)
+	start := time.Now()
+	terraform.Init(t, env.TerraformOptions)
+	logPhase(t, perftrack.PhaseInit, start)
+	start = time.Now()
+	terraform.Apply(t, env.TerraformOptions)
+	logPhase(t, perftrack.PhaseApply, start)
+	if env.Upstream, err = dnsstub.Start(net.JoinHostPort(host, fmt.Sprint(port)), zone); err != nil {
+		return err
+	}
 	
 	// Wait for Pi-hole to be ready
 	t.Log("Waiting for shared Pi-hole to start...")
+	start = time.Now()
 	time.Sleep(60 * time.Second) // Give shared environment more time
+	logPhase(t, perftrack.PhaseReady, start)
 	
 	env.Initialized = true
 	t.Log("Shared Pi-hole environment ready")
@@ -109,7 +138,12 @@ func (env *SharedPiholeEnvironment) Cleanup(t *testing.T) {
 	}
 
 	t.Log("Cleaning up shared Pi-hole environment...")
+	start := time.Now()
 	terraform.Destroy(t, env.TerraformOptions)
+	logPhase(t, perftrack.PhaseDestroy, start)
+	if env.Upstream != nil {
+		env.Upstream.Close()
+	}
 	env.Initialized = false
 }
 
@@ -176,29 +210,68 @@ func GetTestEnvironment(t *testing.T, config SharedTestConfig) (*terraform.Optio
 	return createDedicatedEnvironment(t, config)
 }
 
-// createDedicatedEnvironment creates a dedicated test environment
+// createDedicatedEnvironment creates a dedicated test environment. Callers
+// apply it themselves, so the stub upstream is started in the background
+// once the network exists.
 func createDedicatedEnvironment(t *testing.T, config SharedTestConfig) (*terraform.Options, string, string, error) {
-	// Generate unique identifier based on test name + timestamp for true uniqueness
-	testID := fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano()))))[:8]
-	basePort := 31000 + (len(testID) % 1000) // Use hash for port uniqueness
-	
-	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
-		TerraformDir: "../terraform/modules/pihole",
-		Vars: map[string]interface{}{
-			"container_name":     fmt.Sprintf("pihole-test-%s", testID),
-			"network_name":       fmt.Sprintf("pihole-net-%s", testID),
-			"subnet":             fmt.Sprintf("172.%d.0.0/16", 101+(len(testID)%150)), // Wide subnet spacing for isolation
-			"dns_port":           basePort,
-			"web_port":           basePort + 1,
-			"timezone":           "America/New_York", 
-			"web_password":       fmt.Sprintf("test-password-%s", testID),
-			"dnsmasq_listening":  "all",
-			"use_host_network":   false,
-		},
-	})
-	
-	baseURL := fmt.Sprintf("http://localhost:%d", basePort+1)
-	password := fmt.Sprintf("test-password-%s", testID)
-	
+	builder := NewPiholeEnv(t).WithName("test")
+	terraformOptions := builder.Options()
+	if builder.stubAddr != "" {
+		if err := startStubUpstreamOnNetwork(t, builder.stubAddr); err != nil {
+			return nil, "", "", err
+		}
+	}
+
+	webPort, err := moduleVar[int](terraformOptions.Vars, "web_port")
+	if err != nil {
+		return nil, "", "", err
+	}
+	password, err := moduleVar[string](terraformOptions.Vars, "web_password")
+	if err != nil {
+		return nil, "", "", err
+	}
+	baseURL := fmt.Sprintf("http://localhost:%d", webPort)
+
 	return terraformOptions, baseURL, password, nil
-}
\ No newline at end of file
+}
+// startStubUpstreamOnNetwork serves the upstream fixture zone on addr, a
+// network gateway, as soon as it can bind there: the address appears on
+// the host when Terraform creates the network. The stub stops when the
+// test ends.
+func startStubUpstreamOnNetwork(t *testing.T, addr string) error {
+	zone, err := dnsstub.LoadZone(upstreamZone)
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	var server *dnsstub.Server
+	stopped := false
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		stopped = true
+		if server != nil {
+			server.Close()
+		}
+	})
+	go func() {
+		for {
+			started, err := dnsstub.Start(addr, zone)
+			mu.Lock()
+			if err == nil {
+				if stopped {
+					started.Close()
+				}
+				server = started
+			}
+			done := err == nil || stopped
+			mu.Unlock()
+			if done {
+				return
+			}
+			time.Sleep(500 * time.Millisecond)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+)
+
+// RequireTerraform points options at whichever of terraform or tofu is
+// installed, or skips the test when neither is
+func RequireTerraform(t *testing.T, options *terraform.Options) {
+	t.Helper()
+
+	for _, binary := range []string{"terraform", "tofu"} {
+		if _, err := exec.LookPath(binary); err == nil {
+			options.TerraformBinary = binary
+			return
+		}
+	}
+	t.Skip("Neither terraform nor tofu is installed")
+}
+
+// PlanModule validates vars against a module or environment under
+// ../terraform and returns its JSON plan, skipping when terraform is missing
+func PlanModule(t *testing.T, vars map[string]interface{}, path ...string) *Plan {
+	t.Helper()
+
+	options := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: filepath.Join(append([]string{"..", "terraform"}, path...)...),
+		Vars:         vars,
+		NoColor:      true,
+	})
+	RequireValidVars(t, options)
+	RequireTerraform(t, options)
+	return InitAndPlanJSON(t, options)
+}
+
+// RequireDocker skips the test unless a Docker daemon is reachable
+func RequireDocker(t *testing.T) {
+	t.Helper()
+
+	if err := exec.Command("docker", "info").Run(); err != nil {
+		t.Skipf("Docker is not available: %v", err)
+	}
+}
+
+// dockerContainerExists reports whether a container with the name exists
+func dockerContainerExists(name string) bool {
+	return exec.Command("docker", "inspect", "--type", "container", name).Run() == nil
+}
+
+// runDocker runs a docker CLI command and returns its trimmed output,
+// failing the test on error
+func runDocker(t *testing.T, args ...string) string {
+	t.Helper()
+
+	output, err := exec.Command("docker", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("docker %s failed: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// waitForHTTP polls url until it answers with the wanted status code
+func waitForHTTP(t *testing.T, url string, status int, timeout time.Duration) {
+	t.Helper()
+	t.Logf("Waiting up to %s for %s to return %d...", timeout, url, status)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == status {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			if err == nil {
+				t.Fatalf("%s returned %d after %s, want %d", url, resp.StatusCode, timeout, status)
+			}
+			t.Fatalf("%s not reachable after %s: %v", url, timeout, err)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestPKI is a throwaway CA with a server and a client certificate signed
+// by it, for services that authenticate clients with TLS certificates
+type TestPKI struct {
+	CACert     []byte
+	ServerCert []byte
+	ServerKey  []byte
+	ClientCert []byte
+	ClientKey  []byte
+}
+
+// NewTestPKI generates a CA and certificates valid for a day. The server
+// certificate covers serverHosts, which may be IP addresses or DNS names,
+// plus localhost.
+func NewTestPKI(t *testing.T, serverHosts ...string) *TestPKI {
+	t.Helper()
+
+	now := time.Now()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "home-lab test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage, hosts []string) (certPEM, keyPEM []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    now.Add(-time.Hour),
+			NotAfter:     now.Add(24 * time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		for _, host := range hosts {
+			if ip := net.ParseIP(host); ip != nil {
+				template.IPAddresses = append(template.IPAddresses, ip)
+			} else {
+				template.DNSNames = append(template.DNSNames, host)
+			}
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	}
+
+	pki := &TestPKI{CACert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})}
+	pki.ServerCert, pki.ServerKey = issue(2, "server", x509.ExtKeyUsageServerAuth, append([]string{"localhost", "127.0.0.1"}, serverHosts...))
+	pki.ClientCert, pki.ClientKey = issue(3, "client", x509.ExtKeyUsageClientAuth, nil)
+	return pki
+}
+
+// ServerTLS is a server configuration that requires clients to present a
+// certificate signed by the CA
+func (p *TestPKI) ServerTLS(t *testing.T) *tls.Config {
+	t.Helper()
+
+	cert, err := tls.X509KeyPair(p.ServerCert, p.ServerKey)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(p.CACert))
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// WriteFiles writes ca.crt, server.crt, server.key, client.crt and
+// client.key to dir, world-readable so containers running as other users
+// can read them, and returns the path of each by name
+func (p *TestPKI) WriteFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	paths := make(map[string]string)
+	for name, data := range map[string][]byte{
+		"ca.crt":     p.CACert,
+		"server.crt": p.ServerCert,
+		"server.key": p.ServerKey,
+		"client.crt": p.ClientCert,
+		"client.key": p.ClientKey,
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, data, 0644))
+		paths[name] = path
+	}
+	return paths
+}